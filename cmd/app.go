@@ -4,18 +4,27 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/netip"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/component-base/logs"
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
 	"sigs.k8s.io/cloud-provider-kind/pkg/controller"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
 	"sigs.k8s.io/kind/pkg/cluster"
 	kindcmd "sigs.k8s.io/kind/pkg/cmd"
 )
@@ -25,13 +34,118 @@ var (
 	enableLogDump       bool
 	logDumpDir          string
 	enableLBPortMapping bool
+
+	lbHealthCheckInterval           time.Duration
+	lbHealthCheckUnhealthyThreshold int
+	clusterResyncInterval           time.Duration
+	apiserverWaitTimeout            time.Duration
+	enableLeaderElection            bool
+	lbDrainGracePeriod              time.Duration
+	noCleanupOnExit                 bool
+	enableSharedLB                  bool
+	lbContainerCPU                  string
+	lbContainerMemory               string
+	lbImage                         string
+	containerRuntime                string
+	healthzBindAddress              string
+	metricsBindAddress              string
+	lbIPRange                       string
+	lbIPv4Subnet                    string
+	lbIPv6Subnet                    string
+	lbClass                         string
+	clusterFilter                   string
+	clusterExclude                  string
+	runMode                         string
+	kubeconfigPreference            string
+	informerResync                  time.Duration
+	nodeSyncPeriod                  time.Duration
+	concurrentServiceSyncs          int
+	concurrentClusterSyncs          int
+	maxClusters                     int
+	backendDrainTimeout             time.Duration
+	lbContainerLabels               = labelsFlag{}
+	lbIngressHostname               bool
+	dryRun                          bool
+	lbAccessLog                     string
+	lbContainerNamePrefix           string
+	lbAdditionalNetworks            string
+	lbExtraHosts                    string
+	lbDNSServers                    string
+	containerAPIQPS                 float64
+	containerAPIBurst               int
+	configFile                      string
+	lbPodBackends                   bool
+	lbAnnounceAddresses             bool
+	lbRequireHealthyBackends        bool
+	lbReadOnlyRootfs                bool
+	lbNoNewPrivileges               bool
+	lbCapDrop                       string
+	lbUser                          string
+	lbHostPorts                     string
+	lbDirectRouting                 bool
+	controllers                     string
+	apiserverProbeInsecure          bool
+	skipPreflightChecks             bool
+	lbStatsInterval                 time.Duration
 )
 
 func init() {
 	flag.IntVar(&flagV, "v", 2, "Verbosity level")
+	flag.StringVar(&configFile, "config", "", "YAML or JSON file with the options, the keys are the flag names and the flags set on the command line take precedence")
 	flag.BoolVar(&enableLogDump, "enable-log-dumping", false, "store logs to a temporal directory or to the directory specified using the logs-dir flag")
 	flag.StringVar(&logDumpDir, "logs-dir", "", "store logs to the specified directory")
 	flag.BoolVar(&enableLBPortMapping, "enable-lb-port-mapping", false, "enable port-mapping on the load balancer ports")
+	flag.StringVar(&controllers, "controllers", "*", "comma-separated list of the controllers started for each cluster, * enables all of them and -name disables one, the controllers are "+strings.Join(controller.ControllerNames, ", "))
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "use leader election on each cluster so only one cloud-provider-kind instance manages it")
+	flag.DurationVar(&clusterResyncInterval, "cluster-resync-interval", 30*time.Second, "interval between the scans of the KIND clusters")
+	flag.DurationVar(&apiserverWaitTimeout, "apiserver-wait-timeout", 30*time.Second, "time to wait for the apiserver of a cluster to be healthy, it is checked with exponential backoff")
+	flag.BoolVar(&apiserverProbeInsecure, "apiserver-probe-insecure", false, "do not verify the apiserver certificate when checking if a cluster is reachable, it is verified with the CA of the kubeconfig by default")
+	flag.StringVar(&healthzBindAddress, "healthz-bind-address", "", "address to serve the /healthz, /readyz and /loadbalancers endpoints, disabled if empty")
+	flag.StringVar(&metricsBindAddress, "metrics-bind-address", "", "address to serve the Prometheus metrics on /metrics, e.g. :8080, disabled if empty")
+	flag.StringVar(&containerRuntime, "container-runtime", "", "container runtime used by the KIND clusters and the load balancers, docker or podman, defaults to KIND_EXPERIMENTAL_PROVIDER or autodetected if not set")
+	flag.Float64Var(&containerAPIQPS, "container-api-qps", 0, "maximum number of load balancer containers created, deleted or attached to networks per second for each cluster, 0 means unlimited")
+	flag.IntVar(&containerAPIBurst, "container-api-burst", 10, "maximum burst of container operations when container-api-qps is set")
+	flag.StringVar(&lbImage, "loadbalancer-image", "", "image used by the load balancer containers, defaults to "+loadbalancer.DefaultImage)
+	flag.StringVar(&lbContainerCPU, "lb-container-cpu", "100m", "CPU limit of the load balancer containers as a Kubernetes quantity, 0 means unlimited")
+	flag.StringVar(&lbContainerMemory, "lb-container-memory", "64Mi", "memory limit of the load balancer containers as a Kubernetes quantity, 0 means unlimited")
+	flag.BoolVar(&enableSharedLB, "enable-shared-lb", false, "use a single load balancer container for all the Services of a cluster, Services can not share the same ports")
+	flag.DurationVar(&backendDrainTimeout, "backend-drain-timeout", 0, "time the backends removed from a load balancer keep their existing connections without receiving new ones, 0 removes them immediately")
+	flag.DurationVar(&lbDrainGracePeriod, "lb-drain-grace-period", 10*time.Second, "time the load balancers existing connections have to finish on exit before removing them, 0 disables draining")
+	flag.BoolVar(&noCleanupOnExit, "no-cleanup-on-exit", false, "keep the load balancer containers running on exit so they can be inspected, the next run reconciles them")
+	flag.DurationVar(&lbHealthCheckInterval, "lb-health-check-interval", 3*time.Second, "interval between the health checks of the load balancer backends")
+	flag.IntVar(&concurrentServiceSyncs, "concurrent-service-syncs", 5, "number of Services the service controller of each cluster reconciles concurrently")
+	flag.IntVar(&concurrentClusterSyncs, "concurrent-cluster-syncs", 5, "number of new KIND clusters whose cloud controller managers are started concurrently")
+	flag.IntVar(&maxClusters, "max-clusters", 0, "maximum number of KIND clusters managed, the clusters already managed are kept and the rest are picked by name, 0 means no limit")
+	flag.DurationVar(&informerResync, "informer-resync", 60*time.Second, "resync period of the informers of the cloud controller managers")
+	flag.DurationVar(&nodeSyncPeriod, "node-sync-period", 30*time.Second, "period the node controller updates the Nodes addresses")
+	flag.StringVar(&runMode, "run-mode", "", "where cloud-provider-kind runs: in-cluster if it runs in a container on the KIND network, host to reach the clusters through the host ports, both are tried if empty")
+	flag.StringVar(&kubeconfigPreference, "kubeconfig-preference", string(config.KubeconfigPreferenceAuto), "kubeconfig endpoint used to reach the clusters: internal on the KIND network, external through the host ports, or auto to try the ones of the run-mode, internal first")
+	flag.StringVar(&clusterFilter, "cluster-filter", "", "comma-separated list of names or regular expressions of the KIND clusters to manage, all if empty")
+	flag.StringVar(&clusterExclude, "cluster-exclude", "", "comma-separated list of names or regular expressions of the KIND clusters to not manage")
+	flag.StringVar(&lbClass, "load-balancer-class", "", "only handle the Services with this loadBalancerClass, e.g. kind.sigs.k8s.io/cloud-provider-kind, the Services without class are handled if empty")
+	flag.StringVar(&lbIPRange, "lb-ip-range", "", "CIDR within the KIND network used to allocate the load balancer IPs, the container runtime assigns them if empty")
+	flag.StringVar(&lbIPv4Subnet, "lb-ipv4-subnet", "", "IPv4 subnet of the KIND network the load balancer IPs are assigned from when the network has more than one")
+	flag.StringVar(&lbIPv6Subnet, "lb-ipv6-subnet", "", "IPv6 subnet of the KIND network the load balancer IPs are assigned from when the network has more than one")
+	flag.Var(lbContainerLabels, "lb-container-labels", "key=value label to set on the load balancer containers, can be repeated")
+	flag.BoolVar(&lbIngressHostname, "lb-ingress-hostname", false, "report hostnames instead of IPs in the load balancer status, localhost for the ports published on the host or the Service hostname annotation")
+	flag.BoolVar(&dryRun, "dry-run", false, "log the load balancers that would be created, updated or deleted without modifying any container, the Services status is not updated")
+	flag.StringVar(&lbContainerNamePrefix, "lb-container-name-prefix", constants.ContainerPrefix, "prefix of the load balancer container names, instances with different prefixes do not manage each other's load balancers")
+	flag.StringVar(&lbAdditionalNetworks, "lb-additional-networks", "", "comma-separated list of container networks the load balancers are attached to besides the networks of their cluster")
+	flag.StringVar(&lbExtraHosts, "lb-extra-hosts", "", "comma-separated list of hostname=ip entries added to the hosts file of the load balancer containers")
+	flag.StringVar(&lbDNSServers, "lb-dns-servers", "", "comma-separated list of DNS servers of the load balancer containers, the container runtime defaults are used if empty")
+	flag.StringVar(&lbHostPorts, "lb-host-ports", "auto", "publish the Service ports of the load balancers on the same ports of the host: true, false or auto to publish them if the KIND network is not reachable from the host")
+	flag.BoolVar(&lbDirectRouting, "lb-direct-routing", false, "experimental: add the load balancer IPs to the cluster nodes and let kube-proxy forward them instead of creating load balancer containers, requires lb-ip-range")
+	flag.BoolVar(&lbPodBackends, "lb-pod-backends", false, "forward the load balancer traffic directly to the ready Pods of the Services instead of their NodePorts")
+	flag.BoolVar(&lbRequireHealthyBackends, "lb-require-healthy-backends", false, "only report the load balancer IPs in the Service status while any of its backends passes the health checks")
+	flag.BoolVar(&lbReadOnlyRootfs, "lb-read-only-rootfs", false, "run the load balancer containers with a read-only root filesystem, the proxy configuration is written to a tmpfs")
+	flag.BoolVar(&lbNoNewPrivileges, "lb-no-new-privileges", false, "prevent the processes of the load balancer containers from gaining privileges")
+	flag.StringVar(&lbCapDrop, "lb-cap-drop", "", "comma-separated list of capabilities dropped from the load balancer containers, ALL drops all of them, the ones the proxy needs are added back")
+	flag.StringVar(&lbUser, "lb-user", "", "user[:group] the load balancer containers run as, the image user if empty")
+	flag.BoolVar(&lbAnnounceAddresses, "lb-announce-addresses", false, "send a gratuitous ARP and an unsolicited neighbor advertisement when the load balancer addresses are assigned or moved, the image must provide arping and ndsend")
+	flag.StringVar(&lbAccessLog, "lb-access-log", config.AccessLogStdout, "where the load balancers write the access logs: stdout for the container logs, none to disable them or the absolute path of a file on the host")
+	flag.DurationVar(&lbStatsInterval, "lb-stats-interval", 30*time.Second, "interval between the collections of the CPU and memory usage of the load balancer containers, 0 disables them")
+	flag.BoolVar(&skipPreflightChecks, "skip-preflight-checks", false, "start without checking that the container runtime is reachable, the KIND clusters can be listed and the load balancer image is present")
+	flag.IntVar(&lbHealthCheckUnhealthyThreshold, "lb-health-check-unhealthy-threshold", 2, "number of failed health checks before removing a backend from the load balancer")
 
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr, "Usage: cloud-provider-kind [options]\n\n")
@@ -42,6 +156,11 @@ func init() {
 func Main() {
 	// Parse command line flags and arguments
 	flag.Parse()
+	if configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, configFile); err != nil {
+			klog.Fatalf("%v", err)
+		}
+	}
 	flag.VisitAll(func(flag *flag.Flag) {
 		klog.Infof("FLAG: --%s=%q", flag.Name, flag.Value)
 	})
@@ -118,23 +237,415 @@ func Main() {
 		config.DefaultConfig.LoadBalancerConnectivity = config.Portmap
 	}
 
+	if lbHealthCheckInterval < time.Second {
+		klog.Fatalf("invalid lb-health-check-interval %v, must be at least 1s", lbHealthCheckInterval)
+	}
+	if lbHealthCheckUnhealthyThreshold < 1 {
+		klog.Fatalf("invalid lb-health-check-unhealthy-threshold %d, must be at least 1", lbHealthCheckUnhealthyThreshold)
+	}
+	if clusterResyncInterval < time.Second {
+		klog.Fatalf("invalid cluster-resync-interval %v, must be at least 1s", clusterResyncInterval)
+	}
+	config.DefaultConfig.ClusterResyncInterval = clusterResyncInterval
+	if apiserverWaitTimeout < time.Second {
+		klog.Fatalf("invalid apiserver-wait-timeout %v, must be at least 1s", apiserverWaitTimeout)
+	}
+	config.DefaultConfig.APIServerWaitTimeout = apiserverWaitTimeout
+	if informerResync < 10*time.Second {
+		klog.Fatalf("invalid informer-resync %v, must be at least 10s", informerResync)
+	}
+	config.DefaultConfig.InformerResyncPeriod = informerResync
+	if nodeSyncPeriod < time.Second {
+		klog.Fatalf("invalid node-sync-period %v, must be at least 1s", nodeSyncPeriod)
+	}
+	config.DefaultConfig.NodeSyncPeriod = nodeSyncPeriod
+	if concurrentServiceSyncs < 1 {
+		klog.Fatalf("invalid concurrent-service-syncs %d, must be at least 1", concurrentServiceSyncs)
+	}
+	config.DefaultConfig.ConcurrentServiceSyncs = concurrentServiceSyncs
+	if concurrentClusterSyncs < 1 {
+		klog.Fatalf("invalid concurrent-cluster-syncs %d, must be at least 1", concurrentClusterSyncs)
+	}
+	config.DefaultConfig.ConcurrentClusterSyncs = concurrentClusterSyncs
+	if maxClusters < 0 {
+		klog.Fatalf("invalid max-clusters %d, must not be negative", maxClusters)
+	}
+	config.DefaultConfig.MaxClusters = maxClusters
+	config.DefaultConfig.EnableLeaderElection = enableLeaderElection
+	if lbStatsInterval != 0 && lbStatsInterval < time.Second {
+		klog.Fatalf("invalid lb-stats-interval %v, must be at least 1s or 0 to disable it", lbStatsInterval)
+	}
+	config.DefaultConfig.LoadBalancerStatsInterval = lbStatsInterval
+
+	if lbDrainGracePeriod < 0 {
+		klog.Fatalf("invalid lb-drain-grace-period %v, must not be negative", lbDrainGracePeriod)
+	}
+	config.DefaultConfig.LoadBalancerDrainGracePeriod = lbDrainGracePeriod
+	config.DefaultConfig.NoCleanupOnExit = noCleanupOnExit
+	if backendDrainTimeout < 0 {
+		klog.Fatalf("invalid backend-drain-timeout %v, must not be negative", backendDrainTimeout)
+	}
+	config.DefaultConfig.BackendDrainTimeout = backendDrainTimeout
+	config.DefaultConfig.LoadBalancerHealthCheckInterval = lbHealthCheckInterval
+	config.DefaultConfig.LoadBalancerHealthCheckUnhealthyThreshold = lbHealthCheckUnhealthyThreshold
+
+	config.DefaultConfig.HealthzBindAddress = healthzBindAddress
+	if metricsBindAddress != "" && metricsBindAddress == healthzBindAddress {
+		klog.Fatalf("metrics-bind-address and healthz-bind-address must be different, both are %q", metricsBindAddress)
+	}
+	config.DefaultConfig.MetricsBindAddress = metricsBindAddress
+
+	if lbImage != "" {
+		if !imageReferenceRegexp.MatchString(lbImage) {
+			klog.Fatalf("invalid loadbalancer-image %q", lbImage)
+		}
+		config.DefaultConfig.LoadBalancerImage = lbImage
+	}
+
+	cpu, err := resource.ParseQuantity(lbContainerCPU)
+	if err != nil || cpu.Sign() < 0 {
+		klog.Fatalf("invalid lb-container-cpu %q: %v", lbContainerCPU, err)
+	}
+	config.DefaultConfig.LoadBalancerCPULimit = cpu.MilliValue()
+	memory, err := resource.ParseQuantity(lbContainerMemory)
+	if err != nil || memory.Sign() < 0 {
+		klog.Fatalf("invalid lb-container-memory %q: %v", lbContainerMemory, err)
+	}
+	// docker does not allow less than 6MB
+	if memory.Value() > 0 && memory.Value() < 6*1024*1024 {
+		klog.Fatalf("invalid lb-container-memory %q, must be at least 6Mi", lbContainerMemory)
+	}
+	config.DefaultConfig.LoadBalancerMemoryLimit = memory.Value()
+
+	if err := validateContainerLabels(lbContainerLabels); err != nil {
+		klog.Fatalf("invalid lb-container-labels: %v", err)
+	}
+	config.DefaultConfig.LoadBalancerContainerLabels = lbContainerLabels
+
+	if !containerNamePrefixRegexp.MatchString(lbContainerNamePrefix) {
+		klog.Fatalf("invalid lb-container-name-prefix %q, must be up to 20 alphanumeric characters, '_', '.' or '-' starting with an alphanumeric character", lbContainerNamePrefix)
+	}
+	config.DefaultConfig.LoadBalancerContainerNamePrefix = lbContainerNamePrefix
+	for _, network := range strings.Split(lbAdditionalNetworks, ",") {
+		if network = strings.TrimSpace(network); network != "" {
+			config.DefaultConfig.LoadBalancerAdditionalNetworks = append(config.DefaultConfig.LoadBalancerAdditionalNetworks, network)
+		}
+	}
+	extraHosts, err := loadbalancer.ParseExtraHosts(lbExtraHosts)
+	if err != nil {
+		klog.Fatalf("invalid lb-extra-hosts %q: %v", lbExtraHosts, err)
+	}
+	config.DefaultConfig.LoadBalancerExtraHosts = extraHosts
+	dnsServers, err := loadbalancer.ParseDNSServers(lbDNSServers)
+	if err != nil {
+		klog.Fatalf("invalid lb-dns-servers %q: %v", lbDNSServers, err)
+	}
+	config.DefaultConfig.LoadBalancerDNSServers = dnsServers
+	config.DefaultConfig.LoadBalancerIngressHostname = lbIngressHostname
+	config.DefaultConfig.LoadBalancerPodBackends = lbPodBackends
+	enabledControllers, err := controller.ParseControllers(controllers)
+	if err != nil {
+		klog.Fatalf("invalid controllers %q: %v", controllers, err)
+	}
+	config.DefaultConfig.Controllers = enabledControllers
+	config.DefaultConfig.APIServerProbeInsecure = apiserverProbeInsecure
+	config.DefaultConfig.LoadBalancerAnnounceAddresses = lbAnnounceAddresses
+	capDrop, err := loadbalancer.ParseCapabilities(lbCapDrop)
+	if err != nil {
+		klog.Fatalf("invalid lb-cap-drop %q: %v", lbCapDrop, err)
+	}
+	security := config.ContainerSecurity{
+		ReadOnlyRootFilesystem: lbReadOnlyRootfs,
+		NoNewPrivileges:        lbNoNewPrivileges,
+		DropCapabilities:       capDrop,
+		User:                   lbUser,
+	}
+	// validated once the Pod backends and the announcements are configured, they need capabilities
+	if err := loadbalancer.ValidateSecurity(security); err != nil {
+		klog.Fatalf("invalid load balancer security options: %v", err)
+	}
+	config.DefaultConfig.LoadBalancerSecurity = security
+	if lbRequireHealthyBackends {
+		switch {
+		case enableSharedLB:
+			klog.Fatalf("lb-require-healthy-backends is not supported with enable-shared-lb")
+		case lbDirectRouting:
+			klog.Fatalf("lb-require-healthy-backends is not supported with lb-direct-routing, there are no health checks")
+		}
+		config.DefaultConfig.LoadBalancerRequireHealthyBackends = true
+	}
+	switch lbAccessLog {
+	case config.AccessLogStdout, config.AccessLogNone:
+	default:
+		if !filepath.IsAbs(lbAccessLog) {
+			klog.Fatalf("invalid lb-access-log %q, must be stdout, none or an absolute path", lbAccessLog)
+		}
+		// the directory is mounted in the load balancer containers
+		if fi, err := os.Stat(filepath.Dir(lbAccessLog)); err != nil || !fi.IsDir() {
+			klog.Fatalf("invalid lb-access-log %q, the directory %s must exist", lbAccessLog, filepath.Dir(lbAccessLog))
+		}
+	}
+	config.DefaultConfig.LoadBalancerAccessLog = lbAccessLog
+	config.DefaultConfig.DryRun = dryRun
+	if dryRun {
+		klog.Infof("**** Running in dry-run mode, the load balancer containers are not modified")
+	}
+	config.DefaultConfig.LoadBalancerClass = lbClass
+
+	if clusterFilter != "" {
+		re, err := clusterNamesRegexp(clusterFilter)
+		if err != nil {
+			klog.Fatalf("invalid cluster-filter %q: %v", clusterFilter, err)
+		}
+		config.DefaultConfig.ClusterFilter = re
+	}
+	if clusterExclude != "" {
+		re, err := clusterNamesRegexp(clusterExclude)
+		if err != nil {
+			klog.Fatalf("invalid cluster-exclude %q: %v", clusterExclude, err)
+		}
+		config.DefaultConfig.ClusterExclude = re
+	}
+
+	if lbIPRange != "" {
+		prefix, err := netip.ParsePrefix(lbIPRange)
+		if err != nil {
+			klog.Fatalf("invalid lb-ip-range %q: %v", lbIPRange, err)
+		}
+		if prefix.Addr().Is6() && prefix.Addr().IsLinkLocalUnicast() {
+			klog.Fatalf("invalid lb-ip-range %q: the link-local addresses can not be load balancer IPs", lbIPRange)
+		}
+		config.DefaultConfig.LoadBalancerIPRange = prefix.Masked()
+	}
+	config.DefaultConfig.LoadBalancerIPv4Subnet = parseSubnetFlag("lb-ipv4-subnet", lbIPv4Subnet, false)
+	config.DefaultConfig.LoadBalancerIPv6Subnet = parseSubnetFlag("lb-ipv6-subnet", lbIPv6Subnet, true)
+	for _, subnet := range []netip.Prefix{config.DefaultConfig.LoadBalancerIPv4Subnet, config.DefaultConfig.LoadBalancerIPv6Subnet} {
+		ipRange := config.DefaultConfig.LoadBalancerIPRange
+		if subnet.IsValid() && ipRange.IsValid() && subnet.Addr().Is6() == ipRange.Addr().Is6() &&
+			(subnet.Bits() > ipRange.Bits() || !subnet.Contains(ipRange.Addr())) {
+			klog.Fatalf("lb-ip-range %s is not within the load balancer subnet %s", ipRange, subnet)
+		}
+	}
+
 	// default control plane connectivity to portmap, it will be
 	// overriden if the first cluster added detects direct
 	// connecitivity
 	config.DefaultConfig.ControlPlaneConnectivity = config.Portmap
 
-	// initialize kind provider
-	option, err := cluster.DetectNodeProvider()
-	if err != nil {
-		klog.Fatalf("can not detect cluster provider: %v", err)
+	switch config.RunMode(runMode) {
+	case config.RunModeAuto, config.RunModeHost:
+	case config.RunModeInCluster:
+		// the clusters and the loadbalancers are in the same network
+		if config.DefaultConfig.LoadBalancerConnectivity != config.Unknown && !enableLBPortMapping {
+			klog.Infof("running in-cluster, the load balancers are reached directly")
+			config.DefaultConfig.LoadBalancerConnectivity = config.Unknown
+		}
+		config.DefaultConfig.ControlPlaneConnectivity = config.Direct
+	default:
+		klog.Fatalf("invalid run-mode %q, supported values are in-cluster and host", runMode)
+	}
+	config.DefaultConfig.RunMode = config.RunMode(runMode)
+
+	switch preference := config.KubeconfigPreference(kubeconfigPreference); preference {
+	case config.KubeconfigPreferenceAuto:
+	case config.KubeconfigPreferenceInternal, config.KubeconfigPreferenceExternal:
+		if preference == config.KubeconfigPreferenceInternal && config.DefaultConfig.RunMode == config.RunModeHost ||
+			preference == config.KubeconfigPreferenceExternal && config.DefaultConfig.RunMode == config.RunModeInCluster {
+			klog.Fatalf("kubeconfig-preference %s is not compatible with run-mode %s", preference, runMode)
+		}
+	default:
+		klog.Fatalf("invalid kubeconfig-preference %q, supported values are external, internal and auto", kubeconfigPreference)
+	}
+	config.DefaultConfig.KubeconfigPreference = config.KubeconfigPreference(kubeconfigPreference)
+
+	if enableSharedLB {
+		if config.DefaultConfig.LoadBalancerConnectivity != config.Unknown {
+			klog.Fatalf("enable-shared-lb is only supported when the load balancers are directly reachable")
+		}
+		config.DefaultConfig.EnableSharedLoadBalancer = true
+	}
+	if lbDirectRouting {
+		switch {
+		case !config.DefaultConfig.LoadBalancerIPRange.IsValid():
+			klog.Fatalf("lb-direct-routing requires lb-ip-range, the container runtime does not assign the load balancer IPs")
+		case config.DefaultConfig.LoadBalancerConnectivity != config.Unknown:
+			klog.Fatalf("lb-direct-routing is only supported when the KIND network is directly reachable")
+		case enableSharedLB:
+			klog.Fatalf("lb-direct-routing is not supported with enable-shared-lb")
+		case lbPodBackends:
+			klog.Fatalf("lb-direct-routing is not supported with lb-pod-backends")
+		case lbIngressHostname:
+			klog.Fatalf("lb-direct-routing is not supported with lb-ingress-hostname, kube-proxy only forwards the load balancer IPs")
+		case lbHostPorts == "true":
+			klog.Fatalf("lb-direct-routing is not supported with lb-host-ports")
+		}
+		klog.Warningf("**** lb-direct-routing is experimental, the load balancer IPs are forwarded by kube-proxy on the nodes")
+		config.DefaultConfig.LoadBalancerDirectRouting = true
+	}
+	switch lbHostPorts {
+	case "auto", "false":
+	case "true":
+		if enableSharedLB {
+			klog.Fatalf("lb-host-ports is not supported with enable-shared-lb")
+		}
+		config.DefaultConfig.LoadBalancerHostPorts = true
+	default:
+		klog.Fatalf("invalid lb-host-ports %q, supported values are true, false and auto", lbHostPorts)
+	}
+
+	if err := container.SetRateLimit(float32(containerAPIQPS), containerAPIBurst); err != nil {
+		klog.Fatalf("invalid container-api-qps or container-api-burst: %v", err)
+	}
+
+	// initialize kind provider, the KIND clusters and the load balancers must use the same runtime
+	source := "flag"
+	if containerRuntime == "" {
+		// same environment variable KIND uses to select the provider
+		containerRuntime = os.Getenv("KIND_EXPERIMENTAL_PROVIDER")
+		source = "KIND_EXPERIMENTAL_PROVIDER"
+	}
+	if containerRuntime != "" {
+		if err := container.SetRuntime(containerRuntime); err != nil {
+			klog.Fatalf("invalid container-runtime from %s: %v", source, err)
+		}
+	} else {
+		source = "autodetected"
+	}
+	var option cluster.ProviderOption
+	switch container.Runtime() {
+	case "podman":
+		option = cluster.ProviderWithPodman()
+	default:
+		option = cluster.ProviderWithDocker()
+	}
+	klog.Infof("Using container runtime %s (%s)", container.Runtime(), source)
+	if host := container.RemoteHost(); host != "" {
+		klog.Warningf("**** The container runtime runs on the remote host %s, the load balancer IPs are not local and are only reachable from this host if the container networks of %s are routed to it; the ports published on the host are on %s", host, host, host)
 	}
 	kindProvider := cluster.NewProvider(
 		option,
 		cluster.ProviderWithLogger(logger),
 	)
+	// validate the environment before it is used, the errors of a misconfigured one are confusing otherwise
+	if !skipPreflightChecks {
+		summary, ok := runPreflightChecks(ctx, preflightChecks(kindProvider))
+		if !ok {
+			klog.Fatalf("%s\nFix the failed checks or use --skip-preflight-checks to start anyway", summary)
+		}
+		klog.Info(summary)
+	}
+	if lbHostPorts == "auto" && !lbDirectRouting {
+		config.DefaultConfig.LoadBalancerHostPorts = hostPortsNeeded(ctx)
+	}
 	controller.New(kindProvider).Run(ctx)
 }
 
+// imageReferenceRegexp is a simplified version of the image reference grammar
+// [registry[:port]/]name[:tag][@digest]
+var imageReferenceRegexp = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)*(:[\w][\w.-]{0,127})?(@[a-z0-9]+:[a-fA-F0-9]{32,})?$`)
+
+// containerNamePrefixRegexp matches the valid container name prefixes, the load balancer
+// container names are the prefix followed by a hash of the Service.
+var containerNamePrefixRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,19}$`)
+
+// parseSubnetFlag returns the subnet of the flag, the zero value if it is empty. It exits if the
+// value is not a CIDR of the family.
+func parseSubnetFlag(name, value string, ipv6 bool) netip.Prefix {
+	if value == "" {
+		return netip.Prefix{}
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		klog.Fatalf("invalid %s %q: %v", name, value, err)
+	}
+	if prefix.Addr().Is6() != ipv6 {
+		klog.Fatalf("invalid %s %q: the subnet is not of the right IP family", name, value)
+	}
+	if prefix.Addr().Is6() && prefix.Addr().IsLinkLocalUnicast() {
+		klog.Fatalf("invalid %s %q: the link-local addresses can not be load balancer IPs", name, value)
+	}
+	return prefix.Masked()
+}
+
+// clusterNamesRegexp returns a regular expression that matches the whole cluster
+// name against any of the comma-separated names or regular expressions
+func clusterNamesRegexp(value string) (*regexp.Regexp, error) {
+	patterns := []string{}
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, "(?:"+p+")")
+	}
+	return regexp.Compile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+// labelsFlag is a repeatable flag of key=value labels
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	labels := []string{}
+	for k, v := range l {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+func (l labelsFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("label %q must be in the form key=value", value)
+	}
+	l[k] = v
+	return nil
+}
+
+// validateContainerLabels rejects the labels the provider sets on the load balancer containers
+// and reads back to find them, or the KIND nodes.
+func validateContainerLabels(labels map[string]string) error {
+	for key := range labels {
+		switch key {
+		case constants.KindClusterLabelKey, constants.NodeCCMLabelKey, constants.LoadBalancerNameLabelKey,
+			constants.LoadBalancerSharedLabelKey, constants.LoadBalancerServiceNamespaceLabelKey,
+			constants.LoadBalancerServiceNameLabelKey, constants.LoadBalancerServiceUIDLabelKey,
+			constants.LoadBalancerPrefixLabelKey, constants.LoadBalancerHostPortsLabelKey:
+			return fmt.Errorf("the label %q is reserved for the load balancers", key)
+		}
+	}
+	return nil
+}
+
+// hostPortsNeeded returns true if the load balancers can not be reached from the host, so the
+// Service ports have to be published on the host
+func hostPortsNeeded(ctx context.Context) bool {
+	// the tunnels and the port mappings already make them reachable
+	if config.DefaultConfig.RunMode == config.RunModeInCluster || config.DefaultConfig.LoadBalancerConnectivity != config.Unknown {
+		return false
+	}
+	// the routes of this host do not reach the networks of a remote container runtime
+	if container.RemoteHost() == "" {
+		routable, err := loadbalancer.NetworkRoutable(ctx)
+		if err != nil {
+			klog.Infof("Can not detect if the KIND network is reachable from the host, the Service ports are not published on the host: %v", err)
+			return false
+		}
+		if routable {
+			return false
+		}
+	}
+	if config.DefaultConfig.EnableSharedLoadBalancer {
+		klog.Warningf("**** The KIND network is not reachable from the host, the shared load balancer can only be reached from the containers")
+		return false
+	}
+	klog.Infof("**** The KIND network is not reachable from the host, publishing the Service ports on the host, use --lb-host-ports=false to disable it")
+	return true
+}
+
 func isWSL2() bool {
 	if v, err := os.ReadFile("/proc/version"); err == nil {
 		return strings.Contains(string(v), "WSL2")
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_validateContainerLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "no labels"},
+		{name: "user labels", labels: map[string]string{"team": "web", "io.x-k8s.cloud-provider-kind.owner": "me"}},
+		{name: "kind cluster", labels: map[string]string{constants.KindClusterLabelKey: "kind"}, wantErr: true},
+		{name: "cluster", labels: map[string]string{constants.NodeCCMLabelKey: "kind"}, wantErr: true},
+		{name: "loadbalancer name", labels: map[string]string{constants.LoadBalancerNameLabelKey: "kind/default/web"}, wantErr: true},
+		{name: "shared", labels: map[string]string{constants.LoadBalancerSharedLabelKey: "true"}, wantErr: true},
+		{name: "service namespace", labels: map[string]string{constants.LoadBalancerServiceNamespaceLabelKey: "default"}, wantErr: true},
+		{name: "service name", labels: map[string]string{constants.LoadBalancerServiceNameLabelKey: "web"}, wantErr: true},
+		{name: "service uid", labels: map[string]string{constants.LoadBalancerServiceUIDLabelKey: "uid"}, wantErr: true},
+		{name: "prefix", labels: map[string]string{constants.LoadBalancerPrefixLabelKey: "kindccm"}, wantErr: true},
+		{name: "host ports", labels: map[string]string{constants.LoadBalancerHostPortsLabelKey: "true"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateContainerLabels(tt.labels); (err != nil) != tt.wantErr {
+				t.Errorf("validateContainerLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
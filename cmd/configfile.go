@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// loadConfigFile sets the flags that were not set on the command line from the YAML or
+// JSON file in path, the keys of the file are the names of the flags, per example:
+//
+//	cluster-resync-interval: 1m
+//	enable-shared-lb: true
+//	lb-container-labels:
+//	  team: platform
+//
+// The values are validated the same way as the flags, unknown keys are rejected.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can not read the config file: %w", err)
+	}
+	options := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &options); err != nil {
+		return fmt.Errorf("can not parse the config file %s: %w", path, err)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// sort the keys so the errors are deterministic
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := fs.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("config file %s: unknown option %q", path, key)
+		}
+		if explicit[key] {
+			continue
+		}
+		values, err := configFileValues(options[key])
+		if err != nil {
+			return fmt.Errorf("config file %s: invalid value for option %q: %w", path, key, err)
+		}
+		if _, repeatable := f.Value.(labelsFlag); !repeatable && len(values) > 1 {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := fs.Set(key, value); err != nil {
+				return fmt.Errorf("config file %s: invalid value %q for option %q: %w", path, value, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configFileValues converts the value of an option of the config file to the values of the flag,
+// the lists and maps are converted to one value per element and the maps to key=value elements.
+func configFileValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("nested lists and maps are not supported")
+			}
+			itemValues, err := configFileValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	case map[string]interface{}:
+		values := []string{}
+		for k, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("the value of %q must be a scalar", k)
+			}
+			itemValues, err := configFileValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, k+"="+itemValues[0])
+		}
+		sort.Strings(values)
+		return values, nil
+	case nil:
+		return nil, fmt.Errorf("the value can not be empty")
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
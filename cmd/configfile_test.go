@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFlagSet() (*flag.FlagSet, *string, *bool, *time.Duration, labelsFlag) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	image := fs.String("loadbalancer-image", "", "")
+	shared := fs.Bool("enable-shared-lb", false, "")
+	resync := fs.Duration("cluster-resync-interval", 30*time.Second, "")
+	labels := labelsFlag{}
+	fs.Var(labels, "lb-container-labels", "")
+	fs.String("cluster-filter", "", "")
+	fs.Int("concurrent-service-syncs", 5, "")
+	fs.String("config", "", "")
+	return fs, image, shared, resync, labels
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	fs, image, shared, resync, labels := newTestFlagSet()
+	path := writeConfigFile(t, `
+loadbalancer-image: file-image
+enable-shared-lb: true
+cluster-resync-interval: 1m
+cluster-filter: [dev, "test-.*"]
+concurrent-service-syncs: 10
+lb-container-labels:
+  team: platform
+  env: dev
+`)
+	if err := fs.Parse([]string{"--loadbalancer-image=flag-image"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfigFile(fs, path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *image != "flag-image" {
+		t.Errorf("expected the command line flag to take precedence, got %q", *image)
+	}
+	if !*shared || *resync != time.Minute {
+		t.Errorf("expected the options of the file, got shared %v and resync %v", *shared, *resync)
+	}
+	if got := fs.Lookup("cluster-filter").Value.String(); got != "dev,test-.*" {
+		t.Errorf("expected the list to be comma-separated, got %q", got)
+	}
+	if got := fs.Lookup("concurrent-service-syncs").Value.String(); got != "10" {
+		t.Errorf("expected 10 concurrent syncs, got %s", got)
+	}
+	if labels.String() != "env=dev,team=platform" {
+		t.Errorf("unexpected labels %s", labels)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "unknown option", content: "enable-shared-lbs: true", err: `unknown option "enable-shared-lbs"`},
+		{name: "config option", content: "config: other.yaml", err: `unknown option "config"`},
+		{name: "invalid value", content: "cluster-resync-interval: often", err: `invalid value "often" for option "cluster-resync-interval"`},
+		{name: "empty value", content: "loadbalancer-image:", err: `invalid value for option "loadbalancer-image"`},
+		{name: "nested map", content: "lb-container-labels:\n  team: [a, b]", err: `invalid value for option "lb-container-labels"`},
+		{name: "invalid syntax", content: "enable-shared-lb: [true", err: "can not parse the config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _, _, _, _ := newTestFlagSet()
+			err := loadConfigFile(fs, writeConfigFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	fs, _, _, _, _ := newTestFlagSet()
+	if err := loadConfigFile(fs, filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
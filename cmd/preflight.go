@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/controller"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+	"sigs.k8s.io/kind/pkg/cluster"
+)
+
+// preflightCheck validates a requirement of the environment before starting the controllers
+type preflightCheck struct {
+	name string
+	// fatal checks prevent cloud-provider-kind from working when they fail, the others
+	// only report a problem that can be solved later
+	fatal bool
+	// run returns a short description of the result or the error of the check
+	run func(ctx context.Context) (string, error)
+	// needs is the name of a check that must pass before running this one
+	needs string
+}
+
+// preflightChecks returns the checks of the container runtime, the KIND clusters
+// and the load balancer image
+func preflightChecks(provider *cluster.Provider) []preflightCheck {
+	return []preflightCheck{
+		{
+			name:  "container runtime",
+			fatal: true,
+			run: func(ctx context.Context) (string, error) {
+				if err := container.Ping(ctx); err != nil {
+					return "", err
+				}
+				if host := container.RemoteHost(); host != "" {
+					return fmt.Sprintf("%s is reachable on the remote host %s, the load balancer IPs are not local", container.Runtime(), host), nil
+				}
+				return container.Runtime() + " is reachable", nil
+			},
+		},
+		{
+			name:  "KIND clusters",
+			fatal: true,
+			needs: "container runtime",
+			run: func(ctx context.Context) (string, error) {
+				clusters, err := provider.List()
+				if err != nil {
+					return "", fmt.Errorf("can not list the KIND clusters: %w", err)
+				}
+				if len(clusters) == 0 {
+					return "no clusters yet, they are managed when they are created", nil
+				}
+				return fmt.Sprintf("%d found: %s", len(clusters), strings.Join(clusters, ", ")), nil
+			},
+		},
+		{
+			name:  "load balancer image",
+			needs: "container runtime",
+			run: func(ctx context.Context) (string, error) {
+				image := loadbalancer.Image()
+				if config.DefaultConfig.DryRun || config.DefaultConfig.LoadBalancerDirectRouting ||
+					(config.DefaultConfig.Controllers != nil && !config.DefaultConfig.Controllers[controller.ServiceControllerName]) {
+					return "not needed, no load balancer containers are created", nil
+				}
+				if !container.ImageExists(ctx, image) {
+					return "", fmt.Errorf("%s is not present, it is pulled on startup and the load balancers wait for it", image)
+				}
+				return image + " is present", nil
+			},
+		},
+	}
+}
+
+// runPreflightChecks runs the checks and returns a summary with one line per check,
+// and false if a fatal check failed. The checks whose requirement failed are skipped.
+func runPreflightChecks(ctx context.Context, checks []preflightCheck) (string, bool) {
+	var summary strings.Builder
+	summary.WriteString("Preflight checks:")
+	ok := true
+	failed := map[string]bool{}
+	for _, check := range checks {
+		if failed[check.needs] {
+			failed[check.name] = true
+			fmt.Fprintf(&summary, "\n  [SKIPPED] %s: requires %s", check.name, check.needs)
+			continue
+		}
+		message, err := check.run(ctx)
+		result := "OK"
+		if err != nil {
+			failed[check.name] = true
+			result, message = "WARNING", err.Error()
+			if check.fatal {
+				result = "FAILED"
+				ok = false
+			}
+		}
+		fmt.Fprintf(&summary, "\n  [%s] %s: %s", result, check.name, message)
+	}
+	return summary.String(), ok
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_runPreflightChecks(t *testing.T) {
+	pass := func(ctx context.Context) (string, error) { return "fine", nil }
+	fail := func(ctx context.Context) (string, error) { return "", errors.New("broken") }
+	tests := []struct {
+		name   string
+		checks []preflightCheck
+		want   []string
+		wantOK bool
+	}{
+		{
+			name:   "all pass",
+			checks: []preflightCheck{{name: "runtime", fatal: true, run: pass}, {name: "image", needs: "runtime", run: pass}},
+			want:   []string{"[OK] runtime: fine", "[OK] image: fine"},
+			wantOK: true,
+		},
+		{
+			name:   "warning",
+			checks: []preflightCheck{{name: "runtime", fatal: true, run: pass}, {name: "image", run: fail}},
+			want:   []string{"[OK] runtime: fine", "[WARNING] image: broken"},
+			wantOK: true,
+		},
+		{
+			name: "fatal failure skips the dependent checks",
+			checks: []preflightCheck{
+				{name: "runtime", fatal: true, run: fail},
+				{name: "clusters", fatal: true, needs: "runtime", run: pass},
+				{name: "other", run: pass},
+			},
+			want: []string{"[FAILED] runtime: broken", "[SKIPPED] clusters: requires runtime", "[OK] other: fine"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, ok := runPreflightChecks(context.Background(), tt.checks)
+			if ok != tt.wantOK {
+				t.Errorf("runPreflightChecks() ok = %v, want %v", ok, tt.wantOK)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(summary, line) {
+					t.Errorf("expected %q in the summary:\n%s", line, summary)
+				}
+			}
+		})
+	}
+}
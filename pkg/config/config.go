@@ -1,5 +1,11 @@
 package config
 
+import (
+	"net/netip"
+	"regexp"
+	"time"
+)
+
 // DefaultConfig is a global variable that is initialized at startup with the flags options.
 // It can not be modified after that.
 var DefaultConfig = &Config{}
@@ -14,8 +20,158 @@ type Config struct {
 	LoadBalancerConnectivity Connectivity
 	// Type of connectivity between the cloud-provider-kind and the clusters
 	ControlPlaneConnectivity Connectivity
+	// LoadBalancerHealthCheckInterval is the interval between health checks
+	// of the loadbalancer backends, zero means the default value.
+	LoadBalancerHealthCheckInterval time.Duration
+	// LoadBalancerHealthCheckUnhealthyThreshold is the number of failed health checks
+	// before a backend is removed from rotation, zero means the default value.
+	LoadBalancerHealthCheckUnhealthyThreshold int
+	// ClusterResyncInterval is the interval between the scans of the KIND clusters,
+	// zero means the default value.
+	ClusterResyncInterval time.Duration
+	// APIServerProbeInsecure skips the verification of the apiserver certificates by the probes
+	// that check if the clusters are reachable, they are verified with the kubeconfig CA otherwise.
+	APIServerProbeInsecure bool
+	// APIServerWaitTimeout is the time to wait for the apiserver of a cluster to be healthy
+	// before starting its cloud controller manager, zero means the default value.
+	APIServerWaitTimeout time.Duration
+	// EnableLeaderElection uses a Lease on each cluster so only one cloud-provider-kind
+	// instance runs the controllers of the cluster.
+	EnableLeaderElection bool
+	// LoadBalancerDrainGracePeriod is the time the existing connections have to finish
+	// before deleting the loadbalancers on exit, zero means to not drain the connections.
+	LoadBalancerDrainGracePeriod time.Duration
+	// NoCleanupOnExit keeps the loadbalancers running on exit, so they can be inspected,
+	// the next run garbage collects the ones whose Service no longer exists.
+	NoCleanupOnExit bool
+	// EnableSharedLoadBalancer uses the same loadbalancer container for all the Services
+	// of a cluster, the Services can not use the same ports.
+	EnableSharedLoadBalancer bool
+	// LoadBalancerCPULimit is the number of millicores the loadbalancer containers
+	// can use, zero means unlimited.
+	LoadBalancerCPULimit int64
+	// LoadBalancerMemoryLimit is the number of bytes of memory the loadbalancer
+	// containers can use, zero means unlimited.
+	LoadBalancerMemoryLimit int64
+	// LoadBalancerImage is the image used by the loadbalancer containers,
+	// empty means the default image.
+	LoadBalancerImage string
+	// HealthzBindAddress is the address to serve the health endpoints, empty means disabled.
+	HealthzBindAddress string
+	// MetricsBindAddress is the address to serve the metrics, empty means disabled.
+	MetricsBindAddress string
+	// LoadBalancerIPRange is the range of the container network used to allocate the
+	// loadbalancer addresses, the zero value means the container runtime assigns them.
+	LoadBalancerIPRange netip.Prefix
+	// LoadBalancerIPv4Subnet and LoadBalancerIPv6Subnet are the subnets of the container network the
+	// loadbalancer addresses of each family are assigned from when the network has more than one,
+	// the zero value means the container runtime chooses.
+	LoadBalancerIPv4Subnet netip.Prefix
+	LoadBalancerIPv6Subnet netip.Prefix
+	// LoadBalancerClass is the loadBalancerClass of the Services handled, empty means
+	// the Services without loadBalancerClass.
+	LoadBalancerClass string
+	// ClusterFilter matches the names of the KIND clusters managed, nil means all the clusters.
+	ClusterFilter *regexp.Regexp
+	// ClusterExclude matches the names of the KIND clusters not managed, it takes precedence over ClusterFilter.
+	ClusterExclude *regexp.Regexp
+	// RunMode is where the cloud-provider-kind runs, it determines how the clusters are reached.
+	RunMode RunMode
+	// KubeconfigPreference selects the kubeconfig endpoints tried to reach the clusters, the run mode
+	// decides if it is KubeconfigPreferenceAuto.
+	KubeconfigPreference KubeconfigPreference
+	// InformerResyncPeriod is the resync period of the informers, zero means the default value.
+	InformerResyncPeriod time.Duration
+	// NodeSyncPeriod is the period the node controller updates the Nodes, zero means the default value.
+	NodeSyncPeriod time.Duration
+	// ConcurrentClusterSyncs is the number of clusters started concurrently, zero means the default value.
+	ConcurrentClusterSyncs int
+	// MaxClusters is the maximum number of clusters managed, zero means no limit.
+	MaxClusters int
+	// ConcurrentServiceSyncs is the number of workers of the service controller, zero means the default value.
+	ConcurrentServiceSyncs int
+	// BackendDrainTimeout is the time the backends removed from a loadbalancer keep their
+	// existing connections without receiving new ones, zero means they are removed immediately.
+	BackendDrainTimeout time.Duration
+	// LoadBalancerContainerLabels are additional labels set on the loadbalancer containers.
+	LoadBalancerContainerLabels map[string]string
+	// LoadBalancerIngressHostname reports hostnames instead of IPs in the Services status.
+	LoadBalancerIngressHostname bool
+	// LoadBalancerDirectRouting programs the loadbalancer addresses on the cluster nodes, where
+	// kube-proxy forwards them, instead of creating the loadbalancer containers. The addresses
+	// are allocated from LoadBalancerIPRange.
+	LoadBalancerDirectRouting bool
+	// Controllers are the names of the controllers started for each cluster, nil means all of them.
+	Controllers map[string]bool
+	// DryRun logs the loadbalancers that would be created, updated or deleted without touching the containers.
+	DryRun bool
+	// LoadBalancerAccessLog is where the loadbalancer containers write the access logs,
+	// AccessLogStdout, AccessLogNone or the absolute path of a file on the host.
+	LoadBalancerAccessLog string
+	// LoadBalancerContainerNamePrefix is the prefix of the loadbalancer container names,
+	// empty means the default prefix.
+	LoadBalancerContainerNamePrefix string
+	// LoadBalancerAdditionalNetworks are container networks all the loadbalancers are attached to besides
+	// the networks of their cluster.
+	LoadBalancerAdditionalNetworks []string
+	// LoadBalancerStatsInterval is the interval between the collections of the resource usage
+	// of the loadbalancer containers, zero disables them.
+	LoadBalancerStatsInterval time.Duration
+	// LoadBalancerExtraHosts are the hostname:ip entries added to the hosts file of all the loadbalancers.
+	LoadBalancerExtraHosts []string
+	// LoadBalancerDNSServers are the DNS servers of all the loadbalancer containers, the container
+	// runtime defaults are used if empty.
+	LoadBalancerDNSServers []string
+	// LoadBalancerPodBackends forwards the traffic of all the loadbalancers directly to the
+	// ready Pods of the Services instead of their NodePorts.
+	LoadBalancerPodBackends bool
+	// LoadBalancerAnnounceAddresses sends a gratuitous ARP and an unsolicited neighbor advertisement
+	// when the addresses of a loadbalancer are assigned or moved, so the neighbors update their caches.
+	LoadBalancerAnnounceAddresses bool
+	// LoadBalancerSecurity are the security options of the loadbalancer containers, they are
+	// privileged if none is set.
+	LoadBalancerSecurity ContainerSecurity
+	// LoadBalancerRequireHealthyBackends only reports the loadbalancer status of a Service once
+	// any of its backends passes the health checks, and withdraws it when none does.
+	LoadBalancerRequireHealthyBackends bool
+	// LoadBalancerHostPorts publishes the ports of all the Services on the host, the
+	// Services can disable it with the host ports annotation.
+	LoadBalancerHostPorts bool
 }
 
+const (
+	// AccessLogStdout writes the access logs to the loadbalancer container output,
+	// it is the default so they can be read with the container runtime logs command.
+	AccessLogStdout = "stdout"
+	// AccessLogNone disables the access logs.
+	AccessLogNone = "none"
+)
+
+// RunMode is where the cloud-provider-kind runs
+type RunMode string
+
+const (
+	// RunModeAuto tries to reach the clusters from the KIND network and from the host
+	RunModeAuto RunMode = ""
+	// RunModeInCluster runs in a container attached to the KIND network, the clusters
+	// and the loadbalancers are reached directly.
+	RunModeInCluster RunMode = "in-cluster"
+	// RunModeHost runs on the host, the clusters are reached through the ports published on the host.
+	RunModeHost RunMode = "host"
+)
+
+// KubeconfigPreference is the kubeconfig endpoint of the clusters that is tried
+type KubeconfigPreference string
+
+const (
+	// KubeconfigPreferenceAuto tries the endpoints of the run mode, the internal one first
+	KubeconfigPreferenceAuto KubeconfigPreference = "auto"
+	// KubeconfigPreferenceInternal only tries the internal endpoint on the KIND network
+	KubeconfigPreferenceInternal KubeconfigPreference = "internal"
+	// KubeconfigPreferenceExternal only tries the external endpoint published on the host
+	KubeconfigPreferenceExternal KubeconfigPreference = "external"
+)
+
 type Connectivity int
 
 const (
@@ -24,3 +180,17 @@ const (
 	Portmap
 	Tunnel
 )
+
+// ContainerSecurity are the options to harden the loadbalancer containers
+type ContainerSecurity struct {
+	// ReadOnlyRootFilesystem mounts the root filesystem read-only, the proxy configuration is
+	// written to a tmpfs.
+	ReadOnlyRootFilesystem bool
+	// NoNewPrivileges prevents the processes of the container from gaining privileges.
+	NoNewPrivileges bool
+	// DropCapabilities are the capabilities removed from the container, ALL removes all of them,
+	// the ones the proxy needs are always added back.
+	DropCapabilities []string
+	// User is the user[:group] the proxy runs as, empty means the user of the image.
+	User string
+}
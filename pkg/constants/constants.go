@@ -6,8 +6,84 @@ const (
 	ContainerPrefix = "kindccm"
 	// KIND constants
 	FixedNetworkName = "kind"
+	// KindClusterLabelKey is the label KIND sets on the cluster nodes with the cluster name
+	KindClusterLabelKey = "io.x-k8s.kind.cluster"
 	// NodeCCMLabelKey
 	NodeCCMLabelKey = "io.x-k8s.cloud-provider-kind.cluster"
 	// LoadBalancerNameLabelKey clustername/serviceNamespace/serviceName
 	LoadBalancerNameLabelKey = "io.x-k8s.cloud-provider-kind.loadbalancer.name"
+	// LoadBalancerSharedLabelKey is set on the loadbalancer containers shared by all the Services of a cluster
+	LoadBalancerSharedLabelKey = "io.x-k8s.cloud-provider-kind.loadbalancer.shared"
+	// LoadBalancerServiceNamespaceLabelKey is the namespace of the Service of the loadbalancer
+	LoadBalancerServiceNamespaceLabelKey = "io.x-k8s.cloud-provider-kind.service.namespace"
+	// LoadBalancerServiceNameLabelKey is the name of the Service of the loadbalancer
+	LoadBalancerServiceNameLabelKey = "io.x-k8s.cloud-provider-kind.service.name"
+	// LoadBalancerServiceUIDLabelKey is the UID of the Service of the loadbalancer, it tells apart
+	// the Services deleted and created again with the same name
+	LoadBalancerServiceUIDLabelKey = "io.x-k8s.cloud-provider-kind.service.uid"
+	// LoadBalancerPrefixLabelKey is the prefix of the loadbalancer container name
+	LoadBalancerPrefixLabelKey = "io.x-k8s.cloud-provider-kind.loadbalancer.prefix"
+	// LoadBalancerHostPortsLabelKey is set on the loadbalancer containers that publish the Service ports on the host
+	LoadBalancerHostPortsLabelKey = "io.x-k8s.cloud-provider-kind.loadbalancer.host-ports"
+	// NodeZoneLabelKey is the label used to set the topology zone of a node, it can be set
+	// on the Node object or on the node container, the Node label takes precedence
+	NodeZoneLabelKey = "cloud-provider-kind.x-k8s.io/zone"
+	// NodeRegionLabelKey is the label used to set the topology region of a node, as NodeZoneLabelKey
+	NodeRegionLabelKey = "cloud-provider-kind.x-k8s.io/region"
+	// NodeZoneContainerLabelKey is the container label used to set the topology zone of a node
+	NodeZoneContainerLabelKey = "io.x-k8s.cloud-provider-kind.zone"
+	// NodeRegionContainerLabelKey is the container label used to set the topology region of a node
+	NodeRegionContainerLabelKey = "io.x-k8s.cloud-provider-kind.region"
+	// LoadBalancerReadyConditionType is the Service condition that reports if the loadbalancer is serving the Service
+	LoadBalancerReadyConditionType = "LoadBalancerReady"
+	// AnnotationPrefix is the prefix of the Service annotations to configure the loadbalancer
+	AnnotationPrefix = "loadbalancer.kind.sigs.k8s.io/"
+	// ProxyProtocolAnnotationKey enables the PROXY protocol towards the backends, supported values are v1 and v2
+	ProxyProtocolAnnotationKey = AnnotationPrefix + "proxy-protocol"
+	// IdleTimeoutAnnotationKey is the time a TCP connection without traffic is kept open, as a duration, 0 disables the timeout
+	IdleTimeoutAnnotationKey = AnnotationPrefix + "idle-timeout"
+	// TCPKeepaliveAnnotationKey is the idle time before sending TCP keepalive probes to the clients and the backends, as a duration
+	TCPKeepaliveAnnotationKey = AnnotationPrefix + "tcp-keepalive"
+	// LoadBalancerIPAnnotationKey requests a specific address for the loadbalancer, it takes precedence over the deprecated spec.loadBalancerIP
+	LoadBalancerIPAnnotationKey = AnnotationPrefix + "load-balancer-ip"
+	// HostPortsAnnotationKey publishes the Service ports of the loadbalancer on the same ports of the host, as a boolean
+	HostPortsAnnotationKey = AnnotationPrefix + "host-ports"
+	// AdditionalNetworksAnnotationKey is a comma-separated list of container networks the loadbalancer is attached to
+	// besides the networks of the cluster, the Service addresses are still allocated on the cluster network
+	AdditionalNetworksAnnotationKey = AnnotationPrefix + "additional-networks"
+	// HostnameAnnotationKey is the hostname reported in the Service status when the ingress hostnames are enabled
+	HostnameAnnotationKey = AnnotationPrefix + "hostname"
+	// ProxyConfigOverrideAnnotationKey is the name of a ConfigMap in the Service namespace with the
+	// fields merged into the generated envoy listeners and clusters
+	ProxyConfigOverrideAnnotationKey = AnnotationPrefix + "proxy-config-override"
+	// HealthCheckProtocolAnnotationKey checks the NodePort of the TCP backends with TCP, HTTP or HTTPS
+	// instead of the kube-proxy health check
+	HealthCheckProtocolAnnotationKey = AnnotationPrefix + "health-check-protocol"
+	// HealthCheckPathAnnotationKey is the path of the HTTP and HTTPS health checks, defaults to /
+	HealthCheckPathAnnotationKey = AnnotationPrefix + "health-check-path"
+	// HealthCheckExpectedStatusAnnotationKey is a comma-separated list of HTTP status codes or ranges considered healthy, defaults to 200
+	HealthCheckExpectedStatusAnnotationKey = AnnotationPrefix + "health-check-expected-status"
+	// BackendWeightsAnnotationKey is a comma-separated list of node=weight or zone/zone=weight entries with the
+	// share of the traffic sent to the backends of each node or zone, the backends not listed have weight 1
+	BackendWeightsAnnotationKey = AnnotationPrefix + "backend-weights"
+	// DisabledAnnotationKey stops the loadbalancer container without deleting it, as a boolean,
+	// the loadbalancer keeps its address and is started again when the annotation is removed
+	DisabledAnnotationKey = AnnotationPrefix + "disabled"
+	// ExtraHostsAnnotationKey is a comma-separated list of hostname=ip entries added to the hosts file of the loadbalancer,
+	// so it can resolve the backends referenced by hostname
+	ExtraHostsAnnotationKey = AnnotationPrefix + "extra-hosts"
+	// DNSServersAnnotationKey is a comma-separated list of DNS servers the loadbalancer container uses
+	DNSServersAnnotationKey = AnnotationPrefix + "dns-servers"
+	// TrafficPolicyAnnotationKey selects the backends of the loadbalancer as Cluster, all the nodes, or Local,
+	// only the nodes with ready endpoints, regardless of the Service externalTrafficPolicy
+	TrafficPolicyAnnotationKey = AnnotationPrefix + "traffic-policy"
+	// TLSSecretAnnotationKey is the name of a kubernetes.io/tls Secret in the namespace of the Service,
+	// the loadbalancer terminates TLS with its certificate and forwards plain text to the backends
+	TLSSecretAnnotationKey = AnnotationPrefix + "tls-secret"
+	// TLSPortsAnnotationKey is a comma-separated list of the port numbers or names that terminate TLS,
+	// defaults to all the TCP ports of the Service
+	TLSPortsAnnotationKey = AnnotationPrefix + "tls-ports"
+	// AssignedIPAnnotationKey is set by cloud-provider-kind to the comma-separated addresses of the
+	// loadbalancer of the Service, it is removed when the loadbalancer is deleted
+	AssignedIPAnnotationKey = AnnotationPrefix + "assigned-ip"
 )
@@ -0,0 +1,99 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+var (
+	// commandTimeout is the maximum time a container runtime command can take, so a hung
+	// container runtime does not block the controllers
+	commandTimeout = 30 * time.Second
+	// createTimeout is the maximum time to create a container or to pull an image,
+	// the image may have to be downloaded
+	createTimeout = 5 * time.Minute
+	// waitDelay is the time the output of a killed command is waited for
+	waitDelay = time.Second
+)
+
+// runtimeCommand is a container runtime command that is killed when its context
+// is cancelled or its timeout expires
+type runtimeCommand struct {
+	*exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+// newCommand returns the container runtime command with the arguments, it must be run
+// with Run or Output so its context is released.
+func newCommand(ctx context.Context, timeout time.Duration, args ...string) *runtimeCommand {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	cmd := exec.CommandContext(ctx, current.Command(), args...)
+	cmd.WaitDelay = waitDelay
+	return &runtimeCommand{Cmd: cmd, ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// Run runs the command and waits for it to finish
+func (c *runtimeCommand) Run() error {
+	defer c.cancel()
+	return c.wrap(c.Cmd.Run())
+}
+
+// Output runs the command and returns its standard output
+func (c *runtimeCommand) Output() ([]byte, error) {
+	defer c.cancel()
+	var stderr bytes.Buffer
+	if c.Stderr == nil {
+		c.Stderr = &stderr
+	}
+	output, err := c.Cmd.Output()
+	if err != nil && stderr.Len() > 0 && c.ctx.Err() == nil {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return output, c.wrap(err)
+}
+
+// OutputLines runs the command and returns the lines of its standard output
+func (c *runtimeCommand) OutputLines() ([]string, error) {
+	output, err := c.Output()
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// wrap logs the commands that were cancelled or did not finish in time, the error
+// wraps the context error so the callers can tell them apart
+func (c *runtimeCommand) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	ctxErr := c.ctx.Err()
+	if ctxErr == nil {
+		return err
+	}
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		klog.Warningf("container runtime command %v did not finish in %v, it was killed", c.Args, c.timeout)
+	} else {
+		klog.V(2).Infof("container runtime command %v was cancelled", c.Args)
+	}
+	return fmt.Errorf("%s %s: %w", current.Name(), c.Args[1], ctxErr)
+}
+
+// isContextError returns true if the command was cancelled or did not finish in time
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
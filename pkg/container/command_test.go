@@ -0,0 +1,65 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+// fakeRuntime replaces the container runtime with a script that blocks, as a hung
+// container runtime does
+func fakeRuntime(t *testing.T) {
+	t.Helper()
+	t.Cleanup(Use(containertest.New(t, "exec sleep 30")))
+	oldTimeout, oldDelay := commandTimeout, waitDelay
+	t.Cleanup(func() {
+		commandTimeout, waitDelay = oldTimeout, oldDelay
+	})
+	commandTimeout = 100 * time.Millisecond
+	waitDelay = 100 * time.Millisecond
+}
+
+func TestCommandTimeout(t *testing.T) {
+	fakeRuntime(t)
+
+	for name, fn := range map[string]func(ctx context.Context) error{
+		"delete": func(ctx context.Context) error { return Delete(ctx, "kindccm-test") },
+		"list": func(ctx context.Context) error {
+			_, err := ListByLabel(ctx, "io.x-k8s.cloud-provider-kind.cluster=kind")
+			return err
+		},
+		"exec": func(ctx context.Context) error {
+			return Exec(ctx, "kindccm-test", []string{"true"}, nil, nil, nil)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			err := fn(context.Background())
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected a deadline exceeded error, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the command to be killed after the timeout, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestCommandCancel(t *testing.T) {
+	fakeRuntime(t)
+	commandTimeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, _, err := State(ctx, "kindccm-test")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed when cancelled, took %v", elapsed)
+	}
+}
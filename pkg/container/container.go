@@ -1,122 +1,199 @@
 package container
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 
 	"k8s.io/klog/v2"
-	kindexec "sigs.k8s.io/kind/pkg/exec"
 )
 
-// TODO we can do it as in KIND
-var containerRuntime = "docker"
-
-// dockerIsAvailable checks if docker is available in the system
-func dockerIsAvailable() bool {
-	cmd := kindexec.Command("docker", "-v")
-	lines, err := kindexec.OutputLines(cmd)
-	if err != nil || len(lines) != 1 {
-		return false
+func Logs(ctx context.Context, name string, w io.Writer) error {
+	cmd := newCommand(ctx, commandTimeout, "logs", name)
+	cmd.Stderr = w
+	cmd.Stdout = w
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to get container logs: %w", err)
 	}
-	return strings.HasPrefix(lines[0], "Docker version")
+	return nil
 }
 
-func podmanIsAvailable() bool {
-	cmd := kindexec.Command("podman", "-v")
-	lines, err := kindexec.OutputLines(cmd)
-	if err != nil || len(lines) != 1 {
-		return false
+func LogDump(ctx context.Context, containerName string, fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
 	}
-	return strings.HasPrefix(lines[0], "podman version")
+	defer f.Close()
 
+	err = Logs(ctx, containerName, f)
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
-func init() {
-	if dockerIsAvailable() {
-		return
+func Create(ctx context.Context, name string, args []string) error {
+	if err := waitRateLimit(ctx); err != nil {
+		return err
 	}
-	if podmanIsAvailable() {
-		containerRuntime = "podman"
+	if err := newCommand(ctx, createTimeout, append([]string{"run", "--name", name}, args...)...).Run(); err != nil {
+		return err
 	}
+	return nil
 }
 
-func Logs(name string, w io.Writer) error {
-	cmd := exec.Command(containerRuntime, []string{"logs", name}...)
-	cmd.Stderr = w
-	cmd.Stdout = w
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to get container logs: %w", err)
+// Ping returns an error if the container runtime can not be reached, per example
+// because the docker daemon is not running
+func Ping(ctx context.Context) error {
+	if _, err := newCommand(ctx, commandTimeout, "info").Output(); err != nil {
+		return fmt.Errorf("%s is not reachable: %w", current.Name(), err)
 	}
 	return nil
 }
 
-func LogDump(containerName string, fileName string) error {
-	f, err := os.Create(fileName)
+// Image returns the image reference the container was created with
+func Image(ctx context.Context, name string) (string, error) {
+	lines, err := newCommand(ctx, commandTimeout, "inspect", "--format", "{{.Config.Image}}", name).OutputLines()
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer f.Close()
+	if len(lines) != 1 {
+		return "", fmt.Errorf("expected 1 line, got %d", len(lines))
+	}
+	return lines[0], nil
+}
 
-	err = Logs(containerName, f)
-	if err != nil {
-		return err
+// Rename changes the name of the container, it keeps running.
+func Rename(ctx context.Context, name string, newName string) error {
+	if err := newCommand(ctx, commandTimeout, "rename", name, newName).Run(); err != nil {
+		return fmt.Errorf("failed to rename container %s to %s: %w", name, newName, err)
+	}
+	return nil
+}
+
+// ImageExists returns true if the image is present on the host.
+func ImageExists(ctx context.Context, image string) bool {
+	err := newCommand(ctx, commandTimeout, "image", "inspect", image).Run()
+	return err == nil
+}
+
+func Pull(ctx context.Context, image string) error {
+	if err := newCommand(ctx, createTimeout, "pull", image).Run(); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
 	}
 	return nil
 }
 
-func Create(name string, args []string) error {
-	if err := exec.Command(containerRuntime, append([]string{"run", "--name", name}, args...)...).Run(); err != nil {
+func Restart(ctx context.Context, name string) error {
+	if err := waitRateLimit(ctx); err != nil {
+		return err
+	}
+	if err := newCommand(ctx, commandTimeout, "restart", name).Run(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func Restart(name string) error {
-	if err := exec.Command(containerRuntime, []string{"restart", name}...).Run(); err != nil {
+// Stop stops the container, its configuration is kept so it can be started again.
+func Stop(ctx context.Context, name string) error {
+	if err := waitRateLimit(ctx); err != nil {
 		return err
 	}
+	if err := newCommand(ctx, commandTimeout, "stop", name).Run(); err != nil {
+		return fmt.Errorf("failed to stop container %s: %w", name, err)
+	}
 	return nil
 }
 
-func Delete(name string) error {
-	if err := exec.Command(containerRuntime, []string{"rm", "-f", name}...).Run(); err != nil {
+// Delete removes the container, it does not fail if the container does not exist.
+func Delete(ctx context.Context, name string) error {
+	if err := waitRateLimit(ctx); err != nil {
+		return err
+	}
+	if err := newCommand(ctx, commandTimeout, "rm", "-f", name).Run(); err != nil {
+		// a runtime that did not answer can not tell if the container exists
+		if !isContextError(err) && !Exist(ctx, name) {
+			return nil
+		}
 		return err
 	}
 	return nil
 }
 
-func IsRunning(name string) bool {
-	cmd := exec.Command(containerRuntime, []string{"ps", "-q", "-f", "name=" + name}...)
-	output, err := cmd.Output()
+func IsRunning(ctx context.Context, name string) bool {
+	output, err := newCommand(ctx, commandTimeout, "ps", "-q", "-f", "name="+name).Output()
 	if err != nil || len(output) == 0 {
 		return false
 	}
 	return true
 }
 
-func Exist(name string) bool {
-	err := exec.Command(containerRuntime, []string{"inspect", name}...).Run()
+// IsNotFound returns true if the error of a container runtime command is caused
+// by a container that does not exist
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "no such object") || strings.Contains(msg, "no such container")
+}
+
+// IsPortInUse returns true if the error of a container runtime command is caused
+// by a port of the host that is already in use
+func IsPortInUse(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "port is already allocated") || strings.Contains(msg, "address already in use")
+}
+
+func Exist(ctx context.Context, name string) bool {
+	err := newCommand(ctx, commandTimeout, "inspect", name).Run()
 	return err == nil
 }
 
-func Signal(name string, signal string) error {
-	err := exec.Command(containerRuntime, []string{"kill", "-s", signal, name}...).Run()
+// State returns the ID and the status of the container, per example running, restarting or exited.
+func State(ctx context.Context, name string) (id string, status string, err error) {
+	lines, err := newCommand(ctx, commandTimeout,
+		"inspect",
+		"--format", `{{.Id}} {{.State.Status}}`,
+		name,
+	).OutputLines()
+	if err != nil {
+		return "", "", err
+	}
+	if len(lines) != 1 {
+		return "", "", fmt.Errorf("expected 1 line, got %d", len(lines))
+	}
+	id, status, ok := strings.Cut(lines[0], " ")
+	if !ok {
+		return "", "", fmt.Errorf("unexpected output %q", lines[0])
+	}
+	return id, status, nil
+}
+
+func Signal(ctx context.Context, name string, signal string) error {
+	err := newCommand(ctx, commandTimeout, "kill", "-s", signal, name).Run()
 	return err
 }
 
-func Exec(name string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+func Exec(ctx context.Context, name string, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 	args := []string{"exec", "--privileged"}
 	if stdin != nil {
 		args = append(args, "-i")
 	}
 	args = append(args, name)
 	args = append(args, command...)
-	cmd := exec.Command(containerRuntime, args...)
+	cmd := newCommand(ctx, commandTimeout, args...)
 	if stdin != nil {
 		cmd.Stdin = stdin
 	}
@@ -129,18 +206,157 @@ func Exec(name string, command []string, stdin io.Reader, stdout io.Writer, stde
 	return cmd.Run()
 }
 
-func IPs(name string) (ipv4 string, ipv6 string, err error) {
-	// retrieve the IP address of the node using docker inspect
-	cmd := kindexec.Command(containerRuntime, "inspect",
-		"-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}},{{.GlobalIPv6Address}}{{end}}",
+func IPs(ctx context.Context, name string) (ipv4 string, ipv6 string, err error) {
+	// retrieve the IP address of the node using docker inspect,
+	// the first line is the network the container was created on
+	// and each of the following lines the addresses on each network
+	lines, err := newCommand(ctx, commandTimeout, "inspect",
+		"-f", "{{.HostConfig.NetworkMode}}{{println}}{{range $name, $net := .NetworkSettings.Networks}}{{$name}},{{$net.IPAddress}},{{$net.GlobalIPv6Address}}{{println}}{{end}}",
 		name, // ... against the "node" container
-	)
-	lines, err := kindexec.OutputLines(cmd)
+	).OutputLines()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get container details: %w", err)
+	}
+	if len(lines) < 2 {
+		return "", "", fmt.Errorf("container should have at least one network, got %d lines", len(lines))
+	}
+	for i, line := range lines[1:] {
+		ips := strings.Split(line, ",")
+		if len(ips) != 3 {
+			return "", "", fmt.Errorf("container addresses should have 3 values, got %d values", len(ips))
+		}
+		if ips[0] == lines[0] {
+			return ips[1], ips[2], nil
+		}
+		// use the addresses of the first network if the primary network is not found
+		if i == 0 {
+			ipv4, ipv6 = ips[1], ips[2]
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// Networks returns the names of the networks the container is attached to
+func Networks(ctx context.Context, name string) ([]string, error) {
+	lines, err := newCommand(ctx, commandTimeout, "inspect",
+		"-f", "{{range $name, $net := .NetworkSettings.Networks}}{{$name}}{{println}}{{end}}",
+		name,
+	).OutputLines()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container details: %w", err)
+	}
+	networks := []string{}
+	for _, line := range lines {
+		if line != "" {
+			networks = append(networks, line)
+		}
+	}
+	return networks, nil
+}
+
+// NetworkConnect attaches the container to the network
+func NetworkConnect(ctx context.Context, network string, name string) error {
+	if err := waitRateLimit(ctx); err != nil {
+		return err
+	}
+	if err := newCommand(ctx, commandTimeout, "network", "connect", network, name).Run(); err != nil {
+		return fmt.Errorf("failed to connect container %s to network %s: %w", name, network, err)
+	}
+	return nil
+}
+
+// NetworkDisconnect detaches the container from the network
+func NetworkDisconnect(ctx context.Context, network string, name string) error {
+	if err := waitRateLimit(ctx); err != nil {
+		return err
+	}
+	if err := newCommand(ctx, commandTimeout, "network", "disconnect", network, name).Run(); err != nil {
+		return fmt.Errorf("failed to disconnect container %s from network %s: %w", name, network, err)
+	}
+	return nil
+}
+
+// NetworkConnectWithIPs attaches the container to the network with the addresses, the
+// empty ones are assigned by the container runtime
+func NetworkConnectWithIPs(ctx context.Context, network string, name string, ipv4, ipv6 string) error {
+	if err := waitRateLimit(ctx); err != nil {
+		return err
+	}
+	args := []string{"network", "connect"}
+	if ipv4 != "" {
+		args = append(args, "--ip", ipv4)
+	}
+	if ipv6 != "" {
+		args = append(args, "--ip6", ipv6)
+	}
+	args = append(args, network, name)
+	if err := newCommand(ctx, commandTimeout, args...).Run(); err != nil {
+		return fmt.Errorf("failed to connect container %s to network %s with addresses %q %q: %w", name, network, ipv4, ipv6, err)
+	}
+	return nil
+}
+
+// MoveAddresses moves the addresses of the container from on the network to the container to,
+// that must be attached to the network with other addresses. The addresses can not be in use by
+// two containers, so they are unreachable from the time from is detached until to is attached again.
+// If to can not take the addresses they are given back to from.
+func MoveAddresses(ctx context.Context, network string, from string, to string, ipv4, ipv6 string) error {
+	if err := NetworkDisconnect(ctx, network, to); err != nil {
+		return err
+	}
+	if err := NetworkDisconnect(ctx, network, from); err != nil {
+		if err2 := NetworkConnect(ctx, network, to); err2 != nil {
+			klog.Infof("failed to attach container %s to network %s again: %v", to, network, err2)
+		}
+		return err
+	}
+	err := NetworkConnectWithIPs(ctx, network, to, ipv4, ipv6)
+	if err == nil {
+		return nil
+	}
+	if err2 := NetworkConnectWithIPs(ctx, network, from, ipv4, ipv6); err2 != nil {
+		klog.Infof("failed to give the addresses back to container %s: %v", from, err2)
+	}
+	if err2 := NetworkConnect(ctx, network, to); err2 != nil {
+		klog.Infof("failed to attach container %s to network %s again: %v", to, network, err2)
+	}
+	return err
+}
+
+// ConnectNetworks attaches the container to the networks it is not attached to yet
+func ConnectNetworks(ctx context.Context, name string, networks []string) error {
+	if len(networks) == 0 {
+		return nil
+	}
+	attached, err := Networks(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		if slices.Contains(attached, network) {
+			continue
+		}
+		if err := NetworkConnect(ctx, network, name); err != nil {
+			return err
+		}
+		attached = append(attached, network)
+	}
+	return nil
+}
+
+// ConfiguredIPs returns the addresses the container was created with on its primary network, unlike IPs they are
+// available when the container is not running. Containers that obtained their addresses
+// dynamically return empty values.
+func ConfiguredIPs(ctx context.Context, name string) (ipv4 string, ipv6 string, err error) {
+	lines, err := newCommand(ctx, commandTimeout, "inspect",
+		"-f", "{{with index .NetworkSettings.Networks .HostConfig.NetworkMode}}{{with .IPAMConfig}}{{.IPv4Address}},{{.IPv6Address}}{{else}},{{end}}{{else}},{{end}}",
+		name,
+	).OutputLines()
 	if err != nil {
 		return "", "", fmt.Errorf("failed to get container details: %w", err)
 	}
 	if len(lines) != 1 {
-		return "", "", fmt.Errorf("file should only be one line, got %d lines: %w", len(lines), err)
+		return "", "", fmt.Errorf("file should only be one line, got %d lines", len(lines))
 	}
 	ips := strings.Split(lines[0], ",")
 	if len(ips) != 2 {
@@ -150,14 +366,12 @@ func IPs(name string) (ipv4 string, ipv6 string, err error) {
 }
 
 // return a list with the map of the internal port to the external port
-func PortMaps(name string) (map[string]string, error) {
+func PortMaps(ctx context.Context, name string) (map[string]string, error) {
 	// retrieve the IP address of the node using docker inspect
-	cmd := kindexec.Command(containerRuntime, "inspect",
+	lines, err := newCommand(ctx, commandTimeout, "inspect",
 		"-f", "{{ json .NetworkSettings.Ports }}",
 		name, // ... against the "node" container
-	)
-
-	lines, err := kindexec.OutputLines(cmd)
+	).OutputLines()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get container details: %w", err)
 	}
@@ -199,28 +413,46 @@ func PortMaps(name string) (map[string]string, error) {
 	return result, nil
 }
 
-func ListByLabel(label string) ([]string, error) {
-	cmd := kindexec.Command(containerRuntime,
-		"ps",
-		"-a", // show stopped nodes
-		// filter for nodes with the cluster label
-		"--filter", "label="+label,
-		// format to include the cluster name
-		"--format", `{{.ID }}`,
-	)
-	lines, err := kindexec.OutputLines(cmd)
-	return lines, err
+// ListByLabel returns the IDs of the containers that have all the labels, in key=value format.
+func ListByLabel(ctx context.Context, labels ...string) ([]string, error) {
+	return listByLabel(ctx, true, labels)
+}
+
+// ListRunningByLabel returns the IDs of the running containers that have all the labels,
+// in key=value format.
+func ListRunningByLabel(ctx context.Context, labels ...string) ([]string, error) {
+	return listByLabel(ctx, false, labels)
+}
+
+// ListRunningByLabelOnNetwork returns the IDs of the running containers attached to the network
+// that have all the labels, in key=value format.
+func ListRunningByLabelOnNetwork(ctx context.Context, network string, labels ...string) ([]string, error) {
+	return listByLabel(ctx, false, labels, "--filter", "network="+network)
+}
+
+func listByLabel(ctx context.Context, all bool, labels []string, filters ...string) ([]string, error) {
+	args := []string{"ps"}
+	if all {
+		args = append(args, "-a") // show stopped nodes
+	}
+	args = append(args, filters...)
+	// filter for nodes with the cluster label
+	for _, label := range labels {
+		args = append(args, "--filter", "label="+label)
+	}
+	// format to include the cluster name
+	args = append(args, "--format", `{{.ID }}`)
+	return newCommand(ctx, commandTimeout, args...).OutputLines()
 }
 
 // GetLabelValue return the value of the associated label
 // It returns an error if the label value does not exist
-func GetLabelValue(name string, label string) (string, error) {
-	cmd := kindexec.Command(containerRuntime,
+func GetLabelValue(ctx context.Context, name string, label string) (string, error) {
+	lines, err := newCommand(ctx, commandTimeout,
 		"inspect",
 		"--format", fmt.Sprintf(`{{ index .Config.Labels "%s"}}`, label),
 		name,
-	)
-	lines, err := kindexec.OutputLines(cmd)
+	).OutputLines()
 	if err != nil {
 		return "", err
 	}
@@ -229,3 +461,204 @@ func GetLabelValue(name string, label string) (string, error) {
 	}
 	return lines[0], nil
 }
+
+// Labels returns all the labels of the container
+func Labels(ctx context.Context, name string) (map[string]string, error) {
+	lines, err := newCommand(ctx, commandTimeout,
+		"inspect",
+		"--format", `{{ json .Config.Labels }}`,
+		name,
+	).OutputLines()
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) != 1 {
+		return nil, fmt.Errorf("expected 1 line, got %d", len(lines))
+	}
+	labels := map[string]string{}
+	if err := json.Unmarshal([]byte(lines[0]), &labels); err != nil {
+		return nil, fmt.Errorf("can not parse the labels of container %s: %w", name, err)
+	}
+	return labels, nil
+}
+
+// ResourceUsage is the CPU and memory used by a container
+type ResourceUsage struct {
+	// CPU is the CPU usage in cores
+	CPU float64
+	// MemoryBytes is the memory usage in bytes
+	MemoryBytes float64
+}
+
+// Stats returns the resource usage of the running containers by name, it takes a
+// single sample so the CPU usage is the one since the previous sample of the runtime.
+func Stats(ctx context.Context, names ...string) (map[string]ResourceUsage, error) {
+	if len(names) == 0 {
+		return map[string]ResourceUsage{}, nil
+	}
+	args := append([]string{"stats", "--no-stream", "--format", `{{.Name}}\t{{.CPUPerc}}\t{{.MemUsage}}`}, names...)
+	lines, err := newCommand(ctx, commandTimeout, args...).OutputLines()
+	if err != nil {
+		return nil, err
+	}
+	return parseStats(lines)
+}
+
+// parseStats parses the name, the CPU percentage and the memory usage of the stats lines,
+// the containers without stats, per example because they are stopped, are skipped.
+func parseStats(lines []string) (map[string]ResourceUsage, error) {
+	usage := map[string]ResourceUsage{}
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected stats line %q", line)
+		}
+		cpu, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(fields[1]), "%"), 64)
+		if err != nil {
+			continue
+		}
+		// the memory usage is followed by the limit
+		used, _, _ := strings.Cut(fields[2], "/")
+		memory, err := parseSize(strings.TrimSpace(used))
+		if err != nil {
+			continue
+		}
+		usage[strings.TrimPrefix(fields[0], "/")] = ResourceUsage{CPU: cpu / 100, MemoryBytes: memory}
+	}
+	return usage, nil
+}
+
+// sizeUnits are the multipliers of the sizes printed by docker, binary, and podman, decimal
+var sizeUnits = map[string]float64{
+	"b":   1,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+}
+
+// parseSize parses a human readable size, per example 12.5MiB or 13.1MB
+func parseSize(size string) (float64, error) {
+	i := strings.IndexFunc(size, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	multiplier, ok := sizeUnits[strings.ToLower(strings.TrimSpace(size[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit %q", size)
+	}
+	value, err := strconv.ParseFloat(size[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+	return value * multiplier, nil
+}
+
+// Events calls fn with the name of the container every time a container with
+// the label passed as argument starts, dies or is destroyed.
+// It blocks until the context is cancelled or the event stream is closed.
+func Events(ctx context.Context, label string, fn func(name string)) error {
+	cmd := exec.CommandContext(ctx, current.Command(),
+		"events",
+		"--filter", "type=container",
+		"--filter", "label="+label,
+		"--filter", "event=start",
+		"--filter", "event=die",
+		"--filter", "event=destroy",
+		"--format", `{{.Actor.Attributes.name}}`,
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to watch container events: %w", err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		fn(strings.TrimSpace(scanner.Text()))
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("container events stream closed: %w", err)
+	}
+	return fmt.Errorf("container events stream closed")
+}
+
+// Network contains the subnets of a container network and the addresses in use
+type Network struct {
+	// Subnets of the network in CIDR format
+	Subnets []string
+	// Gateways of the network subnets
+	Gateways []string
+	// Addresses maps the addresses of the containers attached to the network to the container name
+	Addresses map[string]string
+}
+
+// NetworkInspect returns the subnets and the addresses used by containers in the network
+func NetworkInspect(ctx context.Context, name string) (*Network, error) {
+	lines, err := newCommand(ctx, commandTimeout, "network", "inspect",
+		"-f", "{{ json . }}",
+		name,
+	).OutputLines()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network details: %w", err)
+	}
+	if len(lines) != 1 {
+		return nil, fmt.Errorf("network inspect should only be one line, got %d lines", len(lines))
+	}
+
+	type dockerNetwork struct {
+		IPAM struct {
+			Config []struct {
+				Subnet  string
+				Gateway string
+			}
+		}
+		Containers map[string]struct {
+			Name        string
+			IPv4Address string
+			IPv6Address string
+		}
+		// podman
+		Subnets []struct {
+			Subnet  string `json:"subnet"`
+			Gateway string `json:"gateway"`
+		} `json:"subnets"`
+	}
+	var data dockerNetwork
+	if err := json.Unmarshal([]byte(lines[0]), &data); err != nil {
+		return nil, fmt.Errorf("can not parse network details: %w", err)
+	}
+
+	network := &Network{Addresses: map[string]string{}}
+	for _, c := range data.IPAM.Config {
+		network.Subnets = append(network.Subnets, c.Subnet)
+		if c.Gateway != "" {
+			network.Gateways = append(network.Gateways, c.Gateway)
+		}
+	}
+	for _, c := range data.Subnets {
+		network.Subnets = append(network.Subnets, c.Subnet)
+		if c.Gateway != "" {
+			network.Gateways = append(network.Gateways, c.Gateway)
+		}
+	}
+	for _, c := range data.Containers {
+		// addresses are in CIDR format
+		for _, address := range []string{c.IPv4Address, c.IPv6Address} {
+			if address == "" {
+				continue
+			}
+			network.Addresses[strings.Split(address, "/")[0]] = c.Name
+		}
+	}
+	return network, nil
+}
@@ -0,0 +1,138 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+func Test_parseStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    map[string]ResourceUsage
+		wantErr bool
+	}{
+		{
+			name:  "docker",
+			lines: []string{"kindccm-a\t12.50%\t32MiB / 64MiB", "kindccm-b\t0.00%\t1.5GiB / 2GiB"},
+			want: map[string]ResourceUsage{
+				"kindccm-a": {CPU: 0.125, MemoryBytes: 32 << 20},
+				"kindccm-b": {CPU: 0, MemoryBytes: 1.5 * (1 << 30)},
+			},
+		},
+		{
+			name:  "podman",
+			lines: []string{"kindccm-a\t150%\t13.1MB / 67.11MB"},
+			want:  map[string]ResourceUsage{"kindccm-a": {CPU: 1.5, MemoryBytes: 13.1e6}},
+		},
+		{
+			name:  "no stats",
+			lines: []string{"kindccm-a\t--\t-- / --"},
+			want:  map[string]ResourceUsage{},
+		},
+		{
+			name:    "unexpected output",
+			lines:   []string{"kindccm-a 12.50%"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStats(tt.lines)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "moved",
+			want: []string{
+				"network disconnect kind new",
+				"network disconnect kind old",
+				"network connect --ip 172.18.0.10 --ip6 fc00::10 kind new",
+			},
+		},
+		{
+			name: "the addresses are given back",
+			fail: "--ip6 fc00::10 kind new",
+			want: []string{
+				"network disconnect kind new",
+				"network disconnect kind old",
+				"network connect --ip 172.18.0.10 --ip6 fc00::10 kind new",
+				"network connect --ip 172.18.0.10 --ip6 fc00::10 kind old",
+				"network connect kind new",
+			},
+			wantErr: true,
+		},
+		{
+			name: "the old container keeps the addresses",
+			fail: "disconnect kind old",
+			want: []string{
+				"network disconnect kind new",
+				"network disconnect kind old",
+				"network connect kind new",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := containertest.New(t, containertest.FailOn(tt.fail))
+			t.Cleanup(Use(runtime))
+			err := MoveAddresses(context.Background(), "kind", "old", "new", "172.18.0.10", "fc00::10")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MoveAddresses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := runtime.Commands(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MoveAddresses() commands = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPortInUse(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error"},
+		{
+			name: "docker",
+			err:  errors.New("exit status 125: docker: Error response from daemon: driver failed programming external connectivity on endpoint kindccm-lb: Bind for 0.0.0.0:80 failed: port is already allocated."),
+			want: true,
+		},
+		{
+			name: "podman",
+			err:  errors.New("exit status 126: Error: rootlessport listen tcp 0.0.0.0:80: bind: address already in use"),
+			want: true,
+		},
+		{
+			name: "other error",
+			err:  errors.New("exit status 125: Error response from daemon: Conflict. The container name \"/kindccm-lb\" is already in use"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPortInUse(tt.err); got != tt.want {
+				t.Errorf("IsPortInUse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
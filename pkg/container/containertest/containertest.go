@@ -0,0 +1,58 @@
+// Package containertest provides a fake container runtime for the tests, a shell script that
+// answers the container commands. It is used with container.Use:
+//
+//	runtime := containertest.New(t, containertest.FailOn("rm"))
+//	t.Cleanup(container.Use(runtime))
+package containertest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runtime is a fake container runtime that records the arguments of the commands and runs
+// the script with them.
+type Runtime struct {
+	path string
+	log  string
+}
+
+// New writes the script of the fake runtime to a temporary directory of the test, the
+// script gets the arguments of the command and can use the environment of the test.
+func New(t testing.TB, script string) *Runtime {
+	t.Helper()
+	dir := t.TempDir()
+	r := &Runtime{
+		path: filepath.Join(dir, "runtime"),
+		log:  filepath.Join(dir, "commands"),
+	}
+	content := "#!/bin/sh\necho \"$*\" >> " + r.log + "\n" + script + "\n"
+	if err := os.WriteFile(r.path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// FailOn returns a script that fails the commands that contain the text, none if it is empty.
+func FailOn(text string) string {
+	if text == "" {
+		return ""
+	}
+	return "case \"$*\" in *\"" + text + "\"*) exit 1 ;; esac"
+}
+
+func (r *Runtime) Name() string         { return "docker" }
+func (r *Runtime) Command() string      { return r.path }
+func (r *Runtime) HostVariable() string { return "DOCKER_HOST" }
+func (r *Runtime) Available() bool      { return true }
+
+// Commands returns the arguments of the commands the runtime got, one entry per command.
+func (r *Runtime) Commands() []string {
+	data, err := os.ReadFile(r.log)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
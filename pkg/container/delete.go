@@ -0,0 +1,46 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// deleteBackoff bounds the attempts to delete a container to a few seconds
+var deleteBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// DeleteWithRetry deletes the container retrying with backoff if it fails,
+// it returns the last error if the container can not be deleted after all the attempts.
+func DeleteWithRetry(ctx context.Context, name string) error {
+	return deleteWithRetry(ctx, name, Delete, deleteBackoff)
+}
+
+func deleteWithRetry(ctx context.Context, name string, deleteFn func(context.Context, string) error, backoff wait.Backoff) error {
+	var lastErr error
+	attempts := 0
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		attempts++
+		lastErr = deleteFn(ctx, name)
+		if lastErr != nil {
+			klog.V(2).Infof("error deleting container %s, attempt %d: %v", name, attempts, lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		// the context was done before the first attempt
+		if lastErr == nil {
+			lastErr = err
+		}
+		return fmt.Errorf("failed to delete container %s after %d attempts: %w", name, attempts, lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// fakeDeleter fails the first failures deletes
+type fakeDeleter struct {
+	failures int
+	calls    int
+}
+
+func (f *fakeDeleter) Delete(ctx context.Context, name string) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("container is in use")
+	}
+	return nil
+}
+
+func Test_deleteWithRetry(t *testing.T) {
+	backoff := wait.Backoff{Steps: 3}
+	tests := []struct {
+		name      string
+		failures  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "first attempt succeeds",
+			wantCalls: 1,
+		},
+		{
+			name:      "succeeds after failures",
+			failures:  2,
+			wantCalls: 3,
+		},
+		{
+			name:      "gives up after all the attempts",
+			failures:  5,
+			wantErr:   true,
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeDeleter{failures: tt.failures}
+			err := deleteWithRetry(context.Background(), "kindccm-test", f.Delete, backoff)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("deleteWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if f.calls != tt.wantCalls {
+				t.Errorf("deleteWithRetry() calls = %d, want %d", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
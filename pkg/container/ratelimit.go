@@ -0,0 +1,77 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// limiter throttles the operations that create, delete or attach containers so a burst
+// of Services does not overload the container runtime, nil means unlimited.
+var limiter *scopedLimiter
+
+// scopeKey is the context key of the rate limit scope of the container operations
+type scopeKey struct{}
+
+// WithScope returns a context whose container operations are rate limited apart from the
+// operations of other scopes, so a burst of operations of a cluster does not delay the
+// operations of the other clusters.
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// scopeFromContext returns the rate limit scope of the context, empty if it has none
+func scopeFromContext(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeKey{}).(string)
+	return scope
+}
+
+// scopedLimiter has a token bucket for each scope, created the first time it is used
+type scopedLimiter struct {
+	qps   float32
+	burst int
+
+	// mu protects limiters, it is not held while waiting so the scopes do not block each other
+	mu       sync.Mutex
+	limiters map[string]flowcontrol.RateLimiter
+}
+
+func (l *scopedLimiter) get(scope string) flowcontrol.RateLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.limiters[scope]
+	if !ok {
+		r = flowcontrol.NewTokenBucketRateLimiter(l.qps, l.burst)
+		l.limiters[scope] = r
+	}
+	return r
+}
+
+// SetRateLimit limits the container create, delete and network operations of each scope
+// to qps per second with bursts of up to burst operations, zero qps disables the limit.
+// It must be called before any container operation.
+func SetRateLimit(qps float32, burst int) error {
+	if qps < 0 || burst < 0 {
+		return fmt.Errorf("invalid rate limit %v qps and %d burst, must not be negative", qps, burst)
+	}
+	if qps == 0 {
+		limiter = nil
+		return nil
+	}
+	if burst < 1 {
+		return fmt.Errorf("invalid rate limit burst %d, must be at least 1", burst)
+	}
+	limiter = &scopedLimiter{qps: qps, burst: burst, limiters: map[string]flowcontrol.RateLimiter{}}
+	return nil
+}
+
+// waitRateLimit blocks until the rate limiter of the context scope allows the next
+// operation or the context is done
+func waitRateLimit(ctx context.Context) error {
+	if limiter == nil {
+		return nil
+	}
+	return limiter.get(scopeFromContext(ctx)).Wait(ctx)
+}
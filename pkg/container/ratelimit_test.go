@@ -0,0 +1,116 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+func TestSetRateLimit(t *testing.T) {
+	defer func() { limiter = nil }()
+
+	for _, tt := range []struct {
+		qps     float32
+		burst   int
+		wantErr bool
+	}{
+		{qps: 0, burst: 0},
+		{qps: 5, burst: 10},
+		{qps: -1, burst: 1, wantErr: true},
+		{qps: 5, burst: -1, wantErr: true},
+		{qps: 5, burst: 0, wantErr: true},
+	} {
+		if err := SetRateLimit(tt.qps, tt.burst); (err != nil) != tt.wantErr {
+			t.Errorf("SetRateLimit(%v, %d) error = %v, wantErr %v", tt.qps, tt.burst, err, tt.wantErr)
+		}
+	}
+
+	if err := SetRateLimit(0, 0); err != nil || limiter != nil {
+		t.Fatalf("expected zero qps to disable the limiter, got %v", err)
+	}
+	// unlimited does not block
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		waitRateLimit(context.Background()) // nolint:errcheck
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected no throttling without limit, took %v", elapsed)
+	}
+
+	if err := SetRateLimit(20, 1); err != nil {
+		t.Fatal(err)
+	}
+	// the first operation uses the burst, the next ones wait 50ms each
+	start = time.Now()
+	for i := 0; i < 4; i++ {
+		waitRateLimit(context.Background()) // nolint:errcheck
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the operations to be throttled, took %v", elapsed)
+	}
+
+	// a cancelled operation does not wait for its turn
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitRateLimit(ctx); err == nil {
+		t.Errorf("expected the wait to fail with a cancelled context")
+	}
+}
+
+func TestRateLimitScopes(t *testing.T) {
+	defer func() { limiter = nil }()
+	if err := SetRateLimit(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	slow, fast := WithScope(context.Background(), "slow"), WithScope(context.Background(), "fast")
+	// the slow scope uses its burst, its next operation waits a second
+	if err := waitRateLimit(slow); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		waitRateLimit(slow) // nolint:errcheck
+	}()
+	start := time.Now()
+	if err := waitRateLimit(fast); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the other scope not to be throttled, took %v", elapsed)
+	}
+	<-done
+}
+
+func TestSlowScopeDoesNotBlockOthers(t *testing.T) {
+	defer func() { limiter = nil }()
+	if err := SetRateLimit(100, 10); err != nil {
+		t.Fatal(err)
+	}
+	// the runtime takes seconds to answer the commands of the containers of the slow cluster
+	defer Use(containertest.New(t, "case \"$*\" in *slow*) sleep 3 ;; esac"))()
+
+	slow, fast := WithScope(context.Background(), "slow"), WithScope(context.Background(), "fast")
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Restart(slow, fmt.Sprintf("slow-lb-%d", i)) // nolint:errcheck
+		}(i)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := Restart(fast, fmt.Sprintf("fast-lb-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the operations of the other cluster to complete while the slow ones run, took %v", elapsed)
+	}
+	wg.Wait()
+}
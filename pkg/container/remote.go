@@ -0,0 +1,51 @@
+package container
+
+import (
+	"net/netip"
+	"net/url"
+	"os"
+)
+
+// The container runtime commands run with the environment of cloud-provider-kind, so the
+// DOCKER_HOST, DOCKER_TLS_VERIFY, DOCKER_CERT_PATH and CONTAINER_HOST variables apply to
+// them the same as to the commands KIND runs.
+
+// RemoteHost returns the host of the container runtime daemon if it runs on another machine,
+// per example with DOCKER_HOST=tcp://ci-docker:2376, empty if it runs on this host.
+func RemoteHost() string {
+	return remoteHost(os.Getenv(current.HostVariable()))
+}
+
+// remoteHost returns the host of the daemon address if it is not on this host
+func remoteHost(daemon string) string {
+	if daemon == "" {
+		return ""
+	}
+	u, err := url.Parse(daemon)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "tcp", "ssh", "http", "https":
+	default:
+		// unix sockets and named pipes are local
+		return ""
+	}
+	host := u.Hostname()
+	if host == "" || host == "localhost" {
+		return ""
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && (addr.IsLoopback() || addr.IsUnspecified()) {
+		return ""
+	}
+	return host
+}
+
+// PublishedHost returns the host to connect to the ports the containers publish on the host,
+// the host of a remote container runtime or the loopback address.
+func PublishedHost() string {
+	if host := RemoteHost(); host != "" {
+		return host
+	}
+	return "127.0.0.1"
+}
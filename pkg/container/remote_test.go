@@ -0,0 +1,49 @@
+package container
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+func Test_remoteHost(t *testing.T) {
+	tests := []struct {
+		daemon string
+		want   string
+	}{
+		{daemon: "", want: ""},
+		{daemon: "unix:///var/run/docker.sock", want: ""},
+		{daemon: "npipe:////./pipe/docker_engine", want: ""},
+		{daemon: "tcp://127.0.0.1:2375", want: ""},
+		{daemon: "tcp://localhost:2375", want: ""},
+		{daemon: "tcp://[::1]:2375", want: ""},
+		{daemon: "tcp://ci-docker:2376", want: "ci-docker"},
+		{daemon: "tcp://10.0.0.5:2376", want: "10.0.0.5"},
+		{daemon: "ssh://user@builder.example.com", want: "builder.example.com"},
+	}
+	for _, tt := range tests {
+		if got := remoteHost(tt.daemon); got != tt.want {
+			t.Errorf("remoteHost(%q) = %q, want %q", tt.daemon, got, tt.want)
+		}
+	}
+}
+
+func TestCommandsUseTheDaemonEnvironment(t *testing.T) {
+	defer Use(containertest.New(t, "echo \"$DOCKER_HOST $DOCKER_TLS_VERIFY $DOCKER_CERT_PATH\""))()
+	t.Setenv("DOCKER_HOST", "tcp://ci-docker:2376")
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+	t.Setenv("DOCKER_CERT_PATH", "/certs")
+
+	output, err := newCommand(context.Background(), commandTimeout, "info").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "tcp://ci-docker:2376 1 /certs" {
+		t.Errorf("the container runtime commands got the environment %q", got)
+	}
+	if got := PublishedHost(); got != "ci-docker" {
+		t.Errorf("PublishedHost() = %q, want the remote host", got)
+	}
+}
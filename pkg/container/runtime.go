@@ -0,0 +1,101 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Engine is a container runtime, the container commands run with its command line interface.
+type Engine interface {
+	// Name returns the name of the runtime, per example docker
+	Name() string
+	// Command returns the name or the path of the command of the runtime
+	Command() string
+	// HostVariable returns the environment variable with the address of the daemon
+	HostVariable() string
+	// Available returns true if the runtime is installed on the host
+	Available() bool
+}
+
+// docker is the Docker runtime
+type docker struct{}
+
+func (docker) Name() string         { return "docker" }
+func (docker) Command() string      { return "docker" }
+func (docker) HostVariable() string { return "DOCKER_HOST" }
+
+func (docker) Available() bool {
+	lines, err := runtimeVersion("docker")
+	if err != nil || len(lines) != 1 {
+		return false
+	}
+	return strings.HasPrefix(lines[0], "Docker version")
+}
+
+// podman is the Podman runtime, its command line interface is compatible with the Docker one
+type podman struct{}
+
+func (podman) Name() string         { return "podman" }
+func (podman) Command() string      { return "podman" }
+func (podman) HostVariable() string { return "CONTAINER_HOST" }
+
+func (podman) Available() bool {
+	lines, err := runtimeVersion("podman")
+	if err != nil || len(lines) != 1 {
+		return false
+	}
+	return strings.HasPrefix(lines[0], "podman version")
+}
+
+// runtimes are the supported runtimes, in the order they are autodetected
+var runtimes = []Engine{docker{}, podman{}}
+
+// current is the runtime the container commands use
+// TODO we can do it as in KIND
+var current Engine = docker{}
+
+// runtimeVersion returns the lines of the version of the runtime
+func runtimeVersion(runtime string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, runtime, "-v").Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(output)), "\n"), nil
+}
+
+func init() {
+	for _, r := range runtimes {
+		if r.Available() {
+			current = r
+			return
+		}
+	}
+}
+
+// SetRuntime overrides the container runtime autodetected, supported values are docker and podman.
+func SetRuntime(name string) error {
+	for _, r := range runtimes {
+		if r.Name() == name {
+			current = r
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported container runtime %q, only docker and podman are supported", name)
+}
+
+// Use replaces the container runtime, per example with a fake one in the tests, and
+// returns a function that restores the previous one.
+func Use(engine Engine) (restore func()) {
+	previous := current
+	current = engine
+	return func() { current = previous }
+}
+
+// Runtime returns the name of the container runtime in use.
+func Runtime() string {
+	return current.Name()
+}
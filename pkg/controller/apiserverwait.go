@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// apiserverBackoff is the backoff between the health checks of the apiserver of a cluster
+// that is starting, the checks are frequent at first and the interval grows up to the cap
+// so a slow apiserver is not hammered, the jitter spreads the checks of the clusters. The
+// steps are not limited, the wait is bounded by its timeout.
+var apiserverBackoff = wait.Backoff{
+	Duration: 250 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.2,
+	Cap:      4 * time.Second,
+	Steps:    math.MaxInt32,
+}
+
+// waitForAPIServer checks the apiserver with the backoff until it is healthy, it fails if it
+// is not healthy after the timeout or the context is done.
+func waitForAPIServer(ctx context.Context, timeout time.Duration, backoff wait.Backoff, healthy func(ctx context.Context) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	attempts := 0
+	err := backoff.DelayFunc().Until(ctx, true, false, func(ctx context.Context) (bool, error) {
+		attempts++
+		return healthy(ctx), nil
+	})
+	if err != nil {
+		return fmt.Errorf("apiserver not healthy after %v and %d attempts: %w", timeout, attempts, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func Test_waitForAPIServer(t *testing.T) {
+	backoff := wait.Backoff{Duration: 10 * time.Millisecond, Factor: 2, Jitter: 0.2, Cap: 40 * time.Millisecond, Steps: math.MaxInt32}
+
+	// the apiserver becomes healthy after a few checks
+	checks := 0
+	err := waitForAPIServer(context.Background(), time.Second, backoff, func(ctx context.Context) bool {
+		checks++
+		return checks == 4
+	})
+	if err != nil || checks != 4 {
+		t.Errorf("waitForAPIServer() = %v after %d checks, want success after 4", err, checks)
+	}
+
+	// the interval grows up to the cap, the checks do not hammer a slow apiserver
+	checks = 0
+	start := time.Now()
+	err = waitForAPIServer(context.Background(), 300*time.Millisecond, backoff, func(ctx context.Context) bool {
+		checks++
+		return false
+	})
+	if err == nil {
+		t.Fatalf("waitForAPIServer() expected to fail after the timeout")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > time.Second {
+		t.Errorf("waitForAPIServer() returned after %v, want the timeout", elapsed)
+	}
+	// 10+20+40 ms and then every 40ms, about 9 checks in 300ms, 30 with a fixed 10ms interval
+	if checks < 4 || checks > 12 {
+		t.Errorf("waitForAPIServer() checked %d times in 300ms, expected the backoff to space the checks", checks)
+	}
+
+	// a cancelled context stops the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitForAPIServer(ctx, time.Second, backoff, func(ctx context.Context) bool { return false }); err == nil {
+		t.Errorf("waitForAPIServer() expected to fail with a cancelled context")
+	}
+}
+
+func Test_waitForAPIServerCancellation(t *testing.T) {
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Cap: 4 * time.Second, Steps: math.MaxInt32}
+
+	// the first check is immediate, it does not wait for the first interval
+	start := time.Now()
+	if err := waitForAPIServer(context.Background(), time.Minute, backoff, func(ctx context.Context) bool { return true }); err != nil {
+		t.Fatalf("waitForAPIServer() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the first check to be immediate, took %v", elapsed)
+	}
+
+	// cancelling the context while waiting between checks returns without waiting for the next one
+	ctx, cancel := context.WithCancel(context.Background())
+	checks := 0
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	err := waitForAPIServer(ctx, time.Minute, backoff, func(ctx context.Context) bool {
+		checks++
+		return false
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("waitForAPIServer() error = %v, want the context cancellation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the wait to return promptly on cancellation, took %v", elapsed)
+	}
+	if checks != 1 {
+		t.Errorf("expected a single check before the cancellation, got %d", checks)
+	}
+}
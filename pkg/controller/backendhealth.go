@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+// backendHealthInterval is the interval between the checks of the health of the loadbalancer backends
+const backendHealthInterval = 10 * time.Second
+
+type loadBalancerStatusGate interface {
+	GateLoadBalancerStatus(ctx context.Context, clusterName string, service *v1.Service) error
+}
+
+// gateLoadBalancerStatuses withdraws the status of the loadbalancers of the cluster without healthy
+// backends and reports it again when they recover.
+func gateLoadBalancerStatuses(ctx context.Context, clusterName string, services corelisters.ServiceLister, lb loadBalancerStatusGate) {
+	list, err := services.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Can not list Services", "cluster", clusterName)
+		return
+	}
+	for _, service := range list {
+		// the disabled loadbalancers do not run health checks
+		if !wantsLoadBalancer(service, config.DefaultConfig.LoadBalancerClass) || service.DeletionTimestamp != nil ||
+			loadbalancer.LoadBalancerDisabled(service) {
+			continue
+		}
+		// the loadbalancers that are not created yet fail, the service controller creates them
+		if err := lb.GateLoadBalancerStatus(ctx, clusterName, service); err != nil {
+			klog.V(2).InfoS("Error checking the loadbalancer backends", "cluster", clusterName, "service", klog.KObj(service), "err", err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// clientCheckInterval is the interval between the checks of the kube client of a cluster
+	clientCheckInterval = 10 * time.Second
+	// clientFailureTimeout is the time the kube client of a cluster can fail before the
+	// cloud controller manager is restarted with a new client.
+	clientFailureTimeout = time.Minute
+)
+
+// clientMonitor detects that the kube client of a cluster no longer works, per example
+// because the cluster was recreated with the same name or the apiserver certificates
+// changed, the watch errors of the informers trigger a probe of the apiserver and the
+// client is considered broken if the probes keep failing for longer than the timeout.
+type clientMonitor struct {
+	clusterName string
+	probe       func(ctx context.Context) bool
+	clock       clock.Clock
+	timeout     time.Duration
+
+	mu sync.Mutex
+	// watchErrors is the number of watch errors since the last check
+	watchErrors int
+	// failingSince is the time of the first failed probe, zero if the last probe succeeded
+	failingSince time.Time
+}
+
+func newClientMonitor(clusterName string, kubeClient kubernetes.Interface) *clientMonitor {
+	client := kubeClient.Discovery().RESTClient()
+	return &clientMonitor{
+		clusterName: clusterName,
+		probe: func(ctx context.Context) bool {
+			healthStatus := 0
+			client.Get().AbsPath("/healthz").Do(ctx).StatusCode(&healthStatus)
+			return healthStatus == http.StatusOK
+		},
+		clock:   clock.RealClock{},
+		timeout: clientFailureTimeout,
+	}
+}
+
+// watchErrorHandler is the cache.WatchErrorHandler of the informers of the cluster
+func (m *clientMonitor) watchErrorHandler(r *cache.Reflector, err error) {
+	cache.DefaultWatchErrorHandler(r, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchErrors++
+}
+
+// check returns false if the client has been failing for longer than the timeout,
+// the apiserver is only probed if there were watch errors since the last check or
+// the previous probe failed.
+func (m *clientMonitor) check(ctx context.Context) bool {
+	m.mu.Lock()
+	watchErrors := m.watchErrors
+	m.watchErrors = 0
+	m.mu.Unlock()
+	// the reflectors back off between the retries so a failing client may not report errors in every check
+	if watchErrors == 0 && m.failingSince.IsZero() {
+		return true
+	}
+
+	if m.probe(ctx) {
+		m.failingSince = time.Time{}
+		return true
+	}
+	now := m.clock.Now()
+	if m.failingSince.IsZero() {
+		m.failingSince = now
+	}
+	klog.V(2).InfoS("Kube client is failing", "cluster", m.clusterName, "watchErrors", watchErrors, "since", m.failingSince)
+	return now.Sub(m.failingSince) < m.timeout
+}
+
+// run checks the client periodically and calls onFailure once when it is broken
+func (m *clientMonitor) run(ctx context.Context, onFailure func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if !m.check(ctx) {
+			klog.InfoS("Kube client is not working, restarting the cloud controller", "cluster", m.clusterName, "failingSince", m.failingSince)
+			onFailure()
+			cancel()
+		}
+	}, clientCheckInterval)
+}
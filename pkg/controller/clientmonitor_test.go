@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestClientMonitor(t *testing.T) {
+	ctx := context.Background()
+	clock := clocktesting.NewFakeClock(time.Now())
+	healthy := true
+	probes := 0
+	m := &clientMonitor{
+		clusterName: "test",
+		probe: func(ctx context.Context) bool {
+			probes++
+			return healthy
+		},
+		clock:   clock,
+		timeout: time.Minute,
+	}
+	r := cache.NewNamedReflector("test", &cache.ListWatch{}, &v1.Node{}, cache.NewStore(cache.MetaNamespaceKeyFunc), 0)
+
+	// no watch errors, the apiserver is not probed
+	if !m.check(ctx) || probes != 0 {
+		t.Fatalf("expected the client to be healthy without probing, probes %d", probes)
+	}
+
+	// a watch error with a healthy apiserver
+	m.watchErrorHandler(r, errors.New("connection refused"))
+	if !m.check(ctx) || probes != 1 {
+		t.Fatalf("expected the client to be healthy after probing, probes %d", probes)
+	}
+
+	// the apiserver starts failing
+	healthy = false
+	m.watchErrorHandler(r, errors.New("connection refused"))
+	if !m.check(ctx) {
+		t.Fatalf("expected the client to be considered healthy before the timeout")
+	}
+	clock.Step(30 * time.Second)
+	// the reflectors back off, the apiserver is probed without new watch errors
+	if !m.check(ctx) || probes != 3 {
+		t.Fatalf("expected the client to be considered healthy before the timeout")
+	}
+	clock.Step(31 * time.Second)
+	m.watchErrorHandler(r, errors.New("x509: certificate signed by unknown authority"))
+	if m.check(ctx) {
+		t.Fatalf("expected the client to be broken after the timeout")
+	}
+
+	// it recovers
+	healthy = true
+	m.watchErrorHandler(r, errors.New("connection refused"))
+	if !m.check(ctx) {
+		t.Fatalf("expected the client to be healthy after recovering")
+	}
+	clock.Step(2 * time.Minute)
+	healthy = false
+	m.watchErrorHandler(r, errors.New("connection refused"))
+	if !m.check(ctx) {
+		t.Fatalf("expected the failure time to be reset after recovering")
+	}
+}
@@ -0,0 +1,40 @@
+package controller
+
+import "sort"
+
+// getCluster returns the cloud controller manager of the cluster
+func (c *Controller) getCluster(name string) (*ccm, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ccm, ok := c.clusters[name]
+	return ccm, ok
+}
+
+// addCluster stores the cloud controller manager of the cluster
+func (c *Controller) addCluster(name string, ccm *ccm) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clusters[name] = ccm
+}
+
+// removeCluster removes the cloud controller manager of the cluster and returns it,
+// the caller is responsible for stopping it.
+func (c *Controller) removeCluster(name string) (*ccm, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ccm, ok := c.clusters[name]
+	delete(c.clusters, name)
+	return ccm, ok
+}
+
+// clusterNames returns the sorted names of the clusters with a cloud controller manager
+func (c *Controller) clusterNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.clusters))
+	for name := range c.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+func TestControllerClusters(t *testing.T) {
+	c := &Controller{clusters: map[string]*ccm{}}
+	c.addCluster("b", &ccm{})
+	c.addCluster("a", &ccm{})
+	if _, ok := c.getCluster("a"); !ok {
+		t.Errorf("expected cluster a to exist")
+	}
+	if got := c.clusterNames(); fmt.Sprint(got) != "[a b]" {
+		t.Errorf("clusterNames() = %v, want [a b]", got)
+	}
+	if _, ok := c.removeCluster("a"); !ok {
+		t.Errorf("expected cluster a to be removed")
+	}
+	if _, ok := c.removeCluster("a"); ok {
+		t.Errorf("expected cluster a to not exist")
+	}
+	if _, ok := c.getCluster("a"); ok {
+		t.Errorf("expected cluster a to not exist")
+	}
+}
+
+// TestControllerClustersConcurrentAccess must be run with the race detector
+func TestControllerClustersConcurrentAccess(t *testing.T) {
+	c := &Controller{clusters: map[string]*ccm{}}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("cluster-%d", i%3)
+			for j := 0; j < 100; j++ {
+				switch j % 4 {
+				case 0:
+					c.addCluster(name, &ccm{})
+				case 1:
+					c.getCluster(name)
+				case 2:
+					c.clusterNames()
+				case 3:
+					c.removeCluster(name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func Test_limitClusters(t *testing.T) {
+	running := map[string]bool{"d": true}
+	managed := func(cluster string) bool { return running[cluster] }
+	tests := []struct {
+		name        string
+		clusters    []string
+		limit       int
+		wantKept    []string
+		wantSkipped []string
+	}{
+		{name: "no limit", clusters: []string{"c", "a", "d"}, wantKept: []string{"c", "a", "d"}},
+		{name: "under the limit", clusters: []string{"c", "a"}, limit: 2, wantKept: []string{"c", "a"}},
+		{name: "by name", clusters: []string{"c", "b", "a"}, limit: 2, wantKept: []string{"a", "b"}, wantSkipped: []string{"c"}},
+		{name: "managed first", clusters: []string{"c", "b", "a", "d"}, limit: 2, wantKept: []string{"d", "a"}, wantSkipped: []string{"b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped := limitClusters(tt.clusters, tt.limit, managed)
+			if fmt.Sprint(kept) != fmt.Sprint(tt.wantKept) || fmt.Sprint(skipped) != fmt.Sprint(tt.wantSkipped) {
+				t.Errorf("limitClusters() = %v, %v, want %v, %v", kept, skipped, tt.wantKept, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestControllerManagedClustersMaxClusters(t *testing.T) {
+	old := cpkconfig.DefaultConfig.MaxClusters
+	defer func() { cpkconfig.DefaultConfig.MaxClusters = old }()
+	cpkconfig.DefaultConfig.MaxClusters = 1
+
+	c := &Controller{clusters: map[string]*ccm{}}
+	c.addCluster("b", &ccm{})
+	if got := c.managedClusters([]string{"a", "b"}); fmt.Sprint(got) != "[b]" {
+		t.Errorf("managedClusters() = %v, want the managed cluster [b]", got)
+	}
+	if fmt.Sprint(c.skippedClusters) != "[a]" {
+		t.Errorf("skippedClusters = %v, want [a]", c.skippedClusters)
+	}
+	// the skipped cluster is picked up when the managed one is deleted
+	c.removeCluster("b")
+	if got := c.managedClusters([]string{"a"}); fmt.Sprint(got) != "[a]" {
+		t.Errorf("managedClusters() = %v, want [a]", got)
+	}
+	if len(c.skippedClusters) != 0 {
+		t.Errorf("skippedClusters = %v, want none", c.skippedClusters)
+	}
+}
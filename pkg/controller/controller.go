@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -14,9 +17,13 @@ import (
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 	cloudprovider "k8s.io/cloud-provider"
 	nodecontroller "k8s.io/cloud-provider/controllers/node"
+	nodelifecyclecontroller "k8s.io/cloud-provider/controllers/nodelifecycle"
 	servicecontroller "k8s.io/cloud-provider/controllers/service"
 	controllersmetrics "k8s.io/component-base/metrics/prometheus/controllers"
 	ccmfeatures "k8s.io/controller-manager/pkg/features"
@@ -25,115 +32,413 @@ import (
 	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
 	"sigs.k8s.io/cloud-provider-kind/pkg/container"
 	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+	"sigs.k8s.io/cloud-provider-kind/pkg/metrics"
 	"sigs.k8s.io/cloud-provider-kind/pkg/provider"
 	"sigs.k8s.io/kind/pkg/cluster"
 )
 
 var once sync.Once
 
+// defaultClusterResyncInterval is the default interval between the scans of the KIND clusters
+const defaultClusterResyncInterval = 30 * time.Second
+
+const (
+	// probeTimeout is the time the apiserver of a cluster has to answer the probes
+	probeTimeout = 5 * time.Second
+	// probeIdleConnTimeout closes the probe connections not reused, the probes only run while
+	// the clusters are added
+	probeIdleConnTimeout = 30 * time.Second
+)
+
+const (
+	// defaultInformerResyncPeriod is the default resync period of the informers
+	defaultInformerResyncPeriod = 60 * time.Second
+	// defaultNodeSyncPeriod is the default period the node controller updates the Nodes
+	defaultNodeSyncPeriod = 30 * time.Second
+	// defaultConcurrentServiceSyncs is the default number of workers of the service controller
+	defaultConcurrentServiceSyncs = 5
+	// defaultConcurrentClusterSyncs is the default number of clusters started concurrently
+	defaultConcurrentClusterSyncs = 5
+	// defaultAPIServerWaitTimeout is the time to wait for the apiserver of a cluster to be healthy
+	defaultAPIServerWaitTimeout = 30 * time.Second
+)
+
+const (
+	// clusterBackoffInitial and clusterBackoffMax bound the time between the attempts
+	// to start the cloud controller manager of a cluster that is failing
+	clusterBackoffInitial = 10 * time.Second
+	clusterBackoffMax     = 10 * time.Minute
+	// clusterDegradedThreshold is the number of consecutive failures to consider a cluster degraded
+	clusterDegradedThreshold = 3
+)
+
 type Controller struct {
-	kind     *cluster.Provider
+	kind *cluster.Provider
+	// kindCache caches the clusters and kubeconfigs obtained from kind
+	kindCache *kindCache
+	// mu protects clusters, use the accessor methods
+	mu       sync.RWMutex
 	clusters map[string]*ccm
+	// resyncInterval is the interval between the scans of the KIND clusters
+	resyncInterval time.Duration
+	// ready is true once the cloud controller manager of a cluster has started
+	ready atomic.Bool
+	// backoff delays the attempts to start the cloud controller manager of the failing clusters
+	backoff *flowcontrol.Backoff
+	// failuresMu protects failures
+	failuresMu sync.Mutex
+	// failures is the number of consecutive failures to start the cloud controller manager of a cluster
+	failures map[string]int
+	// workers is the number of clusters started concurrently
+	workers int
+	// fingerprint identifies a cluster so it can be detected when it is recreated with the same name
+	fingerprint func(cluster string) (string, error)
+	// probeClients check if the apiservers of the clusters are reachable
+	probeClients *probeClients
+	// skippedClusters are the clusters not managed because of the maximum number of clusters,
+	// it is only used by syncClusters
+	skippedClusters []string
 }
 
 type ccm struct {
 	factory           informers.SharedInformerFactory
 	serviceController *servicecontroller.Controller
 	nodeController    *nodecontroller.CloudNodeController
-	cancelFn          context.CancelFunc
+	cloud             cloudprovider.Interface
+	// fingerprint of the cluster when the controllers were started, empty if unknown
+	fingerprint string
+	// stopCh is closed when the controllers are stopped, per example
+	// if the leader election is lost.
+	stopCh <-chan struct{}
+	// stopFn stops the controllers keeping the resources of the cluster, so they are restarted
+	// without interrupting the loadbalancers
+	stopFn func()
+	// cancelFn stops the controllers and deletes the resources of the cluster
+	cancelFn func()
+	// shutdownFn stops the controllers and drains the loadbalancers before deleting the
+	// resources of the cluster, it is used on exit
+	shutdownFn func()
+}
+
+// stopped returns true if the controllers of the ccm are not running.
+func (c *ccm) stopped() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
 }
 
 func New(provider *cluster.Provider) *Controller {
 	controllersmetrics.Register()
-	return &Controller{
-		kind:     provider,
-		clusters: make(map[string]*ccm),
+	metrics.Register()
+	resyncInterval := cpkconfig.DefaultConfig.ClusterResyncInterval
+	if resyncInterval == 0 {
+		resyncInterval = defaultClusterResyncInterval
+	}
+	workers := cpkconfig.DefaultConfig.ConcurrentClusterSyncs
+	if workers < 1 {
+		workers = defaultConcurrentClusterSyncs
+	}
+	c := &Controller{
+		kind:           provider,
+		kindCache:      newKindCache(provider, kindCacheTTL),
+		clusters:       make(map[string]*ccm),
+		resyncInterval: resyncInterval,
+		backoff:        flowcontrol.NewBackOff(clusterBackoffInitial, clusterBackoffMax),
+		failures:       make(map[string]int),
+		workers:        workers,
+		probeClients:   newProbeClients(),
 	}
+	c.fingerprint = c.clusterFingerprint
+	return c
 }
 
 func (c *Controller) Run(ctx context.Context) {
 	defer c.cleanup()
+	if address := cpkconfig.DefaultConfig.HealthzBindAddress; address != "" {
+		go c.serveHealthz(ctx, address)
+	}
+	if address := cpkconfig.DefaultConfig.MetricsBindAddress; address != "" {
+		go serveMetrics(ctx, address)
+	}
+	// pull the loadbalancer image in advance so the first Service does not wait for it
+	go func() {
+		if cpkconfig.DefaultConfig.DryRun || !controllerEnabled(ServiceControllerName) {
+			return
+		}
+		if err := loadbalancer.PullImage(ctx); err != nil && ctx.Err() == nil {
+			klog.ErrorS(err, "Failed to pull the loadbalancer image")
+		}
+	}()
+	// the container events trigger a resync of the clusters as soon as
+	// the KIND clusters are created or deleted, polling periodically is
+	// kept as a fallback in case some event is missed.
+	eventCh := make(chan struct{}, 1)
+	go c.watchClusterEvents(ctx, eventCh)
 	for {
-		// get existing kind clusters
-		clusters, err := c.kind.List()
-		if err != nil {
-			klog.Infof("error listing clusters, retrying ...: %v", err)
+		c.syncClusters(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-eventCh:
+			klog.V(3).InfoS("Resyncing clusters after container event")
+		// add some jitter so multiple instances don't hit the container runtime at the same time
+		case <-time.After(wait.Jitter(c.resyncInterval, 0.1)):
 		}
+	}
+}
 
-		// add new ones
-		for _, cluster := range clusters {
+// watchClusterEvents notifies on the channel when a KIND node container is
+// started or removed. It reconnects if the event stream is interrupted.
+func (c *Controller) watchClusterEvents(ctx context.Context, eventCh chan<- struct{}) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		// events may have been missed while the stream was not connected
+		c.kindCache.invalidate()
+		err := container.Events(ctx, constants.KindClusterLabelKey, func(name string) {
+			klog.V(3).InfoS("Received event for KIND node", "node", name)
+			c.kindCache.invalidate()
+			// coalesce the events, one pending resync is enough
 			select {
-			case <-ctx.Done():
-				return
+			case eventCh <- struct{}{}:
 			default:
 			}
+		})
+		if err != nil && ctx.Err() == nil {
+			klog.InfoS("Error watching container events, reconnecting", "err", err)
+		}
+	}, 5*time.Second)
+}
 
-			klog.V(3).Infof("processing cluster %s", cluster)
-			_, ok := c.clusters[cluster]
-			if ok {
-				klog.V(3).Infof("cluster %s already exist", cluster)
-				continue
-			}
+// syncClusters starts a cloud controller manager for the new KIND clusters
+// and stops the ones of the clusters that no longer exist.
+func (c *Controller) syncClusters(ctx context.Context) {
+	// get existing kind clusters
+	clusters, err := c.kindCache.List()
+	if err != nil {
+		klog.InfoS("Error listing clusters, retrying", "err", err)
+		// do not delete the existing clusters if we can not list them
+		return
+	}
 
-			kubeClient, err := c.getKubeClient(ctx, cluster)
-			if err != nil {
-				klog.Errorf("Failed to create kubeClient for cluster %s: %v", cluster, err)
-				continue
+	clusters = c.managedClusters(clusters)
+
+	// start the new ones concurrently so the unreachable clusters do not block the others
+	pending := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cluster := range pending {
+				c.startCluster(ctx, cluster)
 			}
+		}()
+	}
+	for _, cluster := range c.clustersToStart(clusters) {
+		select {
+		case <-ctx.Done():
+		case pending <- cluster:
+		}
+	}
+	close(pending)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
 
-			klog.V(2).Infof("Creating new cloud provider for cluster %s", cluster)
-			cloud := provider.New(cluster, c.kind)
-			ccm, err := startCloudControllerManager(ctx, cluster, kubeClient, cloud)
-			if err != nil {
-				klog.Errorf("Failed to start cloud controller for cluster %s: %v", cluster, err)
+	// remove expired ones
+	clusterSet := sets.New(clusters...)
+	c.failuresMu.Lock()
+	for cluster := range c.failures {
+		if !clusterSet.Has(cluster) {
+			c.backoff.Reset(cluster)
+			delete(c.failures, cluster)
+			metrics.ClusterDegraded.DeleteLabelValues(cluster)
+		}
+	}
+	c.failuresMu.Unlock()
+	for _, cluster := range c.clusterNames() {
+		if clusterSet.Has(cluster) {
+			continue
+		}
+		if ccm, ok := c.removeCluster(cluster); ok {
+			klog.InfoS("Deleting resources", "cluster", cluster)
+			ccm.cancelFn()
+		}
+	}
+}
+
+// clustersToStart returns the clusters that do not have a cloud controller manager running
+// and are not backing off, the stopped cloud controller managers are removed so they are restarted.
+func (c *Controller) clustersToStart(clusters []string) []string {
+	result := []string{}
+	for _, cluster := range clusters {
+		klog.V(3).InfoS("Processing cluster", "cluster", cluster)
+		if existing, ok := c.getCluster(cluster); ok {
+			if existing.stopped() {
+				// the client stopped working or the leadership was lost, the loadbalancers are kept
+				klog.InfoS("Cloud controller is stopped, restarting it", "cluster", cluster)
+				existing.stopFn()
+			} else if c.recreated(cluster, existing) {
+				klog.InfoS("Cluster was recreated, restarting the cloud controller", "cluster", cluster)
+				existing.cancelFn()
+			} else {
+				klog.V(3).InfoS("Cluster already exists", "cluster", cluster)
 				continue
 			}
-			klog.Infof("Starting cloud controller for cluster %s", cluster)
-			c.clusters[cluster] = ccm
-		}
-		// remove expired ones
-		clusterSet := sets.New(clusters...)
-		for cluster, ccm := range c.clusters {
-			_, ok := clusterSet[cluster]
-			if !ok {
-				klog.Infof("Deleting resources for cluster %s", cluster)
-				ccm.cancelFn()
-				delete(c.clusters, cluster)
-			}
+			c.removeCluster(cluster)
 		}
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(30 * time.Second):
+
+		if c.backoff.IsInBackOffSinceUpdate(cluster, c.backoff.Clock.Now()) {
+			klog.V(3).InfoS("Cluster is failing, waiting before retrying", "cluster", cluster, "backoff", c.backoff.Get(cluster))
+			continue
+		}
+		result = append(result, cluster)
+	}
+	return result
+}
+
+// startCluster starts the cloud controller manager of the cluster
+func (c *Controller) startCluster(ctx context.Context, cluster string) {
+	// get the fingerprint before the client so a recreation while starting is detected
+	var fingerprint string
+	if c.fingerprint != nil {
+		var err error
+		fingerprint, err = c.fingerprint(cluster)
+		if err != nil {
+			klog.V(2).InfoS("Can not get the cluster fingerprint", "cluster", cluster, "err", err)
+		}
+	}
+	kubeClient, err := c.getKubeClient(ctx, cluster)
+	if err != nil {
+		// the kubeconfig may be outdated, get it again on the next attempt
+		c.kindCache.forget(cluster)
+		c.clusterFailed(cluster, fmt.Errorf("failed to create kubeClient: %w", err))
+		return
+	}
+
+	klog.V(2).InfoS("Creating new cloud provider", "cluster", cluster)
+	cloud := provider.New(cluster, c.kind)
+	ccm, err := startCloudControllerManager(ctx, cluster, kubeClient, cloud)
+	if err != nil {
+		c.clusterFailed(cluster, fmt.Errorf("failed to start cloud controller: %w", err))
+		return
+	}
+	ccm.fingerprint = fingerprint
+	klog.InfoS("Starting cloud controller", "cluster", cluster)
+	c.addCluster(cluster, ccm)
+	c.ready.Store(true)
+	c.clusterRecovered(cluster)
+}
+
+// clusterFailed backs off the next attempt to start the cloud controller manager of the
+// cluster, after repeated failures the cluster is marked as degraded and the errors are
+// only logged at higher verbosity to not flood the logs.
+func (c *Controller) clusterFailed(cluster string, err error) {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+	c.backoff.Next(cluster, c.backoff.Clock.Now())
+	c.failures[cluster]++
+	failures := c.failures[cluster]
+	switch {
+	case failures < clusterDegradedThreshold:
+		klog.ErrorS(err, "Cluster failed", "cluster", cluster)
+	case failures == clusterDegradedThreshold:
+		klog.ErrorS(err, "Cluster is degraded, retrying with backoff", "cluster", cluster, "failures", failures, "maxBackoff", clusterBackoffMax)
+		metrics.ClusterDegraded.WithLabelValues(cluster).Set(1)
+	default:
+		klog.V(2).InfoS("Cluster is degraded", "cluster", cluster, "backoff", c.backoff.Get(cluster), "err", err)
+	}
+}
+
+// clusterRecovered resets the backoff and the degraded state of the cluster
+func (c *Controller) clusterRecovered(cluster string) {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+	if c.failures[cluster] >= clusterDegradedThreshold {
+		klog.InfoS("Cluster is no longer degraded", "cluster", cluster)
+	}
+	c.backoff.Reset(cluster)
+	delete(c.failures, cluster)
+	metrics.ClusterDegraded.WithLabelValues(cluster).Set(0)
+}
+
+// managedClusters returns the clusters that match the cluster filters
+func (c *Controller) managedClusters(clusters []string) []string {
+	filter := cpkconfig.DefaultConfig.ClusterFilter
+	exclude := cpkconfig.DefaultConfig.ClusterExclude
+	managed := []string{}
+	for _, cluster := range clusters {
+		if exclude != nil && exclude.MatchString(cluster) {
+			klog.V(3).InfoS("Skipping cluster, it matches the cluster exclude list", "cluster", cluster)
+			continue
+		}
+		if filter != nil && !filter.MatchString(cluster) {
+			klog.V(3).InfoS("Skipping cluster, it does not match the cluster filter", "cluster", cluster)
+			continue
+		}
+		managed = append(managed, cluster)
+	}
+	managed, skipped := limitClusters(managed, cpkconfig.DefaultConfig.MaxClusters, func(cluster string) bool {
+		_, ok := c.getCluster(cluster)
+		return ok
+	})
+	if !slices.Equal(skipped, c.skippedClusters) {
+		if len(skipped) > 0 {
+			klog.InfoS("Skipping clusters, the maximum number of clusters is reached", "maxClusters", cpkconfig.DefaultConfig.MaxClusters, "skipped", skipped)
+		} else if len(c.skippedClusters) > 0 {
+			klog.InfoS("All the clusters are managed, the maximum number of clusters is no longer reached", "maxClusters", cpkconfig.DefaultConfig.MaxClusters)
 		}
+		c.skippedClusters = skipped
 	}
+	return managed
+}
+
+// limitClusters returns up to limit clusters, the ones already managed first so they are not
+// replaced by new clusters, and then by name. It also returns the clusters skipped, sorted.
+// Zero means no limit.
+func limitClusters(clusters []string, limit int, managed func(cluster string) bool) ([]string, []string) {
+	if limit <= 0 || len(clusters) <= limit {
+		return clusters, nil
+	}
+	sorted := append([]string{}, clusters...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		mi, mj := managed(sorted[i]), managed(sorted[j])
+		if mi != mj {
+			return mi
+		}
+		return sorted[i] < sorted[j]
+	})
+	skipped := append([]string{}, sorted[limit:]...)
+	sort.Strings(skipped)
+	return sorted[:limit], skipped
 }
 
 // getKubeClient returns a kubeclient for the cluster passed as argument
-// It tries first to connect to the internal endpoint.
+// It tries the endpoints of the kubeconfig preference, by default first the internal one.
 func (c *Controller) getKubeClient(ctx context.Context, cluster string) (kubernetes.Interface, error) {
-	httpClient := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-	// prefer internal (direct connectivity) over no-internal (commonly portmap)
-	for _, internal := range []bool{true, false} {
-		kconfig, err := c.kind.KubeConfig(cluster, internal)
+	for _, internal := range kubeconfigEndpoints() {
+		kconfig, err := c.kindCache.KubeConfig(cluster, internal)
 		if err != nil {
-			klog.Errorf("Failed to get kubeconfig for cluster %s: %v", cluster, err)
+			klog.V(2).InfoS("Failed to get kubeconfig", "cluster", cluster, "internal", internal, "err", err)
 			continue
 		}
 
 		config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kconfig))
 		if err != nil {
-			klog.Errorf("Failed to convert kubeconfig for cluster %s: %v", cluster, err)
+			klog.V(2).InfoS("Failed to convert kubeconfig", "cluster", cluster, "internal", internal, "err", err)
 			continue
 		}
 
 		// check that the apiserver is reachable before continue
 		// to fail fast and avoid waiting until the client operations timeout
+		probeClient, err := c.probeClients.forConfig(config)
+		if err != nil {
+			klog.V(2).InfoS("Failed to create the apiserver probe client", "cluster", cluster, "internal", internal, "err", err)
+			continue
+		}
 		var ok bool
 		for i := 0; i < 5; i++ {
 			select {
@@ -141,20 +446,20 @@ func (c *Controller) getKubeClient(ctx context.Context, cluster string) (kuberne
 				return nil, ctx.Err()
 			default:
 			}
-			if probeHTTP(httpClient, config.Host) {
+			if probeHTTP(ctx, probeClient, config.Host) {
 				ok = true
 				break
 			}
 			time.Sleep(time.Second * time.Duration(i))
 		}
 		if !ok {
-			klog.Errorf("Failed to connect to apiserver %s: %v", cluster, err)
+			klog.V(2).InfoS("Failed to connect to apiserver", "cluster", cluster, "host", config.Host)
 			continue
 		}
 
 		kubeClient, err := kubernetes.NewForConfig(config)
 		if err != nil {
-			klog.Errorf("Failed to create kubeClient for cluster %s: %v", cluster, err)
+			klog.V(2).InfoS("Failed to create kubeClient", "cluster", cluster, "err", err)
 			continue
 		}
 		// the first cluster will give us the type of connectivity between
@@ -170,11 +475,49 @@ func (c *Controller) getKubeClient(ctx context.Context, cluster string) (kuberne
 	return nil, fmt.Errorf("can not find a working kubernetes clientset")
 }
 
-func probeHTTP(client *http.Client, address string) bool {
-	klog.Infof("probe HTTP address %s", address)
-	resp, err := client.Get(address)
+// kubeconfigEndpoints returns if the internal or the external endpoints of the clusters are tried, in order.
+func kubeconfigEndpoints() []bool {
+	switch cpkconfig.DefaultConfig.KubeconfigPreference {
+	case cpkconfig.KubeconfigPreferenceInternal:
+		return []bool{true}
+	case cpkconfig.KubeconfigPreferenceExternal:
+		return []bool{false}
+	}
+	switch cpkconfig.DefaultConfig.RunMode {
+	case cpkconfig.RunModeInCluster:
+		return []bool{true}
+	case cpkconfig.RunModeHost:
+		return []bool{false}
+	}
+	// prefer internal (direct connectivity) over no-internal (commonly portmap)
+	return []bool{true, false}
+}
+
+// newProbeClient returns the client used to check if the apiservers are reachable, it is shared
+// by the probes with the same TLS configuration so the connections are reused and the idle ones
+// are closed after a while.
+func newProbeClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: probeTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: probeTimeout,
+			MaxIdleConnsPerHost: 1,
+			IdleConnTimeout:     probeIdleConnTimeout,
+		},
+	}
+}
+
+func probeHTTP(ctx context.Context, client *http.Client, address string) bool {
+	klog.V(2).InfoS("Probing HTTP address", "address", address)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
 	if err != nil {
-		klog.Infof("Failed to connect to HTTP address %s: %v", address, err)
+		klog.V(2).InfoS("Invalid HTTP address", "address", address, "err", err)
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		klog.V(2).InfoS("Failed to connect to HTTP address", "address", address, "err", err)
 		return false
 	}
 	defer resp.Body.Close()
@@ -185,9 +528,9 @@ func probeHTTP(client *http.Client, address string) bool {
 	return true
 }
 
-// TODO: implement leader election to not have problems with  multiple providers
-// ref: https://github.com/kubernetes/kubernetes/blob/d97ea0f705847f90740cac3bc3dd8f6a4026d0b5/cmd/kube-scheduler/app/server.go#L211
 func startCloudControllerManager(ctx context.Context, clusterName string, kubeClient kubernetes.Interface, cloud cloudprovider.Interface) (*ccm, error) {
+	// the container operations of the cluster are rate limited apart from the other clusters
+	ctx = container.WithScope(ctx, clusterName)
 	// TODO: we need to set up the ccm specific feature gates
 	// but try to avoid to expose this to users
 	featureGates := utilfeature.DefaultMutableFeatureGate
@@ -198,111 +541,357 @@ func startCloudControllerManager(ctx context.Context, clusterName string, kubeCl
 
 	client := kubeClient.Discovery().RESTClient()
 	// wait for health
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, 30*time.Second, true, func(ctx context.Context) (bool, error) {
+	timeout := cpkconfig.DefaultConfig.APIServerWaitTimeout
+	if timeout == 0 {
+		timeout = defaultAPIServerWaitTimeout
+	}
+	err = waitForAPIServer(ctx, timeout, apiserverBackoff, func(ctx context.Context) bool {
 		healthStatus := 0
 		client.Get().AbsPath("/healthz").Do(ctx).StatusCode(&healthStatus)
-		if healthStatus != http.StatusOK {
-			return false, nil
-		}
-
-		return true, nil
+		return healthStatus == http.StatusOK
 	})
 	if err != nil {
-		klog.Errorf("Failed waiting for apiserver to be ready: %v", err)
+		klog.ErrorS(err, "Failed waiting for apiserver to be ready", "cluster", clusterName)
 		return nil, err
 	}
 
-	sharedInformers := informers.NewSharedInformerFactory(kubeClient, 60*time.Second)
+	informerOptions := []informers.SharedInformerOption{}
+	if class := cpkconfig.DefaultConfig.LoadBalancerClass; class != "" {
+		informerOptions = append(informerOptions, informers.WithTransform(loadBalancerClassTransform(class)))
+	}
+	resyncPeriod := cpkconfig.DefaultConfig.InformerResyncPeriod
+	if resyncPeriod == 0 {
+		resyncPeriod = defaultInformerResyncPeriod
+	}
+	sharedInformers := informers.NewSharedInformerFactoryWithOptions(kubeClient, resyncPeriod, informerOptions...)
 
 	ccmMetrics := controllersmetrics.NewControllerManagerMetrics(clusterName)
-	// Start the service controller
-	serviceController, err := servicecontroller.New(
-		cloud,
-		kubeClient,
-		sharedInformers.Core().V1().Services(),
-		sharedInformers.Core().V1().Nodes(),
-		clusterName,
-		featureGates,
-	)
-	if err != nil {
-		// This error shouldn't fail. It lives like this as a legacy.
-		klog.Errorf("Failed to start service controller: %v", err)
-		return nil, err
+	// the resources are cleaned up once the goroutines of the controllers have stopped
+	running := &goroutines{}
+	// the controllers that are not enabled are not created, so their informers are not started
+	manageLoadBalancers := controllerEnabled(ServiceControllerName)
+	var serviceController *servicecontroller.Controller
+	if manageLoadBalancers {
+		// Start the service controller
+		serviceController, err = servicecontroller.New(
+			&trackedCloud{Interface: cloud, goroutines: running},
+			kubeClient,
+			sharedInformers.Core().V1().Services(),
+			sharedInformers.Core().V1().Nodes(),
+			clusterName,
+			featureGates,
+		)
+		if err != nil {
+			// This error shouldn't fail. It lives like this as a legacy.
+			klog.ErrorS(err, "Failed to start service controller", "cluster", clusterName)
+			return nil, err
+		}
+	}
+
+	var nodeController *nodecontroller.CloudNodeController
+	if controllerEnabled(NodeControllerName) {
+		// Create the node controller
+		nodeSyncPeriod := cpkconfig.DefaultConfig.NodeSyncPeriod
+		if nodeSyncPeriod == 0 {
+			nodeSyncPeriod = defaultNodeSyncPeriod
+		}
+		nodeController, err = nodecontroller.NewCloudNodeController(
+			sharedInformers.Core().V1().Nodes(),
+			kubeClient,
+			cloud,
+			nodeSyncPeriod,
+			5, // workers
+		)
+		if err != nil {
+			// This error shouldn't fail. It lives like this as a legacy.
+			klog.ErrorS(err, "Failed to start node controller", "cluster", clusterName)
+			return nil, err
+		}
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	go serviceController.Run(ctx, 5, ccmMetrics)
+	var nodeLifecycleController *nodelifecyclecontroller.CloudNodeLifecycleController
+	if controllerEnabled(NodeLifecycleControllerName) {
+		// Create the node lifecycle controller, it deletes the Nodes whose container no longer exists
+		nodeLifecycleController, err = nodelifecyclecontroller.NewCloudNodeLifecycleController(
+			sharedInformers.Core().V1().Nodes(),
+			kubeClient,
+			cloud,
+			5*time.Second,
+		)
+		if err != nil {
+			klog.ErrorS(err, "Failed to start node lifecycle controller", "cluster", clusterName)
+			return nil, err
+		}
+	}
 
-	// Start the node controller
-	nodeController, err := nodecontroller.NewCloudNodeController(
-		sharedInformers.Core().V1().Nodes(),
-		kubeClient,
-		cloud,
-		30*time.Second,
-		5, // workers
-	)
-	if err != nil {
-		// This error shouldn't fail. It lives like this as a legacy.
-		klog.Errorf("Failed to start node controller: %v", err)
-		cancel()
-		return nil, err
+	// restart the cloud controller manager with a new client if the current one stops working
+	monitor := newClientMonitor(clusterName, kubeClient)
+	monitored := []cache.SharedIndexInformer{sharedInformers.Core().V1().Nodes().Informer()}
+	if manageLoadBalancers {
+		monitored = append(monitored, sharedInformers.Core().V1().Services().Informer())
+	}
+	for _, informer := range monitored {
+		if err := informer.SetWatchErrorHandler(monitor.watchErrorHandler); err != nil {
+			klog.ErrorS(err, "Failed to set the watch error handler", "cluster", clusterName)
+			return nil, err
+		}
+	}
+
+	// the Services that do not allocate NodePorts are forwarded to their endpoints
+	if c, ok := cloud.(endpointSliceListerSetter); ok && manageLoadBalancers {
+		c.SetEndpointSliceLister(sharedInformers.Discovery().V1().EndpointSlices().Lister())
+	}
+
+	ctx, cancel := controllersContext(ctx)
+	cloud.Initialize(&kubeClientBuilder{kubeClient: kubeClient}, ctx.Done())
+	// leading is true while this instance owns the cluster resources
+	leading := &atomic.Bool{}
+	run := func(ctx context.Context) {
+		leading.Store(true)
+		if nodeController != nil {
+			running.Go(func() { nodeController.Run(ctx.Done(), ccmMetrics) })
+			running.Go(func() {
+				wait.UntilWithContext(ctx, func(ctx context.Context) {
+					backfillProviderIDs(ctx, clusterName, kubeClient, cloud)
+				}, providerIDBackfillInterval)
+			})
+		}
+		if nodeLifecycleController != nil {
+			running.Go(func() { nodeLifecycleController.Run(ctx, ccmMetrics) })
+		}
+		if manageLoadBalancers {
+			running.Go(func() { runServiceController(ctx, serviceController, ccmMetrics) })
+			if lb, ok := cloud.(loadBalancerResyncer); ok {
+				if err := watchProxyConfigOverrides(ctx, clusterName, sharedInformers.Core().V1().ConfigMaps(), sharedInformers.Core().V1().Services().Lister(), lb); err != nil {
+					klog.ErrorS(err, "Failed to watch the proxy config overrides", "cluster", clusterName)
+				}
+				if err := watchEndpointSlices(ctx, clusterName, sharedInformers.Discovery().V1().EndpointSlices(), sharedInformers.Core().V1().Services().Lister(), lb); err != nil {
+					klog.ErrorS(err, "Failed to watch the EndpointSlices", "cluster", clusterName)
+				}
+				if err := watchTLSSecrets(ctx, clusterName, sharedInformers.Core().V1().Secrets(), sharedInformers.Core().V1().Services().Lister(), lb); err != nil {
+					klog.ErrorS(err, "Failed to watch the TLS Secrets", "cluster", clusterName)
+				}
+			}
+		}
+		sharedInformers.Start(ctx.Done())
+		running.Go(func() { monitor.run(ctx, cancel) })
+		if !manageLoadBalancers {
+			return
+		}
+		if lbController, ok := cloud.LoadBalancer(); ok {
+			running.Go(func() {
+				wait.UntilWithContext(ctx, func(ctx context.Context) {
+					garbageCollectLoadBalancers(ctx, clusterName, kubeClient, lbController)
+				}, loadBalancerGCInterval)
+			})
+		}
+		if lb, ok := cloud.(loadBalancerRepairer); ok && !cpkconfig.DefaultConfig.DryRun && !cpkconfig.DefaultConfig.LoadBalancerDirectRouting {
+			running.Go(func() {
+				wait.UntilWithContext(ctx, func(ctx context.Context) {
+					repairLoadBalancers(ctx, clusterName, sharedInformers.Core().V1().Services().Lister(), lb)
+				}, loadBalancerRepairInterval)
+			})
+		}
+		if lb, ok := cloud.(loadBalancerStatusGate); ok && cpkconfig.DefaultConfig.LoadBalancerRequireHealthyBackends &&
+			!cpkconfig.DefaultConfig.DryRun && !cpkconfig.DefaultConfig.LoadBalancerDirectRouting {
+			running.Go(func() {
+				wait.UntilWithContext(ctx, func(ctx context.Context) {
+					gateLoadBalancerStatuses(ctx, clusterName, sharedInformers.Core().V1().Services().Lister(), lb)
+				}, backendHealthInterval)
+			})
+		}
+		if interval := cpkconfig.DefaultConfig.LoadBalancerStatsInterval; interval > 0 && !cpkconfig.DefaultConfig.DryRun && !cpkconfig.DefaultConfig.LoadBalancerDirectRouting {
+			running.Go(func() { loadbalancer.CollectStats(ctx, clusterName, interval) })
+		}
 	}
-	go nodeController.Run(ctx.Done(), ccmMetrics)
 
-	sharedInformers.Start(ctx.Done())
+	if cpkconfig.DefaultConfig.EnableLeaderElection {
+		le, err := newLeaderElector(clusterName, kubeClient, run, func() {
+			// the new leader owns the loadbalancers now
+			leading.Store(false)
+			cancel()
+		})
+		if err != nil {
+			klog.ErrorS(err, "Failed to create leader elector", "cluster", clusterName)
+			cancel()
+			return nil, err
+		}
+		running.Go(func() { le.Run(ctx) })
+	} else {
+		run(ctx)
+	}
 
 	// This has to cleanup all the resources allocated by the cloud provider in this cluster
 	// - containers as loadbalancers
 	// - in windows and darwin ip addresses on the loopback interface
 	// Find all the containers associated to the cluster and then use the cloud provider methods to delete
 	// the loadbalancer, we can extract the service name from the container labels.
-	cancelFn := func() {
-		cancel()
+	stopper := &ccmStopper{
+		clusterName:         clusterName,
+		cloud:               cloud,
+		cancel:              cancel,
+		running:             running,
+		informers:           sharedInformers,
+		leading:             leading,
+		manageLoadBalancers: manageLoadBalancers,
+	}
 
-		containers, err := container.ListByLabel(fmt.Sprintf("%s=%s", constants.NodeCCMLabelKey, clusterName))
-		if err != nil {
-			klog.Errorf("can't list containers: %v", err)
-			return
-		}
+	return &ccm{
+		factory:           sharedInformers,
+		serviceController: serviceController,
+		nodeController:    nodeController,
+		cloud:             cloud,
+		stopCh:            ctx.Done(),
+		stopFn:            func() { stopper.stop() },
+		cancelFn:          stopper.stopAndCleanup,
+		shutdownFn:        stopper.shutdown}, nil
+}
 
-		lbController, ok := cloud.LoadBalancer()
-		// this can not happen
-		if !ok {
-			return
+// cleanupLoadBalancers deletes the loadbalancer containers of the cluster, the context of the
+// controllers is already cancelled so the container commands run with their own one.
+func cleanupLoadBalancers(clusterName string, cloud cloudprovider.Interface) {
+	ctx, cancel := context.WithTimeout(container.WithScope(context.Background(), clusterName), cleanupTimeout)
+	defer cancel()
+	lbController, ok := cloud.LoadBalancer()
+	// this can not happen
+	if !ok {
+		return
+	}
+	// the addresses programmed on the nodes with direct routing have no container
+	if lb, ok := lbController.(interface {
+		CleanupLoadBalancers(ctx context.Context, clusterName string) error
+	}); ok {
+		if err := lb.CleanupLoadBalancers(ctx, clusterName); err != nil {
+			klog.ErrorS(err, "Error cleaning up loadbalancers", "cluster", clusterName)
 		}
+	}
 
-		for _, name := range containers {
-			// create fake service to pass to the cloud provider method
-			v, err := container.GetLabelValue(name, constants.LoadBalancerNameLabelKey)
-			if err != nil {
-				klog.Infof("could not get the label for the loadbalancer on container %s on cluster %s : %v", name, clusterName, err)
-				continue
-			}
-			clusterName, service := loadbalancer.ServiceFromLoadBalancerSimpleName(v)
-			if service == nil {
-				klog.Infof("invalid format for loadbalancer on cluster %s: %s", clusterName, v)
-				continue
-			}
-			err = lbController.EnsureLoadBalancerDeleted(context.Background(), clusterName, service)
-			if err != nil {
-				klog.Infof("error deleting loadbalancer %s/%s on cluster %s : %v", service.Namespace, service.Name, clusterName, err)
-				continue
+	containers, err := loadbalancer.ListLoadBalancers(ctx, clusterName)
+	if err != nil {
+		klog.ErrorS(err, "Can not list containers", "cluster", clusterName)
+		return
+	}
+
+	for _, name := range containers {
+		labels, err := container.Labels(ctx, name)
+		if err != nil {
+			klog.InfoS("Could not get the loadbalancer labels", "cluster", clusterName, "container", name, "err", err)
+			continue
+		}
+		// the shared loadbalancer does not belong to a single Service
+		if labels[constants.LoadBalancerSharedLabelKey] == "true" {
+			if err := container.DeleteWithRetry(ctx, name); err != nil {
+				klog.ErrorS(err, "Error deleting shared loadbalancer", "cluster", clusterName, "container", name)
 			}
+			continue
+		}
+		// create fake service to pass to the cloud provider method
+		clusterName, service := loadbalancer.ServiceFromLoadBalancerLabels(labels)
+		if service == nil {
+			klog.InfoS("Invalid format for loadbalancer label", "cluster", clusterName, "label", labels[constants.LoadBalancerNameLabelKey])
+			continue
+		}
+		err = lbController.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+		if err != nil {
+			klog.ErrorS(err, "Error deleting loadbalancer", "cluster", clusterName, "service", klog.KObj(service), "container", name)
+			continue
 		}
 	}
+}
 
-	return &ccm{
-		factory:           sharedInformers,
-		serviceController: serviceController,
-		nodeController:    nodeController,
-		cancelFn:          cancelFn}, nil
+// serviceRunner runs the service controller
+type serviceRunner interface {
+	Run(ctx context.Context, workers int, controllerManagerMetrics *controllersmetrics.ControllerManagerMetrics)
+}
+
+// runServiceController runs the service controller with the configured number of workers
+func runServiceController(ctx context.Context, controller serviceRunner, ccmMetrics *controllersmetrics.ControllerManagerMetrics) {
+	workers := cpkconfig.DefaultConfig.ConcurrentServiceSyncs
+	if workers < 1 {
+		workers = defaultConcurrentServiceSyncs
+	}
+	controller.Run(ctx, workers, ccmMetrics)
 }
 
 // TODO cleanup alias ip on mac
 func (c *Controller) cleanup() {
-	for cluster, ccm := range c.clusters {
-		klog.Infof("Cleaning resources for cluster %s", cluster)
-		ccm.cancelFn()
-		delete(c.clusters, cluster)
+	if cpkconfig.DefaultConfig.NoCleanupOnExit {
+		klog.InfoS("Keeping the loadbalancers on exit", "clusters", c.clusterNames())
+		for _, cluster := range c.clusterNames() {
+			if ccm, ok := c.removeCluster(cluster); ok {
+				ccm.stopFn()
+			}
+		}
+		return
+	}
+	// the clusters are shut down concurrently so their drain grace periods overlap
+	var wg sync.WaitGroup
+	for _, cluster := range c.clusterNames() {
+		if ccm, ok := c.removeCluster(cluster); ok {
+			klog.InfoS("Cleaning resources", "cluster", cluster)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ccm.shutdownFn()
+			}()
+		}
+	}
+	wg.Wait()
+	if c.probeClients != nil {
+		c.probeClients.closeIdleConnections()
+	}
+}
+
+// drainLoadBalancers stops the loadbalancers of the cluster from accepting new connections
+// and waits for the grace period so the existing connections can finish.
+func drainLoadBalancers(clusterName string) {
+	gracePeriod := cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod
+	if gracePeriod == 0 {
+		return
+	}
+	// the context of the controllers is already cancelled
+	ctx := container.WithScope(context.Background(), clusterName)
+	containers, err := loadbalancer.ListLoadBalancers(ctx, clusterName)
+	if err != nil {
+		klog.ErrorS(err, "Can not list containers", "cluster", clusterName)
+		return
+	}
+	var drained int
+	for _, name := range containers {
+		if err := loadbalancer.DrainLoadBalancer(ctx, name); err != nil {
+			klog.InfoS("Error draining loadbalancer", "cluster", clusterName, "container", name, "err", err)
+			continue
+		}
+		drained++
 	}
+	if drained == 0 {
+		return
+	}
+	klog.InfoS("Waiting for the loadbalancers connections to finish", "cluster", clusterName, "gracePeriod", gracePeriod, "loadbalancers", drained)
+	time.Sleep(gracePeriod)
+}
+
+// kubeClientBuilder is a cloudprovider.ControllerClientBuilder that returns
+// the existing client of the cluster.
+type kubeClientBuilder struct {
+	kubeClient kubernetes.Interface
+}
+
+var _ cloudprovider.ControllerClientBuilder = &kubeClientBuilder{}
+
+func (b *kubeClientBuilder) Config(name string) (*restclient.Config, error) {
+	return nil, fmt.Errorf("rest config not supported")
+}
+
+func (b *kubeClientBuilder) ConfigOrDie(name string) *restclient.Config {
+	klog.Fatalf("rest config not supported")
+	return nil
+}
+
+func (b *kubeClientBuilder) Client(name string) (kubernetes.Interface, error) {
+	return b.kubeClient, nil
+}
+
+func (b *kubeClientBuilder) ClientOrDie(name string) kubernetes.Interface {
+	return b.kubeClient
 }
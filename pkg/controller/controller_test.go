@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+	controllersmetrics "k8s.io/component-base/metrics/prometheus/controllers"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+type fakeServiceRunner struct {
+	workers int
+}
+
+func (f *fakeServiceRunner) Run(ctx context.Context, workers int, controllerManagerMetrics *controllersmetrics.ControllerManagerMetrics) {
+	f.workers = workers
+}
+
+func Test_runServiceController(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured int
+		want       int
+	}{
+		{name: "default", configured: 0, want: defaultConcurrentServiceSyncs},
+		{name: "configured", configured: 20, want: 20},
+		{name: "one worker", configured: 1, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := cpkconfig.DefaultConfig.ConcurrentServiceSyncs
+			defer func() { cpkconfig.DefaultConfig.ConcurrentServiceSyncs = old }()
+			cpkconfig.DefaultConfig.ConcurrentServiceSyncs = tt.configured
+
+			runner := &fakeServiceRunner{}
+			runServiceController(context.Background(), runner, controllersmetrics.NewControllerManagerMetrics("test"))
+			if runner.workers != tt.want {
+				t.Errorf("service controller workers = %d, want %d", runner.workers, tt.want)
+			}
+		})
+	}
+}
+
+func Test_kubeconfigEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		preference cpkconfig.KubeconfigPreference
+		runMode    cpkconfig.RunMode
+		want       []bool
+	}{
+		{name: "auto", preference: cpkconfig.KubeconfigPreferenceAuto, want: []bool{true, false}},
+		{name: "unset", want: []bool{true, false}},
+		{name: "auto in-cluster", preference: cpkconfig.KubeconfigPreferenceAuto, runMode: cpkconfig.RunModeInCluster, want: []bool{true}},
+		{name: "auto host", preference: cpkconfig.KubeconfigPreferenceAuto, runMode: cpkconfig.RunModeHost, want: []bool{false}},
+		{name: "internal", preference: cpkconfig.KubeconfigPreferenceInternal, want: []bool{true}},
+		{name: "external", preference: cpkconfig.KubeconfigPreferenceExternal, want: []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldPreference, oldRunMode := cpkconfig.DefaultConfig.KubeconfigPreference, cpkconfig.DefaultConfig.RunMode
+			defer func() {
+				cpkconfig.DefaultConfig.KubeconfigPreference, cpkconfig.DefaultConfig.RunMode = oldPreference, oldRunMode
+			}()
+			cpkconfig.DefaultConfig.KubeconfigPreference, cpkconfig.DefaultConfig.RunMode = tt.preference, tt.runMode
+
+			if got := kubeconfigEndpoints(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kubeconfigEndpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_probeHTTPReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := newProbeClient(&tls.Config{InsecureSkipVerify: true})
+	defer client.CloseIdleConnections()
+	for i := 0; i < 3; i++ {
+		if !probeHTTP(context.Background(), client, server.URL) {
+			t.Fatalf("expected the probe %d to reach the server", i)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("expected the probes to reuse the connection, got %d connections", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if probeHTTP(ctx, client, server.URL) {
+		t.Errorf("expected the probe to fail with a cancelled context")
+	}
+}
+
+func TestControllerCleanupNoCleanupOnExit(t *testing.T) {
+	oldNoCleanup, oldGracePeriod := cpkconfig.DefaultConfig.NoCleanupOnExit, cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod
+	defer func() {
+		cpkconfig.DefaultConfig.NoCleanupOnExit = oldNoCleanup
+		cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod = oldGracePeriod
+	}()
+	cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod = 0
+
+	for _, noCleanup := range []bool{false, true} {
+		cpkconfig.DefaultConfig.NoCleanupOnExit = noCleanup
+		stopped, cleaned := false, false
+		c := &Controller{clusters: map[string]*ccm{}}
+		c.addCluster("kind", &ccm{stopFn: func() { stopped = true }, shutdownFn: func() { cleaned = true }})
+		c.cleanup()
+		if cleaned == noCleanup {
+			t.Errorf("cleanup() with no-cleanup-on-exit %v cleaned the resources: %v", noCleanup, cleaned)
+		}
+		if stopped != noCleanup {
+			t.Errorf("cleanup() with no-cleanup-on-exit %v stopped the controllers keeping the resources: %v", noCleanup, stopped)
+		}
+	}
+}
+
+func TestControllerRestartStoppedKeepsLoadBalancers(t *testing.T) {
+	c := &Controller{
+		clusters: map[string]*ccm{},
+		backoff:  flowcontrol.NewBackOff(time.Second, time.Minute),
+	}
+	// the cloud controller was stopped by the client monitor
+	stopCh := make(chan struct{})
+	close(stopCh)
+	stopped, cleaned := false, false
+	c.addCluster("kind", &ccm{
+		stopCh:   stopCh,
+		stopFn:   func() { stopped = true },
+		cancelFn: func() { cleaned = true },
+	})
+	if got := c.clustersToStart([]string{"kind"}); !reflect.DeepEqual(got, []string{"kind"}) {
+		t.Fatalf("expected the stopped cluster to be started again, got %v", got)
+	}
+	if !stopped || cleaned {
+		t.Errorf("expected the controllers to be stopped keeping the loadbalancers, stopped %v cleaned %v", stopped, cleaned)
+	}
+}
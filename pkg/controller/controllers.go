@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+// names of the controllers started for each cluster, they can be selected with the controllers flag
+const (
+	// ServiceControllerName manages the loadbalancers of the Services
+	ServiceControllerName = "service"
+	// NodeControllerName sets the provider ID, the addresses and the topology labels of the Nodes
+	NodeControllerName = "node"
+	// NodeLifecycleControllerName deletes the Nodes whose container no longer exists
+	NodeLifecycleControllerName = "node-lifecycle"
+)
+
+// ControllerNames are the names of all the controllers
+var ControllerNames = []string{ServiceControllerName, NodeControllerName, NodeLifecycleControllerName}
+
+// ParseControllers returns the controllers enabled by the comma-separated list, "*" enables all of
+// them and a name with the "-" prefix disables it, per example "*,-node-lifecycle".
+func ParseControllers(value string) (map[string]bool, error) {
+	known := map[string]bool{}
+	for _, name := range ControllerNames {
+		known[name] = true
+	}
+	enabled := map[string]bool{}
+	disabled := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			for _, name := range ControllerNames {
+				enabled[name] = true
+			}
+			continue
+		}
+		name := strings.TrimPrefix(entry, "-")
+		if !known[name] {
+			return nil, fmt.Errorf("unknown controller %q, supported controllers are %s", name, strings.Join(ControllerNames, ", "))
+		}
+		if name != entry {
+			disabled[name] = true
+		} else {
+			enabled[name] = true
+		}
+	}
+	// the disabled controllers take precedence regardless of the order
+	for name := range disabled {
+		delete(enabled, name)
+	}
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("no controller is enabled, supported controllers are %s", strings.Join(ControllerNames, ", "))
+	}
+	return enabled, nil
+}
+
+// controllerEnabled returns true if the controller is started for the clusters
+func controllerEnabled(name string) bool {
+	enabled := cpkconfig.DefaultConfig.Controllers
+	return enabled == nil || enabled[name]
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseControllers(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{name: "all", value: "*", want: map[string]bool{"service": true, "node": true, "node-lifecycle": true}},
+		{name: "only the service controller", value: "service", want: map[string]bool{"service": true}},
+		{name: "node controllers", value: "node, node-lifecycle", want: map[string]bool{"node": true, "node-lifecycle": true}},
+		{name: "all but one", value: "*,-node-lifecycle", want: map[string]bool{"service": true, "node": true}},
+		{name: "disabled before enabled", value: "-service,*", want: map[string]bool{"node": true, "node-lifecycle": true}},
+		{name: "unknown", value: "service,route", wantErr: true},
+		{name: "none enabled", value: "-service", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseControllers(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseControllers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseControllers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
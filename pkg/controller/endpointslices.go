@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+// endpointSliceListerSetter is implemented by the cloud providers whose loadbalancers can
+// forward the traffic directly to the Pods
+type endpointSliceListerSetter interface {
+	SetEndpointSliceLister(lister discoverylisters.EndpointSliceLister)
+}
+
+// endpointSliceResyncDelay is the time the endpoint changes of a Service are accumulated
+// before updating its loadbalancer, so a rollout does not reconfigure it for every Pod.
+const endpointSliceResyncDelay = time.Second
+
+// watchEndpointSlices resyncs the loadbalancers of the Services whose backends depend on their
+// endpoints when they change, the service controller only updates them when the Nodes change.
+func watchEndpointSlices(ctx context.Context, clusterName string, slices discoveryinformers.EndpointSliceInformer, services corelisters.ServiceLister, lb loadBalancerResyncer) error {
+	queue := workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[string]{Name: "endpointslices-" + clusterName})
+	enqueue := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			return
+		}
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name == "" {
+			return
+		}
+		// the changes of the same Service are coalesced while waiting
+		queue.AddAfter(slice.Namespace+"/"+name, endpointSliceResyncDelay)
+	}
+	_, err := slices.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSlice, ok1 := oldObj.(*discoveryv1.EndpointSlice)
+			newSlice, ok2 := newObj.(*discoveryv1.EndpointSlice)
+			// skip the informer resyncs
+			if ok1 && ok2 && oldSlice.ResourceVersion == newSlice.ResourceVersion {
+				return
+			}
+			enqueue(newObj)
+		},
+		DeleteFunc: enqueue,
+	})
+	if err != nil {
+		queue.ShutDown()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+	go func() {
+		for resyncEndpoints(ctx, clusterName, queue, services, lb) {
+		}
+	}()
+	return nil
+}
+
+// resyncEndpoints updates the loadbalancer of the next Service in the queue, it returns false
+// when the queue is shut down.
+func resyncEndpoints(ctx context.Context, clusterName string, queue workqueue.TypedDelayingInterface[string], services corelisters.ServiceLister, lb loadBalancerResyncer) bool {
+	key, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(key)
+	service := serviceWithEndpointBackends(services, key)
+	if service == nil {
+		return true
+	}
+	if err := lb.ResyncLoadBalancer(ctx, clusterName, service); err != nil {
+		klog.InfoS("Error updating loadbalancer with the Service endpoints", "cluster", clusterName, "service", klog.KObj(service), "err", err)
+	}
+	return true
+}
+
+// serviceWithEndpointBackends returns the Service with the namespace/name key if the backends of its
+// loadbalancer depend on its endpoints, nil otherwise
+func serviceWithEndpointBackends(services corelisters.ServiceLister, key string) *v1.Service {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+	service, err := services.Services(namespace).Get(name)
+	if err != nil {
+		return nil
+	}
+	// the Services in the informer cache are already transformed by the loadbalancer class
+	if !wantsLoadBalancer(service, "") || !loadbalancer.UsesEndpointSlices(service) {
+		return nil
+	}
+	return service
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+type fakeResyncer struct {
+	resynced []string
+}
+
+func (f *fakeResyncer) ResyncLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error {
+	f.resynced = append(f.resynced, service.Namespace+"/"+service.Name)
+	return nil
+}
+
+func TestResyncEndpoints(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, svc := range []*v1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pods", Namespace: "default"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, AllocateLoadBalancerNodePorts: ptr.To(false)},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "nodeports", Namespace: "default"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "local", Namespace: "default", Annotations: map[string]string{constants.TrafficPolicyAnnotationKey: "Local"}},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterip", Namespace: "default"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, AllocateLoadBalancerNodePorts: ptr.To(false)},
+		},
+	} {
+		if err := indexer.Add(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue := workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[string]{})
+	for _, key := range []string{"default/pods", "default/nodeports", "default/local", "default/clusterip", "default/missing", "default/pods"} {
+		queue.Add(key)
+	}
+	queue.ShutDown()
+
+	lb := &fakeResyncer{}
+	for resyncEndpoints(context.Background(), "kind", queue, corelisters.NewServiceLister(indexer), lb) {
+	}
+	// the duplicated keys are coalesced
+	if want := []string{"default/pods", "default/local"}; !reflect.DeepEqual(lb.resynced, want) {
+		t.Errorf("expected the resynced Services %v, got %v", want, lb.resynced)
+	}
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// kubeConfigFingerprint returns a fingerprint of the cluster from its kubeconfig, the
+// certificate authority is generated when the cluster is created so it changes if the
+// cluster is deleted and created again with the same name.
+func kubeConfigFingerprint(kubeconfig string) (string, error) {
+	config, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return "", err
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return "", fmt.Errorf("current context %q not found", config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok {
+		return "", fmt.Errorf("cluster %q not found", context.Cluster)
+	}
+	if len(cluster.CertificateAuthorityData) == 0 {
+		return "", fmt.Errorf("cluster %q has no certificate authority data", context.Cluster)
+	}
+	hash := sha256.Sum256(cluster.CertificateAuthorityData)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// clusterFingerprint returns the fingerprint of the KIND cluster
+func (c *Controller) clusterFingerprint(cluster string) (string, error) {
+	kubeconfig, err := c.kindCache.KubeConfig(cluster, true)
+	if err != nil {
+		return "", err
+	}
+	return kubeConfigFingerprint(kubeconfig)
+}
+
+// recreated returns true if the cluster has a different fingerprint than the one its
+// cloud controller manager was started with, the cluster is considered the same if the
+// fingerprint can not be obtained.
+func (c *Controller) recreated(cluster string, existing *ccm) bool {
+	if c.fingerprint == nil || existing.fingerprint == "" {
+		return false
+	}
+	fingerprint, err := c.fingerprint(cluster)
+	if err != nil {
+		klog.V(2).InfoS("Can not get the cluster fingerprint", "cluster", cluster, "err", err)
+		return false
+	}
+	return fingerprint != existing.fingerprint
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func testKubeConfig(ca string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: https://kind-control-plane:6443
+  name: kind-kind
+contexts:
+- context:
+    cluster: kind-kind
+    user: kind-kind
+  name: kind-kind
+current-context: kind-kind
+users:
+- name: kind-kind
+  user:
+    token: abc
+`, base64.StdEncoding.EncodeToString([]byte(ca)))
+}
+
+func Test_kubeConfigFingerprint(t *testing.T) {
+	a, err := kubeConfigFingerprint(testKubeConfig("ca-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := kubeConfigFingerprint(testKubeConfig("ca-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := kubeConfigFingerprint(testKubeConfig("ca-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != again {
+		t.Errorf("expected the same fingerprint for the same kubeconfig, got %s and %s", a, again)
+	}
+	if a == b {
+		t.Errorf("expected different fingerprints for different certificate authorities")
+	}
+	if _, err := kubeConfigFingerprint("apiVersion: v1\nkind: Config\n"); err == nil {
+		t.Errorf("expected an error for a kubeconfig without current context")
+	}
+}
+
+func TestControllerClustersToStartRecreated(t *testing.T) {
+	kubeconfigs := map[string]string{"kind": testKubeConfig("ca-a")}
+	c := &Controller{
+		clusters: map[string]*ccm{},
+		backoff:  flowcontrol.NewBackOff(time.Second, time.Minute),
+		fingerprint: func(cluster string) (string, error) {
+			kubeconfig, ok := kubeconfigs[cluster]
+			if !ok {
+				return "", fmt.Errorf("cluster %s not found", cluster)
+			}
+			return kubeConfigFingerprint(kubeconfig)
+		},
+	}
+	fingerprint, err := c.fingerprint("kind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := false
+	c.addCluster("kind", &ccm{
+		stopCh:      make(chan struct{}),
+		cancelFn:    func() { cancelled = true },
+		fingerprint: fingerprint,
+	})
+
+	if got := c.clustersToStart([]string{"kind"}); len(got) != 0 {
+		t.Fatalf("expected the running cluster to not be started again, got %v", got)
+	}
+
+	// the cluster can not be reached, it is not restarted
+	delete(kubeconfigs, "kind")
+	if got := c.clustersToStart([]string{"kind"}); len(got) != 0 || cancelled {
+		t.Fatalf("expected the cluster to not be restarted without fingerprint, got %v", got)
+	}
+
+	// the cluster is recreated with the same name
+	kubeconfigs["kind"] = testKubeConfig("ca-b")
+	if got := c.clustersToStart([]string{"kind"}); !reflect.DeepEqual(got, []string{"kind"}) {
+		t.Fatalf("expected the recreated cluster to be started again, got %v", got)
+	}
+	if !cancelled {
+		t.Errorf("expected the old cloud controller to be cancelled")
+	}
+	if _, ok := c.getCluster("kind"); ok {
+		t.Errorf("expected the old cloud controller to be removed")
+	}
+}
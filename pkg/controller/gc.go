@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+// loadBalancerGCInterval is the interval between the garbage collection of orphaned loadbalancers
+const loadBalancerGCInterval = 5 * time.Minute
+
+// garbageCollectLoadBalancers deletes the loadbalancer containers of the cluster whose
+// Service no longer exists or is no longer handled by this cloud-provider-kind, per example because
+// cloud-provider-kind was not running when the Service was deleted.
+// Containers are only deleted when the apiserver confirms the Service is gone,
+// so an unreachable cluster does not lose its loadbalancers.
+func garbageCollectLoadBalancers(ctx context.Context, clusterName string, kubeClient kubernetes.Interface, lbController cloudprovider.LoadBalancer) {
+	containers, err := loadbalancer.ListLoadBalancers(ctx, clusterName)
+	if err != nil {
+		klog.ErrorS(err, "Can not list containers", "cluster", clusterName)
+		return
+	}
+
+	for _, name := range containers {
+		labels, err := container.Labels(ctx, name)
+		if err != nil {
+			klog.InfoS("Could not get the loadbalancer labels", "cluster", clusterName, "container", name, "err", err)
+			continue
+		}
+		// the shared loadbalancers are deleted with their last Service
+		if labels[constants.LoadBalancerSharedLabelKey] == "true" {
+			continue
+		}
+		_, service := loadbalancer.ServiceFromLoadBalancerLabels(labels)
+		if service == nil {
+			klog.InfoS("Invalid format for loadbalancer label", "cluster", clusterName, "label", labels[constants.LoadBalancerNameLabelKey])
+			continue
+		}
+
+		svc, err := kubeClient.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+		// a Service created again with the same name owns a new loadbalancer
+		if err == nil && (service.UID == "" || service.UID == svc.UID) && wantsLoadBalancer(svc, config.DefaultConfig.LoadBalancerClass) {
+			continue
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			klog.InfoS("Could not get Service, skipping garbage collection", "cluster", clusterName, "service", klog.KObj(service), "err", err)
+			continue
+		}
+
+		klog.InfoS("Deleting orphaned loadbalancer", "cluster", clusterName, "service", klog.KObj(service), "container", name)
+		err = lbController.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+		if err != nil {
+			klog.InfoS("Error deleting loadbalancer", "cluster", clusterName, "service", klog.KObj(service), "err", err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// serveHealthz serves the health endpoints of the controller until the context is cancelled:
+// /healthz reports the controller is running and /readyz reports the controller has started
+// the cloud controller manager of at least one cluster, /loadbalancers lists the loadbalancers
+// of all the clusters in JSON.
+func (c *Controller) serveHealthz(ctx context.Context, address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok")) // nolint:errcheck
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !c.ready.Load() {
+			http.Error(w, "no cluster is running", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok")) // nolint:errcheck
+	})
+	mux.HandleFunc("/loadbalancers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.loadBalancers(r.Context())); err != nil {
+			klog.V(2).InfoS("Failed to write the loadbalancers", "err", err)
+		}
+	})
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx) // nolint:errcheck
+	}()
+
+	klog.InfoS("Serving health endpoints", "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.ErrorS(err, "Failed to serve health endpoints", "address", address)
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// kindCacheTTL is the time the KIND clusters and kubeconfigs are cached, the cache is
+// invalidated earlier by the container events of the KIND nodes.
+const kindCacheTTL = time.Minute
+
+// kindClient lists the KIND clusters and returns their kubeconfigs, it is implemented by the KIND provider
+type kindClient interface {
+	List() ([]string, error)
+	KubeConfig(cluster string, internal bool) (string, error)
+}
+
+type kubeConfigKey struct {
+	cluster  string
+	internal bool
+}
+
+type cachedKubeConfig struct {
+	kubeconfig string
+	expires    time.Time
+}
+
+// kindCache caches the results of the KIND provider so the periodic scans of the clusters
+// do not run container runtime commands when nothing changed, the errors are not cached.
+type kindCache struct {
+	kind  kindClient
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu             sync.Mutex
+	clusters       []string
+	clustersExpire time.Time
+	kubeconfigs    map[kubeConfigKey]cachedKubeConfig
+}
+
+func newKindCache(kind kindClient, ttl time.Duration) *kindCache {
+	return &kindCache{
+		kind:        kind,
+		ttl:         ttl,
+		clock:       clock.RealClock{},
+		kubeconfigs: map[kubeConfigKey]cachedKubeConfig{},
+	}
+}
+
+// List returns the names of the KIND clusters
+func (k *kindCache) List() ([]string, error) {
+	k.mu.Lock()
+	if k.clusters != nil && k.clock.Now().Before(k.clustersExpire) {
+		clusters := append([]string{}, k.clusters...)
+		k.mu.Unlock()
+		return clusters, nil
+	}
+	k.mu.Unlock()
+
+	clusters, err := k.kind.List()
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.clusters = append([]string{}, clusters...)
+	k.clustersExpire = k.clock.Now().Add(k.ttl)
+	return clusters, nil
+}
+
+// KubeConfig returns the kubeconfig of the KIND cluster, with the internal or the host endpoint
+func (k *kindCache) KubeConfig(cluster string, internal bool) (string, error) {
+	key := kubeConfigKey{cluster: cluster, internal: internal}
+	k.mu.Lock()
+	if cached, ok := k.kubeconfigs[key]; ok && k.clock.Now().Before(cached.expires) {
+		k.mu.Unlock()
+		return cached.kubeconfig, nil
+	}
+	k.mu.Unlock()
+
+	kubeconfig, err := k.kind.KubeConfig(cluster, internal)
+	if err != nil {
+		return "", err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.kubeconfigs[key] = cachedKubeConfig{kubeconfig: kubeconfig, expires: k.clock.Now().Add(k.ttl)}
+	return kubeconfig, nil
+}
+
+// forget removes the cached kubeconfigs of the cluster
+func (k *kindCache) forget(cluster string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.kubeconfigs, kubeConfigKey{cluster: cluster, internal: true})
+	delete(k.kubeconfigs, kubeConfigKey{cluster: cluster, internal: false})
+}
+
+// invalidate removes all the cached results, per example when a KIND node is created or removed
+func (k *kindCache) invalidate() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.clusters = nil
+	k.kubeconfigs = map[kubeConfigKey]cachedKubeConfig{}
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+type fakeKindClient struct {
+	clusters    []string
+	err         error
+	lists       int
+	kubeconfigs int
+}
+
+func (f *fakeKindClient) List() ([]string, error) {
+	f.lists++
+	return f.clusters, f.err
+}
+
+func (f *fakeKindClient) KubeConfig(cluster string, internal bool) (string, error) {
+	f.kubeconfigs++
+	if f.err != nil {
+		return "", f.err
+	}
+	return fmt.Sprintf("%s-%v-%d", cluster, internal, f.kubeconfigs), nil
+}
+
+func TestKindCache(t *testing.T) {
+	kind := &fakeKindClient{clusters: []string{"a", "b"}}
+	clock := clocktesting.NewFakeClock(time.Now())
+	cache := newKindCache(kind, time.Minute)
+	cache.clock = clock
+
+	for i := 0; i < 3; i++ {
+		clusters, err := cache.List()
+		if err != nil || !reflect.DeepEqual(clusters, []string{"a", "b"}) {
+			t.Fatalf("List() = %v, %v", clusters, err)
+		}
+	}
+	if kind.lists != 1 {
+		t.Errorf("expected the clusters to be listed once, got %d", kind.lists)
+	}
+
+	first, _ := cache.KubeConfig("a", true)
+	second, _ := cache.KubeConfig("a", true)
+	if first != second || kind.kubeconfigs != 1 {
+		t.Errorf("expected the kubeconfig to be cached, got %s and %s after %d calls", first, second, kind.kubeconfigs)
+	}
+	if external, _ := cache.KubeConfig("a", false); external == first {
+		t.Errorf("expected the internal and external kubeconfigs to be cached separately")
+	}
+
+	// expired
+	clock.Step(time.Minute)
+	cache.List() // nolint:errcheck
+	if kind.lists != 2 {
+		t.Errorf("expected the clusters to be listed again after the ttl, got %d", kind.lists)
+	}
+	if kubeconfig, _ := cache.KubeConfig("a", true); kubeconfig == first {
+		t.Errorf("expected the kubeconfig to be obtained again after the ttl")
+	}
+
+	// invalidated by the events
+	kind.clusters = []string{"a"}
+	cache.invalidate()
+	clusters, _ := cache.List()
+	if !reflect.DeepEqual(clusters, []string{"a"}) || kind.lists != 3 {
+		t.Errorf("expected the clusters to be listed again after invalidation, got %v after %d calls", clusters, kind.lists)
+	}
+
+	// the errors are not cached
+	cache.invalidate()
+	kind.err = errors.New("docker not running")
+	if _, err := cache.List(); err == nil {
+		t.Errorf("expected an error")
+	}
+	kind.err = nil
+	if _, err := cache.List(); err != nil || kind.lists != 5 {
+		t.Errorf("expected the errors to not be cached, got %v after %d calls", err, kind.lists)
+	}
+
+	// forget only drops the kubeconfigs of the cluster
+	cache.KubeConfig("b", true) // nolint:errcheck
+	calls := kind.kubeconfigs
+	cache.forget("a")
+	cache.KubeConfig("b", true) // nolint:errcheck
+	if kind.kubeconfigs != calls {
+		t.Errorf("expected the kubeconfig of other clusters to stay cached")
+	}
+	cache.KubeConfig("a", true) // nolint:errcheck
+	if kind.kubeconfigs != calls+1 {
+		t.Errorf("expected the kubeconfig of the forgotten cluster to be obtained again")
+	}
+}
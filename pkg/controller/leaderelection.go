@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+
+	// register the leader election metrics
+	_ "k8s.io/component-base/metrics/prometheus/clientgo/leaderelection"
+)
+
+const (
+	leaderElectionLeaseName      = "cloud-provider-kind"
+	leaderElectionLeaseNamespace = "kube-system"
+)
+
+// newLeaderElector returns a leader elector that uses a Lease on the cluster
+// to guarantee that only one cloud-provider-kind instance is running the
+// controllers of the cluster. Losing the lease calls onStoppedLeading.
+func newLeaderElector(clusterName string, kubeClient kubernetes.Interface, onStartedLeading func(ctx context.Context), onStoppedLeading func()) (*leaderelection.LeaderElector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	// add a uniquifier so that two processes on the same host don't accidentally both become active
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaderElectionLeaseName,
+			Namespace: leaderElectionLeaseNamespace,
+		},
+		Client: kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		// the name is used as label on the leader election metrics
+		Name: clusterName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.InfoS("Started leading", "cluster", clusterName, "identity", identity)
+				onStartedLeading(ctx)
+			},
+			OnStoppedLeading: func() {
+				klog.InfoS("Stopped leading", "cluster", clusterName, "identity", identity)
+				onStoppedLeading()
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.InfoS("New leader elected", "cluster", clusterName, "leader", leader)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+// ignoredLoadBalancerClass replaces the class of the Services that are not handled by
+// this cloud-provider-kind so the service controller ignores them.
+const ignoredLoadBalancerClass = "kind.sigs.k8s.io/ignored"
+
+// loadBalancerClassTransform returns an informer transform that makes the service controller,
+// that only handles Services without class, to handle the Services with the given class instead.
+// The transformed Services are never written back, the service controller only patches the
+// finalizers and the status.
+func loadBalancerClassTransform(class string) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		svc, ok := obj.(*v1.Service)
+		if !ok {
+			return obj, nil
+		}
+		if svc.Spec.LoadBalancerClass != nil && *svc.Spec.LoadBalancerClass == class {
+			svc.Spec.LoadBalancerClass = nil
+		} else {
+			svc.Spec.LoadBalancerClass = ptr.To(ignoredLoadBalancerClass)
+		}
+		return svc, nil
+	}
+}
+
+// wantsLoadBalancer returns true if the Service is handled by this cloud-provider-kind
+func wantsLoadBalancer(svc *v1.Service, class string) bool {
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return false
+	}
+	if class == "" {
+		return svc.Spec.LoadBalancerClass == nil
+	}
+	return svc.Spec.LoadBalancerClass != nil && *svc.Spec.LoadBalancerClass == class
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// loadBalancerInfo describes a loadbalancer managed by cloud-provider-kind
+type loadBalancerInfo struct {
+	Cluster   string   `json:"cluster"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	VIPs      []string `json:"vips"`
+	Ports     []string `json:"ports"`
+	Nodes     []string `json:"nodes"`
+	Container string   `json:"container"`
+	// ContainerID and ContainerStatus are empty if the container does not exist
+	ContainerID     string `json:"containerID,omitempty"`
+	ContainerStatus string `json:"containerStatus,omitempty"`
+}
+
+// loadBalancerNodesGetter returns the nodes a loadbalancer sends traffic to
+type loadBalancerNodesGetter interface {
+	LoadBalancerNodes(clusterName string, service *v1.Service) []string
+}
+
+// containerStateFunc returns the ID and the status of a container
+type containerStateFunc func(ctx context.Context, name string) (id string, status string, err error)
+
+// loadBalancers returns the loadbalancers of all the clusters
+func (c *Controller) loadBalancers(ctx context.Context) []loadBalancerInfo {
+	result := []loadBalancerInfo{}
+	for _, name := range c.clusterNames() {
+		ccm, ok := c.getCluster(name)
+		if !ok || ccm.cloud == nil {
+			continue
+		}
+		lb, ok := ccm.cloud.LoadBalancer()
+		if !ok {
+			continue
+		}
+		result = append(result, listLoadBalancers(ctx, name, ccm.factory.Core().V1().Services().Lister(), lb, container.State)...)
+	}
+	return result
+}
+
+// listLoadBalancers returns the loadbalancers of the Services of the cluster, sorted by namespace and name.
+func listLoadBalancers(ctx context.Context, clusterName string, services corelisters.ServiceLister, lb cloudprovider.LoadBalancer, state containerStateFunc) []loadBalancerInfo {
+	list, err := services.List(labels.Everything())
+	if err != nil {
+		klog.V(2).InfoS("Can not list Services", "cluster", clusterName, "err", err)
+		return nil
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	result := []loadBalancerInfo{}
+	for _, service := range list {
+		// the Services handled by other implementations are removed by the informer transform
+		if !wantsLoadBalancer(service, "") {
+			continue
+		}
+		info := loadBalancerInfo{
+			Cluster:   clusterName,
+			Namespace: service.Namespace,
+			Name:      service.Name,
+			VIPs:      []string{},
+			Ports:     []string{},
+			Nodes:     []string{},
+			Container: lb.GetLoadBalancerName(ctx, clusterName, service),
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				info.VIPs = append(info.VIPs, ingress.IP)
+			} else if ingress.Hostname != "" {
+				info.VIPs = append(info.VIPs, ingress.Hostname)
+			}
+		}
+		for _, port := range service.Spec.Ports {
+			info.Ports = append(info.Ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		}
+		if getter, ok := lb.(loadBalancerNodesGetter); ok {
+			if nodes := getter.LoadBalancerNodes(clusterName, service); nodes != nil {
+				info.Nodes = nodes
+			}
+		}
+		if id, status, err := state(ctx, info.Container); err == nil {
+			info.ContainerID = id
+			info.ContainerStatus = status
+		}
+		result = append(result, info)
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+type fakeLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	nodes map[string][]string
+}
+
+func (f *fakeLoadBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	return fmt.Sprintf("kindccm-%s-%s-%s", clusterName, service.Namespace, service.Name)
+}
+
+func (f *fakeLoadBalancer) LoadBalancerNodes(clusterName string, service *v1.Service) []string {
+	return f.nodes[service.Name]
+}
+
+func Test_listLoadBalancers(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	services := []*v1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}, {Port: 53, Protocol: v1.ProtocolUDP}},
+			},
+			Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{IP: "172.18.0.5"}, {Hostname: "localhost"}},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pending"},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Port: 443, Protocol: v1.ProtocolTCP}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-ip"},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeClusterIP,
+				Ports: []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}},
+			},
+		},
+	}
+	for _, svc := range services {
+		if err := indexer.Add(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lb := &fakeLoadBalancer{nodes: map[string][]string{"web": {"kind-worker", "kind-worker2"}}}
+	state := func(ctx context.Context, name string) (string, string, error) {
+		if name == "kindccm-kind-ns-web" {
+			return "abc123", "running", nil
+		}
+		return "", "", fmt.Errorf("no such container %s", name)
+	}
+
+	got := listLoadBalancers(context.Background(), "kind", corelisters.NewServiceLister(indexer), lb, state)
+	want := []loadBalancerInfo{
+		{
+			Cluster:   "kind",
+			Namespace: "default",
+			Name:      "pending",
+			VIPs:      []string{},
+			Ports:     []string{"443/TCP"},
+			Nodes:     []string{},
+			Container: "kindccm-kind-default-pending",
+		},
+		{
+			Cluster:         "kind",
+			Namespace:       "ns",
+			Name:            "web",
+			VIPs:            []string{"172.18.0.5", "localhost"},
+			Ports:           []string{"80/TCP", "53/UDP"},
+			Nodes:           []string{"kind-worker", "kind-worker2"},
+			Container:       "kindccm-kind-ns-web",
+			ContainerID:     "abc123",
+			ContainerStatus: "running",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("listLoadBalancers() mismatch (-want +got):\n%s", diff)
+	}
+}
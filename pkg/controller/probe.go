@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"k8s.io/client-go/rest"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+// probeClients are the clients used to check if the apiservers are reachable, there is one per
+// cluster CA so the connections of the probes of the same cluster are reused.
+type probeClients struct {
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+func newProbeClients() *probeClients {
+	return &probeClients{clients: map[string]*http.Client{}}
+}
+
+// forConfig returns the probe client that verifies the apiserver certificate with the CA of the
+// REST config, or that skips the verification if the insecure probes are configured.
+func (p *probeClients) forConfig(config *rest.Config) (*http.Client, error) {
+	insecure := cpkconfig.DefaultConfig.APIServerProbeInsecure
+	key := fmt.Sprintf("%t/%s/%s/%s", insecure, config.TLSClientConfig.ServerName, config.TLSClientConfig.CAFile, config.TLSClientConfig.CAData)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
+	tlsConfig, err := probeTLSConfig(config, insecure)
+	if err != nil {
+		return nil, err
+	}
+	client := newProbeClient(tlsConfig)
+	p.clients[key] = client
+	return client, nil
+}
+
+// closeIdleConnections closes the idle connections of all the probe clients
+func (p *probeClients) closeIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, client := range p.clients {
+		client.CloseIdleConnections()
+	}
+}
+
+// probeTLSConfig returns the TLS configuration to verify the apiserver with the CA of the REST
+// config, the system roots are used if it has none. The client certificates are not needed,
+// the probes only check the connectivity.
+func probeTLSConfig(config *rest.Config, insecure bool) (*tls.Config, error) {
+	if insecure || config.TLSClientConfig.Insecure {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	tlsConfig := &tls.Config{ServerName: config.TLSClientConfig.ServerName}
+	caData := config.TLSClientConfig.CAData
+	if len(caData) == 0 && config.TLSClientConfig.CAFile != "" {
+		data, err := os.ReadFile(config.TLSClientConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not read the CA file of the kubeconfig: %w", err)
+		}
+		caData = data
+	}
+	if len(caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("the CA of the kubeconfig has no valid certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+func Test_probeClientsVerifyCA(t *testing.T) {
+	oldInsecure := cpkconfig.DefaultConfig.APIServerProbeInsecure
+	defer func() { cpkconfig.DefaultConfig.APIServerProbeInsecure = oldInsecure }()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	caData := func(s *httptest.Server) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	}
+	// the test servers share their certificate, other cluster has its own CA
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	tests := []struct {
+		name     string
+		insecure bool
+		config   *rest.Config
+		want     bool
+	}{
+		{name: "cluster CA", config: &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: caData(server)}}, want: true},
+		{name: "other CA", config: &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: otherCA}}},
+		{name: "no CA uses the system roots", config: &rest.Config{}},
+		{name: "insecure flag", insecure: true, config: &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: otherCA}}, want: true},
+		{name: "insecure kubeconfig", config: &rest.Config{TLSClientConfig: rest.TLSClientConfig{Insecure: true}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpkconfig.DefaultConfig.APIServerProbeInsecure = tt.insecure
+			clients := newProbeClients()
+			defer clients.closeIdleConnections()
+			client, err := clients.forConfig(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := probeHTTP(context.Background(), client, server.URL); got != tt.want {
+				t.Errorf("probeHTTP() = %v, want %v", got, tt.want)
+			}
+			// the probes of the same cluster share the client and its connections
+			if again, _ := clients.forConfig(tt.config); again != client {
+				t.Errorf("expected the same client for the same config")
+			}
+		})
+	}
+
+	if _, err := newProbeClients().forConfig(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte("invalid")}}); err == nil {
+		t.Errorf("expected an error for a CA without certificates")
+	}
+}
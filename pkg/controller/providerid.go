@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// providerIDBackfillInterval is the interval between the checks of the Nodes without ProviderID
+const providerIDBackfillInterval = time.Minute
+
+// backfillProviderIDs sets the ProviderID of the Nodes that do not have one, the cloud node
+// controller only sets it on the Nodes registered with the cloud provider taint, and KIND
+// nodes are not.
+func backfillProviderIDs(ctx context.Context, clusterName string, kubeClient kubernetes.Interface, cloud cloudprovider.Interface) {
+	instances, ok := cloud.InstancesV2()
+	if !ok {
+		return
+	}
+	nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.InfoS("Could not list nodes", "cluster", clusterName, "err", err)
+		return
+	}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if node.Spec.ProviderID != "" {
+			continue
+		}
+		metadata, err := instances.InstanceMetadata(ctx, node)
+		if err != nil {
+			klog.InfoS("Could not get instance metadata", "cluster", clusterName, "node", klog.KObj(node), "err", err)
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]string{"providerID": metadata.ProviderID},
+		})
+		if err != nil {
+			continue
+		}
+		_, err = kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			klog.InfoS("Could not set ProviderID", "cluster", clusterName, "node", klog.KObj(node), "err", err)
+			continue
+		}
+		klog.V(2).InfoS("Set ProviderID", "cluster", clusterName, "node", klog.KObj(node), "providerID", metadata.ProviderID)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// loadBalancerResyncer updates a loadbalancer when its configuration changes but the Service does not
+type loadBalancerResyncer interface {
+	ResyncLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error
+}
+
+// watchProxyConfigOverrides resyncs the loadbalancers of the Services that reference
+// a proxy config override ConfigMap when the ConfigMap changes.
+func watchProxyConfigOverrides(ctx context.Context, clusterName string, configMaps coreinformers.ConfigMapInformer, services corelisters.ServiceLister, lb loadBalancerResyncer) error {
+	resync := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return
+		}
+		for _, service := range servicesReferencing(services, namespace, name, constants.ProxyConfigOverrideAnnotationKey) {
+			if err := lb.ResyncLoadBalancer(ctx, clusterName, service); err != nil {
+				klog.InfoS("Error updating loadbalancer with the proxy config override", "cluster", clusterName, "service", klog.KObj(service), "configMap", key, "err", err)
+			}
+		}
+	}
+	_, err := configMaps.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: resync,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCM, ok1 := oldObj.(*v1.ConfigMap)
+			newCM, ok2 := newObj.(*v1.ConfigMap)
+			// skip the informer resyncs
+			if ok1 && ok2 && oldCM.ResourceVersion == newCM.ResourceVersion {
+				return
+			}
+			resync(newObj)
+		},
+		DeleteFunc: resync,
+	})
+	return err
+}
+
+// servicesReferencing returns the Services with loadbalancer whose annotation references
+// the object with the name in their namespace
+func servicesReferencing(services corelisters.ServiceLister, namespace, name, annotation string) []*v1.Service {
+	list, err := services.Services(namespace).List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+	result := []*v1.Service{}
+	for _, service := range list {
+		// the Services in the informer cache are already transformed by the loadbalancer class
+		if !wantsLoadBalancer(service, "") {
+			continue
+		}
+		if service.Annotations[annotation] == name {
+			result = append(result, service)
+		}
+	}
+	return result
+}
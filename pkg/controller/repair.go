@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+// loadBalancerRepairInterval is the interval between the checks of the loadbalancers against their Services
+const loadBalancerRepairInterval = time.Minute
+
+type loadBalancerRepairer interface {
+	RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error
+}
+
+// repairLoadBalancers repairs the loadbalancers of the cluster that diverged from their Service,
+// per example because their container was stopped, detached from its network or its configuration
+// was modified by hand, so the traffic does not break until the Service changes.
+func repairLoadBalancers(ctx context.Context, clusterName string, services corelisters.ServiceLister, lb loadBalancerRepairer) {
+	list, err := services.List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Can not list Services", "cluster", clusterName)
+		return
+	}
+	for _, service := range list {
+		// only the loadbalancers already provisioned, the service controller creates the others
+		if !wantsLoadBalancer(service, config.DefaultConfig.LoadBalancerClass) || len(service.Status.LoadBalancer.Ingress) == 0 {
+			continue
+		}
+		if err := lb.RepairLoadBalancer(ctx, clusterName, service); err != nil {
+			klog.InfoS("Error repairing loadbalancer", "cluster", clusterName, "service", klog.KObj(service), "err", err)
+		}
+	}
+}
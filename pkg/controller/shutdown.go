@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+const (
+	// shutdownTimeout is how long the cleanup of a cluster waits for its controllers to stop
+	shutdownTimeout = 30 * time.Second
+	// cleanupTimeout bounds the deletion of the loadbalancers of a cluster
+	cleanupTimeout = 5 * time.Minute
+)
+
+// errShuttingDown is returned by the load balancer operations started after the shutdown
+var errShuttingDown = errors.New("the cloud controller manager is shutting down")
+
+// goroutines tracks the goroutines and the load balancer operations of a cloud controller
+// manager, so its resources are cleaned up once they have stopped and not while a Service is
+// being reconciled.
+type goroutines struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	stopping bool
+}
+
+// Go runs the function in a goroutine, it is not run once the shutdown started.
+func (g *goroutines) Go(f func()) {
+	if !g.add() {
+		return
+	}
+	go func() {
+		defer g.wg.Done()
+		f()
+	}()
+}
+
+// add tracks a new goroutine or operation, it returns false once the shutdown started
+func (g *goroutines) add() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopping {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// stop prevents new goroutines and operations and waits for the running ones to return, up
+// to the timeout. It returns false if they did not return in time.
+func (g *goroutines) stop(timeout time.Duration) bool {
+	g.mu.Lock()
+	g.stopping = true
+	g.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// controllersContext returns the context of the controllers of a cloud controller manager, it
+// keeps the values of the parent but it is only cancelled by the stopper. If the controllers
+// stopped with the parent the leader would stop leading on exit before the cleanup.
+func controllersContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.WithoutCancel(ctx))
+}
+
+// ccmStopper stops the controllers of a cloud controller manager and cleans up its resources
+type ccmStopper struct {
+	clusterName string
+	cloud       cloudprovider.Interface
+	// cancel cancels the context of the controllers
+	cancel  context.CancelFunc
+	running *goroutines
+	// informers are shut down once the controllers stopped
+	informers interface{ Shutdown() }
+	// leading is true while this instance owns the cluster resources
+	leading             *atomic.Bool
+	manageLoadBalancers bool
+
+	once sync.Once
+	// wasLeading is true if this instance owned the cluster resources when it was stopped
+	wasLeading bool
+}
+
+// stop cancels the controllers and waits for them to stop, only the first call stops them.
+// It returns true if this instance was leading the cluster. The leader elector stops leading
+// when it is cancelled, so it is read before.
+func (s *ccmStopper) stop() bool {
+	s.once.Do(func() {
+		s.wasLeading = s.leading.Load()
+		s.cancel()
+		loadbalancer.StopDraining(s.clusterName)
+		if !s.running.stop(shutdownTimeout) {
+			klog.InfoS("Timed out waiting for the controllers to stop", "cluster", s.clusterName, "timeout", shutdownTimeout)
+		}
+		s.informers.Shutdown()
+	})
+	return s.wasLeading
+}
+
+// stopAndCleanup stops the controllers and then deletes the loadbalancers of the cluster, so the
+// cleanup does not race with a Service being reconciled.
+func (s *ccmStopper) stopAndCleanup() {
+	// the resources are owned by the leader
+	if !s.stop() {
+		klog.V(2).InfoS("Not leading, skipping resources cleanup", "cluster", s.clusterName)
+		return
+	}
+	if !s.ownsLoadBalancers() {
+		return
+	}
+	cleanupLoadBalancers(s.clusterName, s.cloud)
+}
+
+// shutdown stops the controllers and, if this instance was leading the cluster, drains its
+// loadbalancers before deleting them. The controllers are stopped first so the drained
+// loadbalancers are not reconfigured.
+func (s *ccmStopper) shutdown() {
+	if s.stop() && s.ownsLoadBalancers() {
+		drainLoadBalancers(s.clusterName)
+	}
+	s.stopAndCleanup()
+}
+
+// ownsLoadBalancers returns false if the controllers do not create loadbalancers, per example
+// in dry run or without the service controller.
+func (s *ccmStopper) ownsLoadBalancers() bool {
+	return !cpkconfig.DefaultConfig.DryRun && s.manageLoadBalancers
+}
+
+// trackedCloud is the cloud provider of the service controller, its workers keep running
+// after the controller returns so the load balancer operations are tracked instead.
+type trackedCloud struct {
+	cloudprovider.Interface
+	goroutines *goroutines
+}
+
+func (c *trackedCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	lb, ok := c.Interface.LoadBalancer()
+	if !ok {
+		return nil, false
+	}
+	return &trackedLoadBalancer{LoadBalancer: lb, goroutines: c.goroutines}, true
+}
+
+// trackedLoadBalancer refuses the operations that change the load balancers once the
+// shutdown started and tracks the running ones
+type trackedLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	goroutines *goroutines
+}
+
+func (l *trackedLoadBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	if !l.goroutines.add() {
+		return nil, errShuttingDown
+	}
+	defer l.goroutines.wg.Done()
+	return l.LoadBalancer.EnsureLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+func (l *trackedLoadBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	if !l.goroutines.add() {
+		return errShuttingDown
+	}
+	defer l.goroutines.wg.Done()
+	return l.LoadBalancer.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+func (l *trackedLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	if !l.goroutines.add() {
+		return errShuttingDown
+	}
+	defer l.goroutines.wg.Done()
+	return l.LoadBalancer.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+}
@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
+
+	cpkconfig "sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+// blockingLoadBalancer blocks the deletions until release is closed
+type blockingLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	close(b.started)
+	<-b.release
+	return nil
+}
+
+func Test_goroutinesStop(t *testing.T) {
+	g := &goroutines{}
+	release := make(chan struct{})
+	stopped := false
+	g.Go(func() {
+		<-release
+		stopped = true
+	})
+	if g.stop(10 * time.Millisecond) {
+		t.Fatalf("expected the stop to time out while a goroutine is running")
+	}
+	close(release)
+	if !g.stop(time.Second) {
+		t.Fatalf("expected the goroutines to stop")
+	}
+	if !stopped {
+		t.Errorf("expected the goroutine to return before the stop")
+	}
+
+	ran := make(chan struct{})
+	g.Go(func() { close(ran) })
+	select {
+	case <-ran:
+		t.Errorf("expected the goroutines started after the stop not to run")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func Test_trackedLoadBalancer(t *testing.T) {
+	g := &goroutines{}
+	blocking := &blockingLoadBalancer{started: make(chan struct{}), release: make(chan struct{})}
+	lb := &trackedLoadBalancer{LoadBalancer: blocking, goroutines: g}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- lb.EnsureLoadBalancerDeleted(context.Background(), "kind", &v1.Service{})
+	}()
+	<-blocking.started
+	// the cleanup waits for the operation in progress
+	stopCh := make(chan bool, 1)
+	go func() { stopCh <- g.stop(time.Second) }()
+	select {
+	case <-stopCh:
+		t.Fatalf("expected the stop to wait for the deletion in progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(blocking.release)
+	if !<-stopCh {
+		t.Fatalf("expected the stop to return once the deletion finished")
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the operations are refused once the shutdown started
+	if _, err := lb.EnsureLoadBalancer(context.Background(), "kind", &v1.Service{}, nil); !errors.Is(err, errShuttingDown) {
+		t.Errorf("expected error %v, got %v", errShuttingDown, err)
+	}
+	if err := lb.UpdateLoadBalancer(context.Background(), "kind", &v1.Service{}, nil); !errors.Is(err, errShuttingDown) {
+		t.Errorf("expected error %v, got %v", errShuttingDown, err)
+	}
+}
+
+// fakeCloud is a cloud provider with the loadbalancer
+type fakeCloud struct {
+	cloudprovider.Interface
+	lb cloudprovider.LoadBalancer
+}
+
+func (f *fakeCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
+	return f.lb, true
+}
+
+// deletingLoadBalancer records the Services whose loadbalancer is deleted and the clusters cleaned up
+type deletingLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	mu      sync.Mutex
+	deleted []string
+	cleaned []string
+}
+
+func (d *deletingLoadBalancer) CleanupLoadBalancers(ctx context.Context, clusterName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cleaned = append(d.cleaned, clusterName)
+	return nil
+}
+
+func (d *deletingLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deleted = append(d.deleted, clusterName+"/"+service.Namespace+"/"+service.Name)
+	return nil
+}
+
+// fakeLoadBalancers replaces the container runtime with one that has the shared loadbalancer
+// and the loadbalancer of the Service default/web of the cluster kind
+func fakeLoadBalancers(t *testing.T) *containertest.Runtime {
+	t.Helper()
+	runtime := containertest.New(t, `case "$*" in
+ps*) printf 'shared\nweb\n' ;;
+inspect*shared) echo '{"io.x-k8s.cloud-provider-kind.cluster":"kind","io.x-k8s.cloud-provider-kind.loadbalancer.shared":"true"}' ;;
+inspect*web) echo '{"io.x-k8s.cloud-provider-kind.cluster":"kind","io.x-k8s.cloud-provider-kind.loadbalancer.name":"kind/default/web","io.x-k8s.cloud-provider-kind.service.namespace":"default","io.x-k8s.cloud-provider-kind.service.name":"web"}' ;;
+esac`)
+	t.Cleanup(container.Use(runtime))
+	return runtime
+}
+
+func Test_cleanupLoadBalancers(t *testing.T) {
+	runtime := fakeLoadBalancers(t)
+	lb := &deletingLoadBalancer{}
+	cleanupLoadBalancers("kind", &fakeCloud{lb: lb})
+
+	if want := []string{"kind/default/web"}; !reflect.DeepEqual(lb.deleted, want) {
+		t.Errorf("expected the loadbalancers %v to be deleted, got %v", want, lb.deleted)
+	}
+	if want := []string{"kind"}; !reflect.DeepEqual(lb.cleaned, want) {
+		t.Errorf("expected the resources of the clusters %v to be cleaned up, got %v", want, lb.cleaned)
+	}
+	deletedShared := false
+	for _, command := range runtime.Commands() {
+		if command == "rm -f shared" {
+			deletedShared = true
+		}
+	}
+	if !deletedShared {
+		t.Errorf("expected the shared loadbalancer to be deleted, got the commands %q", runtime.Commands())
+	}
+}
+
+func Test_ccmStopperStopAndCleanup(t *testing.T) {
+	tests := []struct {
+		name    string
+		leading bool
+		// exit cancels the parent context before stopping the controllers
+		exit bool
+		want []string
+	}{
+		{name: "leader", leading: true, want: []string{"kind/default/web"}},
+		{name: "leader on exit", leading: true, exit: true, want: []string{"kind/default/web"}},
+		{name: "not leading"},
+		{name: "not leading on exit", exit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeLoadBalancers(t)
+			lb := &deletingLoadBalancer{}
+			parent, exit := context.WithCancel(context.Background())
+			defer exit()
+			ctx, cancel := controllersContext(parent)
+			leading := &atomic.Bool{}
+			leading.Store(tt.leading)
+			running := &goroutines{}
+			// the leader elector stops leading when its context is cancelled
+			running.Go(func() {
+				<-ctx.Done()
+				leading.Store(false)
+			})
+			stopper := &ccmStopper{
+				clusterName:         "kind",
+				cloud:               &fakeCloud{lb: lb},
+				cancel:              cancel,
+				running:             running,
+				informers:           informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0),
+				leading:             leading,
+				manageLoadBalancers: true,
+			}
+			if tt.exit {
+				exit()
+				// give the leader elector the chance to stop leading
+				time.Sleep(10 * time.Millisecond)
+			}
+			stopper.stopAndCleanup()
+
+			if ctx.Err() == nil {
+				t.Errorf("expected the controllers to be cancelled")
+			}
+			if !reflect.DeepEqual(lb.deleted, tt.want) {
+				t.Errorf("expected the loadbalancers %v to be deleted, got %v", tt.want, lb.deleted)
+			}
+		})
+	}
+}
+
+func Test_ccmStopperShutdown(t *testing.T) {
+	oldGracePeriod := cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod
+	defer func() { cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod = oldGracePeriod }()
+	cpkconfig.DefaultConfig.LoadBalancerDrainGracePeriod = time.Millisecond
+
+	tests := []struct {
+		name                string
+		leading             bool
+		manageLoadBalancers bool
+		wantDrained         bool
+		want                []string
+	}{
+		{name: "leader", leading: true, manageLoadBalancers: true, wantDrained: true, want: []string{"kind/default/web"}},
+		{name: "not leading", manageLoadBalancers: true},
+		{name: "without service controller", leading: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := fakeLoadBalancers(t)
+			lb := &deletingLoadBalancer{}
+			ctx, cancel := controllersContext(context.Background())
+			leading := &atomic.Bool{}
+			leading.Store(tt.leading)
+			stopper := &ccmStopper{
+				clusterName:         "kind",
+				cloud:               &fakeCloud{lb: lb},
+				cancel:              cancel,
+				running:             &goroutines{},
+				informers:           informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0),
+				leading:             leading,
+				manageLoadBalancers: tt.manageLoadBalancers,
+			}
+			stopper.shutdown()
+
+			if ctx.Err() == nil {
+				t.Errorf("expected the controllers to be cancelled")
+			}
+			drained := false
+			for _, command := range runtime.Commands() {
+				if strings.Contains(command, ".NetworkSettings.Ports") {
+					drained = true
+				}
+			}
+			if drained != tt.wantDrained {
+				t.Errorf("expected the loadbalancers drained %v, got the commands %q", tt.wantDrained, runtime.Commands())
+			}
+			if !tt.leading && len(runtime.Commands()) != 0 {
+				t.Errorf("expected the loadbalancers of other instance to be left alone, got the commands %q", runtime.Commands())
+			}
+			if !reflect.DeepEqual(lb.deleted, tt.want) {
+				t.Errorf("expected the loadbalancers %v to be deleted, got %v", tt.want, lb.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// watchTLSSecrets resyncs the loadbalancers of the Services that terminate TLS with the
+// certificate of a Secret when the Secret changes, so the rotated certificates are served.
+func watchTLSSecrets(ctx context.Context, clusterName string, secrets coreinformers.SecretInformer, services corelisters.ServiceLister, lb loadBalancerResyncer) error {
+	resync := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return
+		}
+		for _, service := range servicesReferencing(services, namespace, name, constants.TLSSecretAnnotationKey) {
+			if err := lb.ResyncLoadBalancer(ctx, clusterName, service); err != nil {
+				klog.InfoS("Error updating loadbalancer with the TLS Secret", "cluster", clusterName, "service", klog.KObj(service), "secret", key, "err", err)
+			}
+		}
+	}
+	_, err := secrets.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: resync,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, ok1 := oldObj.(*v1.Secret)
+			newSecret, ok2 := newObj.(*v1.Secret)
+			// skip the informer resyncs
+			if ok1 && ok2 && oldSecret.ResourceVersion == newSecret.ResourceVersion {
+				return
+			}
+			resync(newObj)
+		},
+		DeleteFunc: resync,
+	})
+	return err
+}
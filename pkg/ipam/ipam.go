@@ -0,0 +1,295 @@
+package ipam
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/netip"
+	"strconv"
+	"sync"
+)
+
+const (
+	// sparseHostBits is the number of host bits of the IPv6 ranges from which the addresses are
+	// allocated sparsely, the smaller ranges are allocated in order
+	sparseHostBits = 16
+	// sparseAttempts is the number of addresses derived from the owner that are tried before
+	// allocating the first free address of a sparse range
+	sparseAttempts = 32
+	// subnetAnycastAddresses is the number of addresses at the end of each IPv6 /64 subnet
+	// reserved for the subnet anycast addresses, RFC 2526
+	subnetAnycastAddresses = 128
+)
+
+var (
+	// ErrExhausted is returned when there are no free addresses in the range
+	ErrExhausted = errors.New("no free addresses in the range")
+	// ErrInUse is returned when the requested address is allocated to other owner
+	ErrInUse = errors.New("address already in use")
+	// ErrOutOfRange is returned when the requested address can not be allocated from the range
+	ErrOutOfRange = errors.New("address out of range")
+)
+
+// Allocator hands out the addresses of a range to their owners,
+// an owner can only have one address allocated.
+type Allocator struct {
+	mu     sync.Mutex
+	prefix netip.Prefix
+	// key is the address and the value the owner
+	allocated map[netip.Addr]string
+	// reserved are the addresses in use in the network, per example by the gateway, the
+	// nodes or the existing containers, the key is the address and the value the owner
+	reserved map[netip.Addr]string
+}
+
+// New returns an Allocator for the addresses in the prefix.
+func New(prefix netip.Prefix) *Allocator {
+	return &Allocator{
+		prefix:    prefix.Masked(),
+		allocated: map[netip.Addr]string{},
+		reserved:  map[netip.Addr]string{},
+	}
+}
+
+// Prefix returns the range of the allocator.
+func (a *Allocator) Prefix() netip.Prefix {
+	return a.prefix
+}
+
+// Clone returns a copy of the allocator with the same allocated and reserved addresses,
+// changing the copy does not change the allocator.
+func (a *Allocator) Clone() *Allocator {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	clone := New(a.prefix)
+	for addr, owner := range a.allocated {
+		clone.allocated[addr] = owner
+	}
+	for addr, owner := range a.reserved {
+		clone.reserved[addr] = owner
+	}
+	return clone
+}
+
+// Reserve marks the address as used by the owner, addresses out of the range are ignored.
+// It is used to sync the allocator with the addresses already in use.
+func (a *Allocator) Reserve(addr netip.Addr, owner string) {
+	if !a.prefix.Contains(addr) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reserved[addr] = owner
+}
+
+// SyncReserved replaces the addresses in use in the network with the given ones, so the
+// addresses of the containers that were removed can be allocated again. The addresses
+// allocated are kept and the addresses out of the range are ignored.
+func (a *Allocator) SyncReserved(addresses map[netip.Addr]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reserved = map[netip.Addr]string{}
+	for addr, owner := range addresses {
+		if a.prefix.Contains(addr) {
+			a.reserved[addr] = owner
+		}
+	}
+}
+
+// owner returns the owner of the address, allocated or reserved
+func (a *Allocator) owner(addr netip.Addr) (string, bool) {
+	if o, ok := a.allocated[addr]; ok {
+		return o, true
+	}
+	o, ok := a.reserved[addr]
+	return o, ok
+}
+
+// Allocate returns a free address for the owner, if the owner already has an address
+// allocated or reserved, per example its existing container, it returns the same address.
+func (a *Allocator) Allocate(owner string) (netip.Addr, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for addr, o := range a.allocated {
+		if o == owner {
+			return addr, nil
+		}
+	}
+	for addr, o := range a.reserved {
+		if o == owner && a.usable(addr) {
+			a.allocated[addr] = owner
+			return addr, nil
+		}
+	}
+	if a.sparse() {
+		// the address depends on the owner, the same Service gets the same address in
+		// any allocator of the range unless it is in use
+		for attempt := 0; attempt < sparseAttempts; attempt++ {
+			addr := a.ownerAddr(owner, attempt)
+			if _, ok := a.owner(addr); !ok && a.usable(addr) {
+				a.allocated[addr] = owner
+				return addr, nil
+			}
+		}
+	}
+	// the scan stops at the first free address, the large ranges are not enumerated
+	for addr := a.first(); a.prefix.Contains(addr); addr = addr.Next() {
+		if a.isBroadcast(addr) {
+			break
+		}
+		if _, ok := a.owner(addr); !ok && a.usable(addr) {
+			a.allocated[addr] = owner
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("allocating address on %s: %w", a.prefix, ErrExhausted)
+}
+
+// AllocateSpecific allocates the requested address to the owner, releasing any
+// other address the owner had allocated.
+func (a *Allocator) AllocateSpecific(addr netip.Addr, owner string) error {
+	if !a.usable(addr) {
+		return fmt.Errorf("allocating address %s on %s: %w", addr, a.prefix, ErrOutOfRange)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if o, ok := a.owner(addr); ok && o != owner {
+		return fmt.Errorf("allocating address %s used by %s: %w", addr, o, ErrInUse)
+	}
+	for allocated, o := range a.allocated {
+		if o == owner {
+			delete(a.allocated, allocated)
+		}
+	}
+	a.allocated[addr] = owner
+	return nil
+}
+
+// Lookup returns the address allocated to the owner, false if it has none.
+func (a *Allocator) Lookup(owner string) (netip.Addr, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for addr, o := range a.allocated {
+		if o == owner {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// Release frees the address of the owner.
+func (a *Allocator) Release(owner string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for addr, o := range a.allocated {
+		if o == owner {
+			delete(a.allocated, addr)
+		}
+	}
+	for addr, o := range a.reserved {
+		if o == owner {
+			delete(a.reserved, addr)
+		}
+	}
+}
+
+// Size returns the number of addresses that can be allocated from the range, the network
+// and the IPv4 broadcast addresses are excluded. It is capped at math.MaxInt64 for the ranges
+// with 63 host bits or more, like the IPv6 /64 subnets, that are never enumerated.
+func (a *Allocator) Size() uint64 {
+	hostBits := a.prefix.Addr().BitLen() - a.prefix.Bits()
+	if hostBits >= 63 {
+		return math.MaxInt64
+	}
+	size := uint64(1) << hostBits
+	if a.prefix.Bits() < a.prefix.Addr().BitLen() {
+		size--
+	}
+	if a.prefix.Addr().Is4() && a.prefix.Bits() < 31 {
+		size--
+	}
+	return size
+}
+
+// Used returns the number of addresses of the range that are allocated or reserved.
+func (a *Allocator) Used() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	used := uint64(0)
+	for addr := range a.allocated {
+		if a.usable(addr) {
+			used++
+		}
+	}
+	for addr := range a.reserved {
+		// the address of an allocated container is also reserved once it is in the network
+		if _, ok := a.allocated[addr]; !ok && a.usable(addr) {
+			used++
+		}
+	}
+	return used
+}
+
+// usable returns true if the address can be allocated, it is in the range and it is
+// not the network, that is the IPv6 subnet-router anycast address, the IPv4 broadcast,
+// an IPv6 subnet anycast or an IPv6 link-local address
+func (a *Allocator) usable(addr netip.Addr) bool {
+	if !a.prefix.Contains(addr) || addr == a.prefix.Addr() && a.prefix.Bits() < addr.BitLen() {
+		return false
+	}
+	if addr.Is6() && addr.IsLinkLocalUnicast() {
+		return false
+	}
+	return !a.isBroadcast(addr) && !a.isSubnetAnycast(addr)
+}
+
+// sparse returns true if the addresses of the range are derived from their owners
+func (a *Allocator) sparse() bool {
+	return a.prefix.Addr().Is6() && a.prefix.Addr().BitLen()-a.prefix.Bits() > sparseHostBits
+}
+
+// ownerAddr returns the address of the range derived from the owner for the attempt
+func (a *Allocator) ownerAddr(owner string, attempt int) netip.Addr {
+	h := fnv.New64a()
+	h.Write([]byte(owner + "/" + strconv.Itoa(attempt)))
+	offset := h.Sum64()
+	if hostBits := a.prefix.Addr().BitLen() - a.prefix.Bits(); hostBits < 64 {
+		offset &= 1<<hostBits - 1
+	}
+	// the host bits of the masked prefix are zero
+	b := a.prefix.Addr().As16()
+	binary.BigEndian.PutUint64(b[8:], binary.BigEndian.Uint64(b[8:])|offset)
+	return netip.AddrFrom16(b)
+}
+
+// first returns the first usable address of the range, the network address is skipped
+func (a *Allocator) first() netip.Addr {
+	addr := a.prefix.Addr()
+	if a.prefix.Bits() < addr.BitLen() {
+		addr = addr.Next()
+	}
+	return addr
+}
+
+// isSubnetAnycast returns true if the address is one of the reserved subnet anycast addresses
+// of its /64 subnet, the highest 128 interface identifiers and their EUI-64 variant, RFC 2526.
+// They are only reserved if the range has whole subnets.
+func (a *Allocator) isSubnetAnycast(addr netip.Addr) bool {
+	if !addr.Is6() || a.prefix.Bits() > 64 {
+		return false
+	}
+	b := addr.As16()
+	id := binary.BigEndian.Uint64(b[8:])
+	return id >= math.MaxUint64-subnetAnycastAddresses+1 ||
+		id>>7 == 0xfdffffffffffff80>>7
+}
+
+// isBroadcast returns true if the address is the IPv4 broadcast address of the range
+func (a *Allocator) isBroadcast(addr netip.Addr) bool {
+	if !addr.Is4() || a.prefix.Bits() >= 31 {
+		return false
+	}
+	return !a.prefix.Contains(addr.Next())
+}
@@ -0,0 +1,244 @@
+package ipam
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"testing"
+)
+
+func TestAllocator(t *testing.T) {
+	a := New(netip.MustParsePrefix("192.168.8.0/30"))
+	// the gateway
+	a.Reserve(netip.MustParseAddr("192.168.8.1"), "gateway")
+	// out of range addresses are ignored
+	a.Reserve(netip.MustParseAddr("10.0.0.1"), "other")
+
+	addr, err := a.Allocate("lb1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addr != netip.MustParseAddr("192.168.8.2") {
+		t.Fatalf("expected 192.168.8.2, got %s", addr)
+	}
+	// same owner gets the same address
+	again, err := a.Allocate("lb1")
+	if err != nil || again != addr {
+		t.Fatalf("expected %s, got %s : %v", addr, again, err)
+	}
+	// the broadcast address is not allocated
+	_, err = a.Allocate("lb2")
+	if !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected exhausted error, got %v", err)
+	}
+	if got, ok := a.Lookup("lb1"); !ok || got != addr {
+		t.Fatalf("expected lb1 to have %s, got %s", addr, got)
+	}
+	a.Release("lb1")
+	if _, ok := a.Lookup("lb1"); ok {
+		t.Fatalf("expected lb1 to have no address after release")
+	}
+	addr, err = a.Allocate("lb2")
+	if err != nil || addr != netip.MustParseAddr("192.168.8.2") {
+		t.Fatalf("expected 192.168.8.2, got %s : %v", addr, err)
+	}
+}
+
+func TestAllocatorIPv6(t *testing.T) {
+	a := New(netip.MustParsePrefix("fc00:f853:ccd:e793::/120"))
+	a.Reserve(netip.MustParseAddr("fc00:f853:ccd:e793::1"), "gateway")
+	addr, err := a.Allocate("lb1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addr != netip.MustParseAddr("fc00:f853:ccd:e793::2") {
+		t.Fatalf("expected fc00:f853:ccd:e793::2, got %s", addr)
+	}
+}
+
+func TestAllocatorIPv6ULA(t *testing.T) {
+	prefix := netip.MustParsePrefix("fd00:10:244::/64")
+	a := New(prefix)
+	a.Reserve(netip.MustParseAddr("fd00:10:244::1"), "gateway")
+	addrs := map[netip.Addr]bool{}
+	for _, owner := range []string{"lb1", "lb2", "lb3"} {
+		addr, err := a.Allocate(owner)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !prefix.Contains(addr) || addrs[addr] {
+			t.Fatalf("expected a new address of %s, got %s", prefix, addr)
+		}
+		// the addresses are spread over the subnet
+		if addr.Compare(netip.MustParseAddr("fd00:10:244::ffff")) <= 0 {
+			t.Errorf("expected a sparse address, got %s", addr)
+		}
+		addrs[addr] = true
+	}
+
+	// other allocator of the range gives the same address to the owner
+	lb1, _ := a.Lookup("lb1")
+	if addr, err := New(prefix).Allocate("lb1"); err != nil || addr != lb1 {
+		t.Errorf("expected %s, got %s : %v", lb1, addr, err)
+	}
+	// the owner gets other address if its address is in use
+	b := New(prefix)
+	b.Reserve(lb1, "container")
+	if addr, err := b.Allocate("lb1"); err != nil || addr == lb1 || !prefix.Contains(addr) {
+		t.Errorf("expected other address than %s, got %s : %v", lb1, addr, err)
+	}
+
+	for _, addr := range []string{
+		"fd00:10:244::",                    // subnet-router anycast
+		"fd00:10:244::ffff:ffff:ffff:ff80", // subnet anycast
+		"fd00:10:244::ffff:ffff:ffff:ffff", // subnet anycast
+		"fd00:10:244::fdff:ffff:ffff:ff80", // subnet anycast, EUI-64
+		"fe80::1",                          // link-local
+	} {
+		if err := a.AllocateSpecific(netip.MustParseAddr(addr), "lb4"); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("expected %s to be out of range, got %v", addr, err)
+		}
+	}
+	if err := a.AllocateSpecific(netip.MustParseAddr("fd00:10:244::ffff:ffff:ffff:ff7f"), "lb4"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAllocatorIPv6LinkLocal(t *testing.T) {
+	a := New(netip.MustParsePrefix("fe80::/120"))
+	if _, err := a.Allocate("lb1"); !errors.Is(err, ErrExhausted) {
+		t.Errorf("expected error %v, got %v", ErrExhausted, err)
+	}
+}
+
+func TestAllocatorAllocateSpecific(t *testing.T) {
+	a := New(netip.MustParsePrefix("192.168.8.0/24"))
+	a.Reserve(netip.MustParseAddr("192.168.8.1"), "gateway")
+
+	tests := []struct {
+		name  string
+		addr  string
+		owner string
+		err   error
+	}{
+		{name: "free address", addr: "192.168.8.7", owner: "lb1"},
+		{name: "same owner", addr: "192.168.8.7", owner: "lb1"},
+		{name: "other owner", addr: "192.168.8.7", owner: "lb2", err: ErrInUse},
+		{name: "gateway", addr: "192.168.8.1", owner: "lb2", err: ErrInUse},
+		{name: "network address", addr: "192.168.8.0", owner: "lb2", err: ErrOutOfRange},
+		{name: "broadcast address", addr: "192.168.8.255", owner: "lb2", err: ErrOutOfRange},
+		{name: "out of range", addr: "10.0.0.7", owner: "lb2", err: ErrOutOfRange},
+		{name: "other address for the same owner", addr: "192.168.8.8", owner: "lb1"},
+		{name: "previous address is released", addr: "192.168.8.7", owner: "lb2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.AllocateSpecific(netip.MustParseAddr(tt.addr), tt.owner)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAllocatorSize(t *testing.T) {
+	tests := []struct {
+		prefix string
+		size   uint64
+	}{
+		{prefix: "192.168.8.0/24", size: 254},
+		{prefix: "192.168.8.0/30", size: 2},
+		{prefix: "192.168.8.0/31", size: 1},
+		{prefix: "192.168.8.1/32", size: 1},
+		{prefix: "fc00:f853:ccd:e793::/120", size: 255},
+		{prefix: "fc00:f853:ccd:e793::/112", size: 65535},
+		{prefix: "fc00:f853:ccd:e793::/64", size: math.MaxInt64},
+		{prefix: "fd00:10:244::/48", size: math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := New(netip.MustParsePrefix(tt.prefix)).Size(); got != tt.size {
+				t.Errorf("expected size %d, got %d", tt.size, got)
+			}
+		})
+	}
+}
+
+func TestAllocatorUsed(t *testing.T) {
+	a := New(netip.MustParsePrefix("192.168.8.0/24"))
+	a.Reserve(netip.MustParseAddr("192.168.8.1"), "gateway")
+	a.Reserve(netip.MustParseAddr("192.168.8.255"), "broadcast")
+	a.Reserve(netip.MustParseAddr("10.0.0.1"), "other")
+	if _, err := a.Allocate("lb1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if used := a.Used(); used != 2 {
+		t.Errorf("expected 2 addresses used, got %d", used)
+	}
+	a.Release("lb1")
+	if used := a.Used(); used != 1 {
+		t.Errorf("expected 1 address used, got %d", used)
+	}
+}
+
+func TestAllocatorSyncReserved(t *testing.T) {
+	a := New(netip.MustParsePrefix("192.168.8.0/29"))
+	a.SyncReserved(map[netip.Addr]string{
+		netip.MustParseAddr("192.168.8.1"): "gateway",
+		netip.MustParseAddr("192.168.8.2"): "kind-worker",
+		netip.MustParseAddr("192.168.8.3"): "lb1",
+		netip.MustParseAddr("10.0.0.1"):    "other",
+	})
+	// the existing container keeps its address
+	addr, err := a.Allocate("lb1")
+	if err != nil || addr != netip.MustParseAddr("192.168.8.3") {
+		t.Fatalf("expected 192.168.8.3, got %s : %v", addr, err)
+	}
+	addr, err = a.Allocate("lb2")
+	if err != nil || addr != netip.MustParseAddr("192.168.8.4") {
+		t.Fatalf("expected 192.168.8.4, got %s : %v", addr, err)
+	}
+	if err := a.AllocateSpecific(netip.MustParseAddr("192.168.8.2"), "lb3"); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected in use error, got %v", err)
+	}
+	if used := a.Used(); used != 4 {
+		t.Errorf("expected 4 addresses used, got %d", used)
+	}
+
+	// the node was removed, the allocated addresses are kept
+	a.SyncReserved(map[netip.Addr]string{
+		netip.MustParseAddr("192.168.8.1"): "gateway",
+		netip.MustParseAddr("192.168.8.3"): "lb1",
+	})
+	if err := a.AllocateSpecific(netip.MustParseAddr("192.168.8.2"), "lb3"); err != nil {
+		t.Fatalf("expected the address of the removed node to be free, got %v", err)
+	}
+	if used := a.Used(); used != 4 {
+		t.Errorf("expected 4 addresses used, got %d", used)
+	}
+	a.Release("lb1")
+	if used := a.Used(); used != 3 {
+		t.Errorf("expected 3 addresses used after the release, got %d", used)
+	}
+}
+
+func TestAllocatorClone(t *testing.T) {
+	a := New(netip.MustParsePrefix("192.168.8.0/29"))
+	a.Reserve(netip.MustParseAddr("192.168.8.1"), "gateway")
+	if _, err := a.Allocate("lb1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clone := a.Clone()
+	if used := clone.Used(); used != 2 {
+		t.Errorf("expected 2 addresses used in the copy, got %d", used)
+	}
+	// the changes of the copy are not seen by the allocator
+	clone.SyncReserved(map[netip.Addr]string{netip.MustParseAddr("192.168.8.5"): "kind-worker"})
+	clone.Release("lb1")
+	if used := a.Used(); used != 2 {
+		t.Errorf("expected 2 addresses used, got %d", used)
+	}
+	if err := a.AllocateSpecific(netip.MustParseAddr("192.168.8.5"), "lb2"); err != nil {
+		t.Errorf("expected the address reserved in the copy to be free, got %v", err)
+	}
+}
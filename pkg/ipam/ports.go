@@ -0,0 +1,89 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+)
+
+// ErrPortInUse is returned when a port of the address is used by other owner
+var ErrPortInUse = errors.New("port already in use")
+
+// Ports tracks the ports used on each address by their owners, so the loadbalancers of
+// two owners are not assigned the same address and port. A nil Ports does not track them.
+type Ports struct {
+	mu sync.Mutex
+	// key is the address, the second key is the port and protocol and the value the owner
+	used map[netip.Addr]map[string]string
+}
+
+// NewPorts returns an empty Ports.
+func NewPorts() *Ports {
+	return &Ports{used: map[netip.Addr]map[string]string{}}
+}
+
+// Claim assigns the ports of the addresses to the owner, replacing the ports the owner
+// had before. It fails without changes if any of them is used by other owner.
+func (p *Ports) Claim(owner string, addrs []netip.Addr, ports []string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, addr := range addrs {
+		for _, port := range ports {
+			if o, ok := p.used[addr][port]; ok && o != owner {
+				return fmt.Errorf("port %s of address %s is used by %s: %w", port, addr, o, ErrPortInUse)
+			}
+		}
+	}
+	p.release(owner)
+	for _, addr := range addrs {
+		if _, ok := p.used[addr]; !ok {
+			p.used[addr] = map[string]string{}
+		}
+		for _, port := range ports {
+			p.used[addr][port] = owner
+		}
+	}
+	return nil
+}
+
+// Release frees the ports of the owner.
+func (p *Ports) Release(owner string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.release(owner)
+}
+
+func (p *Ports) release(owner string) {
+	for addr, ports := range p.used {
+		for port, o := range ports {
+			if o == owner {
+				delete(ports, port)
+			}
+		}
+		if len(ports) == 0 {
+			delete(p.used, addr)
+		}
+	}
+}
+
+// Owned returns the sorted ports of the address used by the owner.
+func (p *Ports) Owned(addr netip.Addr, owner string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ports := []string{}
+	for port, o := range p.used[addr] {
+		if o == owner {
+			ports = append(ports, port)
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
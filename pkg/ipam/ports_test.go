@@ -0,0 +1,55 @@
+package ipam
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestPorts(t *testing.T) {
+	p := NewPorts()
+	vip := netip.MustParseAddr("172.18.0.10")
+	other := netip.MustParseAddr("172.18.0.11")
+
+	if err := p.Claim("kind/ns/web", []netip.Addr{vip}, []string{"80/TCP", "443/TCP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the same owner can claim its ports again
+	if err := p.Claim("kind/ns/web", []netip.Addr{vip}, []string{"80/TCP", "443/TCP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// other protocol of the same port or other address do not collide
+	if err := p.Claim("kind/ns/dns", []netip.Addr{vip}, []string{"80/UDP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Claim("kind/ns/api", []netip.Addr{other}, []string{"443/TCP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the collision is rejected without changing the claims of the owner
+	err := p.Claim("kind/ns/api", []netip.Addr{other, vip}, []string{"443/TCP"})
+	if !errors.Is(err, ErrPortInUse) {
+		t.Fatalf("expected port in use error, got %v", err)
+	}
+	if got := p.Owned(other, "kind/ns/api"); !reflect.DeepEqual(got, []string{"443/TCP"}) {
+		t.Errorf("expected the claims to be kept after the collision, got %v", got)
+	}
+
+	// the ports no longer claimed are freed
+	if err := p.Claim("kind/ns/web", []netip.Addr{vip}, []string{"80/TCP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Claim("kind/ns/api", []netip.Addr{other, vip}, []string{"443/TCP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := p.Owned(vip, "kind/ns/api"); !reflect.DeepEqual(got, []string{"443/TCP"}) {
+		t.Errorf("Owned() = %v, want [443/TCP]", got)
+	}
+
+	// the released ports can be claimed by other owner
+	p.Release("kind/ns/web")
+	if err := p.Claim("kind/ns/other", []netip.Addr{vip}, []string{"80/TCP"}); err != nil {
+		t.Fatalf("unexpected error after release: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+// accessLogDir is where the directory of the access log file is mounted in the loadbalancer containers.
+const accessLogDir = "/var/log/cloud-provider-kind"
+
+// accessLogConfig returns whether the access logs are enabled and
+// the path of the file inside the loadbalancer containers, empty for the container output.
+func accessLogConfig() (bool, string) {
+	switch v := config.DefaultConfig.LoadBalancerAccessLog; v {
+	case "", config.AccessLogStdout:
+		return true, ""
+	case config.AccessLogNone:
+		return false, ""
+	default:
+		return true, filepath.ToSlash(filepath.Join(accessLogDir, filepath.Base(v)))
+	}
+}
+
+// accessLogVolumeArgs returns the arguments to mount the directory of the access log file
+// in the loadbalancer containers, nil if the access logs are not written to a file.
+func accessLogVolumeArgs() []string {
+	switch v := config.DefaultConfig.LoadBalancerAccessLog; v {
+	case "", config.AccessLogStdout, config.AccessLogNone:
+		return nil
+	default:
+		return []string{"--volume", fmt.Sprintf("%s:%s", filepath.Dir(v), accessLogDir)}
+	}
+}
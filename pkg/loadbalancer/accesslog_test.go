@@ -0,0 +1,54 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+func Test_accessLogConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessLog   string
+		wantEnabled bool
+		wantPath    string
+		wantArgs    []string
+	}{
+		{
+			name:        "default",
+			wantEnabled: true,
+		},
+		{
+			name:        "stdout",
+			accessLog:   config.AccessLogStdout,
+			wantEnabled: true,
+		},
+		{
+			name:      "none",
+			accessLog: config.AccessLogNone,
+		},
+		{
+			name:        "file",
+			accessLog:   "/tmp/kind/access.log",
+			wantEnabled: true,
+			wantPath:    "/var/log/cloud-provider-kind/access.log",
+			wantArgs:    []string{"--volume", "/tmp/kind:/var/log/cloud-provider-kind"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.DefaultConfig.LoadBalancerAccessLog
+			config.DefaultConfig.LoadBalancerAccessLog = tt.accessLog
+			defer func() { config.DefaultConfig.LoadBalancerAccessLog = old }()
+
+			enabled, path := accessLogConfig()
+			if enabled != tt.wantEnabled || path != tt.wantPath {
+				t.Errorf("accessLogConfig() = %v, %q, want %v, %q", enabled, path, tt.wantEnabled, tt.wantPath)
+			}
+			if got := accessLogVolumeArgs(); !reflect.DeepEqual(got, tt.wantArgs) {
+				t.Errorf("accessLogVolumeArgs() = %v, want %v", got, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// announceCount is the number of announcements sent for each address, in case some are lost
+const announceCount = 3
+
+// announceCommands returns the commands that announce the addresses to the neighbors on the
+// interface that has them, a gratuitous ARP for the IPv4 address and an unsolicited neighbor
+// advertisement for the IPv6 address.
+func announceCommands(ipv4, ipv6 string) []string {
+	commands := []string{}
+	if ipv4 != "" {
+		commands = append(commands, fmt.Sprintf(`arping -U -c %d -I "$(ip -o -4 addr show to %s | awk '{print $2}')" %s`, announceCount, ipv4, ipv4))
+	}
+	if ipv6 != "" {
+		commands = append(commands, fmt.Sprintf(`for i in $(seq %d); do ndsend %s "$(ip -o -6 addr show to %s | awk '{print $2}')"; done`, announceCount, ipv6, ipv6))
+	}
+	return commands
+}
+
+// announceAddresses announces the addresses of the loadbalancer container so the neighbors that
+// cached the previous owner of the addresses send the traffic to it, per example after it replaced
+// other container keeping its addresses. The errors are only logged because the neighbors learn
+// the addresses anyway once their caches expire.
+func announceAddresses(ctx context.Context, name string) {
+	if !config.DefaultConfig.LoadBalancerAnnounceAddresses {
+		return
+	}
+	ipv4, ipv6, err := container.IPs(ctx, name)
+	if err != nil {
+		klog.Infof("error getting the addresses of loadbalancer %s to announce them: %v", name, err)
+		return
+	}
+	commands := announceCommands(ipv4, ipv6)
+	if len(commands) == 0 {
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	err = container.Exec(ctx, name, []string{"bash", "-c", strings.Join(commands, " && ")}, nil, &stdout, &stderr)
+	if err != nil {
+		klog.Warningf("error announcing the addresses %q %q of loadbalancer %s, the image must provide the ip, arping and ndsend commands: %v Stderr: %s", ipv4, ipv6, name, err, stderr.String())
+		return
+	}
+	klog.V(2).Infof("announced the addresses %q %q of loadbalancer %s", ipv4, ipv6, name)
+}
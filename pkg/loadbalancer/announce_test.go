@@ -0,0 +1,38 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_announceCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		ipv4 string
+		ipv6 string
+		want []string
+	}{
+		{name: "no addresses", want: []string{}},
+		{
+			name: "IPv4",
+			ipv4: "172.18.0.5",
+			want: []string{`arping -U -c 3 -I "$(ip -o -4 addr show to 172.18.0.5 | awk '{print $2}')" 172.18.0.5`},
+		},
+		{
+			name: "dual stack",
+			ipv4: "172.18.0.5",
+			ipv6: "fc00:f853:ccd:e793::5",
+			want: []string{
+				`arping -U -c 3 -I "$(ip -o -4 addr show to 172.18.0.5 | awk '{print $2}')" 172.18.0.5`,
+				`for i in $(seq 3); do ndsend fc00:f853:ccd:e793::5 "$(ip -o -6 addr show to fc00:f853:ccd:e793::5 | awk '{print $2}')"; done`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := announceCommands(tt.ipv4, tt.ipv6); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("announceCommands() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package loadbalancer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrNoHealthyBackends is the reason the loadbalancer is not ready when no backend passes the health checks
+var ErrNoHealthyBackends = fmt.Errorf("%w: no backend passes the health checks", ErrNotReady)
+
+// HealthyBackends returns the number of backends of the loadbalancer of the Service that pass
+// the health checks, the backends of all the Service ports are counted.
+func (s *Server) HealthyBackends(ctx context.Context, clusterName string, service *v1.Service) (int, error) {
+	authority, err := adminAuthority(ctx, s.containerName(clusterName, service))
+	if err != nil {
+		return 0, err
+	}
+	body, err := adminGet(ctx, fmt.Sprintf("http://%s/clusters", authority))
+	if err != nil {
+		return 0, err
+	}
+	return countHealthyHosts(body)
+}
+
+// countHealthyHosts returns the number of hosts of the Service clusters that are healthy in the
+// envoy clusters text format, one cluster::host::stat::value entry per line
+func countHealthyHosts(body string) (int, error) {
+	healthy := 0
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "::")
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], "cluster_") || fields[2] != "health_flags" {
+			continue
+		}
+		if strings.TrimSpace(fields[3]) == "healthy" {
+			healthy++
+		}
+	}
+	return healthy, scanner.Err()
+}
+
+// requireHealthyBackends returns ErrNotReady if none of the backends of the Service pass the
+// health checks, so its address is not reported before the clients can connect
+func (s *Server) requireHealthyBackends(ctx context.Context, clusterName string, service *v1.Service) error {
+	healthy, err := s.HealthyBackends(ctx, clusterName, service)
+	if err != nil {
+		return fmt.Errorf("%w: can not get the health of the backends: %v", ErrNotReady, err)
+	}
+	if healthy == 0 {
+		return ErrNoHealthyBackends
+	}
+	return nil
+}
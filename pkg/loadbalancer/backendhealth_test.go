@@ -0,0 +1,35 @@
+package loadbalancer
+
+import "testing"
+
+func Test_countHealthyHosts(t *testing.T) {
+	body := `cluster_0::observability_name::cluster_0
+cluster_0::default_priority::max_connections::1024
+cluster_0::172.18.0.2:30080::cx_active::0
+cluster_0::172.18.0.2:30080::health_flags::healthy
+cluster_0::172.18.0.3:30080::health_flags::/failed_active_hc
+cluster_1::172.18.0.2:30053::health_flags::healthy
+cluster_1::172.18.0.3:30053::health_flags::/failed_active_hc/pending_active_hc
+admin::127.0.0.1:10000::health_flags::healthy
+`
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "healthy hosts of all the Service ports", body: body, want: 2},
+		{name: "none healthy", body: "cluster_0::172.18.0.2:30080::health_flags::/failed_active_hc\n", want: 0},
+		{name: "no backends", body: "cluster_0::observability_name::cluster_0\n", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countHealthyHosts(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("countHealthyHosts() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// directServer programs the loadbalancer addresses on the cluster nodes instead of creating
+// a loadbalancer container per Service. The address is added to one of the nodes so it answers
+// for it on the KIND network, and the Service status reports it in VIP mode so kube-proxy
+// installs the same DNAT rules it uses for the NodePorts, mapping the address and the Service
+// ports to the Service endpoints on every node.
+// The addresses are allocated from the LoadBalancerIPRange, the container runtime does not
+// know about them.
+type directServer struct {
+	*Server
+}
+
+var _ cloudprovider.LoadBalancer = &directServer{}
+
+// maxDirectAllocations limits the addresses skipped because they are still on the nodes,
+// per example, of Services not synced yet after a restart
+const maxDirectAllocations = 16
+
+// directPlaceholder is the owner of the addresses found on the nodes whose Service is unknown
+func directPlaceholder(addr netip.Addr) string {
+	return "direct/" + addr.String()
+}
+
+func (s *directServer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	addr := s.directAddress(clusterName, service)
+	if !addr.IsValid() {
+		return nil, false, nil
+	}
+	nodes, err := directAddressNodes(ctx, clusterName, addr)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(nodes) == 0 {
+		return nil, false, nil
+	}
+	return directStatus(service, addr), true, nil
+}
+
+func (s *directServer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	name := loadBalancerName(clusterName, service)
+	networkName := clusterNetworks(ctx, clusterName)[0]
+	defer s.updateIPPoolMetrics(ctx, clusterName, networkName, true)
+
+	requested, err := requestedIP(service)
+	if err != nil {
+		return nil, err
+	}
+	previous := primaryFamilyIP(service, statusIPs(service))
+	// the address may have been found on the nodes before the Service was synced
+	for _, a := range []netip.Addr{requested, previous} {
+		if a.IsValid() {
+			s.ipAllocator.Release(directPlaceholder(a))
+		}
+	}
+	var addr netip.Addr
+	if requested.IsValid() {
+		addr, err = s.allocateIP(ctx, networkName, name, requested)
+		if err != nil {
+			return nil, err
+		}
+	} else if previous.IsValid() {
+		addr, err = s.allocateIP(ctx, networkName, name, previous)
+		if err != nil {
+			klog.Infof("previous address %s of loadbalancer %s can not be reused: %v", previous, name, err)
+			addr = netip.Addr{}
+		}
+	}
+	if !addr.IsValid() {
+		addr, err = s.allocateDirectIP(ctx, clusterName, networkName, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !familyMatches(service, addr) {
+		s.ipAllocator.Release(name)
+		return nil, fmt.Errorf("loadbalancer address %s is not of the IP families %v of the Service %s/%s", addr, service.Spec.IPFamilies, service.Namespace, service.Name)
+	}
+	if err := s.claimPorts(clusterName, service, addr); err != nil {
+		return nil, err
+	}
+
+	klog.V(2).Infof("programming loadbalancer address %s for Service %s/%s on the nodes", addr, service.Namespace, service.Name)
+	if err := s.UpdateLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+		return nil, err
+	}
+	return directStatus(service, addr), nil
+}
+
+// allocateDirectIP allocates a new address to the loadbalancer, skipping the addresses that
+// are already on the nodes
+func (s *directServer) allocateDirectIP(ctx context.Context, clusterName string, networkName string, name string) (netip.Addr, error) {
+	for i := 0; i < maxDirectAllocations; i++ {
+		addr, err := s.allocateIP(ctx, networkName, name, netip.Addr{})
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		// the nodes of other clusters on the same network would answer for the address too
+		nodes, err := directAddressNetworkNodes(ctx, networkName, addr)
+		if err != nil {
+			s.ipAllocator.Release(name)
+			return netip.Addr{}, err
+		}
+		if len(nodes) == 0 {
+			return addr, nil
+		}
+		klog.Infof("loadbalancer address %s is already on nodes %v, allocating another one", addr, nodes)
+		s.ipAllocator.Release(name)
+		if err := s.ipAllocator.AllocateSpecific(addr, directPlaceholder(addr)); err != nil {
+			return netip.Addr{}, err
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("can not allocate an address for loadbalancer %s, too many addresses of the range are already on the nodes", name)
+}
+
+func (s *directServer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	name := loadBalancerName(clusterName, service)
+	addr, ok := s.ipAllocator.Lookup(name)
+	if !ok {
+		return fmt.Errorf("loadbalancer %s for Service %s/%s has no address allocated", name, service.Namespace, service.Name)
+	}
+	s.rememberNodes(clusterName, service, nodes)
+	holder, nodeIP := directNode(nodes, addr)
+	if holder == "" {
+		return fmt.Errorf("no node has an address of the family of the loadbalancer address %s", addr)
+	}
+	// only one node can answer for the address, remove it from the rest first
+	if err := removeDirectAddress(ctx, clusterName, addr, holder); err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	err := container.Exec(ctx, holder, []string{"bash", "-c", addDirectAddressCommand(addr, nodeIP)}, nil, &stdout, &stderr)
+	if err != nil {
+		return fmt.Errorf("failed to add the loadbalancer address %s to node %s: %w Stderr: %s", addr, holder, err, stderr.String())
+	}
+	return nil
+}
+
+// ResyncLoadBalancer programs the address of the Service on the last nodes it was updated with.
+func (s *directServer) ResyncLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error {
+	s.mu.Lock()
+	nodes, ok := s.nodes[loadBalancerSimpleName(clusterName, service)]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+func (s *directServer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	name := loadBalancerName(clusterName, service)
+	s.forgetNodes(clusterName, service)
+	s.ports.Release(loadBalancerSimpleName(clusterName, service))
+	addr := s.directAddress(clusterName, service)
+	if addr.IsValid() {
+		if err := removeDirectAddress(ctx, clusterName, addr, ""); err != nil {
+			return err
+		}
+	}
+	s.ipAllocator.Release(name)
+	s.updateIPPoolMetrics(ctx, clusterName, clusterNetworks(ctx, clusterName)[0], false)
+	return nil
+}
+
+// CleanupLoadBalancers removes the loadbalancer addresses of the range from the nodes of the
+// cluster, there are no loadbalancer containers to delete once the controllers stop.
+func (s *directServer) CleanupLoadBalancers(ctx context.Context, clusterName string) error {
+	nodes, err := container.ListByLabel(ctx, fmt.Sprintf("%s=%s", constants.KindClusterLabelKey, clusterName))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, node := range nodes {
+		var stdout, stderr bytes.Buffer
+		if err := container.Exec(ctx, node, []string{"bash", "-c", removeDirectRangeCommand(s.ipAllocator.Prefix())}, nil, &stdout, &stderr); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the loadbalancer addresses of %s from node %s: %w Stderr: %s", s.ipAllocator.Prefix(), node, err, stderr.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// directAddress returns the address allocated to the loadbalancer of the Service, or the
+// address of its status if it was not allocated yet, per example after a restart
+func (s *directServer) directAddress(clusterName string, service *v1.Service) netip.Addr {
+	if addr, ok := s.ipAllocator.Lookup(loadBalancerName(clusterName, service)); ok {
+		return addr
+	}
+	return primaryFamilyIP(service, statusIPs(service))
+}
+
+// familyMatches returns true if the address is of one of the IP families of the Service
+func familyMatches(service *v1.Service, addr netip.Addr) bool {
+	for _, family := range service.Spec.IPFamilies {
+		if addr.Is4() && family == v1.IPv4Protocol || addr.Is6() && family == v1.IPv6Protocol {
+			return true
+		}
+	}
+	return len(service.Spec.IPFamilies) == 0
+}
+
+// directStatus returns the status of the loadbalancer, the VIP mode makes kube-proxy
+// forward the traffic to the address
+func directStatus(service *v1.Service, addr netip.Addr) *v1.LoadBalancerStatus {
+	ports := []v1.PortStatus{}
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, v1.PortStatus{
+			Port:     port.Port,
+			Protocol: port.Protocol,
+		})
+	}
+	return &v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{
+			IP:     addr.String(),
+			IPMode: ptr.To(v1.LoadBalancerIPModeVIP),
+			Ports:  ports,
+		}},
+	}
+}
+
+// directNode returns the node that holds the loadbalancer address and its internal IP of the
+// same family, the first by name so the address does not move while the node is available.
+func directNode(nodes []*v1.Node, addr netip.Addr) (string, string) {
+	sorted := append([]*v1.Node{}, nodes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, node := range sorted {
+		for _, address := range node.Status.Addresses {
+			if address.Type != v1.NodeInternalIP {
+				continue
+			}
+			ip, err := netip.ParseAddr(address.Address)
+			if err != nil {
+				continue
+			}
+			if ip.Unmap().Is4() == addr.Is4() {
+				return node.Name, ip.Unmap().String()
+			}
+		}
+	}
+	return "", ""
+}
+
+// addDirectAddressCommand returns the command that adds the address to the interface of
+// the node on the KIND network
+func addDirectAddressCommand(addr netip.Addr, nodeIP string) string {
+	return fmt.Sprintf(`dev=$(ip -o addr show to %s | awk '{print $2; exit}') && ip addr replace %s dev "$dev"`,
+		nodeIP, netip.PrefixFrom(addr, addr.BitLen()))
+}
+
+// removeDirectAddressCommand returns the command that removes the address from the node,
+// unless it is the holder
+func removeDirectAddressCommand(addr netip.Addr, holder string) string {
+	prefix := netip.PrefixFrom(addr, addr.BitLen())
+	cmd := fmt.Sprintf(`for dev in $(ip -o addr show to %s | awk '{print $2}'); do ip addr del %s dev "$dev"; done`, prefix, prefix)
+	if holder != "" {
+		cmd = fmt.Sprintf(`[ "$(hostname)" = %q ] || { %s; }`, holder, cmd)
+	}
+	return cmd
+}
+
+// removeDirectRangeCommand returns the command that removes from the node the loadbalancer
+// addresses of the range, the addresses of the node are not single host prefixes
+func removeDirectRangeCommand(ipRange netip.Prefix) string {
+	return fmt.Sprintf(`ip -o addr show to %s | while read -r _ dev _ addr _; do case "$addr" in */32|*/128) ip addr del "$addr" dev "$dev" ;; esac; done`, ipRange.Masked())
+}
+
+// removeDirectAddress removes the address from all the nodes of the cluster but the holder
+func removeDirectAddress(ctx context.Context, clusterName string, addr netip.Addr, holder string) error {
+	nodes, err := container.ListByLabel(ctx, fmt.Sprintf("%s=%s", constants.KindClusterLabelKey, clusterName))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, node := range nodes {
+		var stdout, stderr bytes.Buffer
+		if err := container.Exec(ctx, node, []string{"bash", "-c", removeDirectAddressCommand(addr, holder)}, nil, &stdout, &stderr); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the loadbalancer address %s from node %s: %w Stderr: %s", addr, node, err, stderr.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// directAddressNodes returns the nodes of the cluster that have the address
+func directAddressNodes(ctx context.Context, clusterName string, addr netip.Addr) ([]string, error) {
+	nodes, err := container.ListByLabel(ctx, fmt.Sprintf("%s=%s", constants.KindClusterLabelKey, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	return addressHolders(ctx, nodes, addr)
+}
+
+// directAddressNetworkNodes returns the running nodes of any KIND cluster on the network that
+// have the address
+func directAddressNetworkNodes(ctx context.Context, networkName string, addr netip.Addr) ([]string, error) {
+	nodes, err := container.ListRunningByLabelOnNetwork(ctx, networkName, constants.KindClusterLabelKey)
+	if err != nil {
+		return nil, err
+	}
+	return addressHolders(ctx, nodes, addr)
+}
+
+// addressHolders returns the nodes that have the address
+func addressHolders(ctx context.Context, nodes []string, addr netip.Addr) ([]string, error) {
+	holders := []string{}
+	for _, node := range nodes {
+		var stdout, stderr bytes.Buffer
+		cmd := fmt.Sprintf("ip -o addr show to %s", netip.PrefixFrom(addr, addr.BitLen()))
+		if err := container.Exec(ctx, node, []string{"bash", "-c", cmd}, nil, &stdout, &stderr); err != nil {
+			return nil, fmt.Errorf("failed to get the addresses of node %s: %w Stderr: %s", node, err, stderr.String())
+		}
+		if strings.TrimSpace(stdout.String()) != "" {
+			holders = append(holders, node)
+		}
+	}
+	return holders, nil
+}
@@ -0,0 +1,155 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
+)
+
+func Test_directNode(t *testing.T) {
+	node := func(name string, ips ...string) *v1.Node {
+		n := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		n.Status.Addresses = append(n.Status.Addresses, v1.NodeAddress{Type: v1.NodeHostName, Address: name})
+		for _, ip := range ips {
+			n.Status.Addresses = append(n.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ip})
+		}
+		return n
+	}
+	nodes := []*v1.Node{
+		node("kind-worker2", "172.18.0.4", "fc00:f853:ccd:e793::4"),
+		node("kind-worker", "172.18.0.3"),
+		node("kind-control-plane"),
+	}
+	tests := []struct {
+		name       string
+		addr       string
+		wantNode   string
+		wantNodeIP string
+	}{
+		{
+			name:       "ipv4 first node by name",
+			addr:       "172.18.0.200",
+			wantNode:   "kind-worker",
+			wantNodeIP: "172.18.0.3",
+		},
+		{
+			name:       "ipv6 node with an address of the family",
+			addr:       "fc00:f853:ccd:e793::200",
+			wantNode:   "kind-worker2",
+			wantNodeIP: "fc00:f853:ccd:e793::4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotNode, gotNodeIP := directNode(nodes, netip.MustParseAddr(tt.addr))
+			if gotNode != tt.wantNode || gotNodeIP != tt.wantNodeIP {
+				t.Errorf("directNode() = %s, %s, want %s, %s", gotNode, gotNodeIP, tt.wantNode, tt.wantNodeIP)
+			}
+		})
+	}
+	if got, _ := directNode(nodes[2:], netip.MustParseAddr("172.18.0.200")); got != "" {
+		t.Errorf("directNode() = %s, want no node", got)
+	}
+}
+
+func Test_directAddressCommands(t *testing.T) {
+	addr := netip.MustParseAddr("172.18.0.200")
+	want := `dev=$(ip -o addr show to 172.18.0.3 | awk '{print $2; exit}') && ip addr replace 172.18.0.200/32 dev "$dev"`
+	if got := addDirectAddressCommand(addr, "172.18.0.3"); got != want {
+		t.Errorf("addDirectAddressCommand() = %s, want %s", got, want)
+	}
+	want = `for dev in $(ip -o addr show to 172.18.0.200/32 | awk '{print $2}'); do ip addr del 172.18.0.200/32 dev "$dev"; done`
+	if got := removeDirectAddressCommand(addr, ""); got != want {
+		t.Errorf("removeDirectAddressCommand() = %s, want %s", got, want)
+	}
+	want = `[ "$(hostname)" = "kind-worker" ] || { ` + want + `; }`
+	if got := removeDirectAddressCommand(addr, "kind-worker"); got != want {
+		t.Errorf("removeDirectAddressCommand() = %s, want %s", got, want)
+	}
+	if got := removeDirectAddressCommand(netip.MustParseAddr("fc00::200"), ""); got != `for dev in $(ip -o addr show to fc00::200/128 | awk '{print $2}'); do ip addr del fc00::200/128 dev "$dev"; done` {
+		t.Errorf("removeDirectAddressCommand() = %s", got)
+	}
+	want = `ip -o addr show to 172.18.255.0/24 | while read -r _ dev _ addr _; do case "$addr" in */32|*/128) ip addr del "$addr" dev "$dev" ;; esac; done`
+	if got := removeDirectRangeCommand(netip.MustParsePrefix("172.18.255.7/24")); got != want {
+		t.Errorf("removeDirectRangeCommand() = %s, want %s", got, want)
+	}
+}
+
+func Test_directServerCleanupLoadBalancers(t *testing.T) {
+	runtime := containertest.New(t, `case "$*" in
+ps*) printf 'kind-control-plane\nkind-worker\n' ;;
+esac`)
+	t.Cleanup(container.Use(runtime))
+	s := &directServer{Server: &Server{ipAllocator: ipam.New(netip.MustParsePrefix("172.18.255.0/24"))}}
+	if err := s.CleanupLoadBalancers(context.Background(), "kind"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	remove := removeDirectRangeCommand(netip.MustParsePrefix("172.18.255.0/24"))
+	want := []string{
+		"ps -a --filter label=io.x-k8s.kind.cluster=kind --format {{.ID }}",
+		"exec --privileged kind-control-plane bash -c " + remove,
+		"exec --privileged kind-worker bash -c " + remove,
+	}
+	if got := runtime.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CleanupLoadBalancers() commands = %q, want %q", got, want)
+	}
+}
+
+func Test_directAddressNetworkNodes(t *testing.T) {
+	// the node of the other cluster on the network has the address
+	runtime := containertest.New(t, `case "$*" in
+ps*) printf 'kind-control-plane\nother-control-plane\n' ;;
+exec*other-control-plane*) echo "3: eth0    inet 172.18.255.1/32 scope global eth0" ;;
+esac`)
+	t.Cleanup(container.Use(runtime))
+	nodes, err := directAddressNetworkNodes(context.Background(), "kind", netip.MustParseAddr("172.18.255.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"other-control-plane"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("directAddressNetworkNodes() = %v, want %v", nodes, want)
+	}
+	if got := runtime.Commands()[0]; got != "ps --filter network=kind --filter label=io.x-k8s.kind.cluster --format {{.ID }}" {
+		t.Errorf("expected the running nodes of every cluster on the network to be listed, got %q", got)
+	}
+}
+
+func Test_directStatus(t *testing.T) {
+	service := &v1.Service{
+		Spec: v1.ServiceSpec{
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			Ports: []v1.ServicePort{
+				{Port: 80, Protocol: v1.ProtocolTCP},
+				{Port: 5000, Protocol: v1.ProtocolSCTP},
+			},
+		},
+	}
+	want := &v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{
+			IP:     "172.18.0.200",
+			IPMode: ptr.To(v1.LoadBalancerIPModeVIP),
+			Ports: []v1.PortStatus{
+				{Port: 80, Protocol: v1.ProtocolTCP},
+				{Port: 5000, Protocol: v1.ProtocolSCTP},
+			},
+		}},
+	}
+	if got := directStatus(service, netip.MustParseAddr("172.18.0.200")); !reflect.DeepEqual(got, want) {
+		t.Errorf("directStatus() = %+v, want %+v", got, want)
+	}
+	if familyMatches(service, netip.MustParseAddr("fc00::200")) {
+		t.Errorf("familyMatches() = true for an IPv6 address on an IPv4 Service")
+	}
+	if !familyMatches(service, netip.MustParseAddr("172.18.0.200")) {
+		t.Errorf("familyMatches() = false for an IPv4 address on an IPv4 Service")
+	}
+}
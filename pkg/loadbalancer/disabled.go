@@ -0,0 +1,98 @@
+package loadbalancer
+
+import (
+	"context"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// DisabledReason is the error reported in the ports of the status of the disabled loadbalancers
+const DisabledReason = "LoadBalancerDisabled"
+
+// LoadBalancerDisabled returns true if the loadbalancer of the Service is disabled by the annotation,
+// the loadbalancers shared by several Services can not be disabled.
+func LoadBalancerDisabled(service *v1.Service) bool {
+	v, ok := service.Annotations[constants.DisabledAnnotationKey]
+	if !ok {
+		return false
+	}
+	disabled, err := strconv.ParseBool(v)
+	if err != nil {
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be a boolean",
+			service.Namespace, service.Name, constants.DisabledAnnotationKey, v)
+		return false
+	}
+	return disabled
+}
+
+// disabled returns true if the loadbalancer of the Service must be stopped
+func (s *Server) disabled(service *v1.Service) bool {
+	if !LoadBalancerDisabled(service) {
+		return false
+	}
+	if s.sharedPorts != nil {
+		klog.Infof("annotation %s of Service %s/%s is ignored, the loadbalancer is shared", constants.DisabledAnnotationKey, service.Namespace, service.Name)
+		return false
+	}
+	return true
+}
+
+// disableLoadBalancer stops the loadbalancer container of the Service, the container is kept so the
+// loadbalancer is recreated with its address when it is enabled again. The container runtime frees
+// the address of a stopped container, it is only reserved if it was allocated from the configured range.
+func (s *Server) disableLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, error) {
+	name := s.containerName(clusterName, service)
+	if !container.Exist(ctx, name) {
+		klog.Infof("loadbalancer %s for Service %s/%s is disabled, it is not created", name, service.Namespace, service.Name)
+		return &v1.LoadBalancerStatus{}, nil
+	}
+	if s.tunnelManager != nil {
+		if err := s.tunnelManager.removeTunnels(name); err != nil {
+			return nil, err
+		}
+	}
+	if container.IsRunning(ctx, name) {
+		klog.Infof("stopping disabled loadbalancer %s for Service %s/%s", name, service.Namespace, service.Name)
+		if err := container.Stop(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	if s.ipAllocator != nil {
+		if addr := previousIP(ctx, name, service); addr.IsValid() && s.ipAllocator.Prefix().Contains(addr) {
+			if err := s.ipAllocator.AllocateSpecific(addr, name); err != nil {
+				klog.Infof("address %s of disabled loadbalancer %s can not be reserved: %v", addr, name, err)
+			}
+		}
+	}
+	return disabledStatus(ctx, name, service), nil
+}
+
+// disabledStatus returns the status of the disabled loadbalancer, with the address it keeps
+// and the ports reporting that they are disabled
+func disabledStatus(ctx context.Context, name string, service *v1.Service) *v1.LoadBalancerStatus {
+	status := &v1.LoadBalancerStatus{}
+	addr := previousIP(ctx, name, service)
+	if !addr.IsValid() {
+		return status
+	}
+	ports := []v1.PortStatus{}
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, v1.PortStatus{
+			Port:     port.Port,
+			Protocol: port.Protocol,
+			Error:    ptr.To(DisabledReason),
+		})
+	}
+	status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{
+		IP:     addr.String(),
+		IPMode: ptr.To(v1.LoadBalancerIPModeProxy),
+		Ports:  ports,
+	})
+	return status
+}
@@ -0,0 +1,114 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
+)
+
+func TestLoadBalancerDisabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:        "disabled",
+			annotations: map[string]string{constants.DisabledAnnotationKey: "true"},
+			want:        true,
+		},
+		{
+			name:        "enabled",
+			annotations: map[string]string{constants.DisabledAnnotationKey: "false"},
+		},
+		{
+			name:        "invalid value",
+			annotations: map[string]string{constants.DisabledAnnotationKey: "paused"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := LoadBalancerDisabled(service); got != tt.want {
+				t.Errorf("LoadBalancerDisabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_disabledStatus(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: v1.ServiceSpec{
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			Ports: []v1.ServicePort{
+				{Port: 80, Protocol: v1.ProtocolTCP},
+				{Port: 53, Protocol: v1.ProtocolUDP},
+			},
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{IP: "127.0.0.1"}, {IP: "172.18.0.5"}},
+			},
+		},
+	}
+	want := &v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{{
+			IP:     "172.18.0.5",
+			IPMode: ptr.To(v1.LoadBalancerIPModeProxy),
+			Ports: []v1.PortStatus{
+				{Port: 80, Protocol: v1.ProtocolTCP, Error: ptr.To(DisabledReason)},
+				{Port: 53, Protocol: v1.ProtocolUDP, Error: ptr.To(DisabledReason)},
+			},
+		}},
+	}
+	if got := disabledStatus(context.Background(), "kindccm-not-existing", service); !reflect.DeepEqual(got, want) {
+		t.Errorf("disabledStatus(ctx) = %+v, want %+v", got, want)
+	}
+
+	// the address was never assigned
+	service.Status.LoadBalancer.Ingress = nil
+	if got := disabledStatus(context.Background(), "kindccm-not-existing", service); len(got.Ingress) != 0 {
+		t.Errorf("disabledStatus(ctx) = %+v, want no ingress", got)
+	}
+}
+
+func TestServer_disableLoadBalancerReservesAddress(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       v1.ServiceSpec{IPFamilies: []v1.IPFamily{v1.IPv4Protocol}},
+	}
+	// the stopped container keeps the address it was created with in its configuration
+	script := `case "$*" in
+*IPAMConfig*) echo '172.18.200.5,' ;;
+inspect\ -f*) exit 1 ;;
+esac`
+	t.Cleanup(container.Use(containertest.New(t, script)))
+
+	s := &Server{ipAllocator: ipam.New(netip.MustParsePrefix("172.18.200.0/24"))}
+	name := s.containerName("kind", service)
+	if _, err := s.disableLoadBalancer(context.Background(), "kind", service); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := netip.MustParseAddr("172.18.200.5")
+	if got, ok := s.ipAllocator.Lookup(name); !ok || got != addr {
+		t.Fatalf("expected the address %s to be reserved for %s, got %s", addr, name, got)
+	}
+	if err := s.ipAllocator.AllocateSpecific(addr, "kindccm-other"); !errors.Is(err, ipam.ErrInUse) {
+		t.Errorf("expected the address to be in use, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// ParseExtraHosts parses a comma-separated list of hostname=ip entries and returns them
+// in the hostname:ip format of the container runtimes, sorted by hostname.
+func ParseExtraHosts(value string) ([]string, error) {
+	hosts := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		hostname, ip, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("entry %q must be in the form hostname=ip", entry)
+		}
+		if errs := validation.IsDNS1123Subdomain(hostname); len(errs) > 0 {
+			return nil, fmt.Errorf("entry %q has an invalid hostname: %s", entry, strings.Join(errs, ", "))
+		}
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("entry %q has an invalid IP: %w", entry, err)
+		}
+		// the runtimes split the entries on the first colon, the IPv6 addresses do not need brackets
+		hosts = append(hosts, hostname+":"+addr.Unmap().String())
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// ParseDNSServers parses a comma-separated list of DNS server addresses
+func ParseDNSServers(value string) ([]string, error) {
+	servers := []string{}
+	for _, server := range strings.Split(value, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNS server %q: %w", server, err)
+		}
+		servers = append(servers, addr.Unmap().String())
+	}
+	return servers, nil
+}
+
+// dnsArgs returns the container runtime arguments with the extra hosts entries and the DNS
+// servers of the loadbalancer, the Service annotations are added to the ones of the flags.
+func dnsArgs(service *v1.Service, shared bool) ([]string, error) {
+	hosts := append([]string{}, config.DefaultConfig.LoadBalancerExtraHosts...)
+	servers := append([]string{}, config.DefaultConfig.LoadBalancerDNSServers...)
+	for _, key := range []string{constants.ExtraHostsAnnotationKey, constants.DNSServersAnnotationKey} {
+		v, ok := service.Annotations[key]
+		if !ok {
+			continue
+		}
+		if shared {
+			klog.Infof("annotation %s of Service %s/%s is ignored, the loadbalancer is shared", key, service.Namespace, service.Name)
+			continue
+		}
+		var values []string
+		var err error
+		if key == constants.ExtraHostsAnnotationKey {
+			values, err = ParseExtraHosts(v)
+			hosts = append(hosts, values...)
+		} else {
+			values, err = ParseDNSServers(v)
+			servers = append(servers, values...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("service %s/%s annotation %s has an invalid value %q: %w", service.Namespace, service.Name, key, v, err)
+		}
+	}
+	args := []string{}
+	for _, host := range hosts {
+		args = append(args, "--add-host="+host)
+	}
+	for _, server := range servers {
+		args = append(args, "--dns="+server)
+	}
+	return args, nil
+}
@@ -0,0 +1,113 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func TestParseExtraHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: []string{}},
+		{name: "sorted", value: "web.example.com=192.168.1.10, db=fd00::10,,", want: []string{"db:fd00::10", "web.example.com:192.168.1.10"}},
+		{name: "no ip", value: "web.example.com", wantErr: true},
+		{name: "invalid ip", value: "web=192.168.1", wantErr: true},
+		{name: "invalid hostname", value: "Web_1=192.168.1.10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExtraHosts(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExtraHosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExtraHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDNSServers(t *testing.T) {
+	got, err := ParseDNSServers("8.8.8.8, 2001:4860:4860::8888")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"8.8.8.8", "2001:4860:4860::8888"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDNSServers() = %v, want %v", got, want)
+	}
+	if _, err := ParseDNSServers("dns.google"); err == nil {
+		t.Errorf("expected an error for a hostname")
+	}
+}
+
+func Test_dnsArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		hosts       []string
+		servers     []string
+		annotations map[string]string
+		shared      bool
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "none",
+			want: []string{},
+		},
+		{
+			name:    "flags",
+			hosts:   []string{"web.example.com:192.168.1.10"},
+			servers: []string{"8.8.8.8"},
+			want:    []string{"--add-host=web.example.com:192.168.1.10", "--dns=8.8.8.8"},
+		},
+		{
+			name:  "flags and annotations",
+			hosts: []string{"web.example.com:192.168.1.10"},
+			annotations: map[string]string{
+				constants.ExtraHostsAnnotationKey: "db.example.com=192.168.1.20",
+				constants.DNSServersAnnotationKey: "1.1.1.1",
+			},
+			want: []string{"--add-host=web.example.com:192.168.1.10", "--add-host=db.example.com:192.168.1.20", "--dns=1.1.1.1"},
+		},
+		{
+			name:        "annotations are ignored by the shared loadbalancer",
+			hosts:       []string{"web.example.com:192.168.1.10"},
+			annotations: map[string]string{constants.ExtraHostsAnnotationKey: "db.example.com=192.168.1.20"},
+			shared:      true,
+			want:        []string{"--add-host=web.example.com:192.168.1.10"},
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{constants.ExtraHostsAnnotationKey: "db.example.com"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldHosts, oldServers := config.DefaultConfig.LoadBalancerExtraHosts, config.DefaultConfig.LoadBalancerDNSServers
+			config.DefaultConfig.LoadBalancerExtraHosts, config.DefaultConfig.LoadBalancerDNSServers = tt.hosts, tt.servers
+			defer func() {
+				config.DefaultConfig.LoadBalancerExtraHosts, config.DefaultConfig.LoadBalancerDNSServers = oldHosts, oldServers
+			}()
+
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", Annotations: tt.annotations}}
+			got, err := dnsArgs(service, tt.shared)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dnsArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dnsArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
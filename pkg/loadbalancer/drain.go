@@ -0,0 +1,145 @@
+package loadbalancer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+// backends keeps the backends removed from the loadbalancers during the drain timeout
+var backends = newBackendDrainer()
+
+// backendDrainer keeps the backends removed from a loadbalancer configuration as draining,
+// so they do not receive new connections but the existing ones are not reset, until the
+// drain timeout expires.
+type backendDrainer struct {
+	mu sync.Mutex
+	// backends of each loadbalancer configuration, the key is the loadbalancer configuration,
+	// then the servicePort key, and the value is the drain deadline, zero if the backend is active.
+	backends map[string]map[string]map[endpoint]time.Time
+	// clusters are the clusters of the loadbalancer configurations
+	clusters map[string]string
+	// timers reconfigure the loadbalancers once the draining backends expire
+	timers map[string]*time.Timer
+	// contexts are cancelled when the loadbalancers of the cluster are no longer reconfigured
+	contexts map[string]context.Context
+	cancels  map[string]context.CancelFunc
+}
+
+func newBackendDrainer() *backendDrainer {
+	return &backendDrainer{
+		backends: map[string]map[string]map[endpoint]time.Time{},
+		clusters: map[string]string{},
+		timers:   map[string]*time.Timer{},
+		contexts: map[string]context.Context{},
+		cancels:  map[string]context.CancelFunc{},
+	}
+}
+
+// drain adds to the configuration the backends removed in the last updates that are still within the
+// drain timeout, and calls resync once they expire so they are removed from the loadbalancer.
+// resync must regenerate the configuration with the current Service and nodes, its context is
+// cancelled when the loadbalancers of the cluster are no longer reconfigured.
+func (d *backendDrainer) drain(clusterName string, key string, data *proxyConfigData, now time.Time, resync func(ctx context.Context)) {
+	timeout := config.DefaultConfig.BackendDrainTimeout
+	if timeout <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous := d.backends[key]
+	current := map[string]map[endpoint]time.Time{}
+	var next time.Duration
+	for portKey, sp := range data.ServicePorts {
+		current[portKey] = map[endpoint]time.Time{}
+		for _, ep := range sp.Cluster {
+			current[portKey][ep] = time.Time{}
+		}
+		for ep, deadline := range previous[portKey] {
+			if _, ok := current[portKey][ep]; ok {
+				continue
+			}
+			if deadline.IsZero() {
+				deadline = now.Add(timeout)
+			}
+			if !now.Before(deadline) {
+				continue
+			}
+			current[portKey][ep] = deadline
+			sp.Draining = append(sp.Draining, ep)
+			if remaining := deadline.Sub(now); next == 0 || remaining < next {
+				next = remaining
+			}
+		}
+		sort.Slice(sp.Draining, func(i, j int) bool {
+			if sp.Draining[i].Address != sp.Draining[j].Address {
+				return sp.Draining[i].Address < sp.Draining[j].Address
+			}
+			return sp.Draining[i].Port < sp.Draining[j].Port
+		})
+		data.ServicePorts[portKey] = sp
+	}
+	d.backends[key] = current
+	d.clusters[key] = clusterName
+
+	if t, ok := d.timers[key]; ok {
+		t.Stop()
+		delete(d.timers, key)
+	}
+	if next > 0 {
+		klog.V(2).Infof("loadbalancer %s has draining backends, reconfiguring in %v", key, next)
+		ctx, ok := d.contexts[clusterName]
+		if !ok {
+			ctx, d.cancels[clusterName] = context.WithCancel(context.Background())
+			d.contexts[clusterName] = ctx
+		}
+		d.timers[key] = time.AfterFunc(next, func() { resync(ctx) })
+	}
+}
+
+// forget removes the backends of the loadbalancer configuration
+func (d *backendDrainer) forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.timers[key]; ok {
+		t.Stop()
+		delete(d.timers, key)
+	}
+	delete(d.backends, key)
+	delete(d.clusters, key)
+}
+
+// forgetCluster removes the backends of the loadbalancer configurations of the cluster and
+// cancels the reconfigurations in progress
+func (d *backendDrainer) forgetCluster(clusterName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, cluster := range d.clusters {
+		if cluster != clusterName {
+			continue
+		}
+		if t, ok := d.timers[key]; ok {
+			t.Stop()
+			delete(d.timers, key)
+		}
+		delete(d.backends, key)
+		delete(d.clusters, key)
+	}
+	if cancel, ok := d.cancels[clusterName]; ok {
+		cancel()
+		delete(d.cancels, clusterName)
+		delete(d.contexts, clusterName)
+	}
+}
+
+// StopDraining stops reconfiguring the loadbalancers of the cluster when their draining backends
+// expire, it is called once the cloud controller manager of the cluster stops.
+func StopDraining(clusterName string) {
+	backends.forgetCluster(clusterName)
+}
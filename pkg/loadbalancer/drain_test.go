@@ -0,0 +1,136 @@
+package loadbalancer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+func Test_backendDrainer(t *testing.T) {
+	old := config.DefaultConfig.BackendDrainTimeout
+	defer func() { config.DefaultConfig.BackendDrainTimeout = old }()
+	config.DefaultConfig.BackendDrainTimeout = 10 * time.Second
+
+	a := endpoint{"192.168.8.2", 30000, string(v1.ProtocolTCP)}
+	b := endpoint{"192.168.8.3", 30000, string(v1.ProtocolTCP)}
+	makeConfig := func(backends ...endpoint) *proxyConfigData {
+		return &proxyConfigData{
+			ServicePorts: map[string]servicePort{
+				"IPv4_80_TCP": {
+					Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+					Cluster:  backends,
+				},
+			},
+		}
+	}
+
+	d := newBackendDrainer()
+	defer d.forget("lb")
+	resync := func(context.Context) {}
+	now := time.Now()
+
+	data := makeConfig(a, b)
+	d.drain("kind", "lb", data, now, resync)
+	if got := data.ServicePorts["IPv4_80_TCP"].Draining; len(got) != 0 {
+		t.Fatalf("expected no draining backends, got %v", got)
+	}
+
+	// b is removed and keeps draining until the timeout expires
+	data = makeConfig(a)
+	d.drain("kind", "lb", data, now.Add(time.Second), resync)
+	if got := data.ServicePorts["IPv4_80_TCP"].Draining; !reflect.DeepEqual(got, []endpoint{b}) {
+		t.Fatalf("expected draining backends %v, got %v", []endpoint{b}, got)
+	}
+	if _, ok := d.timers["lb"]; !ok {
+		t.Fatalf("expected a timer to remove the draining backends")
+	}
+	data = makeConfig(a)
+	d.drain("kind", "lb", data, now.Add(5*time.Second), resync)
+	if got := data.ServicePorts["IPv4_80_TCP"].Draining; !reflect.DeepEqual(got, []endpoint{b}) {
+		t.Fatalf("expected draining backends %v, got %v", []endpoint{b}, got)
+	}
+	data = makeConfig(a)
+	d.drain("kind", "lb", data, now.Add(12*time.Second), resync)
+	if got := data.ServicePorts["IPv4_80_TCP"].Draining; len(got) != 0 {
+		t.Fatalf("expected no draining backends after the timeout, got %v", got)
+	}
+	if _, ok := d.timers["lb"]; ok {
+		t.Fatalf("expected no timer without draining backends")
+	}
+
+	// a backend that comes back stops draining
+	data = makeConfig()
+	d.drain("kind", "lb", data, now.Add(13*time.Second), resync)
+	data = makeConfig(a)
+	d.drain("kind", "lb", data, now.Add(14*time.Second), resync)
+	if got := data.ServicePorts["IPv4_80_TCP"].Draining; len(got) != 0 {
+		t.Fatalf("expected no draining backends, got %v", got)
+	}
+}
+
+func Test_backendDrainerDisabled(t *testing.T) {
+	old := config.DefaultConfig.BackendDrainTimeout
+	defer func() { config.DefaultConfig.BackendDrainTimeout = old }()
+	config.DefaultConfig.BackendDrainTimeout = 0
+
+	d := newBackendDrainer()
+	a := endpoint{"192.168.8.2", 30000, string(v1.ProtocolTCP)}
+	data := &proxyConfigData{ServicePorts: map[string]servicePort{"IPv4_80_TCP": {Cluster: []endpoint{a}}}}
+	d.drain("kind", "lb", data, time.Now(), func(context.Context) {})
+	data = &proxyConfigData{ServicePorts: map[string]servicePort{"IPv4_80_TCP": {}}}
+	d.drain("kind", "lb", data, time.Now(), func(context.Context) {})
+	if got := data.ServicePorts["IPv4_80_TCP"].Draining; len(got) != 0 {
+		t.Fatalf("expected no draining backends, got %v", got)
+	}
+}
+
+func Test_backendDrainerForgetCluster(t *testing.T) {
+	old := config.DefaultConfig.BackendDrainTimeout
+	defer func() { config.DefaultConfig.BackendDrainTimeout = old }()
+	config.DefaultConfig.BackendDrainTimeout = 10 * time.Millisecond
+
+	a := endpoint{"192.168.8.2", 30000, string(v1.ProtocolTCP)}
+	makeConfig := func(backends ...endpoint) *proxyConfigData {
+		return &proxyConfigData{ServicePorts: map[string]servicePort{"IPv4_80_TCP": {Cluster: backends}}}
+	}
+
+	d := newBackendDrainer()
+	defer d.forget("other-lb")
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	// the reconfiguration in progress is cancelled with the cluster
+	resync := func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+	}
+	d.drain("kind", "lb", makeConfig(a), time.Now(), resync)
+	d.drain("kind", "lb", makeConfig(), time.Now(), resync)
+	d.drain("other", "other-lb", makeConfig(a), time.Now(), func(context.Context) {})
+	d.drain("other", "other-lb", makeConfig(), time.Now(), func(context.Context) {})
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the loadbalancer to be reconfigured once the backends expire")
+	}
+	d.forgetCluster("kind")
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the reconfiguration to be cancelled")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.backends["lb"]; ok {
+		t.Errorf("expected the backends of the cluster to be removed")
+	}
+	if _, ok := d.backends["other-lb"]; !ok {
+		t.Errorf("expected the backends of other clusters to be kept")
+	}
+}
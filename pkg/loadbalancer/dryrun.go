@@ -0,0 +1,89 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// dryRunServer computes the loadbalancers of the Services and logs them without
+// creating, updating or deleting any container. The Services status is not updated.
+type dryRunServer struct {
+	*Server
+}
+
+var _ cloudprovider.LoadBalancer = &dryRunServer{}
+
+func (s *dryRunServer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	return nil, false, nil
+}
+
+func (s *dryRunServer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	name := s.containerName(clusterName, service)
+	requested, err := requestedIP(service)
+	if err != nil {
+		return nil, err
+	}
+	var ip netip.Addr
+	if requested.IsValid() || s.ipAllocator != nil {
+		ip, err = s.allocateIP(ctx, clusterNetworks(ctx, clusterName)[0], name, requested)
+		if err != nil {
+			return nil, err
+		}
+	}
+	address := "assigned by the container runtime"
+	if ip.IsValid() {
+		address = ip.String()
+	}
+	klog.Infof("[dry-run] would create loadbalancer %s for Service %s/%s with address %s", name, service.Namespace, service.Name, address)
+	if err := s.UpdateLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+		return nil, err
+	}
+	// the service controller does not update the status of the Service
+	return nil, cloudprovider.ImplementedElsewhere
+}
+
+func (s *dryRunServer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	name := s.containerName(clusterName, service)
+	override, err := s.proxyOverride(service)
+	if err != nil {
+		return err
+	}
+	slices, err := s.endpointSlices(service)
+	if err != nil {
+		return err
+	}
+	certificate, err := s.tlsCertificate(service)
+	if err != nil {
+		return err
+	}
+	config := generateConfig(service, endpointNodes(service, nodes, slices))
+	setPodBackends(config, service, slices)
+	setTLS(config, service, certificate)
+	config.Override = override
+	ldsConfig, err := proxyConfig(proxyLDSConfigTemplate, config)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate loadbalancer config data")
+	}
+	cdsConfig, err := proxyConfig(proxyCDSConfigTemplate, config)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate loadbalancer config data")
+	}
+	klog.Infof("[dry-run] would update loadbalancer %s for Service %s/%s for %d nodes", name, service.Namespace, service.Name, len(nodes))
+	klog.V(2).Infof("[dry-run] loadbalancer %s config %s:\n%s", name, proxyConfigPathLDS, redactPrivateKey(ldsConfig, certificate))
+	klog.V(2).Infof("[dry-run] loadbalancer %s config %s:\n%s", name, proxyConfigPathCDS, cdsConfig)
+	return nil
+}
+
+func (s *dryRunServer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	name := s.containerName(clusterName, service)
+	klog.Infof("[dry-run] would delete loadbalancer %s for Service %s/%s", name, service.Namespace, service.Name)
+	if s.ipAllocator != nil {
+		s.ipAllocator.Release(name)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package loadbalancer
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func Test_dryRunServer(t *testing.T) {
+	s := &dryRunServer{Server: &Server{}}
+	service := makeService("dry-run")
+	nodes := []*v1.Node{makeNode("a", "10.0.0.1"), makeNode("b", "10.0.0.2")}
+
+	status, err := s.EnsureLoadBalancer(context.Background(), "kind", service, nodes)
+	if err != cloudprovider.ImplementedElsewhere {
+		t.Errorf("EnsureLoadBalancer() error = %v, want %v", err, cloudprovider.ImplementedElsewhere)
+	}
+	if status != nil {
+		t.Errorf("EnsureLoadBalancer() status = %v, want nil", status)
+	}
+	if _, exists, err := s.GetLoadBalancer(context.Background(), "kind", service); exists || err != nil {
+		t.Errorf("GetLoadBalancer() exists = %v error = %v, want false and nil", exists, err)
+	}
+	if err := s.UpdateLoadBalancer(context.Background(), "kind", service, nodes); err != nil {
+		t.Errorf("UpdateLoadBalancer() error = %v", err)
+	}
+	if err := s.EnsureLoadBalancerDeleted(context.Background(), "kind", service); err != nil {
+		t.Errorf("EnsureLoadBalancerDeleted() error = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// EndpointSliceLister returns the EndpointSlices of the Service with the namespace and name.
+type EndpointSliceLister func(namespace, service string) ([]*discoveryv1.EndpointSlice, error)
+
+// SetEndpointSliceLister sets the function used to list the endpoints of the Services with
+// Pod backends, those Services have no backends until it is set.
+func (s *Server) SetEndpointSliceLister(lister EndpointSliceLister) {
+	s.endpointSliceLister = lister
+}
+
+// UsesPodBackends returns true if the loadbalancer of the Service forwards the traffic directly
+// to the Pods instead of the NodePorts, because the Pod backends are enabled for all the Services
+// or the Service sets allocateLoadBalancerNodePorts to false.
+func UsesPodBackends(service *v1.Service) bool {
+	if config.DefaultConfig.LoadBalancerPodBackends {
+		return true
+	}
+	return service.Spec.AllocateLoadBalancerNodePorts != nil && !*service.Spec.AllocateLoadBalancerNodePorts
+}
+
+// UsesEndpointSlices returns true if the backends of the loadbalancer of the Service depend on its
+// endpoints, because it uses Pod backends or it only sends the traffic to the nodes with endpoints.
+func UsesEndpointSlices(service *v1.Service) bool {
+	return UsesPodBackends(service) || selectsEndpointNodes(service)
+}
+
+// selectsEndpointNodes returns true if the traffic-policy annotation of the Service is Local but its
+// externalTrafficPolicy is not, kube-proxy forwards the traffic to all the endpoints and does not
+// report which nodes have them, so the loadbalancer selects the nodes from the EndpointSlices.
+func selectsEndpointNodes(service *v1.Service) bool {
+	if UsesPodBackends(service) || service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
+		return false
+	}
+	return strings.EqualFold(service.Annotations[constants.TrafficPolicyAnnotationKey], string(v1.ServiceExternalTrafficPolicyTypeLocal))
+}
+
+// endpointNodes returns the nodes that run a ready endpoint of the Service if the loadbalancer
+// selects them from the EndpointSlices, all the nodes otherwise.
+func endpointNodes(service *v1.Service, nodes []*v1.Node, slices []*discoveryv1.EndpointSlice) []*v1.Node {
+	if service == nil || !selectsEndpointNodes(service) {
+		return nodes
+	}
+	names := map[string]bool{}
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if ep.NodeName != nil && ptr.Deref(ep.Conditions.Ready, true) {
+				names[*ep.NodeName] = true
+			}
+		}
+	}
+	selected := []*v1.Node{}
+	for _, node := range nodes {
+		if names[node.Name] {
+			selected = append(selected, node)
+		}
+	}
+	return selected
+}
+
+// endpointSlices returns the EndpointSlices of the Service if the backends of its loadbalancer
+// depend on its endpoints, nil otherwise.
+func (s *Server) endpointSlices(service *v1.Service) ([]*discoveryv1.EndpointSlice, error) {
+	if !UsesEndpointSlices(service) {
+		return nil, nil
+	}
+	if s.endpointSliceLister == nil {
+		klog.Warningf("service %s/%s backends depend on its endpoints but the EndpointSlices are not available, the loadbalancer has no backends",
+			service.Namespace, service.Name)
+		return nil, nil
+	}
+	slices, err := s.endpointSliceLister(service.Namespace, service.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the EndpointSlices of the Service %s/%s: %w", service.Namespace, service.Name, err)
+	}
+	return slices, nil
+}
+
+// setPodBackends replaces the NodePort backends of the config with the ready endpoints of the Service.
+func setPodBackends(config *proxyConfigData, service *v1.Service, slices []*discoveryv1.EndpointSlice) {
+	if config == nil || !UsesPodBackends(service) {
+		return
+	}
+	// kube-proxy is not in the path, the Pods are checked on their own port and
+	// all of them are local to the loadbalancer
+	config.HealthCheckPort = 0
+	config.TrafficPolicy = ""
+	weights := parseBackendWeights(service)
+	for _, ipFamily := range service.Spec.IPFamilies {
+		for _, port := range service.Spec.Ports {
+			key := fmt.Sprintf("%s_%d_%s", ipFamily, port.Port, port.Protocol)
+			sp, ok := config.ServicePorts[key]
+			if !ok {
+				continue
+			}
+			sp.Cluster, sp.Weights = podBackends(port, ipFamily, slices, weights)
+			config.ServicePorts[key] = sp
+		}
+	}
+}
+
+// podBackends returns the sorted addresses and target ports of the ready endpoints of the Service port,
+// and their weights by the node and the zone of the endpoints, nil if they are not weighted
+func podBackends(port v1.ServicePort, ipFamily v1.IPFamily, slices []*discoveryv1.EndpointSlice, weights *backendWeights) ([]endpoint, map[endpoint]int) {
+	backends := []endpoint{}
+	var backendWeights map[endpoint]int
+	if weights != nil {
+		backendWeights = map[endpoint]int{}
+	}
+	seen := map[endpoint]bool{}
+	for _, slice := range slices {
+		if string(slice.AddressType) != string(ipFamily) {
+			continue
+		}
+		targetPort := int32(0)
+		for _, p := range slice.Ports {
+			// the ports of the EndpointSlices have the name of the Service ports
+			if p.Port != nil && ptr.Deref(p.Name, "") == port.Name && ptr.Deref(p.Protocol, v1.ProtocolTCP) == port.Protocol {
+				targetPort = *p.Port
+				break
+			}
+		}
+		if targetPort == 0 {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			// same as kube-proxy, only the first address of the ready endpoints is used
+			if len(ep.Addresses) == 0 || !ptr.Deref(ep.Conditions.Ready, true) {
+				continue
+			}
+			backend := endpoint{Address: ep.Addresses[0], Port: int(targetPort), Protocol: string(port.Protocol)}
+			// an endpoint can be in more than one slice while they are updated
+			if seen[backend] {
+				continue
+			}
+			seen[backend] = true
+			backends = append(backends, backend)
+			if weights != nil {
+				backendWeights[backend] = weights.weight(ptr.Deref(ep.NodeName, ""), ptr.Deref(ep.Zone, ""))
+			}
+		}
+	}
+	// the order of the slices is not stable, keep the config the same if the endpoints do not change
+	sort.Slice(backends, func(i, j int) bool {
+		if backends[i].Address != backends[j].Address {
+			return backends[i].Address < backends[j].Address
+		}
+		return backends[i].Port < backends[j].Port
+	})
+	return backends, backendWeights
+}
+
+// podRoutes returns the ip commands that route the Pod CIDRs of the nodes through their internal IPs,
+// the Pod IPs are not routable from the loadbalancer containers on the KIND network otherwise.
+func podRoutes(nodes []*v1.Node) []string {
+	routes := []string{}
+	for _, node := range nodes {
+		cidrs := node.Spec.PodCIDRs
+		if len(cidrs) == 0 && node.Spec.PodCIDR != "" {
+			cidrs = []string{node.Spec.PodCIDR}
+		}
+		for _, cidr := range cidrs {
+			for _, addr := range node.Status.Addresses {
+				if addr.Type != v1.NodeInternalIP {
+					continue
+				}
+				if netutils.IsIPv4CIDRString(cidr) && netutils.IsIPv4String(addr.Address) {
+					routes = append(routes, fmt.Sprintf("ip route replace %s via %s", cidr, addr.Address))
+					break
+				}
+				if netutils.IsIPv6CIDRString(cidr) && netutils.IsIPv6String(addr.Address) {
+					routes = append(routes, fmt.Sprintf("ip -6 route replace %s via %s", cidr, addr.Address))
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// addPodRoutes routes the Pod CIDRs of the nodes in the loadbalancer container, the routes are
+// replaced so it can be called on every update. The errors are only logged because the Pods
+// can be reachable without the routes, per example if the network already routes them.
+func addPodRoutes(ctx context.Context, name string, nodes []*v1.Node) {
+	routes := podRoutes(nodes)
+	if len(routes) == 0 {
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	err := container.Exec(ctx, name, []string{"bash", "-c", strings.Join(routes, " && ")}, nil, &stdout, &stderr)
+	if err != nil {
+		klog.Warningf("error adding the routes to the Pods to loadbalancer %s, the image must provide the ip command: %v Stderr: %s", name, err, stderr.String())
+	}
+}
@@ -0,0 +1,200 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_setPodBackends(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Type:                          v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy:         v1.ServiceExternalTrafficPolicyTypeLocal,
+			HealthCheckNodePort:           32000,
+			AllocateLoadBalancerNodePorts: ptr.To(false),
+			IPFamilies:                    []v1.IPFamily{v1.IPv4Protocol},
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80, Protocol: v1.ProtocolTCP},
+				{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP},
+			},
+		},
+	}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "a"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}}
+	slices := []*discoveryv1.EndpointSlice{
+		{
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports: []discoveryv1.EndpointPort{
+				{Name: ptr.To("http"), Port: ptr.To[int32](8080), Protocol: ptr.To(v1.ProtocolTCP)},
+				{Name: ptr.To("dns"), Port: ptr.To[int32](5353), Protocol: ptr.To(v1.ProtocolUDP)},
+			},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.244.1.3"}, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}},
+				{Addresses: []string{"10.244.1.2"}},
+				// not ready
+				{Addresses: []string{"10.244.1.4"}, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(false)}},
+			},
+		},
+		{
+			// duplicated endpoint while the slices are updated
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports:       []discoveryv1.EndpointPort{{Name: ptr.To("http"), Port: ptr.To[int32](8080), Protocol: ptr.To(v1.ProtocolTCP)}},
+			Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.244.1.2"}}},
+		},
+		{
+			AddressType: discoveryv1.AddressTypeIPv6,
+			Ports:       []discoveryv1.EndpointPort{{Name: ptr.To("http"), Port: ptr.To[int32](8080), Protocol: ptr.To(v1.ProtocolTCP)}},
+			Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"fd00::2"}}},
+		},
+	}
+
+	config := generateConfig(service, nodes)
+	setPodBackends(config, service, slices)
+	if config.HealthCheckPort != 0 || config.TrafficPolicy != "" {
+		t.Errorf("expected the Pods to be checked on the backend port, got port %d and policy %q", config.HealthCheckPort, config.TrafficPolicy)
+	}
+	want := map[string][]endpoint{
+		"IPv4_80_TCP": {
+			{Address: "10.244.1.2", Port: 8080, Protocol: "TCP"},
+			{Address: "10.244.1.3", Port: 8080, Protocol: "TCP"},
+		},
+		"IPv4_53_UDP": {
+			{Address: "10.244.1.2", Port: 5353, Protocol: "UDP"},
+			{Address: "10.244.1.3", Port: 5353, Protocol: "UDP"},
+		},
+	}
+	for key, backends := range want {
+		if got := config.ServicePorts[key].Cluster; !reflect.DeepEqual(got, backends) {
+			t.Errorf("port %s: expected backends %v, got %v", key, backends, got)
+		}
+	}
+
+	// without endpoints there are no backends
+	config = generateConfig(service, nodes)
+	setPodBackends(config, service, nil)
+	if got := config.ServicePorts["IPv4_80_TCP"].Cluster; len(got) != 0 {
+		t.Errorf("expected no backends, got %v", got)
+	}
+
+	// the NodePorts are used by default
+	service.Spec.AllocateLoadBalancerNodePorts = nil
+	service.Spec.Ports[0].NodePort = 30080
+	config = generateConfig(service, nodes)
+	setPodBackends(config, service, slices)
+	want80 := []endpoint{{Address: "10.0.0.1", Port: 30080, Protocol: "TCP"}}
+	if got := config.ServicePorts["IPv4_80_TCP"].Cluster; !reflect.DeepEqual(got, want80) {
+		t.Errorf("expected the NodePort backends %v, got %v", want80, got)
+	}
+	if config.HealthCheckPort != 32000 {
+		t.Errorf("expected the health check node port, got %d", config.HealthCheckPort)
+	}
+}
+
+func TestUsesPodBackends(t *testing.T) {
+	defer func(enabled bool) { config.DefaultConfig.LoadBalancerPodBackends = enabled }(config.DefaultConfig.LoadBalancerPodBackends)
+
+	service := &v1.Service{}
+	config.DefaultConfig.LoadBalancerPodBackends = false
+	if UsesPodBackends(service) {
+		t.Errorf("expected the NodePorts by default")
+	}
+	service.Spec.AllocateLoadBalancerNodePorts = ptr.To(true)
+	if UsesPodBackends(service) {
+		t.Errorf("expected the NodePorts when they are allocated")
+	}
+	service.Spec.AllocateLoadBalancerNodePorts = ptr.To(false)
+	if !UsesPodBackends(service) {
+		t.Errorf("expected the Pods when the NodePorts are not allocated")
+	}
+	service.Spec.AllocateLoadBalancerNodePorts = nil
+	config.DefaultConfig.LoadBalancerPodBackends = true
+	if !UsesPodBackends(service) {
+		t.Errorf("expected the Pods when they are enabled for all the Services")
+	}
+}
+
+func Test_endpointNodes(t *testing.T) {
+	nodes := []*v1.Node{makeNode("a", "10.0.0.1"), makeNode("b", "10.0.0.2"), makeNode("c", "10.0.0.3")}
+	slices := []*discoveryv1.EndpointSlice{{
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.244.1.5"}, NodeName: ptr.To("a")},
+			{Addresses: []string{"10.244.2.5"}, NodeName: ptr.To("b"), Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(false)}},
+			{Addresses: []string{"10.244.3.5"}},
+		},
+	}}
+	tests := []struct {
+		name   string
+		policy v1.ServiceExternalTrafficPolicy
+		value  string
+		want   []string
+	}{
+		{name: "no annotation", policy: v1.ServiceExternalTrafficPolicyTypeCluster, want: []string{"a", "b", "c"}},
+		{name: "forced local", policy: v1.ServiceExternalTrafficPolicyTypeCluster, value: "local", want: []string{"a"}},
+		{name: "forced cluster", policy: v1.ServiceExternalTrafficPolicyTypeLocal, value: "Cluster", want: []string{"a", "b", "c"}},
+		// the healthCheckNodePort already reports the nodes with endpoints
+		{name: "local service", policy: v1.ServiceExternalTrafficPolicyTypeLocal, value: "Local", want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Annotations: map[string]string{}},
+				Spec:       v1.ServiceSpec{ExternalTrafficPolicy: tt.policy},
+			}
+			if tt.value != "" {
+				service.Annotations[constants.TrafficPolicyAnnotationKey] = tt.value
+			}
+			got := []string{}
+			for _, node := range endpointNodes(service, nodes, slices) {
+				got = append(got, node.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("endpointNodes() = %v, want %v", got, tt.want)
+			}
+			if gotUses := UsesEndpointSlices(service); gotUses != (len(tt.want) == 1) {
+				t.Errorf("UsesEndpointSlices() = %v", gotUses)
+			}
+		})
+	}
+}
+
+func Test_podRoutes(t *testing.T) {
+	nodes := []*v1.Node{
+		{
+			Spec: v1.NodeSpec{PodCIDRs: []string{"10.244.1.0/24", "fd00:10:244:1::/64"}},
+			Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "kind-worker"},
+				{Type: v1.NodeInternalIP, Address: "172.18.0.3"},
+				{Type: v1.NodeInternalIP, Address: "fc00:f853:ccd:e793::3"},
+			}},
+		},
+		{
+			// only the legacy field
+			Spec:   v1.NodeSpec{PodCIDR: "10.244.0.0/24"},
+			Status: v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "172.18.0.2"}}},
+		},
+		{
+			// no Pod CIDR allocated yet
+			Status: v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "172.18.0.4"}}},
+		},
+	}
+	want := []string{
+		"ip -6 route replace fd00:10:244:1::/64 via fc00:f853:ccd:e793::3",
+		"ip route replace 10.244.0.0/24 via 172.18.0.2",
+		"ip route replace 10.244.1.0/24 via 172.18.0.3",
+	}
+	if got := podRoutes(nodes); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected routes %v, got %v", want, got)
+	}
+}
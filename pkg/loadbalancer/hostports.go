@@ -0,0 +1,152 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// wantsHostPorts returns true if the Service ports have to be published on the host,
+// the annotation of the Service takes precedence over the global configuration.
+func wantsHostPorts(service *v1.Service) bool {
+	v, ok := service.Annotations[constants.HostPortsAnnotationKey]
+	if !ok {
+		return config.DefaultConfig.LoadBalancerHostPorts
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be a boolean",
+			service.Namespace, service.Name, constants.HostPortsAnnotationKey, v)
+		return config.DefaultConfig.LoadBalancerHostPorts
+	}
+	return enabled
+}
+
+// NetworkRoutable returns true if the host has an address in the subnets of the KIND network, so the
+// loadbalancer addresses can be reached from the host. The rootless container runtimes and the ones
+// that run the containers in a virtual machine do not expose the network to the host.
+func NetworkRoutable(ctx context.Context) (bool, error) {
+	network, err := container.NetworkInspect(ctx, defaultNetwork())
+	if err != nil {
+		return false, err
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false, err
+	}
+	return hostInSubnets(addrs, network.Subnets), nil
+}
+
+// hostInSubnets returns true if any of the host addresses is in the subnets
+func hostInSubnets(addrs []net.Addr, subnets []string) bool {
+	for _, subnet := range subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipNet.IP)
+			if ok && prefix.Contains(ip.Unmap()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publishArgs returns the arguments to publish the Service ports on the host,
+// on the same port numbers if static is true or on ephemeral ports otherwise.
+func publishArgs(service *v1.Service, static bool) []string {
+	args := []string{}
+	for _, port := range service.Spec.Ports {
+		if !IsProtocolSupported(port.Protocol) {
+			continue
+		}
+		if static {
+			args = append(args, fmt.Sprintf("--publish=%d:%d/%s", port.Port, port.Port, port.Protocol))
+		} else {
+			args = append(args, fmt.Sprintf("--publish=%d/%s", port.Port, port.Protocol))
+		}
+	}
+	return args
+}
+
+// hostPortsPublished returns true if all the Service ports are published on the host
+func hostPortsPublished(ctx context.Context, name string, service *v1.Service) bool {
+	portmaps, err := container.PortMaps(ctx, name)
+	if err != nil {
+		return false
+	}
+	for _, port := range service.Spec.Ports {
+		if !IsProtocolSupported(port.Protocol) {
+			continue
+		}
+		if _, ok := portmaps[strconv.Itoa(int(port.Port))]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// publishesHostPorts returns true if the container was created to publish the Service ports on the host
+func publishesHostPorts(ctx context.Context, name string) bool {
+	labels, err := container.Labels(ctx, name)
+	if err != nil {
+		return false
+	}
+	return labels[constants.LoadBalancerHostPortsLabelKey] == "true"
+}
+
+// hostPortsIngress returns the ingress of the Service ports published on the host,
+// the ports are the ones of the host that may differ from the Service ports if they were in use.
+func hostPortsIngress(ctx context.Context, name string, service *v1.Service) (*v1.LoadBalancerIngress, error) {
+	portmaps, err := container.PortMaps(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ingress := &v1.LoadBalancerIngress{
+		IP:     "127.0.0.1",
+		IPMode: ptr.To(v1.LoadBalancerIPModeProxy),
+	}
+	if len(service.Spec.IPFamilies) > 0 && service.Spec.IPFamilies[0] == v1.IPv6Protocol {
+		ingress.IP = "::1"
+	}
+	// the ports of a remote container runtime are published on its host
+	if host := container.RemoteHost(); host != "" {
+		ingress.IP = ""
+		if _, err := netip.ParseAddr(host); err == nil {
+			ingress.IP = host
+		} else {
+			ingress.Hostname = host
+		}
+	}
+	for _, port := range service.Spec.Ports {
+		hostPort, ok := portmaps[strconv.Itoa(int(port.Port))]
+		if !ok {
+			continue
+		}
+		p, err := strconv.Atoi(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host port %q for port %d: %w", hostPort, port.Port, err)
+		}
+		ingress.Ports = append(ingress.Ports, v1.PortStatus{
+			Port:     int32(p),
+			Protocol: port.Protocol,
+		})
+	}
+	return ingress, nil
+}
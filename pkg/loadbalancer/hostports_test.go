@@ -0,0 +1,134 @@
+package loadbalancer
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+func Test_wantsHostPorts(t *testing.T) {
+	defer func(enabled bool) { config.DefaultConfig.LoadBalancerHostPorts = enabled }(config.DefaultConfig.LoadBalancerHostPorts)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		global      bool
+		want        bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:   "enabled globally",
+			global: true,
+			want:   true,
+		},
+		{
+			name:        "disabled by the annotation",
+			annotations: map[string]string{constants.HostPortsAnnotationKey: "false"},
+			global:      true,
+		},
+		{
+			name:        "enabled",
+			annotations: map[string]string{constants.HostPortsAnnotationKey: "true"},
+			want:        true,
+		},
+		{
+			name:        "disabled",
+			annotations: map[string]string{constants.HostPortsAnnotationKey: "false"},
+		},
+		{
+			name:        "invalid value",
+			annotations: map[string]string{constants.HostPortsAnnotationKey: "yes please"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.DefaultConfig.LoadBalancerHostPorts = tt.global
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := wantsHostPorts(service); got != tt.want {
+				t.Errorf("wantsHostPorts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_publishArgs(t *testing.T) {
+	service := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Port: 80, Protocol: v1.ProtocolTCP},
+				{Port: 53, Protocol: v1.ProtocolUDP},
+				{Port: 9000, Protocol: v1.ProtocolSCTP},
+			},
+		},
+	}
+	tests := []struct {
+		name   string
+		static bool
+		want   []string
+	}{
+		{
+			name:   "static ports",
+			static: true,
+			want:   []string{"--publish=80:80/TCP", "--publish=53:53/UDP"},
+		},
+		{
+			name: "ephemeral ports",
+			want: []string{"--publish=80/TCP", "--publish=53/UDP"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := publishArgs(service, tt.static); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("publishArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hostInSubnets(t *testing.T) {
+	ipNet := func(cidr string) net.Addr {
+		ip, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.IP = ip
+		return n
+	}
+	addrs := []net.Addr{ipNet("127.0.0.1/8"), ipNet("192.168.1.10/24"), ipNet("172.18.0.1/16")}
+	subnets := []string{"fc00:f853:ccd:e793::/64", "172.18.0.0/16"}
+	if !hostInSubnets(addrs, subnets) {
+		t.Errorf("expected the bridge address to be in the network")
+	}
+	// rootless runtimes do not create the bridge on the host
+	if hostInSubnets(addrs[:2], subnets) {
+		t.Errorf("expected the network to not be routable")
+	}
+	if hostInSubnets(addrs, []string{"invalid"}) {
+		t.Errorf("expected the invalid subnets to be ignored")
+	}
+}
+
+func Test_publishesHostPorts(t *testing.T) {
+	script := `case "$*" in
+*static) echo '{"io.x-k8s.cloud-provider-kind.loadbalancer.host-ports":"true"}' ;;
+*ephemeral) echo '{"io.x-k8s.cloud-provider-kind.cluster":"kind"}' ;;
+*) echo "Error: No such object: $4" >&2; exit 1 ;;
+esac`
+	t.Cleanup(container.Use(containertest.New(t, script)))
+	for name, want := range map[string]bool{"static": true, "ephemeral": false, "missing": false} {
+		if got := publishesHostPorts(context.Background(), name); got != want {
+			t.Errorf("publishesHostPorts(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/netip"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
+	"sigs.k8s.io/cloud-provider-kind/pkg/metrics"
+)
+
+// ipPoolWarningThreshold is the utilization of the address pool that logs a warning,
+// the loadbalancers can not be created once the pool is exhausted.
+const ipPoolWarningThreshold = 0.9
+
+// reserveNetworkAddresses syncs the addresses in use of the allocator with the gateways and the
+// addresses of the containers of the network, the addresses of the removed containers are freed
+func reserveNetworkAddresses(allocator *ipam.Allocator, network *container.Network) {
+	reserved := map[netip.Addr]string{}
+	for _, gateway := range network.Gateways {
+		if addr, err := netip.ParseAddr(gateway); err == nil {
+			reserved[addr] = "gateway"
+		}
+	}
+	for address, owner := range network.Addresses {
+		if addr, err := netip.ParseAddr(address); err == nil {
+			reserved[addr] = owner
+		}
+	}
+	allocator.SyncReserved(reserved)
+}
+
+// networkIPPool returns the pool the loadbalancer addresses are assigned from with the addresses of
+// the network in use, the configured range, the configured IPv4 subnet or the first IPv4 subnet the
+// container runtime assigns the addresses from. It returns nil if the network has no IPv4 subnet.
+// The pool of the configured range is a copy, so the allocator is not changed by the metrics.
+func networkIPPool(ipRange *ipam.Allocator, network *container.Network) *ipam.Allocator {
+	var pool *ipam.Allocator
+	if ipRange != nil {
+		pool = ipRange.Clone()
+	}
+	if subnet := config.DefaultConfig.LoadBalancerIPv4Subnet; pool == nil && subnet.IsValid() {
+		pool = ipam.New(subnet)
+	}
+	if pool == nil {
+		for _, subnet := range network.Subnets {
+			prefix, err := netip.ParsePrefix(subnet)
+			if err == nil && prefix.Addr().Is4() {
+				pool = ipam.New(prefix)
+				break
+			}
+		}
+	}
+	if pool == nil {
+		return nil
+	}
+	reserveNetworkAddresses(pool, network)
+	return pool
+}
+
+// updateIPPoolMetrics updates the utilization of the address pool of the network, and warns if it
+// is almost exhausted so the users know before the loadbalancers fail to be created.
+func (s *Server) updateIPPoolMetrics(ctx context.Context, clusterName string, networkName string, warn bool) {
+	network, err := container.NetworkInspect(ctx, networkName)
+	if err != nil {
+		klog.V(2).Infof("can not get the address pool of network %s: %v", networkName, err)
+		return
+	}
+	pool := networkIPPool(s.ipAllocator, network)
+	if pool == nil {
+		return
+	}
+	used, size := pool.Used(), pool.Size()
+	available := uint64(0)
+	if size > used {
+		available = size - used
+	}
+	metrics.LoadBalancerIPPoolUsed.WithLabelValues(clusterName, networkName).Set(float64(used))
+	metrics.LoadBalancerIPPoolAvailable.WithLabelValues(clusterName, networkName).Set(float64(available))
+	if warn && size > 0 && float64(used)/float64(size) >= ipPoolWarningThreshold {
+		klog.Warningf("loadbalancer address pool %s of network %s is almost exhausted, %d of %d addresses in use", pool.Prefix(), networkName, used, size)
+	}
+}
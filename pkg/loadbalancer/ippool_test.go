@@ -0,0 +1,46 @@
+package loadbalancer
+
+import (
+	"net/netip"
+	"testing"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
+)
+
+func Test_networkIPPool(t *testing.T) {
+	network := &container.Network{
+		Subnets:  []string{"fc00:f853:ccd:e793::/64", "172.18.0.0/16"},
+		Gateways: []string{"fc00:f853:ccd:e793::1", "172.18.0.1"},
+		Addresses: map[string]string{
+			"172.18.0.2":            "kind-control-plane",
+			"172.18.0.3":            "kind-worker",
+			"172.18.200.5":          "kindccm-lb",
+			"fc00:f853:ccd:e793::2": "kind-control-plane",
+		},
+	}
+
+	// the subnet the container runtime assigns the addresses from
+	pool := networkIPPool(nil, network)
+	if pool == nil || pool.Prefix() != netip.MustParsePrefix("172.18.0.0/16") {
+		t.Fatalf("expected the IPv4 subnet pool, got %v", pool)
+	}
+	if used, size := pool.Used(), pool.Size(); used != 4 || size != 65534 {
+		t.Errorf("expected 4 of 65534 addresses in use, got %d of %d", used, size)
+	}
+
+	// the configured range
+	ipRange := ipam.New(netip.MustParsePrefix("172.18.200.0/24"))
+	pool = networkIPPool(ipRange, network)
+	if used, size := pool.Used(), pool.Size(); used != 1 || size != 254 {
+		t.Errorf("expected 1 of 254 addresses in use, got %d of %d", used, size)
+	}
+	if used := ipRange.Used(); used != 0 {
+		t.Errorf("expected the configured range not to be changed, got %d addresses in use", used)
+	}
+
+	// no IPv4 subnet
+	if pool := networkIPPool(nil, &container.Network{Subnets: []string{"fc00:f853:ccd:e793::/64"}}); pool != nil {
+		t.Errorf("expected no pool, got %v", pool.Prefix())
+	}
+}
@@ -0,0 +1,115 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// suffixes of the container names used while a loadbalancer is migrated
+const (
+	standbySuffix = "-standby"
+	retiredSuffix = "-retired"
+)
+
+// outdatedImage returns true if the loadbalancer container was created with another image
+// than the configured one
+func outdatedImage(ctx context.Context, name string) bool {
+	image, err := container.Image(ctx, name)
+	return err == nil && image != Image()
+}
+
+// migrateLoadBalancer replaces the running loadbalancer container with a new one created with
+// the current configuration that keeps its addresses, making the new one before breaking the old one:
+//  1. a standby container is created with a temporary address while the old one serves the traffic
+//  2. the containers swap their names, the new one is configured and waits until it is ready
+//  3. the addresses are moved from the old container to the new one and the old one is deleted
+//
+// The traffic is only interrupted while the addresses move, the old container keeps serving it
+// if any of the previous steps fails.
+func (s *Server) migrateLoadBalancer(ctx context.Context, name string, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	standby, retired := name+standbySuffix, name+retiredSuffix
+	// the containers of an interrupted migration
+	for _, leftover := range []string{standby, retired} {
+		if container.Exist(ctx, leftover) {
+			if err := container.Delete(ctx, leftover); err != nil {
+				return err
+			}
+		}
+	}
+	ipv4, ipv6, err := container.IPs(ctx, name)
+	if err != nil {
+		return err
+	}
+	networkName := clusterNetworks(ctx, clusterName)[0]
+	s.holdAddresses(name, ipv4, ipv6)
+
+	klog.Infof("migrating loadbalancer %s to image %s keeping the addresses %q %q", name, Image(), ipv4, ipv6)
+	if err := s.createLoadBalancer(ctx, standby, clusterName, service, Image(), netip.Addr{}, netip.Addr{}); err != nil {
+		return fmt.Errorf("failed to create the standby loadbalancer %s: %w", standby, err)
+	}
+	// the temporary address is not needed once the addresses are moved or the migration fails
+	defer s.releaseIPs(standby)
+	if err := container.Rename(ctx, name, retired); err != nil {
+		s.deleteStandby(ctx, standby)
+		return err
+	}
+	if err := container.Rename(ctx, standby, name); err != nil {
+		s.deleteStandby(ctx, standby)
+		if err2 := container.Rename(ctx, retired, name); err2 != nil {
+			klog.Infof("failed to restore the name of loadbalancer %s: %v", name, err2)
+		}
+		return err
+	}
+	// the old container is restored with its name if the new one can not take over
+	rollback := func(err error) error {
+		s.deleteStandby(ctx, name)
+		if err2 := container.Rename(ctx, retired, name); err2 != nil {
+			klog.Infof("failed to restore the name of loadbalancer %s: %v", name, err2)
+		}
+		return fmt.Errorf("failed to migrate loadbalancer %s, the previous container keeps serving: %w", name, err)
+	}
+	// the configuration is applied to the container with the name of the loadbalancer
+	if err := s.UpdateLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+		return rollback(err)
+	}
+	if err := container.MoveAddresses(ctx, networkName, retired, name, ipv4, ipv6); err != nil {
+		return rollback(err)
+	}
+	announceAddresses(ctx, name)
+	if err := container.Delete(ctx, retired); err != nil {
+		// it is detached from the primary network, it is deleted on the next migration
+		klog.Infof("failed to delete the previous container of loadbalancer %s: %v", name, err)
+	}
+	klog.Infof("loadbalancer %s migrated to image %s", name, Image())
+	return nil
+}
+
+// holdAddresses allocates the addresses of the range to the loadbalancer, so they are not
+// allocated to other loadbalancer while they are not attached to any container
+func (s *Server) holdAddresses(name string, ips ...string) {
+	if s.ipAllocator == nil {
+		return
+	}
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !s.ipAllocator.Prefix().Contains(addr) {
+			continue
+		}
+		if err := s.ipAllocator.AllocateSpecific(addr, name); err != nil {
+			klog.V(2).Infof("failed to hold address %s of loadbalancer %s: %v", addr, name, err)
+		}
+	}
+}
+
+// deleteStandby deletes the container created for a migration that did not complete
+func (s *Server) deleteStandby(ctx context.Context, name string) {
+	if err := container.Delete(ctx, name); err != nil {
+		klog.Infof("failed to delete the standby loadbalancer %s: %v", name, err)
+	}
+}
@@ -0,0 +1,96 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// defaultNetwork returns the network KIND uses for the clusters
+func defaultNetwork() string {
+	if n := os.Getenv("KIND_EXPERIMENTAL_DOCKER_NETWORK"); n != "" {
+		return n
+	}
+	return constants.FixedNetworkName
+}
+
+// clusterNetworks returns the networks the nodes of the cluster are attached to,
+// the first one is the network used to create the loadbalancer and allocate its
+// addresses, the loadbalancer is attached to the rest so it can reach all the nodes.
+// The default network is preferred, otherwise the network with more nodes.
+func clusterNetworks(ctx context.Context, clusterName string) []string {
+	nodes, err := container.ListByLabel(ctx, fmt.Sprintf("%s=%s", constants.KindClusterLabelKey, clusterName))
+	if err != nil || len(nodes) == 0 {
+		klog.V(2).Infof("could not find the nodes of cluster %s, using the default network: %v", clusterName, err)
+		return []string{defaultNetwork()}
+	}
+	// number of nodes on each network
+	count := map[string]int{}
+	for _, node := range nodes {
+		networks, err := container.Networks(ctx, node)
+		if err != nil {
+			klog.Infof("could not get the networks of node %s on cluster %s: %v", node, clusterName, err)
+			continue
+		}
+		for _, network := range networks {
+			count[network]++
+		}
+	}
+	if len(count) == 0 {
+		return []string{defaultNetwork()}
+	}
+
+	networks := make([]string, 0, len(count))
+	for network := range count {
+		networks = append(networks, network)
+	}
+	preferred := defaultNetwork()
+	sort.Slice(networks, func(i, j int) bool {
+		if networks[i] == preferred || networks[j] == preferred {
+			return networks[i] == preferred
+		}
+		if count[networks[i]] != count[networks[j]] {
+			return count[networks[i]] > count[networks[j]]
+		}
+		return networks[i] < networks[j]
+	})
+	return networks
+}
+
+// additionalNetworks returns the networks the loadbalancer of the Service is attached to
+// besides the networks of the cluster, from the flag and from the Service annotation,
+// the annotation is ignored by the shared loadbalancer as it would affect all the Services.
+func additionalNetworks(service *v1.Service, shared bool) []string {
+	networks := append([]string{}, config.DefaultConfig.LoadBalancerAdditionalNetworks...)
+	if v, ok := service.Annotations[constants.AdditionalNetworksAnnotationKey]; ok {
+		if shared {
+			klog.Infof("annotation %s of Service %s/%s is ignored, the loadbalancer is shared", constants.AdditionalNetworksAnnotationKey, service.Namespace, service.Name)
+		} else {
+			for _, network := range strings.Split(v, ",") {
+				if network = strings.TrimSpace(network); network != "" {
+					networks = append(networks, network)
+				}
+			}
+		}
+	}
+	// keep the order, the first occurrence wins
+	result := []string{}
+	seen := sets.New[string]()
+	for _, network := range networks {
+		if !seen.Has(network) {
+			seen.Insert(network)
+			result = append(result, network)
+		}
+	}
+	return result
+}
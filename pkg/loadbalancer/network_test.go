@@ -0,0 +1,57 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_additionalNetworks(t *testing.T) {
+	tests := []struct {
+		name        string
+		flag        []string
+		annotations map[string]string
+		shared      bool
+		want        []string
+	}{
+		{
+			name: "none",
+			want: []string{},
+		},
+		{
+			name: "flag",
+			flag: []string{"clients"},
+			want: []string{"clients"},
+		},
+		{
+			name:        "flag and annotation without duplicates",
+			flag:        []string{"clients"},
+			annotations: map[string]string{constants.AdditionalNetworksAnnotationKey: "monitoring, clients,,"},
+			want:        []string{"clients", "monitoring"},
+		},
+		{
+			name:        "annotation is ignored by the shared loadbalancer",
+			flag:        []string{"clients"},
+			annotations: map[string]string{constants.AdditionalNetworksAnnotationKey: "monitoring"},
+			shared:      true,
+			want:        []string{"clients"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.DefaultConfig.LoadBalancerAdditionalNetworks
+			config.DefaultConfig.LoadBalancerAdditionalNetworks = tt.flag
+			defer func() { config.DefaultConfig.LoadBalancerAdditionalNetworks = old }()
+
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", Annotations: tt.annotations}}
+			if got := additionalNetworks(service, tt.shared); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("additionalNetworks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+const (
+	// overrideListenerKey is the ConfigMap key with the fields merged into every listener of the Service
+	overrideListenerKey = "listener.yaml"
+	// overrideClusterKey is the ConfigMap key with the fields merged into every cluster of the Service
+	overrideClusterKey = "cluster.yaml"
+
+	listenerType = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	clusterType  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+)
+
+// reservedListenerFields and reservedClusterFields wire the listeners with the clusters
+// and the backends, they can not be overridden.
+var (
+	reservedListenerFields = []string{"@type", "name", "address", "filter_chains"}
+	reservedClusterFields  = []string{"@type", "name", "type", "load_assignment"}
+)
+
+// ConfigMapGetter returns the ConfigMap with the namespace and name.
+type ConfigMapGetter func(namespace, name string) (*v1.ConfigMap, error)
+
+// proxyOverride are the fields merged into the generated envoy resources
+type proxyOverride struct {
+	Listener map[string]interface{}
+	Cluster  map[string]interface{}
+}
+
+// SetConfigMapGetter sets the function used to get the ConfigMaps referenced by the
+// proxy config override annotation, the annotation is ignored until it is set.
+func (s *Server) SetConfigMapGetter(getter ConfigMapGetter) {
+	s.configMapGetter = getter
+}
+
+// proxyOverride returns the override of the Service, nil means there is no override.
+// A missing ConfigMap falls back to the generated configuration.
+func (s *Server) proxyOverride(service *v1.Service) (*proxyOverride, error) {
+	name := service.Annotations[constants.ProxyConfigOverrideAnnotationKey]
+	if name == "" || s.configMapGetter == nil {
+		return nil, nil
+	}
+	cm, err := s.configMapGetter(service.Namespace, name)
+	if apierrors.IsNotFound(err) {
+		klog.Warningf("ConfigMap %s/%s referenced by the Service %s annotation %s does not exist, using the default configuration",
+			service.Namespace, name, service.Name, constants.ProxyConfigOverrideAnnotationKey)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the proxy config override ConfigMap %s/%s: %w", service.Namespace, name, err)
+	}
+	return parseProxyOverride(cm)
+}
+
+// parseProxyOverride parses and validates the override of the ConfigMap
+func parseProxyOverride(cm *v1.ConfigMap) (*proxyOverride, error) {
+	override := &proxyOverride{}
+	for key, reserved := range map[string][]string{overrideListenerKey: reservedListenerFields, overrideClusterKey: reservedClusterFields} {
+		data, ok := cm.Data[key]
+		if !ok {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(data), &fields); err != nil {
+			return nil, fmt.Errorf("invalid %s in ConfigMap %s/%s: %w", key, cm.Namespace, cm.Name, err)
+		}
+		for _, field := range reserved {
+			if _, ok := fields[field]; ok {
+				return nil, fmt.Errorf("invalid %s in ConfigMap %s/%s: field %s can not be overridden", key, cm.Namespace, cm.Name, field)
+			}
+		}
+		if key == overrideListenerKey {
+			override.Listener = fields
+		} else {
+			override.Cluster = fields
+		}
+	}
+	return override, nil
+}
+
+// applyProxyOverride merges the override into the listeners and clusters of the envoy config
+func applyProxyOverride(config string, override *proxyOverride) (string, error) {
+	resources := struct {
+		Resources []map[string]interface{} `json:"resources"`
+	}{}
+	if err := yaml.Unmarshal([]byte(config), &resources); err != nil {
+		return "", fmt.Errorf("failed to parse loadbalancer config: %w", err)
+	}
+	for _, resource := range resources.Resources {
+		switch resource["@type"] {
+		case listenerType:
+			mergeFields(resource, override.Listener)
+		case clusterType:
+			mergeFields(resource, override.Cluster)
+		}
+	}
+	out, err := yaml.Marshal(resources)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate loadbalancer config: %w", err)
+	}
+	// keep the same format of the templates
+	return "\n" + strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// mergeFields merges the src fields into dst, the nested objects are merged
+// and any other value replaced.
+func mergeFields(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstMap, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dstMap = map[string]interface{}{}
+			dst[k] = dstMap
+		}
+		mergeFields(dstMap, srcMap)
+	}
+}
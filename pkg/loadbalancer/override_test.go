@@ -0,0 +1,139 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_parseProxyOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *proxyOverride
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: &proxyOverride{},
+		},
+		{
+			name: "listener and cluster",
+			data: map[string]string{
+				overrideListenerKey: "per_connection_buffer_limit_bytes: 32768",
+				overrideClusterKey:  "circuit_breakers:\n  thresholds:\n  - max_connections: 100",
+			},
+			want: &proxyOverride{
+				Listener: map[string]interface{}{"per_connection_buffer_limit_bytes": float64(32768)},
+				Cluster: map[string]interface{}{"circuit_breakers": map[string]interface{}{
+					"thresholds": []interface{}{map[string]interface{}{"max_connections": float64(100)}},
+				}},
+			},
+		},
+		{
+			name:    "listener address can not be overridden",
+			data:    map[string]string{overrideListenerKey: "address:\n  socket_address:\n    port_value: 8080"},
+			wantErr: true,
+		},
+		{
+			name:    "cluster endpoints can not be overridden",
+			data:    map[string]string{overrideClusterKey: "load_assignment: {}"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			data:    map[string]string{overrideClusterKey: "- a\nb: c"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "override", Namespace: "ns"}, Data: tt.data}
+			got, err := parseProxyOverride(cm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProxyOverride() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProxyOverride() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_proxyConfigOverride(t *testing.T) {
+	data := &proxyConfigData{
+		HealthCheckPort: 32764,
+		ServicePorts: map[string]servicePort{
+			"IPv4_80_TCP": {
+				Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: "TCP"},
+				Cluster:  []endpoint{{Address: "192.168.8.2", Port: 30497, Protocol: "TCP"}},
+			},
+		},
+		Override: &proxyOverride{
+			Listener: map[string]interface{}{"per_connection_buffer_limit_bytes": 32768},
+			Cluster:  map[string]interface{}{"connect_timeout": "1s", "common_lb_config": map[string]interface{}{"healthy_panic_threshold": map[string]interface{}{"value": 0}}},
+		},
+	}
+	for _, tt := range []struct {
+		name     string
+		template string
+		check    func(resource map[string]interface{}) bool
+	}{
+		{
+			name:     "listener",
+			template: proxyLDSConfigTemplate,
+			check: func(resource map[string]interface{}) bool {
+				return resource["per_connection_buffer_limit_bytes"] == float64(32768) && resource["name"] == "listener_IPv4_80_TCP"
+			},
+		},
+		{
+			name:     "cluster",
+			template: proxyCDSConfigTemplate,
+			check: func(resource map[string]interface{}) bool {
+				lbConfig, _ := resource["common_lb_config"].(map[string]interface{})
+				return resource["connect_timeout"] == "1s" && lbConfig != nil &&
+					// the existing fields are kept
+					lbConfig["healthy_panic_threshold"] != nil && resource["load_assignment"] != nil
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := proxyConfig(tt.template, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resources := struct {
+				Resources []map[string]interface{} `json:"resources"`
+			}{}
+			if err := yaml.Unmarshal([]byte(config), &resources); err != nil {
+				t.Fatalf("invalid config %s: %v", config, err)
+			}
+			if len(resources.Resources) != 1 || !tt.check(resources.Resources[0]) {
+				t.Errorf("override not applied to the config:\n%s", config)
+			}
+		})
+	}
+}
+
+func TestServer_proxyOverrideMissingConfigMap(t *testing.T) {
+	s := &Server{}
+	s.SetConfigMapGetter(func(namespace, name string) (*v1.ConfigMap, error) {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	})
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "svc",
+		Namespace:   "ns",
+		Annotations: map[string]string{constants.ProxyConfigOverrideAnnotationKey: "missing"},
+	}}
+	override, err := s.proxyOverride(service)
+	if err != nil || override != nil {
+		t.Errorf("proxyOverride() = %v, %v, want the default configuration", override, err)
+	}
+}
@@ -5,34 +5,85 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 	netutils "k8s.io/utils/net"
 
 	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
 	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/metrics"
 )
 
-// proxyImage defines the loadbalancer image:tag
-const proxyImage = "docker.io/envoyproxy/envoy:v1.30.1"
+// DefaultImage defines the default loadbalancer image:tag
+const DefaultImage = "docker.io/envoyproxy/envoy:v1.30.1"
+
+// Image returns the loadbalancer image configured or the default one
+func Image() string {
+	if image := config.DefaultConfig.LoadBalancerImage; image != "" {
+		return image
+	}
+	return DefaultImage
+}
+
+// PullImage pulls the loadbalancer image if it is not present on the host,
+// so the first loadbalancer does not have to wait for it. It retries with
+// backoff until it succeeds or the context is cancelled.
+func PullImage(ctx context.Context) error {
+	image := Image()
+	imagePulling.Store(true)
+	defer imagePulling.Store(false)
+	backoff := wait.Backoff{
+		Duration: 1 * time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      2 * time.Minute,
+	}
+	return wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		if container.ImageExists(ctx, image) {
+			klog.Infof("loadbalancer image %s is ready", image)
+			metrics.LoadBalancerImageReady.Set(1)
+			return true, nil
+		}
+		klog.Infof("pulling loadbalancer image %s", image)
+		if err := container.Pull(ctx, image); err != nil {
+			klog.Infof("error pulling loadbalancer image, retrying ...: %v", err)
+			return false, nil
+		}
+		klog.Infof("loadbalancer image %s is ready", image)
+		metrics.LoadBalancerImageReady.Set(1)
+		return true, nil
+	})
+}
 
 // keep in sync with dynamicFilesystemConfig
 const (
-	proxyConfigPath    = "/home/envoy/envoy.yaml"
-	proxyConfigPathCDS = "/home/envoy/cds.yaml"
-	proxyConfigPathLDS = "/home/envoy/lds.yaml"
+	proxyConfigDir     = "/home/envoy"
+	proxyConfigPath    = proxyConfigDir + "/envoy.yaml"
+	proxyConfigPathCDS = proxyConfigDir + "/cds.yaml"
+	proxyConfigPathLDS = proxyConfigDir + "/lds.yaml"
 	envoyAdminPort     = 10000
 )
 
+// default values for the backends health checks
+const (
+	defaultHealthCheckInterval           = 3 * time.Second
+	defaultHealthCheckUnhealthyThreshold = 2
+)
+
 // start Envoy with dynamic configuration by using files that implement the xDS protocol.
 // https://www.envoyproxy.io/docs/envoy/latest/start/quick-start/configuration-dynamic-filesystem
 const dynamicFilesystemConfig = `node:
@@ -57,10 +108,51 @@ admin:
 
 // proxyConfigData is supplied to the loadbalancer config template
 type proxyConfigData struct {
-	HealthCheckPort int                    // is the same for all ServicePorts
-	ServicePorts    map[string]servicePort // key is the IP family and Port and Protocol to support MultiPort services
-	SessionAffinity string
-	SourceRanges    []sourceRange
+	HealthCheckPort               int    // is the same for all ServicePorts, zero means to check the backend port
+	HealthCheckInterval           string // envoy duration format
+	HealthCheckUnhealthyThreshold int
+	ServicePorts                  map[string]servicePort // key is the IP family and Port and Protocol to support MultiPort services
+	SessionAffinity               string
+	// SessionAffinityTimeout is the sessionAffinityConfig.clientIP.timeoutSeconds of the Service,
+	// the TCP connections are always hashed to the same backend and the UDP sessions expire after the timeout.
+	SessionAffinityTimeout int
+	SourceRanges           []sourceRange
+	// TrafficPolicy is the Service externalTrafficPolicy or the one of its traffic-policy annotation,
+	// with Local policy only the nodes that pass the health check must receive traffic.
+	TrafficPolicy string
+	// ProxyProtocol is the version of the PROXY protocol sent to the TCP backends, V1 or V2.
+	// Empty means disabled.
+	ProxyProtocol string
+	// IdleTimeout is the idle timeout of the TCP connections in envoy duration format,
+	// empty means the envoy default.
+	IdleTimeout string
+	// TCPKeepalive is the number of seconds a TCP connection is idle before sending
+	// keepalive probes, zero means disabled.
+	TCPKeepalive int
+	// Override is merged into the generated configuration, nil means no override.
+	Override *proxyOverride
+	// HealthCheckProtocol is the protocol used to check the NodePort of the TCP backends
+	// instead of the default health check, TCP, HTTP or HTTPS. Empty means the default.
+	HealthCheckProtocol string
+	// HealthCheckPath is the path of the HTTP and HTTPS health checks.
+	HealthCheckPath string
+	// HealthCheckExpectedStatuses are the HTTP status ranges considered healthy, empty means 200.
+	HealthCheckExpectedStatuses []statusRange
+	// AccessLogDisabled disables the access logs of the listeners.
+	AccessLogDisabled bool
+	// AccessLogPath is the file inside the container the access logs are written to,
+	// empty means the container output.
+	AccessLogPath string
+	// Weighted balances the traffic by the weights of the backends.
+	Weighted bool
+	// TLSCertificate is the certificate of the listeners that terminate TLS, nil means none does.
+	TLSCertificate *tlsCertificate
+}
+
+// statusRange is a range of HTTP status codes, the end is exclusive.
+type statusRange struct {
+	Start int
+	End   int
 }
 
 type sourceRange struct {
@@ -73,6 +165,13 @@ type servicePort struct {
 	Listener endpoint
 	// backend
 	Cluster []endpoint
+	// Draining are the backends removed that do not receive new connections
+	// but keep the existing ones until the drain timeout expires
+	Draining []endpoint
+	// Weights are the shares of the traffic of the backends, empty means unweighted
+	Weights map[endpoint]int
+	// TLS terminates TLS on the listener with the certificate of the config
+	TLS bool
 }
 
 type endpoint struct {
@@ -92,6 +191,17 @@ resources:
       address: {{ $servicePort.Listener.Address }}
       port_value: {{ $servicePort.Listener.Port }}
       protocol: {{ $servicePort.Listener.Protocol }}
+  {{- if and $.TCPKeepalive (eq $servicePort.Listener.Protocol "TCP") }}
+  socket_options:
+  # SOL_SOCKET SO_KEEPALIVE
+  - level: 1
+    name: 9
+    int_value: 1
+  # IPPROTO_TCP TCP_KEEPIDLE
+  - level: 6
+    name: 4
+    int_value: {{ $.TCPKeepalive }}
+  {{- end }}
   {{- if eq $servicePort.Listener.Protocol "UDP"}}
   udp_listener_config:
     downstream_socket_config:
@@ -100,21 +210,56 @@ resources:
   - name: envoy.filters.udp_listener.udp_proxy
     typed_config:
       '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+      {{- if not $.AccessLogDisabled }}
       access_log:
       - name: envoy.file_access_log
         typed_config:
+          {{- if $.AccessLogPath }}
+          "@type": type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog
+          path: {{ $.AccessLogPath }}
+          {{- else }}
           "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+          {{- end }}
+          log_format:
+            text_format_source:
+              inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms\n"
+      {{- end }}
       stat_prefix: udp_proxy
       matcher:
+      {{- if len $.SourceRanges }}
+        matcher_tree:
+          input:
+            name: envoy.matching.inputs.source_ip
+            typed_config:
+              '@type': type.googleapis.com/envoy.extensions.matching.common_inputs.network.v3.SourceIPInput
+          custom_match:
+            name: source_ranges
+            typed_config:
+              '@type': type.googleapis.com/xds.type.matcher.v3.IPMatcher
+              range_matchers:
+              - ranges:
+                {{- range $sr := $.SourceRanges }}
+                - address_prefix: "{{ $sr.Prefix }}"
+                  prefix_len: {{ $sr.Length }}
+                {{- end }}
+                on_match:
+                  action:
+                    name: route
+                    typed_config:
+                      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
+                      cluster: cluster_{{$index}}
+      {{- else }}
         on_no_match:
           action:
             name: route
             typed_config:
               '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
               cluster: cluster_{{$index}}
+      {{- end }}
       {{- if eq $.SessionAffinity "ClientIP"}}
       hash_policies:
         source_ip: true
+      idle_timeout: {{ $.SessionAffinityTimeout }}s
       {{- end}}
       upstream_socket_config:
         max_rx_datagram_size: 9000
@@ -124,16 +269,41 @@ resources:
     - name: envoy.filters.network.tcp_proxy
       typed_config:
         "@type": type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+        {{- if not $.AccessLogDisabled }}
         access_log:
         - name: envoy.file_access_log
           typed_config:
+            {{- if $.AccessLogPath }}
+            "@type": type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog
+            path: {{ $.AccessLogPath }}
+            {{- else }}
             "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+            {{- end }}
+            log_format:
+              text_format_source:
+                inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms flags=%RESPONSE_FLAGS%\n"
+        {{- end }}
         stat_prefix: tcp_proxy
         cluster: cluster_{{$index}}
+        {{- if $.IdleTimeout }}
+        idle_timeout: {{ $.IdleTimeout }}
+        {{- end }}
         {{- if eq $.SessionAffinity "ClientIP"}}
         hash_policy:
           source_ip: {}
         {{- end}}
+  {{- if and $servicePort.TLS $.TLSCertificate }}
+    transport_socket:
+      name: envoy.transport_sockets.tls
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext
+        common_tls_context:
+          tls_certificates:
+          - certificate_chain:
+              inline_string: {{ printf "%q" $.TLSCertificate.CertificateChain }}
+            private_key:
+              inline_string: {{ printf "%q" $.TLSCertificate.PrivateKey }}
+  {{- end }}
   {{- if len $.SourceRanges }}
     filter_chain_match:
       source_prefix_ranges:
@@ -151,34 +321,124 @@ resources:
 const proxyCDSConfigTemplate = `
 resources:
 {{- range $index, $servicePort := .ServicePorts }}
+{{- $customHealthCheck := and $.HealthCheckProtocol (eq $servicePort.Listener.Protocol "TCP") }}
+{{- $httpsHealthCheck := and $customHealthCheck (eq $.HealthCheckProtocol "HTTPS") }}
+{{- $proxyProtocol := and $.ProxyProtocol (eq $servicePort.Listener.Protocol "TCP") }}
 - "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
   name: cluster_{{$index}}
   connect_timeout: 5s
   type: STATIC
   {{- if eq $.SessionAffinity "ClientIP"}}
   lb_policy: RING_HASH
+  {{- else if $.Weighted }}
+  lb_policy: ROUND_ROBIN
   {{- else}}
   lb_policy: RANDOM
   {{- end}}
+  {{- if eq $.TrafficPolicy "Local"}}
+  common_lb_config:
+    healthy_panic_threshold:
+      value: 0
+  {{- end}}
+  {{- if $proxyProtocol }}
+  transport_socket:
+    name: envoy.transport_sockets.upstream_proxy_protocol
+    typed_config:
+      "@type": type.googleapis.com/envoy.extensions.transport_sockets.proxy_protocol.v3.ProxyProtocolUpstreamTransport
+      config:
+        version: {{ $.ProxyProtocol }}
+      transport_socket:
+        name: envoy.transport_sockets.raw_buffer
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.transport_sockets.raw_buffer.v3.RawBuffer
+  {{- end }}
+  {{- if or $proxyProtocol $httpsHealthCheck }}
+  transport_socket_matches:
+  {{- if $proxyProtocol }}
+  - name: health_check
+    match:
+      health_check: true
+    transport_socket:
+      name: envoy.transport_sockets.raw_buffer
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.raw_buffer.v3.RawBuffer
+  {{- end }}
+  {{- if $httpsHealthCheck }}
+  - name: health_check_tls
+    match:
+      health_check_tls: true
+    transport_socket:
+      name: envoy.transport_sockets.tls
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+  {{- end }}
+  {{- end }}
+  {{- if and $.TCPKeepalive (eq $servicePort.Listener.Protocol "TCP") }}
+  upstream_connection_options:
+    tcp_keepalive:
+      keepalive_time: {{ $.TCPKeepalive }}
+  {{- end }}
   health_checks:
   - timeout: 5s
-    interval: 3s
-    unhealthy_threshold: 2
+    interval: {{ $.HealthCheckInterval }}
+    unhealthy_threshold: {{ $.HealthCheckUnhealthyThreshold }}
     healthy_threshold: 1
     no_traffic_interval: 5s
     always_log_health_check_failures: true
     always_log_health_check_success: true
     event_log_path: /dev/stdout
+    {{- if $httpsHealthCheck }}
+    transport_socket_match_criteria:
+      health_check_tls: true
+    {{- else if $proxyProtocol }}
+    transport_socket_match_criteria:
+      health_check: true
+    {{- end }}
+    {{- if and $customHealthCheck (ne $.HealthCheckProtocol "TCP") }}
+    http_health_check:
+      path: {{ $.HealthCheckPath }}
+      {{- if $.HealthCheckExpectedStatuses }}
+      expected_statuses:
+      {{- range $status := $.HealthCheckExpectedStatuses }}
+      - start: {{ $status.Start }}
+        end: {{ $status.End }}
+      {{- end }}
+      {{- end }}
+    {{- else if $customHealthCheck }}
+    tcp_health_check: {}
+    {{- else if $.HealthCheckPort }}
     http_health_check:
       path: /healthz
+    {{- else }}
+    tcp_health_check: {}
+    {{- end }}
   load_assignment:
     cluster_name: cluster_{{$index}}
     endpoints:
     {{- range $address := $servicePort.Cluster }}
       - lb_endpoints:
         - endpoint:
+            {{- if and $.HealthCheckPort (not $customHealthCheck) }}
             health_check_config:
               port_value: {{ $.HealthCheckPort }}
+            {{- end }}
+            address:
+              socket_address:
+                address: {{ $address.Address }}
+                port_value: {{ $address.Port }}
+                protocol: {{ $address.Protocol }}
+          {{- with index $servicePort.Weights $address }}
+          load_balancing_weight: {{ . }}
+          {{- end }}
+    {{- end}}
+    {{- range $address := $servicePort.Draining }}
+      - lb_endpoints:
+        - health_status: DRAINING
+          endpoint:
+            {{- if and $.HealthCheckPort (not $customHealthCheck) }}
+            health_check_config:
+              port_value: {{ $.HealthCheckPort }}
+            {{- end }}
             address:
               socket_address:
                 address: {{ $address.Address }}
@@ -188,10 +448,27 @@ resources:
 {{- end }}
 `
 
+// proxyTemplates caches the parsed config templates by their text, they are parsed once
+// instead of on every update of every loadbalancer.
+var proxyTemplates sync.Map
+
+// parseProxyTemplate returns the parsed config template
+func parseProxyTemplate(configTemplate string) (*template.Template, error) {
+	if t, ok := proxyTemplates.Load(configTemplate); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("loadbalancer-config").Parse(configTemplate)
+	if err != nil {
+		return nil, err
+	}
+	proxyTemplates.Store(configTemplate, t)
+	return t, nil
+}
+
 // proxyConfig returns a kubeadm config generated from config data, in particular
 // the kubernetes version
 func proxyConfig(configTemplate string, data *proxyConfigData) (config string, err error) {
-	t, err := template.New("loadbalancer-config").Parse(configTemplate)
+	t, err := parseProxyTemplate(configTemplate)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to parse config template")
 	}
@@ -201,28 +478,162 @@ func proxyConfig(configTemplate string, data *proxyConfigData) (config string, e
 	if err != nil {
 		return "", errors.Wrap(err, "error executing config template")
 	}
+	if data != nil && data.Override != nil {
+		return applyProxyOverride(buff.String(), data.Override)
+	}
 	return buff.String(), nil
 }
 
+// parseStatusRanges parses a comma-separated list of HTTP status codes or inclusive
+// ranges of status codes, e.g. 200,300-399
+func parseStatusRanges(value string) ([]statusRange, error) {
+	ranges := []statusRange{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		startValue, endValue, isRange := strings.Cut(item, "-")
+		if !isRange {
+			endValue = startValue
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(startValue))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", item)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(endValue))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", item)
+		}
+		if start < 100 || end > 599 || start > end {
+			return nil, fmt.Errorf("invalid status %q, the status codes must be between 100 and 599", item)
+		}
+		// envoy ranges do not include the end
+		ranges = append(ranges, statusRange{Start: start, End: end + 1})
+	}
+	return ranges, nil
+}
+
+// trafficPolicy returns the policy used to select the backends of the loadbalancer, the one of the
+// traffic-policy annotation if it is valid or the Service externalTrafficPolicy otherwise.
+func trafficPolicy(service *v1.Service) v1.ServiceExternalTrafficPolicy {
+	switch v := service.Annotations[constants.TrafficPolicyAnnotationKey]; strings.ToLower(v) {
+	case "":
+	case "cluster":
+		return v1.ServiceExternalTrafficPolicyTypeCluster
+	case "local":
+		return v1.ServiceExternalTrafficPolicyTypeLocal
+	default:
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q, only Cluster and Local are supported",
+			service.Namespace, service.Name, constants.TrafficPolicyAnnotationKey, v)
+	}
+	return service.Spec.ExternalTrafficPolicy
+}
+
 func generateConfig(service *v1.Service, nodes []*v1.Node) *proxyConfigData {
 	if service == nil {
 		return nil
 	}
-	hcPort := 10256 // kube-proxy default port
-	if service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
+	policy := trafficPolicy(service)
+	// the healthCheckNodePort reports if the node has local endpoints, it is only allocated with
+	// Local policy. Without it, per example with Cluster policy, the NodePort is checked directly.
+	hcPort := 0
+	if policy == v1.ServiceExternalTrafficPolicyTypeLocal && service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
 		hcPort = int(service.Spec.HealthCheckNodePort)
 	}
 
+	hcInterval := config.DefaultConfig.LoadBalancerHealthCheckInterval
+	if hcInterval < time.Second {
+		hcInterval = defaultHealthCheckInterval
+	}
+	hcUnhealthyThreshold := config.DefaultConfig.LoadBalancerHealthCheckUnhealthyThreshold
+	if hcUnhealthyThreshold < 1 {
+		hcUnhealthyThreshold = defaultHealthCheckUnhealthyThreshold
+	}
+
 	lbConfig := &proxyConfigData{
-		HealthCheckPort: hcPort,
-		SessionAffinity: string(service.Spec.SessionAffinity),
+		HealthCheckPort:               hcPort,
+		HealthCheckInterval:           envoyDuration(hcInterval),
+		HealthCheckUnhealthyThreshold: hcUnhealthyThreshold,
+		SessionAffinity:               string(service.Spec.SessionAffinity),
+		TrafficPolicy:                 string(policy),
+	}
+	accessLog, accessLogPath := accessLogConfig()
+	lbConfig.AccessLogDisabled = !accessLog
+	lbConfig.AccessLogPath = accessLogPath
+
+	if service.Spec.SessionAffinity == v1.ServiceAffinityClientIP {
+		lbConfig.SessionAffinityTimeout = int(v1.DefaultClientIPServiceAffinitySeconds)
+		if c := service.Spec.SessionAffinityConfig; c != nil && c.ClientIP != nil && c.ClientIP.TimeoutSeconds != nil {
+			lbConfig.SessionAffinityTimeout = int(*c.ClientIP.TimeoutSeconds)
+		}
 	}
 
+	switch v := service.Annotations[constants.ProxyProtocolAnnotationKey]; strings.ToLower(v) {
+	case "":
+	case "v1":
+		lbConfig.ProxyProtocol = "V1"
+	case "v2":
+		lbConfig.ProxyProtocol = "V2"
+	default:
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q, only v1 and v2 are supported",
+			service.Namespace, service.Name, constants.ProxyProtocolAnnotationKey, v)
+	}
+
+	if v, ok := service.Annotations[constants.IdleTimeoutAnnotationKey]; ok {
+		d, err := time.ParseDuration(v)
+		switch {
+		case err != nil || d < 0:
+			klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be a positive duration",
+				service.Namespace, service.Name, constants.IdleTimeoutAnnotationKey, v)
+		case d > 0 && d < time.Millisecond:
+			// it would be rendered as 0s, that disables the timeout
+			klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be 0 or at least 1ms",
+				service.Namespace, service.Name, constants.IdleTimeoutAnnotationKey, v)
+		default:
+			lbConfig.IdleTimeout = envoyDuration(d)
+		}
+	}
+	if v, ok := service.Annotations[constants.TCPKeepaliveAnnotationKey]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be a duration of at least 1s",
+				service.Namespace, service.Name, constants.TCPKeepaliveAnnotationKey, v)
+		} else {
+			lbConfig.TCPKeepalive = int(d.Seconds())
+		}
+	}
+
+	switch v := service.Annotations[constants.HealthCheckProtocolAnnotationKey]; strings.ToUpper(v) {
+	case "":
+	case "TCP", "HTTP", "HTTPS":
+		lbConfig.HealthCheckProtocol = strings.ToUpper(v)
+		lbConfig.HealthCheckPath = "/"
+		if path, ok := service.Annotations[constants.HealthCheckPathAnnotationKey]; ok {
+			if strings.HasPrefix(path, "/") {
+				lbConfig.HealthCheckPath = path
+			} else {
+				klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be an absolute path",
+					service.Namespace, service.Name, constants.HealthCheckPathAnnotationKey, path)
+			}
+		}
+		if statuses, ok := service.Annotations[constants.HealthCheckExpectedStatusAnnotationKey]; ok {
+			ranges, err := parseStatusRanges(statuses)
+			if err != nil {
+				klog.Warningf("service %s/%s annotation %s has an invalid value %q: %v",
+					service.Namespace, service.Name, constants.HealthCheckExpectedStatusAnnotationKey, statuses, err)
+			} else {
+				lbConfig.HealthCheckExpectedStatuses = ranges
+			}
+		}
+	default:
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q, only TCP, HTTP and HTTPS are supported",
+			service.Namespace, service.Name, constants.HealthCheckProtocolAnnotationKey, v)
+	}
+
+	weights := parseBackendWeights(service)
 	servicePortConfig := map[string]servicePort{}
 	for _, ipFamily := range service.Spec.IPFamilies {
 		for _, port := range service.Spec.Ports {
-			if port.Protocol != v1.ProtocolTCP && port.Protocol != v1.ProtocolUDP {
-				klog.Infof("service port protocol %s not supported", port.Protocol)
+			if !IsProtocolSupported(port.Protocol) {
+				klog.V(2).Infof("service port protocol %s not supported", port.Protocol)
 				continue
 			}
 			key := fmt.Sprintf("%s_%d_%s", ipFamily, port.Port, port.Protocol)
@@ -232,6 +643,11 @@ func generateConfig(service *v1.Service, nodes []*v1.Node) *proxyConfigData {
 			}
 
 			backends := []endpoint{}
+			// nil if the backends are not weighted
+			var backendWeights map[endpoint]int
+			if weights != nil {
+				backendWeights = map[endpoint]int{}
+			}
 			for _, n := range nodes {
 				for _, addr := range n.Status.Addresses {
 					// only internal IPs supported
@@ -244,17 +660,23 @@ func generateConfig(service *v1.Service, nodes []*v1.Node) *proxyConfigData {
 						(netutils.IsIPv6String(addr.Address) && ipFamily != v1.IPv6Protocol) {
 						continue
 					}
-					backends = append(backends, endpoint{Address: addr.Address, Port: int(port.NodePort), Protocol: string(port.Protocol)})
+					backend := endpoint{Address: addr.Address, Port: int(port.NodePort), Protocol: string(port.Protocol)}
+					backends = append(backends, backend)
+					if weights != nil {
+						backendWeights[backend] = weights.weight(n.Name, n.Labels[v1.LabelTopologyZone])
+					}
 				}
 			}
 
 			servicePortConfig[key] = servicePort{
 				Listener: endpoint{Address: bind, Port: int(port.Port), Protocol: string(port.Protocol)},
 				Cluster:  backends,
+				Weights:  backendWeights,
 			}
 		}
 	}
 	lbConfig.ServicePorts = servicePortConfig
+	lbConfig.Weighted = weights != nil
 
 	for _, sr := range service.Spec.LoadBalancerSourceRanges {
 		// This is validated (though the validation mistakenly allows whitespace)
@@ -275,95 +697,161 @@ func generateConfig(service *v1.Service, nodes []*v1.Node) *proxyConfigData {
 	return lbConfig
 }
 
+// IsProtocolSupported returns true if the protocol can be proxied by envoy.
+// Envoy does not implement SCTP proxying.
+func IsProtocolSupported(protocol v1.Protocol) bool {
+	return protocol == v1.ProtocolTCP || protocol == v1.ProtocolUDP
+}
+
+// envoyDuration returns the duration in the envoy format, in seconds with up to millisecond precision
+func envoyDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Truncate(time.Millisecond).Seconds(), 'f', -1, 64) + "s"
+}
+
 // TODO: move to xDS via GRPC instead of having to deal with files
-func proxyUpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+func proxyUpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node, slices []*discoveryv1.EndpointSlice, override *proxyOverride, certificate *tlsCertificate, resync func(ctx context.Context)) error {
 	if service == nil {
 		return nil
 	}
 	var stdout, stderr bytes.Buffer
 	name := loadBalancerName(clusterName, service)
-	config := generateConfig(service, nodes)
+	config := generateConfig(service, endpointNodes(service, nodes, slices))
+	setPodBackends(config, service, slices)
+	setTLS(config, service, certificate)
+	config.Override = override
+	backends.drain(clusterName, name, config, time.Now(), resync)
 	// create loadbalancer config data
-	ldsConfig, err := proxyConfig(proxyLDSConfigTemplate, config)
+	ldsConfig, err := renderedConfigs.render(name, proxyConfigPathLDS, proxyLDSConfigTemplate, config)
 	if err != nil {
 		return errors.Wrap(err, "failed to generate loadbalancer config data")
 	}
 
-	klog.V(2).Infof("updating loadbalancer with config %s", ldsConfig)
-	err = container.Exec(name, []string{"cp", "/dev/stdin", proxyConfigPathLDS + ".tmp"}, strings.NewReader(ldsConfig), &stdout, &stderr)
-	if err != nil {
-		return err
-	}
-
-	cdsConfig, err := proxyConfig(proxyCDSConfigTemplate, config)
+	cdsConfig, err := renderedConfigs.render(name, proxyConfigPathCDS, proxyCDSConfigTemplate, config)
 	if err != nil {
 		return errors.Wrap(err, "failed to generate loadbalancer config data")
 	}
 
-	klog.V(2).Infof("updating loadbalancer with config %s", cdsConfig)
-	err = container.Exec(name, []string{"cp", "/dev/stdin", proxyConfigPathCDS + ".tmp"}, strings.NewReader(cdsConfig), &stdout, &stderr)
-	if err != nil {
-		return err
+	// only rewrite the files that changed, so a change on the endpoints of one
+	// protocol does not cause envoy to reload the listeners of the other ones.
+	moves := []string{}
+	for _, f := range []struct {
+		path   string
+		config string
+	}{
+		{path: proxyConfigPathLDS, config: ldsConfig},
+		{path: proxyConfigPathCDS, config: cdsConfig},
+	} {
+		if currentProxyConfig(ctx, name, f.path) == f.config {
+			klog.V(2).Infof("loadbalancer config %s is up to date", f.path)
+			continue
+		}
+		klog.V(2).Infof("updating loadbalancer with config %s", redactPrivateKey(f.config, certificate))
+		err = container.Exec(ctx, name, []string{"cp", "/dev/stdin", f.path + ".tmp"}, strings.NewReader(f.config), &stdout, &stderr)
+		if err != nil {
+			return err
+		}
+		moves = append(moves, fmt.Sprintf("mv %s %s", f.path+".tmp", f.path))
 	}
-	// envoy has an initialization process until starts to forward traffic
-	// https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/operations/init#arch-overview-initialization
-	// also wait for the healthchecks and "no_traffic_interval"
-	cmd := fmt.Sprintf(`chmod a+rw /home/envoy/* && mv %s %s && mv %s %s`, proxyConfigPathCDS+".tmp", proxyConfigPathCDS, proxyConfigPathLDS+".tmp", proxyConfigPathLDS)
-	err = container.Exec(name, []string{"bash", "-c", cmd}, nil, &stdout, &stderr)
-	if err != nil {
-		return fmt.Errorf("error updating configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+
+	if len(moves) > 0 {
+		// envoy has an initialization process until starts to forward traffic
+		// https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/operations/init#arch-overview-initialization
+		// also wait for the healthchecks and "no_traffic_interval"
+		// CDS has to be moved before LDS so the listeners find their clusters.
+		cmd := "chmod a+rw /home/envoy/*"
+		for i := len(moves) - 1; i >= 0; i-- {
+			cmd += " && " + moves[i]
+		}
+		err = container.Exec(ctx, name, []string{"bash", "-c", cmd}, nil, &stdout, &stderr)
+		if err != nil {
+			return fmt.Errorf("error updating configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+		}
 	}
 	return waitLoadBalancerReady(ctx, name, 30*time.Second)
 }
 
-func waitLoadBalancerReady(ctx context.Context, name string, timeout time.Duration) error {
-	portmaps, err := container.PortMaps(name)
+// currentProxyConfig returns the content of the config file in the loadbalancer
+// container, or an empty string if it can not be read.
+func currentProxyConfig(ctx context.Context, name string, path string) string {
+	var stdout bytes.Buffer
+	err := container.Exec(ctx, name, []string{"cat", path}, nil, &stdout, io.Discard)
 	if err != nil {
-		return err
+		return ""
 	}
+	return stdout.String()
+}
 
-	var authority string
+// adminAuthority returns the host:port to reach the envoy admin interface of the loadbalancer
+func adminAuthority(ctx context.Context, name string) (string, error) {
 	if config.DefaultConfig.ControlPlaneConnectivity == config.Direct {
-		ipv4, _, err := container.IPs(name)
+		ipv4, ipv6, err := container.IPs(ctx, name)
 		if err != nil {
-			return err
+			return "", err
+		}
+		// IPv6 only networks does not have IPv4 addresses
+		address := ipv4
+		if address == "" {
+			address = ipv6
 		}
-		authority = net.JoinHostPort(ipv4, strconv.Itoa(envoyAdminPort))
-	} else {
-		port, ok := portmaps[strconv.Itoa(envoyAdminPort)]
-		if !ok {
-			return fmt.Errorf("envoy admin port %d not found, got %v", envoyAdminPort, portmaps)
+		if address == "" {
+			return "", fmt.Errorf("loadbalancer %s does not have IP addresses", name)
 		}
-		authority = net.JoinHostPort("127.0.0.1", port)
+		return net.JoinHostPort(address, strconv.Itoa(envoyAdminPort)), nil
 	}
 
-	httpClient := http.DefaultClient
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
-		// iptables port forwarding on localhost only works for IPv4
-		resp, err := httpClient.Get(fmt.Sprintf("http://%s/ready", authority))
-		if err != nil {
-			klog.V(2).Infof("unexpected error trying to get load balancer %s readiness :%v", name, err)
-			return false, nil
-		}
-		defer resp.Body.Close()
+	portmaps, err := container.PortMaps(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	port, ok := portmaps[strconv.Itoa(envoyAdminPort)]
+	if !ok {
+		return "", fmt.Errorf("envoy admin port %d not found, got %v", envoyAdminPort, portmaps)
+	}
+	return net.JoinHostPort(container.PublishedHost(), port), nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			klog.V(2).Infof("unexpected status code from load balancer %s expected LIVE got %d", name, resp.StatusCode)
-			return false, nil
-		}
+// DrainLoadBalancer stops the loadbalancer container from accepting new connections,
+// the existing connections are not closed.
+func DrainLoadBalancer(ctx context.Context, name string) error {
+	authority, err := adminAuthority(ctx, name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/drain_listeners", authority), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := adminClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.ReadAll(resp.Body) // nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code draining loadbalancer %s: %d", name, resp.StatusCode)
+	}
+	return nil
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			klog.V(2).Infof("unexpected error trying to get load balancer %s readiness :%v", name, err)
-			return false, nil
-		}
+// waitLoadBalancerReady waits until the loadbalancer forwards the traffic, it returns
+// ErrNotReady if it is not ready in time.
+func waitLoadBalancerReady(ctx context.Context, name string, timeout time.Duration) error {
+	authority, err := adminAuthority(ctx, name)
+	if err != nil {
+		return err
+	}
 
-		response := strings.TrimSpace(string(body))
-		if response != "LIVE" {
-			klog.V(2).Infof("unexpected ready response from load balancer %s expected LIVE got %s", name, response)
+	var reason error
+	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
+		// iptables port forwarding on localhost only works for IPv4
+		if reason = proxyReadiness(ctx, authority); reason != nil {
+			klog.V(2).Infof("load balancer %s is not ready: %v", name, reason)
 			return false, nil
 		}
 		return true, nil
 	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w after %v: %v", ErrNotReady, timeout, reason)
+	}
 	return err
 }
@@ -3,6 +3,7 @@ package loadbalancer
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/lithammer/dedent"
@@ -10,6 +11,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
 )
 
 func makeNode(name string, ip string) *v1.Node {
@@ -76,7 +80,10 @@ func Test_generateConfig(t *testing.T) {
 				makeNode("b", "10.0.0.2"),
 			},
 			want: &proxyConfigData{
-				HealthCheckPort: 32000,
+				HealthCheckPort:               32000,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Local",
 				ServicePorts: map[string]servicePort{
 					"IPv4_80_TCP": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -117,7 +124,10 @@ func Test_generateConfig(t *testing.T) {
 				makeNode("b", "10.0.0.2"),
 			},
 			want: &proxyConfigData{
-				HealthCheckPort: 32000,
+				HealthCheckPort:               32000,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Local",
 				ServicePorts: map[string]servicePort{
 					"IPv4_80_TCP": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -162,7 +172,10 @@ func Test_generateConfig(t *testing.T) {
 				makeNode("b", "10.0.0.2"),
 			},
 			want: &proxyConfigData{
-				HealthCheckPort: 32000,
+				HealthCheckPort:               32000,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Local",
 				ServicePorts: map[string]servicePort{
 					"IPv4_80_TCP": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -207,7 +220,10 @@ func Test_generateConfig(t *testing.T) {
 				makeNode("b", "2001:db2::4"),
 			},
 			want: &proxyConfigData{
-				HealthCheckPort: 32000,
+				HealthCheckPort:               32000,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Local",
 				ServicePorts: map[string]servicePort{
 					"IPv6_80_TCP": servicePort{
 						Listener: endpoint{Address: `"::"`, Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -241,7 +257,6 @@ func Test_generateConfig(t *testing.T) {
 					SessionAffinity: v1.ServiceAffinityClientIP,
 					SessionAffinityConfig: &v1.SessionAffinityConfig{
 						ClientIP: &v1.ClientIPConfig{
-							// FIXME: This is currently ignored
 							TimeoutSeconds: ptr.To[int32](60),
 						},
 					},
@@ -251,14 +266,17 @@ func Test_generateConfig(t *testing.T) {
 				makeNode("a", "10.0.0.1"),
 			},
 			want: &proxyConfigData{
-				HealthCheckPort: 10256,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Cluster",
 				ServicePorts: map[string]servicePort{
 					"IPv4_80_TCP": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
 						Cluster:  []endpoint{{"10.0.0.1", 30000, string(v1.ProtocolTCP)}},
 					},
 				},
-				SessionAffinity: "ClientIP",
+				SessionAffinity:        "ClientIP",
+				SessionAffinityTimeout: 60,
 			},
 		},
 		{
@@ -290,7 +308,9 @@ func Test_generateConfig(t *testing.T) {
 				makeNode("a", "10.0.0.1"),
 			},
 			want: &proxyConfigData{
-				HealthCheckPort: 10256,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Cluster",
 				ServicePorts: map[string]servicePort{
 					"IPv4_80_TCP": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -298,8 +318,170 @@ func Test_generateConfig(t *testing.T) {
 					},
 				},
 				SourceRanges: []sourceRange{
-					{ Prefix: "10.0.0.0", Length: 8},
-					{ Prefix: "192.168.0.0", Length: 16},
+					{Prefix: "10.0.0.0", Length: 8},
+					{Prefix: "192.168.0.0", Length: 16},
+				},
+			},
+		},
+		{
+			name: "proxy protocol",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Annotations: map[string]string{
+						constants.ProxyProtocolAnnotationKey: "v2",
+					},
+				},
+				Spec: v1.ServiceSpec{
+					Type:                  v1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyCluster,
+					IPFamilies:            []v1.IPFamily{v1.IPv4Protocol},
+					Ports: []v1.ServicePort{
+						{
+							Port:       80,
+							TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+							NodePort:   30000,
+							Protocol:   v1.ProtocolTCP,
+						},
+					},
+				},
+			},
+			nodes: []*v1.Node{
+				makeNode("a", "10.0.0.1"),
+			},
+			want: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Cluster",
+				ServicePorts: map[string]servicePort{
+					"IPv4_80_TCP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"10.0.0.1", 30000, string(v1.ProtocolTCP)}},
+					},
+				},
+				ProxyProtocol: "V2",
+			},
+		},
+		{
+			name: "http health check",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Annotations: map[string]string{
+						constants.HealthCheckProtocolAnnotationKey:       "http",
+						constants.HealthCheckPathAnnotationKey:           "/ready",
+						constants.HealthCheckExpectedStatusAnnotationKey: "200,300-399",
+					},
+				},
+				Spec: v1.ServiceSpec{
+					Type:                  v1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyCluster,
+					IPFamilies:            []v1.IPFamily{v1.IPv4Protocol},
+					Ports: []v1.ServicePort{
+						{
+							Port:       80,
+							TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+							NodePort:   30000,
+							Protocol:   v1.ProtocolTCP,
+						},
+					},
+				},
+			},
+			nodes: []*v1.Node{
+				makeNode("a", "10.0.0.1"),
+			},
+			want: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Cluster",
+				ServicePorts: map[string]servicePort{
+					"IPv4_80_TCP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"10.0.0.1", 30000, string(v1.ProtocolTCP)}},
+					},
+				},
+				HealthCheckProtocol:         "HTTP",
+				HealthCheckPath:             "/ready",
+				HealthCheckExpectedStatuses: []statusRange{{Start: 200, End: 201}, {Start: 300, End: 400}},
+			},
+		},
+		{
+			name: "idle timeout and tcp keepalive",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Annotations: map[string]string{
+						constants.IdleTimeoutAnnotationKey:  "2h",
+						constants.TCPKeepaliveAnnotationKey: "30s",
+					},
+				},
+				Spec: v1.ServiceSpec{
+					Type:                  v1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyCluster,
+					IPFamilies:            []v1.IPFamily{v1.IPv4Protocol},
+					Ports: []v1.ServicePort{
+						{
+							Port:       80,
+							TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+							NodePort:   30000,
+							Protocol:   v1.ProtocolTCP,
+						},
+					},
+				},
+			},
+			nodes: []*v1.Node{
+				makeNode("a", "10.0.0.1"),
+			},
+			want: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Cluster",
+				ServicePorts: map[string]servicePort{
+					"IPv4_80_TCP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"10.0.0.1", 30000, string(v1.ProtocolTCP)}},
+					},
+				},
+				IdleTimeout:  "7200s",
+				TCPKeepalive: 30,
+			},
+		},
+		{
+			name: "invalid idle timeout and tcp keepalive",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Annotations: map[string]string{
+						constants.IdleTimeoutAnnotationKey:  "forever",
+						constants.TCPKeepaliveAnnotationKey: "0s",
+					},
+				},
+				Spec: v1.ServiceSpec{
+					Type:                  v1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyCluster,
+					IPFamilies:            []v1.IPFamily{v1.IPv4Protocol},
+					Ports: []v1.ServicePort{
+						{
+							Port:       80,
+							TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
+							NodePort:   30000,
+							Protocol:   v1.ProtocolTCP,
+						},
+					},
+				},
+			},
+			nodes: []*v1.Node{
+				makeNode("a", "10.0.0.1"),
+			},
+			want: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				TrafficPolicy:                 "Cluster",
+				ServicePorts: map[string]servicePort{
+					"IPv4_80_TCP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"10.0.0.1", 30000, string(v1.ProtocolTCP)}},
+					},
 				},
 			},
 		},
@@ -314,6 +496,73 @@ func Test_generateConfig(t *testing.T) {
 	}
 }
 
+func Test_generateConfigHealthCheckInterval(t *testing.T) {
+	old := config.DefaultConfig.LoadBalancerHealthCheckInterval
+	defer func() { config.DefaultConfig.LoadBalancerHealthCheckInterval = old }()
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{interval: 0, want: "3s"},
+		{interval: 500 * time.Millisecond, want: "3s"},
+		{interval: 1500 * time.Millisecond, want: "1.5s"},
+		{interval: 10 * time.Second, want: "10s"},
+	}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Type:       v1.ServiceTypeLoadBalancer,
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			Ports:      []v1.ServicePort{{Port: 80, NodePort: 30000, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	for _, tt := range tests {
+		config.DefaultConfig.LoadBalancerHealthCheckInterval = tt.interval
+		if got := generateConfig(service, []*v1.Node{makeNode("a", "10.0.0.1")}).HealthCheckInterval; got != tt.want {
+			t.Errorf("generateConfig() with interval %v health check interval %q, want %q", tt.interval, got, tt.want)
+		}
+	}
+}
+
+func Test_generateConfigTrafficPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     v1.ServiceExternalTrafficPolicy
+		value      string
+		wantPolicy string
+		wantPort   int
+	}{
+		{name: "cluster", policy: v1.ServiceExternalTrafficPolicyTypeCluster, wantPolicy: "Cluster", wantPort: 0},
+		{name: "local", policy: v1.ServiceExternalTrafficPolicyTypeLocal, wantPolicy: "Local", wantPort: 32000},
+		{name: "forced cluster", policy: v1.ServiceExternalTrafficPolicyTypeLocal, value: "cluster", wantPolicy: "Cluster", wantPort: 0},
+		{name: "forced local", policy: v1.ServiceExternalTrafficPolicyTypeCluster, value: "Local", wantPolicy: "Local", wantPort: 0},
+		{name: "invalid", policy: v1.ServiceExternalTrafficPolicyTypeLocal, value: "Node", wantPolicy: "Local", wantPort: 32000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Annotations: map[string]string{}},
+				Spec: v1.ServiceSpec{
+					Type:                  v1.ServiceTypeLoadBalancer,
+					ExternalTrafficPolicy: tt.policy,
+					IPFamilies:            []v1.IPFamily{v1.IPv4Protocol},
+					Ports:                 []v1.ServicePort{{Port: 80, NodePort: 30000, Protocol: v1.ProtocolTCP}},
+				},
+			}
+			if tt.policy == v1.ServiceExternalTrafficPolicyTypeLocal {
+				service.Spec.HealthCheckNodePort = 32000
+			}
+			if tt.value != "" {
+				service.Annotations[constants.TrafficPolicyAnnotationKey] = tt.value
+			}
+			got := generateConfig(service, []*v1.Node{makeNode("a", "10.0.0.1")})
+			if got.TrafficPolicy != tt.wantPolicy || got.HealthCheckPort != tt.wantPort {
+				t.Errorf("generateConfig() traffic policy %s health check port %d, want %s and %d", got.TrafficPolicy, got.HealthCheckPort, tt.wantPolicy, tt.wantPort)
+			}
+		})
+	}
+}
+
 func Test_proxyConfig(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -325,7 +574,9 @@ func Test_proxyConfig(t *testing.T) {
 			name:     "ipv4 CDS",
 			template: proxyCDSConfigTemplate,
 			data: &proxyConfigData{
-				HealthCheckPort: 32764,
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
 				ServicePorts: map[string]servicePort{
 					"IPv4_80": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -419,7 +670,9 @@ func Test_proxyConfig(t *testing.T) {
 			name:     "ipv4 LDS",
 			template: proxyLDSConfigTemplate,
 			data: &proxyConfigData{
-				HealthCheckPort: 32764,
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
 				ServicePorts: map[string]servicePort{
 					"IPv4_80": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -449,6 +702,9 @@ func Test_proxyConfig(t *testing.T) {
 				        - name: envoy.file_access_log
 				          typed_config:
 				            "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				            log_format:
+				              text_format_source:
+				                inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms flags=%RESPONSE_FLAGS%\n"
 				        stat_prefix: tcp_proxy
 				        cluster: cluster_IPv4_443
 				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
@@ -467,15 +723,277 @@ func Test_proxyConfig(t *testing.T) {
 				        - name: envoy.file_access_log
 				          typed_config:
 				            "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				            log_format:
+				              text_format_source:
+				                inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms flags=%RESPONSE_FLAGS%\n"
 				        stat_prefix: tcp_proxy
 				        cluster: cluster_IPv4_80
 			`,
 		},
+		{
+			name:     "ipv4 LDS UDP",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				ServicePorts: map[string]servicePort{
+					"IPv4_53_UDP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 53, Protocol: string(v1.ProtocolUDP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30053, string(v1.ProtocolUDP)}},
+					},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_53_UDP
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 53
+				      protocol: UDP
+				  udp_listener_config:
+				    downstream_socket_config:
+				      max_rx_datagram_size: 9000
+				  listener_filters:
+				  - name: envoy.filters.udp_listener.udp_proxy
+				    typed_config:
+				      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+				      access_log:
+				      - name: envoy.file_access_log
+				        typed_config:
+				          "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				          log_format:
+				            text_format_source:
+				              inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms\n"
+				      stat_prefix: udp_proxy
+				      matcher:
+				        on_no_match:
+				          action:
+				            name: route
+				            typed_config:
+				              '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
+				              cluster: cluster_IPv4_53_UDP
+				      upstream_socket_config:
+				        max_rx_datagram_size: 9000
+			`,
+		},
+		{
+			name:     "ipv4 LDS UDP with access log file",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				AccessLogPath:                 "/var/log/cloud-provider-kind/access.log",
+				ServicePorts: map[string]servicePort{
+					"IPv4_53_UDP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 53, Protocol: string(v1.ProtocolUDP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30053, string(v1.ProtocolUDP)}},
+					},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_53_UDP
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 53
+				      protocol: UDP
+				  udp_listener_config:
+				    downstream_socket_config:
+				      max_rx_datagram_size: 9000
+				  listener_filters:
+				  - name: envoy.filters.udp_listener.udp_proxy
+				    typed_config:
+				      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+				      access_log:
+				      - name: envoy.file_access_log
+				        typed_config:
+				          "@type": type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog
+				          path: /var/log/cloud-provider-kind/access.log
+				          log_format:
+				            text_format_source:
+				              inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms\n"
+				      stat_prefix: udp_proxy
+				      matcher:
+				        on_no_match:
+				          action:
+				            name: route
+				            typed_config:
+				              '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
+				              cluster: cluster_IPv4_53_UDP
+				      upstream_socket_config:
+				        max_rx_datagram_size: 9000
+			`,
+		},
+		{
+			name:     "ipv4 LDS UDP without access log",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				AccessLogDisabled:             true,
+				ServicePorts: map[string]servicePort{
+					"IPv4_53_UDP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 53, Protocol: string(v1.ProtocolUDP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30053, string(v1.ProtocolUDP)}},
+					},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_53_UDP
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 53
+				      protocol: UDP
+				  udp_listener_config:
+				    downstream_socket_config:
+				      max_rx_datagram_size: 9000
+				  listener_filters:
+				  - name: envoy.filters.udp_listener.udp_proxy
+				    typed_config:
+				      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+				      stat_prefix: udp_proxy
+				      matcher:
+				        on_no_match:
+				          action:
+				            name: route
+				            typed_config:
+				              '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
+				              cluster: cluster_IPv4_53_UDP
+				      upstream_socket_config:
+				        max_rx_datagram_size: 9000
+			`,
+		},
+		{
+			name:     "ipv4 LDS UDP with affinity",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				ServicePorts: map[string]servicePort{
+					"IPv4_53_UDP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 53, Protocol: string(v1.ProtocolUDP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30053, string(v1.ProtocolUDP)}},
+					},
+				},
+				SessionAffinity:        "ClientIP",
+				SessionAffinityTimeout: 60,
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_53_UDP
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 53
+				      protocol: UDP
+				  udp_listener_config:
+				    downstream_socket_config:
+				      max_rx_datagram_size: 9000
+				  listener_filters:
+				  - name: envoy.filters.udp_listener.udp_proxy
+				    typed_config:
+				      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+				      access_log:
+				      - name: envoy.file_access_log
+				        typed_config:
+				          "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				          log_format:
+				            text_format_source:
+				              inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms\n"
+				      stat_prefix: udp_proxy
+				      matcher:
+				        on_no_match:
+				          action:
+				            name: route
+				            typed_config:
+				              '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
+				              cluster: cluster_IPv4_53_UDP
+				      hash_policies:
+				        source_ip: true
+				      idle_timeout: 60s
+				      upstream_socket_config:
+				        max_rx_datagram_size: 9000
+			`,
+		},
+		{
+			name:     "ipv4 LDS UDP with source ranges",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				ServicePorts: map[string]servicePort{
+					"IPv4_53_UDP": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 53, Protocol: string(v1.ProtocolUDP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30053, string(v1.ProtocolUDP)}},
+					},
+				},
+				SourceRanges: []sourceRange{
+					{Prefix: "10.0.0.0", Length: 8},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_53_UDP
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 53
+				      protocol: UDP
+				  udp_listener_config:
+				    downstream_socket_config:
+				      max_rx_datagram_size: 9000
+				  listener_filters:
+				  - name: envoy.filters.udp_listener.udp_proxy
+				    typed_config:
+				      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig
+				      access_log:
+				      - name: envoy.file_access_log
+				        typed_config:
+				          "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				          log_format:
+				            text_format_source:
+				              inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms\n"
+				      stat_prefix: udp_proxy
+				      matcher:
+				        matcher_tree:
+				          input:
+				            name: envoy.matching.inputs.source_ip
+				            typed_config:
+				              '@type': type.googleapis.com/envoy.extensions.matching.common_inputs.network.v3.SourceIPInput
+				          custom_match:
+				            name: source_ranges
+				            typed_config:
+				              '@type': type.googleapis.com/xds.type.matcher.v3.IPMatcher
+				              range_matchers:
+				              - ranges:
+				                - address_prefix: "10.0.0.0"
+				                  prefix_len: 8
+				                on_match:
+				                  action:
+				                    name: route
+				                    typed_config:
+				                      '@type': type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route
+				                      cluster: cluster_IPv4_53_UDP
+				      upstream_socket_config:
+				        max_rx_datagram_size: 9000
+			`,
+		},
 		{
 			name:     "ipv4 CDS with affinity",
 			template: proxyCDSConfigTemplate,
 			data: &proxyConfigData{
-				HealthCheckPort: 32764,
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
 				ServicePorts: map[string]servicePort{
 					"IPv4_80": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -526,36 +1044,513 @@ func Test_proxyConfig(t *testing.T) {
 				`,
 		},
 		{
-			name:     "ipv4 LDS with affinity",
-			template: proxyLDSConfigTemplate,
+			name:     "ipv4 CDS with traffic policy local",
+			template: proxyCDSConfigTemplate,
 			data: &proxyConfigData{
-				HealthCheckPort: 32764,
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
 				ServicePorts: map[string]servicePort{
 					"IPv4_80": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
-						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}, {"192.168.8.3", 30497, string(v1.ProtocolTCP)}},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
 					},
 				},
-				SessionAffinity: "ClientIP",
+				TrafficPolicy: "Local",
 			},
 			wantConfig: `
 				resources:
-				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
-				  name: listener_IPv4_80
-				  address:
-				    socket_address:
-				      address: 0.0.0.0
-				      port_value: 80
-				      protocol: TCP
-				  filter_chains:
-				  - filters:
-				    - name: envoy.filters.network.tcp_proxy
-				      typed_config:
-				        "@type": type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
-				        access_log:
-				        - name: envoy.file_access_log
-				          typed_config:
-				            "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  common_lb_config:
+				    healthy_panic_threshold:
+				      value: 0
+				  health_checks:
+				  - timeout: 5s
+				    interval: 3s
+				    unhealthy_threshold: 2
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    http_health_check:
+				      path: /healthz
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            health_check_config:
+				              port_value: 32764
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 CDS without health check port",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "5s",
+				HealthCheckUnhealthyThreshold: 3,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  health_checks:
+				  - timeout: 5s
+				    interval: 5s
+				    unhealthy_threshold: 3
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    tcp_health_check: {}
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 LDS with idle timeout and tcp keepalive",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+				IdleTimeout:  "7200s",
+				TCPKeepalive: 30,
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_80
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 80
+				      protocol: TCP
+				  socket_options:
+				  # SOL_SOCKET SO_KEEPALIVE
+				  - level: 1
+				    name: 9
+				    int_value: 1
+				  # IPPROTO_TCP TCP_KEEPIDLE
+				  - level: 6
+				    name: 4
+				    int_value: 30
+				  filter_chains:
+				  - filters:
+				    - name: envoy.filters.network.tcp_proxy
+				      typed_config:
+				        "@type": type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+				        access_log:
+				        - name: envoy.file_access_log
+				          typed_config:
+				            "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				            log_format:
+				              text_format_source:
+				                inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms flags=%RESPONSE_FLAGS%\n"
+				        stat_prefix: tcp_proxy
+				        cluster: cluster_IPv4_80
+				        idle_timeout: 7200s
+			`,
+		},
+		{
+			name:     "ipv4 CDS with tcp keepalive",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "5s",
+				HealthCheckUnhealthyThreshold: 3,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+				TCPKeepalive: 30,
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  upstream_connection_options:
+				    tcp_keepalive:
+				      keepalive_time: 30
+				  health_checks:
+				  - timeout: 5s
+				    interval: 5s
+				    unhealthy_threshold: 3
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    tcp_health_check: {}
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 CDS with draining backends",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "5s",
+				HealthCheckUnhealthyThreshold: 3,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+						Draining: []endpoint{{"192.168.8.3", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  health_checks:
+				  - timeout: 5s
+				    interval: 5s
+				    unhealthy_threshold: 3
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    tcp_health_check: {}
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				      - lb_endpoints:
+				        - health_status: DRAINING
+				          endpoint:
+				            address:
+				              socket_address:
+				                address: 192.168.8.3
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 CDS with http health check",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "5s",
+				HealthCheckUnhealthyThreshold: 3,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+				HealthCheckProtocol:         "HTTP",
+				HealthCheckPath:             "/ready",
+				HealthCheckExpectedStatuses: []statusRange{{Start: 200, End: 400}},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  health_checks:
+				  - timeout: 5s
+				    interval: 5s
+				    unhealthy_threshold: 3
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    http_health_check:
+				      path: /ready
+				      expected_statuses:
+				      - start: 200
+				        end: 400
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 CDS with https health check",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckInterval:           "5s",
+				HealthCheckUnhealthyThreshold: 3,
+				ServicePorts: map[string]servicePort{
+					"IPv4_443": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 443, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+				HealthCheckProtocol: "HTTPS",
+				HealthCheckPath:     "/",
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_443
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  transport_socket_matches:
+				  - name: health_check_tls
+				    match:
+				      health_check_tls: true
+				    transport_socket:
+				      name: envoy.transport_sockets.tls
+				      typed_config:
+				        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+				  health_checks:
+				  - timeout: 5s
+				    interval: 5s
+				    unhealthy_threshold: 3
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    transport_socket_match_criteria:
+				      health_check_tls: true
+				    http_health_check:
+				      path: /
+				  load_assignment:
+				    cluster_name: cluster_IPv4_443
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 CDS with proxy protocol",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+				ProxyProtocol: "V2",
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: RANDOM
+				  transport_socket:
+				    name: envoy.transport_sockets.upstream_proxy_protocol
+				    typed_config:
+				      "@type": type.googleapis.com/envoy.extensions.transport_sockets.proxy_protocol.v3.ProxyProtocolUpstreamTransport
+				      config:
+				        version: V2
+				      transport_socket:
+				        name: envoy.transport_sockets.raw_buffer
+				        typed_config:
+				          "@type": type.googleapis.com/envoy.extensions.transport_sockets.raw_buffer.v3.RawBuffer
+				  transport_socket_matches:
+				  - name: health_check
+				    match:
+				      health_check: true
+				    transport_socket:
+				      name: envoy.transport_sockets.raw_buffer
+				      typed_config:
+				        "@type": type.googleapis.com/envoy.extensions.transport_sockets.raw_buffer.v3.RawBuffer
+				  health_checks:
+				  - timeout: 5s
+				    interval: 3s
+				    unhealthy_threshold: 2
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    transport_socket_match_criteria:
+				      health_check: true
+				    http_health_check:
+				      path: /healthz
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            health_check_config:
+				              port_value: 32764
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				`,
+		},
+		{
+			name:     "ipv4 CDS weighted",
+			template: proxyCDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				Weighted:                      true,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}, {"192.168.8.3", 30497, string(v1.ProtocolTCP)}},
+						Weights: map[endpoint]int{
+							{"192.168.8.2", 30497, string(v1.ProtocolTCP)}: 3,
+							{"192.168.8.3", 30497, string(v1.ProtocolTCP)}: 1,
+						},
+					},
+				},
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+				  name: cluster_IPv4_80
+				  connect_timeout: 5s
+				  type: STATIC
+				  lb_policy: ROUND_ROBIN
+				  health_checks:
+				  - timeout: 5s
+				    interval: 3s
+				    unhealthy_threshold: 2
+				    healthy_threshold: 1
+				    no_traffic_interval: 5s
+				    always_log_health_check_failures: true
+				    always_log_health_check_success: true
+				    event_log_path: /dev/stdout
+				    http_health_check:
+				      path: /healthz
+				  load_assignment:
+				    cluster_name: cluster_IPv4_80
+				    endpoints:
+				      - lb_endpoints:
+				        - endpoint:
+				            health_check_config:
+				              port_value: 32764
+				            address:
+				              socket_address:
+				                address: 192.168.8.2
+				                port_value: 30497
+				                protocol: TCP
+				          load_balancing_weight: 3
+				      - lb_endpoints:
+				        - endpoint:
+				            health_check_config:
+				              port_value: 32764
+				            address:
+				              socket_address:
+				                address: 192.168.8.3
+				                port_value: 30497
+				                protocol: TCP
+				          load_balancing_weight: 1
+			`,
+		},
+		{
+			name:     "ipv4 LDS with affinity",
+			template: proxyLDSConfigTemplate,
+			data: &proxyConfigData{
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
+				ServicePorts: map[string]servicePort{
+					"IPv4_80": servicePort{
+						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
+						Cluster:  []endpoint{{"192.168.8.2", 30497, string(v1.ProtocolTCP)}, {"192.168.8.3", 30497, string(v1.ProtocolTCP)}},
+					},
+				},
+				SessionAffinity: "ClientIP",
+			},
+			wantConfig: `
+				resources:
+				- "@type": type.googleapis.com/envoy.config.listener.v3.Listener
+				  name: listener_IPv4_80
+				  address:
+				    socket_address:
+				      address: 0.0.0.0
+				      port_value: 80
+				      protocol: TCP
+				  filter_chains:
+				  - filters:
+				    - name: envoy.filters.network.tcp_proxy
+				      typed_config:
+				        "@type": type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+				        access_log:
+				        - name: envoy.file_access_log
+				          typed_config:
+				            "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				            log_format:
+				              text_format_source:
+				                inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms flags=%RESPONSE_FLAGS%\n"
 				        stat_prefix: tcp_proxy
 				        cluster: cluster_IPv4_80
 				        hash_policy:
@@ -566,7 +1561,9 @@ func Test_proxyConfig(t *testing.T) {
 			name:     "ipv4 LDS with source ranges",
 			template: proxyLDSConfigTemplate,
 			data: &proxyConfigData{
-				HealthCheckPort: 32764,
+				HealthCheckPort:               32764,
+				HealthCheckInterval:           "3s",
+				HealthCheckUnhealthyThreshold: 2,
 				ServicePorts: map[string]servicePort{
 					"IPv4_80": servicePort{
 						Listener: endpoint{Address: "0.0.0.0", Port: 80, Protocol: string(v1.ProtocolTCP)},
@@ -574,8 +1571,8 @@ func Test_proxyConfig(t *testing.T) {
 					},
 				},
 				SourceRanges: []sourceRange{
-					{ Prefix: "10.0.0.0", Length: 8},
-					{ Prefix: "192.168.0.0", Length: 16},
+					{Prefix: "10.0.0.0", Length: 8},
+					{Prefix: "192.168.0.0", Length: 16},
 				},
 			},
 			wantConfig: `
@@ -596,6 +1593,9 @@ func Test_proxyConfig(t *testing.T) {
 				        - name: envoy.file_access_log
 				          typed_config:
 				            "@type": type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+				            log_format:
+				              text_format_source:
+				                inline_string: "[%START_TIME%] %HOSTNAME% %DOWNSTREAM_REMOTE_ADDRESS% -> %UPSTREAM_HOST% %UPSTREAM_CLUSTER% received=%BYTES_RECEIVED% sent=%BYTES_SENT% duration=%DURATION%ms flags=%RESPONSE_FLAGS%\n"
 				        stat_prefix: tcp_proxy
 				        cluster: cluster_IPv4_80
 				    filter_chain_match:
@@ -622,3 +1622,97 @@ func Test_proxyConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseStatusRanges(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []statusRange
+		wantErr bool
+	}{
+		{value: "200", want: []statusRange{{Start: 200, End: 201}}},
+		{value: "200, 300-399", want: []statusRange{{Start: 200, End: 201}, {Start: 300, End: 400}}},
+		{value: "2xx", wantErr: true},
+		{value: "399-300", wantErr: true},
+		{value: "600", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseStatusRanges(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStatusRanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStatusRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// manyPortsService returns a dual stack Service with the number of TCP ports
+func manyPortsService(ports int) *v1.Service {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "many-ports", Namespace: "test"},
+		Spec: v1.ServiceSpec{
+			Type:       v1.ServiceTypeLoadBalancer,
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol},
+		},
+	}
+	for i := 0; i < ports; i++ {
+		service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{
+			Port:     int32(8000 + i),
+			Protocol: v1.ProtocolTCP,
+			NodePort: int32(30000 + i),
+		})
+	}
+	return service
+}
+
+// BenchmarkProxyConfigManyPorts measures the generation of the configuration that
+// EnsureLoadBalancer writes to the loadbalancer of a Service with 50 ports.
+func BenchmarkProxyConfigManyPorts(b *testing.B) {
+	service := manyPortsService(50)
+	nodes := []*v1.Node{makeNode("a", "10.0.0.1"), makeNode("b", "10.0.0.2"), makeNode("c", "10.0.0.3")}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		config := generateConfig(service, nodes)
+		if _, err := proxyConfig(proxyLDSConfigTemplate, config); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := proxyConfig(proxyCDSConfigTemplate, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_generateConfigIdleTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "2h", want: "7200s"},
+		{value: "0", want: "0s"},
+		{value: "1.5s", want: "1.5s"},
+		{value: "250ms", want: "0.25s"},
+		// sub-millisecond values would disable the timeout
+		{value: "500us", want: ""},
+		{value: "-1s", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Annotations: map[string]string{constants.IdleTimeoutAnnotationKey: tt.value},
+				},
+				Spec: v1.ServiceSpec{
+					Type:       v1.ServiceTypeLoadBalancer,
+					IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+					Ports:      []v1.ServicePort{{Port: 80, NodePort: 30000, Protocol: v1.ProtocolTCP}},
+				},
+			}
+			if got := generateConfig(service, []*v1.Node{makeNode("a", "10.0.0.1")}).IdleTimeout; got != tt.want {
+				t.Errorf("IdleTimeout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
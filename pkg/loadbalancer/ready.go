@@ -0,0 +1,99 @@
+package loadbalancer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// ErrNotReady is returned when the loadbalancer is not serving the Service yet, its status
+// is not reported so the clients do not use the address before the proxy forwards the traffic.
+var ErrNotReady = errors.New("loadbalancer is not ready")
+
+// imagePulling is true while the loadbalancer image is pulled in advance
+var imagePulling atomic.Bool
+
+// imagePending returns true if the loadbalancer image is still being pulled in advance,
+// the loadbalancers are not created until it is present so they do not pull it again.
+func imagePending(ctx context.Context, image string) bool {
+	return imagePulling.Load() && !container.ImageExists(ctx, image)
+}
+
+// listenersWarmingStat is the number of envoy listeners that are not serving yet,
+// per example because their clusters are still initializing
+const listenersWarmingStat = "listener_manager.total_listeners_warming"
+
+// proxyReadiness returns nil if the envoy admin interface reports that the server is live
+// and all its listeners are serving, or the reason why it is not ready.
+func proxyReadiness(ctx context.Context, authority string) error {
+	body, err := adminGet(ctx, fmt.Sprintf("http://%s/ready", authority))
+	if err != nil {
+		return err
+	}
+	if response := strings.TrimSpace(body); response != "LIVE" {
+		return fmt.Errorf("expected LIVE got %s", response)
+	}
+	body, err = adminGet(ctx, fmt.Sprintf("http://%s/stats?filter=%s", authority, url.QueryEscape("^"+strings.ReplaceAll(listenersWarmingStat, ".", `\.`)+"$")))
+	if err != nil {
+		return err
+	}
+	warming, err := parseStat(body, listenersWarmingStat)
+	if err != nil {
+		return err
+	}
+	if warming > 0 {
+		return fmt.Errorf("%d listeners are warming", warming)
+	}
+	return nil
+}
+
+// adminClient is the client of the envoy admin interface, its requests time out so an unresponsive
+// loadbalancer does not block the controllers or the shutdown
+var adminClient = &http.Client{Timeout: 5 * time.Second}
+
+// adminGet returns the body of the envoy admin endpoint
+func adminGet(ctx context.Context, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := adminClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, req.URL.Path)
+	}
+	return string(body), nil
+}
+
+// parseStat returns the value of the stat in the envoy text stats format, name: value
+func parseStat(body string, name string) (int, error) {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(key) != name {
+			continue
+		}
+		return strconv.Atoi(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("stat %s not found", name)
+}
@@ -0,0 +1,89 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{name: "zero", body: "listener_manager.total_listeners_warming: 0\n", want: 0},
+		{name: "warming", body: "listener_manager.total_listeners_active: 1\nlistener_manager.total_listeners_warming: 2\n", want: 2},
+		{name: "missing", body: "listener_manager.total_listeners_active: 1\n", wantErr: true},
+		{name: "invalid", body: "listener_manager.total_listeners_warming: no\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStat(tt.body, listenersWarmingStat)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseStat() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_proxyReadiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		ready   string
+		warming string
+		wantErr bool
+	}{
+		{name: "ready", ready: "LIVE", warming: "0"},
+		{name: "initializing", ready: "PRE_INITIALIZING", warming: "0", wantErr: true},
+		{name: "listeners warming", ready: "LIVE", warming: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/ready":
+					w.Write([]byte(tt.ready + "\n")) // nolint:errcheck
+				case "/stats":
+					if !strings.Contains(r.URL.Query().Get("filter"), "total_listeners_warming") {
+						http.Error(w, "unexpected filter", http.StatusBadRequest)
+						return
+					}
+					w.Write([]byte(listenersWarmingStat + ": " + tt.warming + "\n")) // nolint:errcheck
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			err := proxyReadiness(context.Background(), strings.TrimPrefix(server.URL, "http://"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("proxyReadiness() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_adminGetTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	oldClient := adminClient
+	defer func() { adminClient = oldClient }()
+	adminClient = &http.Client{Timeout: 50 * time.Millisecond}
+
+	// the shutdown drains the loadbalancers without a deadline
+	if _, err := adminGet(context.Background(), server.URL+"/ready"); err == nil {
+		t.Errorf("expected the request to an unresponsive admin interface to time out")
+	}
+}
@@ -0,0 +1,151 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// renderedConfigs keeps the configuration rendered for each Service port of the loadbalancers
+var renderedConfigs = newRenderCache()
+
+// renderCache keeps the listeners and clusters rendered for each Service port of the loadbalancers,
+// so an update only renders the Service ports whose configuration changed, per example the port
+// added to the Service, instead of all the listeners and clusters of a Service with many ports.
+type renderCache struct {
+	mu sync.Mutex
+	// first key is the loadbalancer and the config file, second key is the Service port
+	entries map[string]map[string]renderedPort
+	// configs are the last configurations rendered, the key is the loadbalancer and the config file
+	configs map[string]string
+}
+
+// renderedPort is the configuration rendered for a Service port and the data it was rendered with
+type renderedPort struct {
+	fingerprint string
+	config      string
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{entries: map[string]map[string]renderedPort{}, configs: map[string]string{}}
+}
+
+// render returns the same configuration as proxyConfig for the config file of the loadbalancer,
+// the Service ports rendered with the same data in the previous update are reused.
+func (c *renderCache) render(name string, path string, configTemplate string, data *proxyConfigData) (string, error) {
+	config, err := c.renderPorts(name, path, configTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.configs[name+"/"+path] = config
+	return config, nil
+}
+
+// renderPorts renders the configuration reusing the Service ports rendered with the same data
+func (c *renderCache) renderPorts(name string, path string, configTemplate string, data *proxyConfigData) (string, error) {
+	if data == nil || len(data.ServicePorts) == 0 {
+		return proxyConfig(configTemplate, data)
+	}
+	t, err := parseProxyTemplate(configTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse config template")
+	}
+	// the template ranges over the Service ports in key order, the text before the first
+	// port is the one rendered without ports
+	portData := *data
+	portData.Override = nil
+	portData.ServicePorts = nil
+	var header bytes.Buffer
+	if err := t.Execute(&header, &portData); err != nil {
+		return "", errors.Wrap(err, "error executing config template")
+	}
+
+	key := name + "/" + path
+	c.mu.Lock()
+	previous := c.entries[key]
+	c.mu.Unlock()
+
+	keys := make([]string, 0, len(data.ServicePorts))
+	for k := range data.ServicePorts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// the data shared by all the Service ports is compared once
+	common := configFingerprint(&portData)
+	current := make(map[string]renderedPort, len(keys))
+	var config strings.Builder
+	config.Write(header.Bytes())
+	for _, k := range keys {
+		portData.ServicePorts = map[string]servicePort{k: data.ServicePorts[k]}
+		fingerprint := common + fmt.Sprintf("%+v", data.ServicePorts[k])
+		entry, ok := previous[k]
+		if !ok || entry.fingerprint != fingerprint {
+			var buff bytes.Buffer
+			if err := t.Execute(&buff, &portData); err != nil {
+				return "", errors.Wrap(err, "error executing config template")
+			}
+			rendered, ok := strings.CutPrefix(buff.String(), header.String())
+			if !ok {
+				return "", fmt.Errorf("unexpected configuration rendered for Service port %s", k)
+			}
+			entry = renderedPort{fingerprint: fingerprint, config: rendered}
+		}
+		current[k] = entry
+		config.WriteString(entry.config)
+	}
+
+	c.mu.Lock()
+	c.entries[key] = current
+	c.mu.Unlock()
+
+	if data.Override != nil {
+		return applyProxyOverride(config.String(), data.Override)
+	}
+	return config.String(), nil
+}
+
+// last returns the last configuration rendered for the config file of the loadbalancer,
+// false if it was not rendered since the start
+func (c *renderCache) last(name string, path string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	config, ok := c.configs[name+"/"+path]
+	return config, ok
+}
+
+// configFingerprint returns a text that changes if the data of the config other than the
+// Service ports changes
+func configFingerprint(data *proxyConfigData) string {
+	// the pointers are printed as addresses, the certificate is printed apart
+	copied := *data
+	copied.TLSCertificate = nil
+	copied.ServicePorts = nil
+	fingerprint := fmt.Sprintf("%+v", copied)
+	if data.TLSCertificate != nil {
+		fingerprint += fmt.Sprintf("%+v", *data.TLSCertificate)
+	}
+	return fingerprint
+}
+
+// forget removes the configuration rendered for the loadbalancer
+func (c *renderCache) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, name+"/") {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.configs {
+		if strings.HasPrefix(key, name+"/") {
+			delete(c.configs, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_renderCache(t *testing.T) {
+	nodes := []*v1.Node{makeNode("a", "10.0.0.1"), makeNode("b", "10.0.0.2")}
+	service := manyPortsService(3)
+	service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{Port: 53, Protocol: v1.ProtocolUDP, NodePort: 30053})
+	c := newRenderCache()
+
+	updates := []struct {
+		name   string
+		update func(*v1.Service)
+	}{
+		{name: "first update", update: func(*v1.Service) {}},
+		{name: "no changes", update: func(*v1.Service) {}},
+		{name: "port added", update: func(s *v1.Service) {
+			s.Spec.Ports = append(s.Spec.Ports, v1.ServicePort{Port: 9000, Protocol: v1.ProtocolTCP, NodePort: 31000})
+		}},
+		{name: "port removed", update: func(s *v1.Service) { s.Spec.Ports = s.Spec.Ports[1:] }},
+		{name: "node port changed", update: func(s *v1.Service) { s.Spec.Ports[0].NodePort = 32000 }},
+		{name: "setting of all the ports changed", update: func(s *v1.Service) {
+			s.Annotations = map[string]string{constants.IdleTimeoutAnnotationKey: "30s"}
+		}},
+		{name: "certificate changed", update: func(s *v1.Service) {}},
+	}
+	for i, tt := range updates {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.update(service)
+			config := generateConfig(service, nodes)
+			if i == len(updates)-1 {
+				setTLS(config, service, &tlsCertificate{CertificateChain: "chain", PrivateKey: "key"})
+			}
+			for _, f := range []struct{ path, template string }{
+				{path: proxyConfigPathLDS, template: proxyLDSConfigTemplate},
+				{path: proxyConfigPathCDS, template: proxyCDSConfigTemplate},
+			} {
+				want, err := proxyConfig(f.template, config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := c.render("lb", f.path, f.template, config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("render() %s differs from the full rendering\n%s", f.path, cmp.Diff(want, got))
+				}
+			}
+		})
+	}
+
+	c.forget("lb")
+	if len(c.entries) != 0 {
+		t.Errorf("expected the rendered configuration to be forgotten, got %d entries", len(c.entries))
+	}
+}
+
+// BenchmarkRenderAddPort measures the update of the loadbalancer of a Service with 50 ports
+// when one port is added, only the new port is rendered.
+func BenchmarkRenderAddPort(b *testing.B) {
+	nodes := []*v1.Node{makeNode("a", "10.0.0.1"), makeNode("b", "10.0.0.2"), makeNode("c", "10.0.0.3")}
+	before, after := generateConfig(manyPortsService(50), nodes), generateConfig(manyPortsService(51), nodes)
+	c := newRenderCache()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c.forget("lb")
+		if _, err := c.render("lb", proxyConfigPathLDS, proxyLDSConfigTemplate, before); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if _, err := c.render("lb", proxyConfigPathLDS, proxyLDSConfigTemplate, after); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/netip"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// Repairs of the loadbalancers that diverged from the configuration of their Service
+const (
+	// RepairCreated is a loadbalancer container that was removed and is created again
+	RepairCreated = "create"
+	// RepairStarted is a loadbalancer container that was stopped and is running again
+	RepairStarted = "start"
+	// RepairPorts is a loadbalancer container recreated to publish the Service ports on the host
+	RepairPorts = "ports"
+	// RepairNetwork is a loadbalancer container attached again to a network it was detached from
+	RepairNetwork = "network"
+	// RepairConfig is a loadbalancer whose configuration was modified and is written again
+	RepairConfig = "config"
+)
+
+// RepairLoadBalancer compares the loadbalancer container of the Service with the configuration
+// of the Service and repairs the differences, per example when the container was stopped or
+// detached from its network by hand, and returns the repairs done. Only the loadbalancers
+// updated by this instance are repaired, with the nodes of their last update.
+func (s *Server) RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) ([]string, error) {
+	s.mu.Lock()
+	nodes, ok := s.nodes[loadBalancerSimpleName(clusterName, service)]
+	s.mu.Unlock()
+	if !ok || s.disabled(service) {
+		return nil, nil
+	}
+	name := s.containerName(clusterName, service)
+
+	// the containers that do not run or do not publish the Service ports are recreated
+	repair := ""
+	if _, status, err := container.State(ctx, name); err != nil {
+		if !container.IsNotFound(err) {
+			return nil, err
+		}
+		repair = RepairCreated
+	} else if status != "running" {
+		repair = RepairStarted
+	} else if s.sharedPorts == nil && wantsHostPorts(service) && !hostPortsPublished(ctx, name, service) {
+		repair = RepairPorts
+	}
+	if repair != "" {
+		klog.Infof("loadbalancer %s of Service %s/%s diverged (%s), ensuring it again", name, service.Namespace, service.Name, repair)
+		if _, err := s.EnsureLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+			return nil, err
+		}
+		return []string{repair}, nil
+	}
+
+	repairs := []string{}
+	networks, err := container.Networks(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	attached := map[string]bool{}
+	for _, network := range networks {
+		attached[network] = true
+	}
+	// the addresses of the Service status are the ones of the cluster network
+	primary := clusterNetworks(ctx, clusterName)[0]
+	if !attached[primary] {
+		klog.Infof("loadbalancer %s is not attached to network %s, attaching it", name, primary)
+		if err := reattachNetwork(ctx, primary, name, service); err != nil {
+			return repairs, err
+		}
+		announceAddresses(ctx, name)
+		repairs = append(repairs, RepairNetwork)
+	}
+	for _, network := range additionalNetworks(service, s.sharedPorts != nil) {
+		if attached[network] || network == primary {
+			continue
+		}
+		klog.Infof("loadbalancer %s is not attached to network %s, attaching it", name, network)
+		if err := container.NetworkConnect(ctx, network, name); err != nil {
+			return repairs, err
+		}
+		repairs = append(repairs, RepairNetwork)
+	}
+
+	// the shared loadbalancer has the configuration of each Service in its own files
+	if s.sharedPorts != nil {
+		return repairs, nil
+	}
+	// the configuration is only written again if it is not the one written by the last update,
+	// it is unknown until the first update after a restart
+	modified := false
+	for _, path := range []string{proxyConfigPathLDS, proxyConfigPathCDS} {
+		if config, ok := renderedConfigs.last(name, path); !ok || currentProxyConfig(ctx, name, path) != config {
+			modified = true
+		}
+	}
+	if !modified {
+		return repairs, nil
+	}
+	before := currentProxyConfig(ctx, name, proxyConfigPathLDS) + currentProxyConfig(ctx, name, proxyConfigPathCDS)
+	if err := s.UpdateLoadBalancer(ctx, clusterName, service, nodes); err != nil {
+		return repairs, err
+	}
+	after := currentProxyConfig(ctx, name, proxyConfigPathLDS) + currentProxyConfig(ctx, name, proxyConfigPathCDS)
+	if before != after {
+		repairs = append(repairs, RepairConfig)
+	}
+	return repairs, nil
+}
+
+// reattachNetwork attaches the loadbalancer to the network with the addresses of the Service
+// status, so the Service keeps its addresses, or with new ones if they are in use.
+func reattachNetwork(ctx context.Context, network string, name string, service *v1.Service) error {
+	var ipv4, ipv6 string
+	for _, ip := range statusIPs(service) {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		if addr.Unmap().Is4() && ipv4 == "" {
+			ipv4 = addr.Unmap().String()
+		} else if addr.Is6() && !addr.Is4In6() && ipv6 == "" {
+			ipv6 = addr.String()
+		}
+	}
+	if ipv4 != "" || ipv6 != "" {
+		err := container.NetworkConnectWithIPs(ctx, network, name, ipv4, ipv6)
+		if err == nil {
+			return nil
+		}
+		klog.Infof("loadbalancer %s can not get back the addresses %q %q: %v", name, ipv4, ipv6, err)
+	}
+	return container.NetworkConnect(ctx, network, name)
+}
+
+// RepairLoadBalancer is not supported in dry run mode, there are no loadbalancer containers.
+func (s *dryRunServer) RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) ([]string, error) {
+	return nil, nil
+}
+
+// RepairLoadBalancer is not supported with direct routing, the addresses are programmed on every update.
+func (s *directServer) RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package loadbalancer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+func TestServer_RepairLoadBalancerNotManaged(t *testing.T) {
+	runtime := containertest.New(t, "")
+	t.Cleanup(container.Use(runtime))
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	repairs, err := (&Server{}).RepairLoadBalancer(context.Background(), "kind", service)
+	if err != nil || len(repairs) != 0 {
+		t.Errorf("RepairLoadBalancer() = %v, %v, want no repairs", repairs, err)
+	}
+	if got := runtime.Commands(); len(got) != 0 {
+		t.Errorf("expected no container commands for a loadbalancer not updated by this instance, got %v", got)
+	}
+}
+
+func TestServer_RepairLoadBalancerConfigUpToDate(t *testing.T) {
+	// the container runs attached to its network with the configuration of the last update
+	runtime := containertest.New(t, `case "$*" in
+*State.Status*) echo "0123 running" ;;
+*NetworkSettings.Networks*) echo kind ;;
+exec*cat*) echo config ;;
+esac`)
+	t.Cleanup(container.Use(runtime))
+	t.Setenv("KIND_EXPERIMENTAL_DOCKER_NETWORK", "kind")
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	s := &Server{}
+	s.rememberNodes("kind", service, nil)
+	name := s.containerName("kind", service)
+	for _, path := range []string{proxyConfigPathLDS, proxyConfigPathCDS} {
+		renderedConfigs.configs[name+"/"+path] = "config\n"
+	}
+	defer renderedConfigs.forget(name)
+
+	repairs, err := s.RepairLoadBalancer(context.Background(), "kind", service)
+	if err != nil || len(repairs) != 0 {
+		t.Errorf("RepairLoadBalancer() = %v, %v, want no repairs", repairs, err)
+	}
+	for _, command := range runtime.Commands() {
+		if strings.Contains(command, "/dev/stdin") {
+			t.Errorf("expected the configuration not to be written again, got the command %q", command)
+		}
+	}
+}
+
+func Test_reattachNetwork(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{
+			{IP: "172.18.0.5"}, {IP: "fc00:f853:ccd:e793::5"},
+		}}},
+	}
+	tests := []struct {
+		name    string
+		service *v1.Service
+		fail    string
+		want    []string
+	}{
+		{
+			name:    "keeps the addresses of the status",
+			service: service,
+			want:    []string{"network connect --ip 172.18.0.5 --ip6 fc00:f853:ccd:e793::5 kind lb"},
+		},
+		{
+			name:    "addresses in use",
+			service: service,
+			fail:    "--ip",
+			want:    []string{"network connect --ip 172.18.0.5 --ip6 fc00:f853:ccd:e793::5 kind lb", "network connect kind lb"},
+		},
+		{
+			name:    "no status",
+			service: &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+			want:    []string{"network connect kind lb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := containertest.New(t, containertest.FailOn(tt.fail))
+			t.Cleanup(container.Use(runtime))
+			if err := reattachNetwork(context.Background(), "kind", "lb", tt.service); err != nil {
+				t.Fatalf("reattachNetwork() error = %v", err)
+			}
+			if got := runtime.Commands(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reattachNetwork() commands = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+var (
+	capabilityRegexp = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+	userRegexp       = regexp.MustCompile(`^([a-z_][a-z0-9_-]*|[0-9]+)(:([a-z_][a-z0-9_-]*|[0-9]+))?$`)
+)
+
+// ParseCapabilities parses a comma-separated list of Linux capabilities, with or without the CAP_ prefix
+func ParseCapabilities(value string) ([]string, error) {
+	capabilities := []string{}
+	for _, capability := range strings.Split(value, ",") {
+		capability = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+		if capability == "" {
+			continue
+		}
+		if !capabilityRegexp.MatchString(capability) {
+			return nil, fmt.Errorf("invalid capability %q", capability)
+		}
+		capabilities = append(capabilities, capability)
+	}
+	return capabilities, nil
+}
+
+// ValidateSecurity returns an error if the security options prevent the loadbalancers from working
+// with the configuration: the proxy binds the Service ports, the routes to the Pods are added with
+// the ip command and the addresses are announced with raw sockets.
+func ValidateSecurity(security config.ContainerSecurity) error {
+	for _, capability := range security.DropCapabilities {
+		if capability == "ALL" {
+			continue
+		}
+		if sets.New(requiredCapabilities(nil)...).Has(capability) {
+			return fmt.Errorf("the capability %s can not be dropped, the load balancer needs it with the current options", capability)
+		}
+	}
+	if security.User == "" {
+		return nil
+	}
+	if !userRegexp.MatchString(security.User) {
+		return fmt.Errorf("invalid user %q, it must be user[:group] with names or IDs", security.User)
+	}
+	if config.DefaultConfig.LoadBalancerPodBackends {
+		return fmt.Errorf("the user can not be set with the Pod backends, the routes to the Pods are added as root")
+	}
+	if config.DefaultConfig.LoadBalancerAnnounceAddresses {
+		return fmt.Errorf("the user can not be set when the addresses are announced, arping and ndsend run as root")
+	}
+	return nil
+}
+
+// securityEnabled returns true if any security option is set
+func securityEnabled(security config.ContainerSecurity) bool {
+	return security.ReadOnlyRootFilesystem || security.NoNewPrivileges || len(security.DropCapabilities) > 0 || security.User != ""
+}
+
+// requiredCapabilities returns the capabilities the loadbalancer of the Service needs, the proxy
+// binds the Service ports below 1024 and the routes to the Pods and the announcements need the
+// network administration and the raw sockets.
+func requiredCapabilities(service *v1.Service) []string {
+	capabilities := []string{"NET_BIND_SERVICE"}
+	if config.DefaultConfig.LoadBalancerPodBackends || (service != nil && UsesPodBackends(service)) {
+		capabilities = append(capabilities, "NET_ADMIN")
+	}
+	if config.DefaultConfig.LoadBalancerAnnounceAddresses {
+		capabilities = append(capabilities, "NET_RAW")
+	}
+	return capabilities
+}
+
+// securityArgs returns the container runtime arguments with the security options of the loadbalancer
+// container, it runs privileged unless any of them is set.
+func securityArgs(service *v1.Service) []string {
+	security := config.DefaultConfig.LoadBalancerSecurity
+	if !securityEnabled(security) {
+		// running containers in a container requires privileged
+		// NOTE: we could try to replicate this with --cap-add, and use less
+		// privileges, but this flag also changes some mounts that are necessary
+		// including some ones docker would otherwise do by default.
+		// for now this is what we want. in the future we may revisit this.
+		return []string{"--privileged"}
+	}
+	args := []string{}
+	if security.ReadOnlyRootFilesystem {
+		args = append(args, "--read-only", "--tmpfs", "/tmp:mode=1777")
+	}
+	// the configuration is written on every update, also by other users than the image one
+	if security.ReadOnlyRootFilesystem || security.User != "" {
+		args = append(args, "--tmpfs", fmt.Sprintf("%s:mode=1777", proxyConfigDir))
+	}
+	if security.NoNewPrivileges {
+		args = append(args, "--security-opt=no-new-privileges")
+	}
+	required := requiredCapabilities(service)
+	for _, capability := range security.DropCapabilities {
+		// the Services with Pod backends need the capabilities validated only for the configuration
+		if sets.New(required...).Has(capability) {
+			klog.Warningf("loadbalancer of Service %s/%s needs the capability %s, it is not dropped", service.Namespace, service.Name, capability)
+			continue
+		}
+		args = append(args, "--cap-drop="+capability)
+	}
+	for _, capability := range required {
+		args = append(args, "--cap-add="+capability)
+	}
+	if security.User != "" {
+		if service != nil && UsesPodBackends(service) {
+			klog.Warningf("loadbalancer of Service %s/%s runs as user %s, the routes to its Pods can not be added", service.Namespace, service.Name, security.User)
+		}
+		// the capabilities are not effective for other users than root, the ports are bound without them
+		args = append(args, "--user", security.User, "--sysctl=net.ipv4.ip_unprivileged_port_start=0")
+	}
+	return args
+}
@@ -0,0 +1,111 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	got, err := ParseCapabilities("all, cap_net_raw,SYS_ADMIN,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ALL", "NET_RAW", "SYS_ADMIN"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCapabilities() = %v, want %v", got, want)
+	}
+	if _, err := ParseCapabilities("NET-RAW"); err == nil {
+		t.Errorf("expected an error for an invalid capability")
+	}
+}
+
+func TestValidateSecurity(t *testing.T) {
+	oldConfig := config.DefaultConfig
+	defer func() { config.DefaultConfig = oldConfig }()
+
+	tests := []struct {
+		name        string
+		security    config.ContainerSecurity
+		podBackends bool
+		announce    bool
+		wantErr     bool
+	}{
+		{name: "none"},
+		{name: "drop all", security: config.ContainerSecurity{DropCapabilities: []string{"ALL"}, ReadOnlyRootFilesystem: true, NoNewPrivileges: true}},
+		{name: "drop the bind capability", security: config.ContainerSecurity{DropCapabilities: []string{"NET_BIND_SERVICE"}}, wantErr: true},
+		{name: "drop the admin capability", security: config.ContainerSecurity{DropCapabilities: []string{"NET_ADMIN"}}},
+		{name: "drop the admin capability with Pod backends", security: config.ContainerSecurity{DropCapabilities: []string{"NET_ADMIN"}}, podBackends: true, wantErr: true},
+		{name: "drop the raw capability with announcements", security: config.ContainerSecurity{DropCapabilities: []string{"NET_RAW"}}, announce: true, wantErr: true},
+		{name: "user and group", security: config.ContainerSecurity{User: "101:101"}},
+		{name: "user name", security: config.ContainerSecurity{User: "envoy"}},
+		{name: "invalid user", security: config.ContainerSecurity{User: "envoy:"}, wantErr: true},
+		{name: "user with Pod backends", security: config.ContainerSecurity{User: "envoy"}, podBackends: true, wantErr: true},
+		{name: "user with announcements", security: config.ContainerSecurity{User: "envoy"}, announce: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.DefaultConfig.LoadBalancerPodBackends = tt.podBackends
+			config.DefaultConfig.LoadBalancerAnnounceAddresses = tt.announce
+			if err := ValidateSecurity(tt.security); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSecurity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_securityArgs(t *testing.T) {
+	oldConfig := config.DefaultConfig
+	defer func() { config.DefaultConfig = oldConfig }()
+	config.DefaultConfig.LoadBalancerPodBackends = false
+	config.DefaultConfig.LoadBalancerAnnounceAddresses = false
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	podBackends := service.DeepCopy()
+	podBackends.Spec.AllocateLoadBalancerNodePorts = ptr.To(false)
+	tests := []struct {
+		name     string
+		security config.ContainerSecurity
+		service  *v1.Service
+		want     []string
+	}{
+		{name: "privileged by default", service: service, want: []string{"--privileged"}},
+		{
+			name:     "hardened",
+			security: config.ContainerSecurity{ReadOnlyRootFilesystem: true, NoNewPrivileges: true, DropCapabilities: []string{"ALL"}},
+			service:  service,
+			want: []string{"--read-only", "--tmpfs", "/tmp:mode=1777", "--tmpfs", "/home/envoy:mode=1777",
+				"--security-opt=no-new-privileges", "--cap-drop=ALL", "--cap-add=NET_BIND_SERVICE"},
+		},
+		{
+			name:     "user",
+			security: config.ContainerSecurity{User: "101"},
+			service:  service,
+			want: []string{"--tmpfs", "/home/envoy:mode=1777", "--cap-add=NET_BIND_SERVICE",
+				"--user", "101", "--sysctl=net.ipv4.ip_unprivileged_port_start=0"},
+		},
+		{
+			name:     "Pod backends keep the admin capability",
+			security: config.ContainerSecurity{DropCapabilities: []string{"NET_ADMIN", "SYS_ADMIN"}},
+			service:  podBackends,
+			want:     []string{"--cap-drop=SYS_ADMIN", "--cap-add=NET_BIND_SERVICE", "--cap-add=NET_ADMIN"},
+		},
+		{
+			name:     "shared loadbalancer",
+			security: config.ContainerSecurity{DropCapabilities: []string{"ALL"}},
+			want:     []string{"--cap-drop=ALL", "--cap-add=NET_BIND_SERVICE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.DefaultConfig.LoadBalancerSecurity = tt.security
+			if got := securityArgs(tt.service); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("securityArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
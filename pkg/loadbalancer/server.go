@@ -6,45 +6,112 @@ import (
 	"encoding/base32"
 	"errors"
 	"fmt"
-	"os"
+	"net/netip"
 	"path"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/cloud-provider-kind/pkg/config"
 	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
 	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
 )
 
 type Server struct {
 	tunnelManager *tunnelManager
+	// sharedPorts is not nil if all the Services of a cluster share the same loadbalancer container
+	sharedPorts *sharedPorts
+	// ipAllocator is not nil if the loadbalancer addresses are allocated from a configured range
+	ipAllocator *ipam.Allocator
+	// configMapGetter gets the ConfigMaps with the proxy config overrides, nil means the overrides are ignored
+	configMapGetter ConfigMapGetter
+	// secretGetter gets the Secrets with the certificates of the Services that terminate TLS
+	secretGetter SecretGetter
+	// endpointSliceLister lists the endpoints of the Services that do not allocate NodePorts
+	endpointSliceLister EndpointSliceLister
+	// ports are the ports used on the addresses of the loadbalancers that are not shared
+	ports *ipam.Ports
+
+	// mu protects nodes and subnetAllocators
+	mu sync.Mutex
+	// nodes are the last nodes each loadbalancer was updated with, the key is the loadbalancer simple name
+	nodes map[string][]*v1.Node
+	// subnetAllocators allocate the addresses of the configured subnets, the key is the subnet
+	subnetAllocators map[netip.Prefix]*ipam.Allocator
 }
 
 var _ cloudprovider.LoadBalancer = &Server{}
 
 func NewServer() cloudprovider.LoadBalancer {
-	s := &Server{}
+	s := &Server{ports: ipam.NewPorts()}
 
 	if config.DefaultConfig.LoadBalancerConnectivity == config.Tunnel {
 		s.tunnelManager = NewTunnelManager()
 	}
+	if config.DefaultConfig.EnableSharedLoadBalancer {
+		s.sharedPorts = newSharedPorts()
+	}
+	if config.DefaultConfig.LoadBalancerIPRange.IsValid() {
+		s.ipAllocator = ipam.New(config.DefaultConfig.LoadBalancerIPRange)
+	}
+	if config.DefaultConfig.DryRun {
+		return &dryRunServer{Server: s}
+	}
+	if config.DefaultConfig.LoadBalancerDirectRouting {
+		return &directServer{Server: s}
+	}
 	return s
 }
 
+// containerName returns the name of the loadbalancer container used by the Service
+func (s *Server) containerName(clusterName string, service *v1.Service) string {
+	if s.sharedPorts != nil {
+		return sharedLoadBalancerName(clusterName)
+	}
+	return loadBalancerName(clusterName, service)
+}
+
 func (s *Server) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
 	// report status
-	name := loadBalancerName(clusterName, service)
-	ipv4, ipv6, err := container.IPs(name)
+	name := s.containerName(clusterName, service)
+	// only a container that does not exist is reported as missing, the service controller
+	// creates the loadbalancer again otherwise when the container runtime fails
+	if s.disabled(service) {
+		if _, _, err := container.State(ctx, name); err != nil {
+			if container.IsNotFound(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return disabledStatus(ctx, name, service), true, nil
+	}
+	ipv4, ipv6, err := container.IPs(ctx, name)
 	if err != nil {
-		if strings.Contains(err.Error(), "failed to get container details") {
+		if container.IsNotFound(err) {
 			return nil, false, nil
 		}
 		return nil, false, err
 	}
+	// the shared container exists while other Services use it
+	if s.sharedPorts != nil {
+		configured, err := sharedServiceConfigured(ctx, name, clusterName, service)
+		if err != nil {
+			return nil, false, err
+		}
+		if !configured {
+			return nil, false, nil
+		}
+	}
 	status := &v1.LoadBalancerStatus{}
 
 	// process Ports
@@ -81,49 +148,167 @@ func (s *Server) GetLoadBalancer(ctx context.Context, clusterName string, servic
 			Ports:  portStatus,
 		})
 	}
+	// report the ports published on the host so they can be reached from there
+	if s.sharedPorts == nil && wantsHostPorts(service) {
+		ingress, err := hostPortsIngress(ctx, name, service)
+		if err != nil {
+			return nil, true, err
+		}
+		status.Ingress = append(status.Ingress, *ingress)
+	}
+	if config.DefaultConfig.LoadBalancerIngressHostname {
+		status.Ingress = ingressHostnames(service, status.Ingress)
+	}
 
 	return status, true, nil
 }
 
+// GetLoadBalancerName returns the name of the container that serves the Service, the same
+// that EnsureLoadBalancer creates.
 func (s *Server) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
-	return loadBalancerName(clusterName, service)
+	return s.containerName(clusterName, service)
 }
 
 func (s *Server) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	name := loadBalancerName(clusterName, service)
-	if !container.IsRunning(name) {
+	name := s.containerName(clusterName, service)
+	if s.disabled(service) {
+		s.rememberNodes(clusterName, service, nodes)
+		return s.disableLoadBalancer(ctx, clusterName, service)
+	}
+	if s.sharedPorts != nil {
+		// fail before touching the container so other Services are not affected
+		if err := s.sharedPorts.claim(name, sharedServiceKey(clusterName, service), service); err != nil {
+			return nil, err
+		}
+	}
+	// keep the address the loadbalancer had assigned if it has to be recreated
+	var previous netip.Addr
+	if s.sharedPorts == nil {
+		previous = previousIP(ctx, name, service)
+	}
+	if !container.IsRunning(ctx, name) {
 		klog.Infof("container %s for loadbalancer is not running", name)
-		if container.Exist(name) {
-			err := container.Delete(name)
+		if s.sharedPorts != nil && container.Exist(ctx, name) {
+			// the shared container has the configuration of other Services, restart it instead of recreating
+			if err := container.Restart(ctx, name); err != nil {
+				return nil, err
+			}
+		} else if container.Exist(ctx, name) {
+			err := container.Delete(ctx, name)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
-	if !container.Exist(name) {
+	requested, err := requestedIP(service)
+	if err != nil {
+		return nil, err
+	}
+	if requested.IsValid() && s.sharedPorts != nil {
+		klog.Infof("requested IP %s for Service %s/%s is ignored, the loadbalancer is shared", requested, service.Namespace, service.Name)
+		requested = netip.Addr{}
+	}
+	// reject the Service before touching the container if other loadbalancer uses its address and ports
+	if s.sharedPorts == nil {
+		addr := requested
+		if !addr.IsValid() {
+			addr = previous
+		}
+		if addr.IsValid() {
+			if err := s.claimPorts(clusterName, service, addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// the address of a container can not be changed, recreate it with the requested address
+	if requested.IsValid() && container.Exist(ctx, name) {
+		ipv4, ipv6, err := container.IPs(ctx, name)
+		if err == nil && ipv4 != requested.String() && ipv6 != requested.String() {
+			klog.Infof("loadbalancer %s address does not match the requested IP %s, recreating it", name, requested)
+			if err := container.Delete(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// the Service was deleted and created again while the loadbalancer was not deleted,
+	// recreate it so its labels identify the current Service
+	if s.sharedPorts == nil && container.Exist(ctx, name) && !ownedBy(ctx, name, service) {
+		klog.Infof("loadbalancer %s belongs to a previous Service %s/%s, recreating it", name, service.Namespace, service.Name)
+		if err := container.Delete(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	// the ports published on the host can not be changed, recreate it to publish the Service ports
+	if wantsHostPorts(service) {
+		if s.sharedPorts != nil {
+			klog.Infof("annotation %s of Service %s/%s is ignored, the loadbalancer is shared", constants.HostPortsAnnotationKey, service.Namespace, service.Name)
+		} else if container.Exist(ctx, name) && !hostPortsPublished(ctx, name, service) {
+			klog.Infof("loadbalancer %s does not publish the Service ports on the host, recreating it", name)
+			if err := container.Delete(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+	} else if s.sharedPorts == nil && container.Exist(ctx, name) && publishesHostPorts(ctx, name) {
+		klog.Infof("loadbalancer %s publishes the Service ports on the host, recreating it", name)
+		if err := container.Delete(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	// the loadbalancers created with another image are replaced keeping their addresses, except
+	// when they publish the Service ports on the host, the new container can not publish them
+	if s.sharedPorts == nil && !wantsHostPorts(service) && container.IsRunning(ctx, name) && outdatedImage(ctx, name) {
+		if imagePending(ctx, Image()) {
+			klog.V(2).Infof("loadbalancer %s is migrated when the image %s is present", name, Image())
+		} else if err := s.migrateLoadBalancer(ctx, name, clusterName, service, nodes); err != nil {
+			return nil, err
+		}
+	}
+	created := false
+	if !container.Exist(ctx, name) {
+		// retry when the image is present instead of blocking while it is pulled
+		image := Image()
+		if imagePending(ctx, image) {
+			return nil, fmt.Errorf("%w: the image %s is still being pulled", ErrNotReady, image)
+		}
 		klog.V(2).Infof("creating container for loadbalancer")
-		err := s.createLoadBalancer(clusterName, service, proxyImage)
+		err := s.createLoadBalancer(ctx, name, clusterName, service, image, requested, previous)
 		if err != nil {
 			return nil, err
 		}
+		created = true
+	} else if networks := additionalNetworks(service, s.sharedPorts != nil); len(networks) > 0 {
+		// the networks can be added after the loadbalancer was created
+		if err := container.ConnectNetworks(ctx, name, networks); err != nil {
+			return nil, err
+		}
 	}
 
 	// update loadbalancer
 	klog.V(2).Infof("updating loadbalancer")
-	err := s.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+	err = s.UpdateLoadBalancer(ctx, clusterName, service, nodes)
 	if err != nil {
 		return nil, err
 	}
+	// the addresses of a recreated loadbalancer may be cached with the previous container
+	if created {
+		announceAddresses(ctx, name)
+	}
 
 	// on some platforms that run containers in VMs forward from userspace
 	if s.tunnelManager != nil {
 		klog.V(2).Infof("updating loadbalancer tunnels on userspace")
-		err = s.tunnelManager.setupTunnels(loadBalancerName(clusterName, service))
+		err = s.tunnelManager.setupTunnels(ctx, name)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if config.DefaultConfig.LoadBalancerRequireHealthyBackends && s.sharedPorts == nil && !s.disabled(service) {
+		if err := s.requireHealthyBackends(ctx, clusterName, service); err != nil {
+			return nil, err
+		}
+	}
+
 	// get loadbalancer Status
 	klog.V(2).Infof("get loadbalancer status")
 	status, ok, err := s.GetLoadBalancer(ctx, clusterName, service)
@@ -133,28 +318,141 @@ func (s *Server) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 	if err != nil {
 		return nil, err
 	}
+	// track the addresses assigned to the container
+	if s.sharedPorts == nil {
+		if ipv4, ipv6, err := container.IPs(ctx, name); err == nil {
+			addrs := []netip.Addr{}
+			for _, ip := range []string{ipv4, ipv6} {
+				if addr, err := netip.ParseAddr(ip); err == nil {
+					addrs = append(addrs, addr.Unmap())
+				}
+			}
+			if err := s.claimPorts(clusterName, service, addrs...); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return status, nil
 }
 
 func (s *Server) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
-	return proxyUpdateLoadBalancer(ctx, clusterName, service, nodes)
+	override, err := s.proxyOverride(service)
+	if err != nil {
+		return err
+	}
+	certificate, err := s.tlsCertificate(service)
+	if err != nil {
+		return err
+	}
+	slices, err := s.endpointSlices(service)
+	if err != nil {
+		return err
+	}
+	s.rememberNodes(clusterName, service, nodes)
+	// the container is stopped, it is configured when it is enabled again
+	if s.disabled(service) {
+		return nil
+	}
+	if UsesPodBackends(service) {
+		addPodRoutes(ctx, s.containerName(clusterName, service), nodes)
+	}
+	// the draining backends are removed with the nodes and the endpoints of the Service at that time
+	resync := func(ctx context.Context) {
+		if err := s.ResyncLoadBalancer(ctx, clusterName, service); err != nil {
+			klog.Infof("error removing draining backends from loadbalancer %s of Service %s/%s: %v", s.containerName(clusterName, service), service.Namespace, service.Name, err)
+		}
+	}
+	if s.sharedPorts != nil {
+		name := s.containerName(clusterName, service)
+		if err := s.sharedPorts.claim(name, sharedServiceKey(clusterName, service), service); err != nil {
+			return err
+		}
+		return proxySharedUpdateLoadBalancer(ctx, name, clusterName, service, nodes, slices, override, certificate, resync)
+	}
+	return proxyUpdateLoadBalancer(ctx, clusterName, service, nodes, slices, override, certificate, resync)
+}
+
+// ResyncLoadBalancer updates the loadbalancer of the Service with the last nodes it was
+// updated with, it is used when the configuration changes but the Service does not.
+func (s *Server) ResyncLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error {
+	s.mu.Lock()
+	nodes, ok := s.nodes[loadBalancerSimpleName(clusterName, service)]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+// LoadBalancerNodes returns the sorted names of the nodes the loadbalancer of the Service
+// was last updated with.
+func (s *Server) LoadBalancerNodes(clusterName string, service *v1.Service) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := s.nodes[loadBalancerSimpleName(clusterName, service)]
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) rememberNodes(clusterName string, service *v1.Service, nodes []*v1.Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes == nil {
+		s.nodes = map[string][]*v1.Node{}
+	}
+	s.nodes[loadBalancerSimpleName(clusterName, service)] = nodes
+}
+
+func (s *Server) forgetNodes(clusterName string, service *v1.Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.nodes, loadBalancerSimpleName(clusterName, service))
 }
 
 func (s *Server) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
-	containerName := loadBalancerName(clusterName, service)
+	containerName := s.containerName(clusterName, service)
+	s.forgetNodes(clusterName, service)
+	s.ports.Release(loadBalancerSimpleName(clusterName, service))
+	if s.sharedPorts != nil {
+		s.sharedPorts.release(containerName, sharedServiceKey(clusterName, service))
+		backends.forget(containerName + "/" + sharedServiceKey(clusterName, service))
+		if !container.Exist(ctx, containerName) {
+			return nil
+		}
+		// only delete the shared container when there are no more Services using it
+		remaining, err := proxySharedDeleteLoadBalancer(ctx, containerName, clusterName, service)
+		if err != nil || remaining > 0 {
+			return err
+		}
+	}
+	backends.forget(containerName)
+	renderedConfigs.forget(containerName)
 	var err1, err2 error
 	if s.tunnelManager != nil {
 		err1 = s.tunnelManager.removeTunnels(containerName)
 	}
+	// the container may be already deleted, per example if the controller restarted
+	if !container.Exist(ctx, containerName) {
+		s.releaseIPs(containerName)
+		return err1
+	}
 	// Before deleting the load balancer store the logs if required
 	if config.DefaultConfig.EnableLogDump {
 		fileName := path.Join(config.DefaultConfig.LogDir, service.Namespace+"_"+service.Name+".log")
 		klog.V(2).Infof("storing logs for loadbalancer %s on %s", containerName, fileName)
-		if err := container.LogDump(containerName, fileName); err != nil {
+		if err := container.LogDump(ctx, containerName, fileName); err != nil {
 			klog.Infof("error trying to store logs for load balancer %s : %v", containerName, err)
 		}
 	}
-	err2 = container.Delete(containerName)
+	err2 = container.DeleteWithRetry(ctx, containerName)
+	if err2 == nil {
+		s.releaseIPs(containerName)
+		s.updateIPPoolMetrics(ctx, clusterName, clusterNetworks(ctx, clusterName)[0], false)
+	}
 	return errors.Join(err1, err2)
 }
 
@@ -162,15 +460,127 @@ func (s *Server) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 func loadBalancerName(clusterName string, service *v1.Service) string {
 	hash := sha256.Sum256([]byte(loadBalancerSimpleName(clusterName, service)))
 	encoded := base32.StdEncoding.EncodeToString(hash[:])
-	name := constants.ContainerPrefix + "-" + encoded[:40]
+	name := containerNamePrefix() + "-" + encoded[:40]
 
 	return name
 }
 
+// containerNamePrefix returns the prefix of the loadbalancer container names
+func containerNamePrefix() string {
+	if prefix := config.DefaultConfig.LoadBalancerContainerNamePrefix; prefix != "" {
+		return prefix
+	}
+	return constants.ContainerPrefix
+}
+
+// ListLoadBalancers returns the IDs of the loadbalancer containers of the cluster with the
+// prefix of this instance, running or not.
+func ListLoadBalancers(ctx context.Context, clusterName string) ([]string, error) {
+	return listLoadBalancers(ctx, clusterName, container.ListByLabel)
+}
+
+// ListRunningLoadBalancers returns the IDs of the running loadbalancer containers of the
+// cluster with the prefix of this instance.
+func ListRunningLoadBalancers(ctx context.Context, clusterName string) ([]string, error) {
+	return listLoadBalancers(ctx, clusterName, container.ListRunningByLabel)
+}
+
+// listLoadBalancers lists the loadbalancer containers of the cluster with the prefix of this
+// instance. The containers without the prefix label, created before it existed, have the default
+// prefix, so the ones with the label of other prefix are filtered out after listing them.
+func listLoadBalancers(ctx context.Context, clusterName string, list func(ctx context.Context, labels ...string) ([]string, error)) ([]string, error) {
+	clusterFilter := fmt.Sprintf("%s=%s", constants.NodeCCMLabelKey, clusterName)
+	prefixFilter := fmt.Sprintf("%s=%s", constants.LoadBalancerPrefixLabelKey, containerNamePrefix())
+	if containerNamePrefix() != constants.ContainerPrefix {
+		return list(ctx, clusterFilter, prefixFilter)
+	}
+	all, err := list(ctx, clusterFilter)
+	if err != nil {
+		return nil, err
+	}
+	labeled, err := list(ctx, clusterFilter, constants.LoadBalancerPrefixLabelKey)
+	if err != nil {
+		return nil, err
+	}
+	own, err := list(ctx, clusterFilter, prefixFilter)
+	if err != nil {
+		return nil, err
+	}
+	others := sets.New(labeled...).Delete(own...)
+	result := []string{}
+	for _, id := range all {
+		if !others.Has(id) {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
 func loadBalancerSimpleName(clusterName string, service *v1.Service) string {
 	return clusterName + "/" + service.Namespace + "/" + service.Name
 }
 
+// loadBalancerLabels returns the labels of the loadbalancer container, the extra labels
+// can not override the labels used to identify the loadbalancers.
+func loadBalancerLabels(clusterName string, service *v1.Service, shared bool, extra map[string]string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	// label the node with the cluster ID
+	labels[constants.NodeCCMLabelKey] = clusterName
+	labels[constants.LoadBalancerPrefixLabelKey] = containerNamePrefix()
+	if shared {
+		labels[constants.LoadBalancerSharedLabelKey] = "true"
+		delete(labels, constants.LoadBalancerNameLabelKey)
+		delete(labels, constants.LoadBalancerServiceNamespaceLabelKey)
+		delete(labels, constants.LoadBalancerServiceNameLabelKey)
+		delete(labels, constants.LoadBalancerServiceUIDLabelKey)
+	} else {
+		// label the node with the load balancer name
+		labels[constants.LoadBalancerNameLabelKey] = loadBalancerSimpleName(clusterName, service)
+		labels[constants.LoadBalancerServiceNamespaceLabelKey] = service.Namespace
+		labels[constants.LoadBalancerServiceNameLabelKey] = service.Name
+		labels[constants.LoadBalancerServiceUIDLabelKey] = string(service.UID)
+		delete(labels, constants.LoadBalancerSharedLabelKey)
+	}
+	return labels
+}
+
+// ServiceFromLoadBalancerLabels returns the cluster name and the Service of the labels of a
+// loadbalancer container, the Service has the UID if the container was labeled with it.
+// The containers created before the Service labels existed are identified by the name label.
+// The Service is nil if the labels do not identify one.
+func ServiceFromLoadBalancerLabels(labels map[string]string) (clusterName string, service *v1.Service) {
+	if labels[constants.LoadBalancerSharedLabelKey] == "true" {
+		return
+	}
+	namespace, name := labels[constants.LoadBalancerServiceNamespaceLabelKey], labels[constants.LoadBalancerServiceNameLabelKey]
+	if namespace == "" || name == "" || labels[constants.NodeCCMLabelKey] == "" {
+		return ServiceFromLoadBalancerSimpleName(labels[constants.LoadBalancerNameLabelKey])
+	}
+	clusterName = labels[constants.NodeCCMLabelKey]
+	service = &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace: namespace,
+		Name:      name,
+		UID:       types.UID(labels[constants.LoadBalancerServiceUIDLabelKey]),
+	}}
+	return
+}
+
+// ownedBy returns false if the loadbalancer container was created for another Service with
+// the same namespace and name, the containers without the UID label belong to any of them.
+func ownedBy(ctx context.Context, name string, service *v1.Service) bool {
+	if service.UID == "" {
+		return true
+	}
+	uid, err := container.GetLabelValue(ctx, name, constants.LoadBalancerServiceUIDLabelKey)
+	if err != nil || uid == "" {
+		return true
+	}
+	return uid == string(service.UID)
+}
+
 func ServiceFromLoadBalancerSimpleName(s string) (clusterName string, service *v1.Service) {
 	slices := strings.Split(s, "/")
 	if len(slices) != 3 {
@@ -182,60 +592,109 @@ func ServiceFromLoadBalancerSimpleName(s string) (clusterName string, service *v
 }
 
 // createLoadBalancer create a docker container with a loadbalancer
-func (s *Server) createLoadBalancer(clusterName string, service *v1.Service, image string) error {
-	name := loadBalancerName(clusterName, service)
+// If the requested address is valid the container uses it, otherwise it tries to reuse the previous address
+// and falls back to allocate one from the configured range if any.
+func (s *Server) createLoadBalancer(ctx context.Context, name string, clusterName string, service *v1.Service, image string, requested netip.Addr, previous netip.Addr) error {
+	// fail before allocating the address if the annotations are invalid
+	dns, err := dnsArgs(service, s.sharedPorts != nil)
+	if err != nil {
+		return err
+	}
+	networks := clusterNetworks(ctx, clusterName)
+	networkName := networks[0]
+	// also when it fails, the pool may be exhausted
+	defer s.updateIPPoolMetrics(ctx, clusterName, networkName, true)
 
-	networkName := constants.FixedNetworkName
-	if n := os.Getenv("KIND_EXPERIMENTAL_DOCKER_NETWORK"); n != "" {
-		networkName = n
+	var ip netip.Addr
+	if requested.IsValid() {
+		ip, err = s.allocateIP(ctx, networkName, name, requested)
+		if err != nil {
+			return err
+		}
+	} else if previous.IsValid() && inConfiguredSubnet(previous) {
+		ip, err = s.allocateIP(ctx, networkName, name, previous)
+		if err != nil {
+			klog.Infof("previous address %s of loadbalancer %s can not be reused: %v", previous, name, err)
+			ip = netip.Addr{}
+		}
+	}
+	if !ip.IsValid() && s.ipAllocator != nil {
+		ip, err = s.allocateIP(ctx, networkName, name, netip.Addr{})
+		if err != nil {
+			return err
+		}
+	}
+	subnetIPs, err := s.allocateSubnetIPs(ctx, networkName, name, ip)
+	if err != nil {
+		s.releaseIPs(name)
+		return err
 	}
 
 	args := []string{
 		"--detach", // run the container detached
 		"--tty",    // allocate a tty for entrypoint logs
-		// label the node with the cluster ID
-		"--label", fmt.Sprintf("%s=%s", constants.NodeCCMLabelKey, clusterName),
-		// label the node with the load balancer name
-		"--label", fmt.Sprintf("%s=%s", constants.LoadBalancerNameLabelKey, loadBalancerSimpleName(clusterName, service)),
 		// user a user defined docker network so we get embedded DNS
 		"--net", networkName,
 		"--init=false",
 		"--hostname", name, // make hostname match container name
-		// label the node with the role ID
-		// running containers in a container requires privileged
-		// NOTE: we could try to replicate this with --cap-add, and use less
-		// privileges, but this flag also changes some mounts that are necessary
-		// including some ones docker would otherwise do by default.
-		// for now this is what we want. in the future we may revisit this.
-		"--privileged",
 		"--restart=on-failure",                   // to deal with the crash casued by https://github.com/envoyproxy/envoy/issues/34195
 		"--sysctl=net.ipv4.ip_forward=1",         // allow ip forwarding
 		"--sysctl=net.ipv4.conf.all.rp_filter=0", // disable rp filter
 	}
 
-	if isIPv6Service(service) {
+	labels := loadBalancerLabels(clusterName, service, s.sharedPorts != nil, config.DefaultConfig.LoadBalancerContainerLabels)
+	// the ports published on the host are removed by creating the container again
+	hostPorts := s.sharedPorts == nil && wantsHostPorts(service)
+	if hostPorts {
+		labels[constants.LoadBalancerHostPortsLabelKey] = "true"
+	}
+	for _, key := range sets.List(sets.KeySet(labels)) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+
+	if cpu := config.DefaultConfig.LoadBalancerCPULimit; cpu > 0 {
+		args = append(args, fmt.Sprintf("--cpus=%.3f", float64(cpu)/1000))
+	}
+	if memory := config.DefaultConfig.LoadBalancerMemoryLimit; memory > 0 {
+		args = append(args, fmt.Sprintf("--memory=%d", memory))
+	}
+	args = append(args, securityArgs(service)...)
+	args = append(args, accessLogVolumeArgs()...)
+	args = append(args, dns...)
+
+	// the shared loadbalancer can be used by Services of any family
+	if s.sharedPorts != nil || isIPv6Service(service) {
 		args = append(args, []string{
 			"--sysctl=net.ipv6.conf.all.disable_ipv6=0", // enable IPv6
 			"--sysctl=net.ipv6.conf.all.forwarding=1",   // allow ipv6 forwarding})
 		}...)
 	}
 
-	if s.tunnelManager != nil ||
-		config.DefaultConfig.LoadBalancerConnectivity == config.Portmap {
+	// the ports of the shared loadbalancer are not known at creation time
+	var publish []string
+	if hostPorts {
+		// Publish the Service Ports on the same ports of the host
+		publish = publishArgs(service, true)
+	} else if s.sharedPorts == nil && (s.tunnelManager != nil ||
+		config.DefaultConfig.LoadBalancerConnectivity == config.Portmap) {
 		// Forward the Service Ports to the host so they are accessible on Mac and Windows
-		for _, port := range service.Spec.Ports {
-			if port.Protocol != v1.ProtocolTCP && port.Protocol != v1.ProtocolUDP {
-				continue
-			}
-			args = append(args, fmt.Sprintf("--publish=%d/%s", port.Port, port.Protocol))
+		publish = publishArgs(service, false)
+	}
+	for _, addr := range append([]netip.Addr{ip}, subnetIPs...) {
+		if addr.Is4() {
+			args = append(args, "--ip", addr.String())
+		} else if addr.Is6() {
+			args = append(args, "--ip6", addr.String())
 		}
 	}
+
 	// publish the admin endpoint
 	args = append(args, fmt.Sprintf("--publish=%d/%s", envoyAdminPort, v1.ProtocolTCP))
 	// Publish all ports in the host in random ports
 	args = append(args, "--publish-all")
+	// only pull the image if is not present locally
+	args = append(args, "--pull=missing")
 
-	args = append(args, image)
 	// we need to override the default envoy configuration
 	// https://www.envoyproxy.io/docs/envoy/latest/start/quick-start/configuration-dynamic-filesystem
 	// envoy crashes in some circumstances, causing the container to restart, the problem is that the container
@@ -245,16 +704,225 @@ func (s *Server) createLoadBalancer(clusterName string, service *v1.Service, ima
 	cmd := []string{"bash", "-c",
 		fmt.Sprintf(`echo -en '%s' > %s && touch %s && touch %s && while true; do envoy -c %s && break; sleep 1; done`,
 			dynamicFilesystemConfig, proxyConfigPath, proxyConfigPathCDS, proxyConfigPathLDS, proxyConfigPath)}
-	args = append(args, cmd...)
-	klog.V(2).Infof("creating loadbalancer with parameters: %v", args)
-	err := container.Create(name, args)
+	createArgs := func(publish []string) []string {
+		a := append([]string{}, args...)
+		a = append(a, publish...)
+		a = append(a, image)
+		return append(a, cmd...)
+	}
+	klog.V(2).Infof("creating loadbalancer with parameters: %v", createArgs(publish))
+	err = container.Create(ctx, name, createArgs(publish))
+	if hostPorts && container.IsPortInUse(err) {
+		// the ports are in use on the host, fall back to ephemeral ports
+		klog.Infof("loadbalancer %s can not publish the Service ports on the same host ports, using ephemeral ports: %v", name, err)
+		if err := container.Delete(ctx, name); err != nil {
+			klog.V(2).Infof("failed to delete loadbalancer %s: %v", name, err)
+		}
+		publish = publishArgs(service, false)
+		err = container.Create(ctx, name, createArgs(publish))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create continers %s %v: %w", name, args, err)
+		s.releaseIPs(name)
+		return fmt.Errorf("failed to create continers %s %v: %w", name, createArgs(publish), err)
+	}
+	// the nodes of the cluster can be attached to more than one network, and the
+	// loadbalancer may have to be reachable from networks without nodes
+	attach := append(append([]string{}, networks[1:]...), additionalNetworks(service, s.sharedPorts != nil)...)
+	klog.V(2).Infof("connecting loadbalancer %s to networks %v", name, attach)
+	if err := container.ConnectNetworks(ctx, name, attach); err != nil {
+		// removing the container detaches it from all the networks, it is created again on the next attempt
+		if err := container.Delete(ctx, name); err != nil {
+			klog.V(2).Infof("failed to delete loadbalancer %s: %v", name, err)
+		}
+		s.releaseIPs(name)
+		return err
 	}
 
 	return nil
 }
 
+// allocateIP returns the requested address, or an address of the configured range if it is not valid,
+// for the loadbalancer container. The addresses in use in the network are obtained from the container
+// runtime so the allocations survive restarts of the cloud-provider-kind.
+func (s *Server) allocateIP(ctx context.Context, networkName string, name string, requested netip.Addr) (netip.Addr, error) {
+	network, err := container.NetworkInspect(ctx, networkName)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	subnets := []netip.Prefix{}
+	for _, subnet := range network.Subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			continue
+		}
+		subnets = append(subnets, prefix.Masked())
+	}
+
+	allocator := s.ipAllocator
+	if requested.IsValid() && (allocator == nil || !allocator.Prefix().Contains(requested)) {
+		// the requested address can be out of the configured range but it must be in the network
+		allocator = nil
+		for _, prefix := range subnets {
+			if prefix.Contains(requested) {
+				allocator = ipam.New(prefix)
+				break
+			}
+		}
+		if allocator == nil {
+			return netip.Addr{}, fmt.Errorf("requested IP %s is not within the subnets %v of network %s: %w", requested, network.Subnets, networkName, ipam.ErrOutOfRange)
+		}
+	} else if !requested.IsValid() {
+		ipRange := allocator.Prefix()
+		inNetwork := false
+		for _, prefix := range subnets {
+			if prefix.Bits() <= ipRange.Bits() && prefix.Contains(ipRange.Addr()) {
+				inNetwork = true
+				break
+			}
+		}
+		if !inNetwork {
+			return netip.Addr{}, fmt.Errorf("loadbalancer IP range %s is not within the subnets %v of network %s", ipRange, network.Subnets, networkName)
+		}
+	}
+
+	reserveNetworkAddresses(allocator, network)
+	if requested.IsValid() {
+		if err := allocator.AllocateSpecific(requested, name); err != nil {
+			return netip.Addr{}, err
+		}
+		return requested, nil
+	}
+	return allocator.Allocate(name)
+}
+
+// claimPorts assigns the ports of the Service on the addresses to its loadbalancer, it fails
+// if other loadbalancer uses any of them.
+func (s *Server) claimPorts(clusterName string, service *v1.Service, addrs ...netip.Addr) error {
+	ports := []string{}
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, portKey(port))
+	}
+	return s.ports.Claim(loadBalancerSimpleName(clusterName, service), addrs, ports)
+}
+
+// portKey identifies the port and protocol of a Service port
+func portKey(port v1.ServicePort) string {
+	return fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+}
+
+// previousIP returns the address assigned to the loadbalancer of the Service, it is obtained
+// from the container if it exists, or from the Service status if the container was deleted,
+// per example, because cloud-provider-kind was restarted.
+// The zero value is returned if there is no address for the primary family of the Service.
+func previousIP(ctx context.Context, name string, service *v1.Service) netip.Addr {
+	candidates := []string{}
+	// the addresses configured are kept when the container is stopped
+	if ipv4, ipv6, err := container.ConfiguredIPs(ctx, name); err == nil {
+		candidates = append(candidates, ipv4, ipv6)
+	}
+	if ipv4, ipv6, err := container.IPs(ctx, name); err == nil {
+		candidates = append(candidates, ipv4, ipv6)
+	}
+	candidates = append(candidates, statusIPs(service)...)
+	return primaryFamilyIP(service, candidates)
+}
+
+// statusIPs returns the addresses of the Service status
+func statusIPs(service *v1.Service) []string {
+	ips := []string{}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		ips = append(ips, ingress.IP)
+	}
+	return ips
+}
+
+// primaryFamilyIP returns the first of the candidate addresses of the primary family of
+// the Service, the zero value if there is none.
+func primaryFamilyIP(service *v1.Service, candidates []string) netip.Addr {
+	for _, candidate := range candidates {
+		addr, err := netip.ParseAddr(candidate)
+		if err != nil {
+			continue
+		}
+		addr = addr.Unmap()
+		// the ingress of the ports published on the host
+		if addr.IsLoopback() {
+			continue
+		}
+		if len(service.Spec.IPFamilies) == 0 ||
+			addr.Is4() && service.Spec.IPFamilies[0] == v1.IPv4Protocol ||
+			addr.Is6() && service.Spec.IPFamilies[0] == v1.IPv6Protocol {
+			return addr
+		}
+	}
+	return netip.Addr{}
+}
+
+// requestedIP returns the address requested by the Service, the zero value means
+// there is no address requested.
+func requestedIP(service *v1.Service) (netip.Addr, error) {
+	value := service.Spec.LoadBalancerIP
+	if v, ok := service.Annotations[constants.LoadBalancerIPAnnotationKey]; ok {
+		value = v
+	}
+	if value == "" {
+		return netip.Addr{}, nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid requested IP %q: %w", value, err)
+	}
+	addr = addr.Unmap()
+	if len(service.Spec.IPFamilies) == 0 {
+		return addr, nil
+	}
+	family := v1.IPv4Protocol
+	if addr.Is6() {
+		family = v1.IPv6Protocol
+	}
+	for _, f := range service.Spec.IPFamilies {
+		if f == family {
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("requested IP %s does not match the Service IP families %v: %w", addr, service.Spec.IPFamilies, ipam.ErrOutOfRange)
+}
+
+// ingressHostnames replaces the IPs of the ingress with hostnames, localhost for the
+// loopback addresses and the Service hostname annotation for the loadbalancer addresses.
+// The ingress without hostname keep the IP.
+func ingressHostnames(service *v1.Service, ingress []v1.LoadBalancerIngress) []v1.LoadBalancerIngress {
+	hostname := service.Annotations[constants.HostnameAnnotationKey]
+	if hostname != "" && len(validation.IsDNS1123Subdomain(hostname)) > 0 {
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q, it must be a DNS name",
+			service.Namespace, service.Name, constants.HostnameAnnotationKey, hostname)
+		hostname = ""
+	}
+	result := []v1.LoadBalancerIngress{}
+	for _, ing := range ingress {
+		name := hostname
+		if addr, err := netip.ParseAddr(ing.IP); err == nil && addr.IsLoopback() {
+			name = "localhost"
+		}
+		if name != "" {
+			// the IPMode can only be set with the IP
+			ing = v1.LoadBalancerIngress{Hostname: name, Ports: ing.Ports}
+		}
+		// dual-stack loadbalancers have the same hostname for both families
+		duplicated := false
+		for _, r := range result {
+			if reflect.DeepEqual(r, ing) {
+				duplicated = true
+				break
+			}
+		}
+		if !duplicated {
+			result = append(result, ing)
+		}
+	}
+	return result
+}
+
 func isIPv6Service(service *v1.Service) bool {
 	if service == nil {
 		return false
@@ -1,11 +1,22 @@
 package loadbalancer
 
 import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
 	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
 )
 
 func TestLoadBalancerName(t *testing.T) {
@@ -37,3 +48,466 @@ func TestLoadBalancerName(t *testing.T) {
 		})
 	}
 }
+
+func Test_requestedIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		service *v1.Service
+		want    netip.Addr
+		wantErr bool
+		errIs   error
+	}{
+		{
+			name: "no address requested",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{IPFamilies: []v1.IPFamily{v1.IPv4Protocol}},
+			},
+		},
+		{
+			name: "spec.loadBalancerIP",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{LoadBalancerIP: "192.168.8.7", IPFamilies: []v1.IPFamily{v1.IPv4Protocol}},
+			},
+			want: netip.MustParseAddr("192.168.8.7"),
+		},
+		{
+			name: "annotation takes precedence",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{constants.LoadBalancerIPAnnotationKey: "fc00:f853:ccd:e793::7"},
+				},
+				Spec: v1.ServiceSpec{LoadBalancerIP: "192.168.8.7", IPFamilies: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}},
+			},
+			want: netip.MustParseAddr("fc00:f853:ccd:e793::7"),
+		},
+		{
+			name: "family does not match",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{LoadBalancerIP: "fc00:f853:ccd:e793::7", IPFamilies: []v1.IPFamily{v1.IPv4Protocol}},
+			},
+			wantErr: true,
+			errIs:   ipam.ErrOutOfRange,
+		},
+		{
+			name: "invalid address",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{LoadBalancerIP: "192.168.8", IPFamilies: []v1.IPFamily{v1.IPv4Protocol}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := requestedIP(tt.service)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requestedIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Fatalf("requestedIP() error = %v, want %v", err, tt.errIs)
+			}
+			if got != tt.want {
+				t.Errorf("requestedIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadBalancerLabels(t *testing.T) {
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", UID: "1234-abcd"}}
+	tests := []struct {
+		name   string
+		shared bool
+		extra  map[string]string
+		want   map[string]string
+	}{
+		{
+			name: "no extra labels",
+			want: map[string]string{
+				constants.NodeCCMLabelKey:                      "kind",
+				constants.LoadBalancerNameLabelKey:             "kind/ns/svc",
+				constants.LoadBalancerPrefixLabelKey:           "kindccm",
+				constants.LoadBalancerServiceNamespaceLabelKey: "ns",
+				constants.LoadBalancerServiceNameLabelKey:      "svc",
+				constants.LoadBalancerServiceUIDLabelKey:       "1234-abcd",
+			},
+		},
+		{
+			name:  "extra labels",
+			extra: map[string]string{"team": "platform", "cost-center": "1234"},
+			want: map[string]string{
+				constants.NodeCCMLabelKey:                      "kind",
+				constants.LoadBalancerNameLabelKey:             "kind/ns/svc",
+				constants.LoadBalancerPrefixLabelKey:           "kindccm",
+				constants.LoadBalancerServiceNamespaceLabelKey: "ns",
+				constants.LoadBalancerServiceNameLabelKey:      "svc",
+				constants.LoadBalancerServiceUIDLabelKey:       "1234-abcd",
+				"team":                                         "platform",
+				"cost-center":                                  "1234",
+			},
+		},
+		{
+			name:   "extra labels shared loadbalancer",
+			shared: true,
+			extra:  map[string]string{"team": "platform", constants.LoadBalancerServiceNameLabelKey: "svc"},
+			want: map[string]string{
+				constants.NodeCCMLabelKey:            "kind",
+				constants.LoadBalancerSharedLabelKey: "true",
+				constants.LoadBalancerPrefixLabelKey: "kindccm",
+				"team":                               "platform",
+			},
+		},
+		{
+			name: "extra labels can not override the required labels",
+			extra: map[string]string{
+				constants.NodeCCMLabelKey:                "other",
+				constants.LoadBalancerNameLabelKey:       "other/ns/svc",
+				constants.LoadBalancerSharedLabelKey:     "true",
+				constants.LoadBalancerServiceUIDLabelKey: "other",
+				"team":                                   "platform",
+			},
+			want: map[string]string{
+				constants.NodeCCMLabelKey:                      "kind",
+				constants.LoadBalancerNameLabelKey:             "kind/ns/svc",
+				constants.LoadBalancerPrefixLabelKey:           "kindccm",
+				constants.LoadBalancerServiceNamespaceLabelKey: "ns",
+				constants.LoadBalancerServiceNameLabelKey:      "svc",
+				constants.LoadBalancerServiceUIDLabelKey:       "1234-abcd",
+				"team":                                         "platform",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := loadBalancerLabels("kind", service, tt.shared, tt.extra)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadBalancerLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceFromLoadBalancerLabels(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		wantCluster string
+		wantService *v1.Service
+	}{
+		{
+			name:        "service labels",
+			labels:      loadBalancerLabels("kind", &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", UID: "1234-abcd"}}, false, nil),
+			wantCluster: "kind",
+			wantService: &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", UID: "1234-abcd"}},
+		},
+		{
+			name: "created before the service labels",
+			labels: map[string]string{
+				constants.NodeCCMLabelKey:          "kind",
+				constants.LoadBalancerNameLabelKey: "kind/ns/svc",
+			},
+			wantCluster: "kind",
+			wantService: &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}},
+		},
+		{
+			name:   "shared loadbalancer",
+			labels: loadBalancerLabels("kind", &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}, true, nil),
+		},
+		{
+			name:   "invalid name label",
+			labels: map[string]string{constants.LoadBalancerNameLabelKey: "kind/svc"},
+		},
+		{
+			name: "no labels",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, service := ServiceFromLoadBalancerLabels(tt.labels)
+			if cluster != tt.wantCluster || !reflect.DeepEqual(service, tt.wantService) {
+				t.Errorf("ServiceFromLoadBalancerLabels() = %s, %v, want %s, %v", cluster, service, tt.wantCluster, tt.wantService)
+			}
+		})
+	}
+}
+
+func Test_containerNamePrefix(t *testing.T) {
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}
+	tests := []struct {
+		name       string
+		prefix     string
+		wantPrefix string
+	}{
+		{
+			name:       "default prefix",
+			wantPrefix: "kindccm-",
+		},
+		{
+			name:       "custom prefix",
+			prefix:     "ci-42",
+			wantPrefix: "ci-42-",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.DefaultConfig.LoadBalancerContainerNamePrefix
+			config.DefaultConfig.LoadBalancerContainerNamePrefix = tt.prefix
+			defer func() { config.DefaultConfig.LoadBalancerContainerNamePrefix = old }()
+
+			if got := loadBalancerName("kind", service); !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("loadBalancerName() = %s, want prefix %s", got, tt.wantPrefix)
+			}
+			if got := sharedLoadBalancerName("kind"); !strings.HasPrefix(got, tt.wantPrefix+"shared-") {
+				t.Errorf("sharedLoadBalancerName() = %s, want prefix %sshared-", got, tt.wantPrefix)
+			}
+			if got := loadBalancerLabels("kind", service, false, nil)[constants.LoadBalancerPrefixLabelKey]; got+"-" != tt.wantPrefix {
+				t.Errorf("prefix label = %s, want %s", got, strings.TrimSuffix(tt.wantPrefix, "-"))
+			}
+		})
+	}
+}
+
+func TestListLoadBalancers(t *testing.T) {
+	// legacy has no prefix label, own has the default prefix and other the ci-42 prefix
+	t.Cleanup(container.Use(containertest.New(t, `case "$*" in
+*prefix=kindccm*) echo own ;;
+*prefix=ci-42*) echo other ;;
+*"prefix --format"*) printf 'own\nother\n' ;;
+*) printf 'legacy\nown\nother\n' ;;
+esac`)))
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{name: "default prefix", want: []string{"legacy", "own"}},
+		{name: "custom prefix", prefix: "ci-42", want: []string{"other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := config.DefaultConfig.LoadBalancerContainerNamePrefix
+			config.DefaultConfig.LoadBalancerContainerNamePrefix = tt.prefix
+			defer func() { config.DefaultConfig.LoadBalancerContainerNamePrefix = old }()
+
+			got, err := ListLoadBalancers(context.Background(), "kind")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListLoadBalancers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ingressHostnames(t *testing.T) {
+	ports := []v1.PortStatus{{Port: 80, Protocol: v1.ProtocolTCP}}
+	hostPorts := []v1.PortStatus{{Port: 32000, Protocol: v1.ProtocolTCP}}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		ingress     []v1.LoadBalancerIngress
+		want        []v1.LoadBalancerIngress
+	}{
+		{
+			name: "no hostname keeps the IPs",
+			ingress: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+			},
+			want: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+			},
+		},
+		{
+			name: "loopback is localhost",
+			ingress: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+				{IP: "127.0.0.1", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: hostPorts},
+			},
+			want: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+				{Hostname: "localhost", Ports: hostPorts},
+			},
+		},
+		{
+			name:        "hostname annotation",
+			annotations: map[string]string{constants.HostnameAnnotationKey: "web.kind.test"},
+			ingress: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+				{IP: "fc00:f853:ccd:e793::5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+				{IP: "127.0.0.1", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: hostPorts},
+			},
+			want: []v1.LoadBalancerIngress{
+				{Hostname: "web.kind.test", Ports: ports},
+				{Hostname: "localhost", Ports: hostPorts},
+			},
+		},
+		{
+			name:        "invalid hostname annotation",
+			annotations: map[string]string{constants.HostnameAnnotationKey: "not a hostname"},
+			ingress: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+			},
+			want: []v1.LoadBalancerIngress{
+				{IP: "172.18.0.5", IPMode: ptr.To(v1.LoadBalancerIPModeProxy), Ports: ports},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := ingressHostnames(service, tt.ingress); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ingressHostnames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_EnsureLoadBalancerDeletedTwice(t *testing.T) {
+	s := &Server{ipAllocator: ipam.New(netip.MustParsePrefix("172.18.200.0/24"))}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}
+	name := s.containerName("kind", service)
+	addr, err := s.ipAllocator.Allocate(name)
+	if err != nil {
+		t.Fatalf("unexpected error allocating the address: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.EnsureLoadBalancerDeleted(context.Background(), "kind", service); err != nil {
+			t.Fatalf("EnsureLoadBalancerDeleted() attempt %d error = %v", i+1, err)
+		}
+	}
+	// the address must be free again
+	if err := s.ipAllocator.AllocateSpecific(addr, "other"); err != nil {
+		t.Errorf("address %s was not released: %v", addr, err)
+	}
+}
+
+func TestServer_claimPortsCollision(t *testing.T) {
+	s := &Server{ports: ipam.NewPorts()}
+	vip := netip.MustParseAddr("172.18.0.10")
+	web := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}}},
+	}
+	api := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "api"},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}}},
+	}
+	if err := s.claimPorts("kind", web, vip); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.claimPorts("kind", api, vip); !errors.Is(err, ipam.ErrPortInUse) {
+		t.Fatalf("expected the later Service to be rejected, got %v", err)
+	}
+	// other cluster uses other loadbalancer
+	if err := s.claimPorts("other", web, netip.MustParseAddr("172.18.0.11")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the address is free once the loadbalancer is deleted
+	if err := s.EnsureLoadBalancerDeleted(context.Background(), "kind", web); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.claimPorts("kind", api, vip); err != nil {
+		t.Fatalf("expected the port to be free after the delete, got %v", err)
+	}
+}
+
+// fakeDocker replaces the container runtime with a script that answers the inspect commands
+// with the addresses of a running container, a missing container or a runtime failure
+func fakeDocker(t *testing.T, state string) {
+	t.Helper()
+	script := `case "$FAKE_CONTAINER_STATE" in
+running) printf 'kind\nkind,172.18.0.5,fc00:f853:ccd:e793::5\n' ;;
+missing) echo "Error: No such object: $4" >&2; exit 1 ;;
+*) echo "Cannot connect to the Docker daemon" >&2; exit 1 ;;
+esac`
+	t.Setenv("FAKE_CONTAINER_STATE", state)
+	t.Cleanup(container.Use(containertest.New(t, script)))
+}
+
+func TestServer_GetLoadBalancer(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Type:       v1.ServiceTypeLoadBalancer,
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			Ports:      []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	tests := []struct {
+		name       string
+		state      string
+		wantExists bool
+		wantErr    bool
+		wantIP     string
+	}{
+		{name: "exists", state: "running", wantExists: true, wantIP: "172.18.0.5"},
+		{name: "does not exist", state: "missing"},
+		// the service controller must not create the loadbalancer again
+		{name: "runtime failure", state: "failing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeDocker(t, tt.state)
+			status, exists, err := (&Server{}).GetLoadBalancer(context.Background(), "kind", service)
+			if (err != nil) != tt.wantErr || exists != tt.wantExists {
+				t.Fatalf("GetLoadBalancer() exists = %v error = %v, want exists %v and error %v", exists, err, tt.wantExists, tt.wantErr)
+			}
+			if tt.wantIP == "" {
+				if status != nil {
+					t.Errorf("GetLoadBalancer() status = %+v, want nil", status)
+				}
+				return
+			}
+			if len(status.Ingress) != 1 || status.Ingress[0].IP != tt.wantIP {
+				t.Errorf("GetLoadBalancer() status = %+v, want the IP %s", status, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestServer_GetLoadBalancerShared(t *testing.T) {
+	makeSvc := func(name string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: v1.ServiceSpec{
+				Type:       v1.ServiceTypeLoadBalancer,
+				IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+				Ports:      []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}},
+			},
+		}
+	}
+	web, api := makeSvc("web"), makeSvc("api")
+	// the shared container has only the configuration of the Service web
+	script := `case "$*" in
+exec*) case "$*" in *"$FAKE_CONFIGURED.yaml"*) echo configured ;; esac ;;
+*) printf 'kind\nkind,172.18.0.5,fc00:f853:ccd:e793::5\n' ;;
+esac`
+	t.Setenv("FAKE_CONFIGURED", sharedServiceKey("kind", web))
+	t.Cleanup(container.Use(containertest.New(t, script)))
+
+	s := &Server{sharedPorts: newSharedPorts()}
+	status, exists, err := s.GetLoadBalancer(context.Background(), "kind", web)
+	if err != nil || !exists {
+		t.Fatalf("GetLoadBalancer() exists = %v error = %v, want the configured Service to exist", exists, err)
+	}
+	if len(status.Ingress) != 1 || status.Ingress[0].IP != "172.18.0.5" {
+		t.Errorf("GetLoadBalancer() status = %+v, want the IP 172.18.0.5", status)
+	}
+	if status, exists, err := s.GetLoadBalancer(context.Background(), "kind", api); err != nil || exists || status != nil {
+		t.Errorf("GetLoadBalancer() status = %+v exists = %v error = %v, want the Service without configuration not to exist", status, exists, err)
+	}
+}
+
+func TestServer_GetLoadBalancerName(t *testing.T) {
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	s := &Server{}
+	name := s.GetLoadBalancerName(context.Background(), "kind", service)
+	if name != loadBalancerName("kind", service) || name != s.GetLoadBalancerName(context.Background(), "kind", service.DeepCopy()) {
+		t.Errorf("expected the stable name of the loadbalancer container, got %s", name)
+	}
+	s.sharedPorts = newSharedPorts()
+	if got := s.GetLoadBalancerName(context.Background(), "kind", service); got != sharedLoadBalancerName("kind") {
+		t.Errorf("expected the name of the shared loadbalancer %s, got %s", sharedLoadBalancerName("kind"), got)
+	}
+}
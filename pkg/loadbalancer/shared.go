@@ -0,0 +1,198 @@
+package loadbalancer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+)
+
+// In shared mode all the LoadBalancer Services of a cluster are multiplexed on the
+// same loadbalancer container, each Service stores its listeners and clusters in
+// its own file and the envoy configuration is the concatenation of all of them.
+const (
+	sharedConfigDirLDS = "/home/envoy/lds.d"
+	sharedConfigDirCDS = "/home/envoy/cds.d"
+)
+
+// sharedPorts tracks the listeners used by each Service on the shared containers
+// to reject the Services that try to use a port already in use by other Service.
+type sharedPorts struct {
+	mu sync.Mutex
+	// first key is the container name, second key is the Port and Protocol and the value the Service
+	ports map[string]map[string]string
+}
+
+func newSharedPorts() *sharedPorts {
+	return &sharedPorts{ports: map[string]map[string]string{}}
+}
+
+// claim reserves the ports of the service on the container, it fails if any of
+// the ports is already used by other service.
+func (p *sharedPorts) claim(containerName string, serviceKey string, service *v1.Service) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	used, ok := p.ports[containerName]
+	if !ok {
+		used = map[string]string{}
+		p.ports[containerName] = used
+	}
+	wanted := map[string]bool{}
+	for _, port := range service.Spec.Ports {
+		key := portKey(port)
+		if owner, ok := used[key]; ok && owner != serviceKey {
+			return fmt.Errorf("port %s is already in use by other Service on the shared loadbalancer %s", key, containerName)
+		}
+		wanted[key] = true
+	}
+	// release the ports no longer used by the service
+	for key, owner := range used {
+		if owner == serviceKey && !wanted[key] {
+			delete(used, key)
+		}
+	}
+	for key := range wanted {
+		used[key] = serviceKey
+	}
+	return nil
+}
+
+// release frees the ports used by the service on the container
+func (p *sharedPorts) release(containerName string, serviceKey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	used := p.ports[containerName]
+	for key, owner := range used {
+		if owner == serviceKey {
+			delete(used, key)
+		}
+	}
+	if len(used) == 0 {
+		delete(p.ports, containerName)
+	}
+}
+
+// sharedLoadBalancerName is the name of the loadbalancer container shared by all the Services of the cluster
+func sharedLoadBalancerName(clusterName string) string {
+	hash := sha256.Sum256([]byte(clusterName))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return containerNamePrefix() + "-shared-" + encoded[:33]
+}
+
+// sharedServiceKey identifies the Service configuration on the shared loadbalancer,
+// it is safe to use as file name and as envoy resource name.
+func sharedServiceKey(clusterName string, service *v1.Service) string {
+	return strings.TrimPrefix(loadBalancerName(clusterName, service), containerNamePrefix()+"-")
+}
+
+// sharedProxyConfig returns the envoy resources of the Service without the top level
+// resources field, so it can be concatenated with the ones of other Services.
+func sharedProxyConfig(configTemplate string, data *proxyConfigData) (string, error) {
+	config, err := proxyConfig(configTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(config, "\nresources:", "", 1), nil
+}
+
+// proxySharedUpdateLoadBalancer writes the configuration of the Service in the shared loadbalancer
+// and regenerates the envoy configuration with the resources of all the Services.
+func proxySharedUpdateLoadBalancer(ctx context.Context, name string, clusterName string, service *v1.Service, nodes []*v1.Node, slices []*discoveryv1.EndpointSlice, override *proxyOverride, certificate *tlsCertificate, resync func(ctx context.Context)) error {
+	if service == nil {
+		return nil
+	}
+	var stdout, stderr bytes.Buffer
+	key := sharedServiceKey(clusterName, service)
+	config := generateConfig(service, endpointNodes(service, nodes, slices))
+	setPodBackends(config, service, slices)
+	setTLS(config, service, certificate)
+	config.Override = override
+	backends.drain(clusterName, name+"/"+key, config, time.Now(), resync)
+	// prefix the resources names with the Service key so they are unique in the container
+	servicePorts := map[string]servicePort{}
+	for index, sp := range config.ServicePorts {
+		servicePorts[key+"_"+index] = sp
+	}
+	config.ServicePorts = servicePorts
+
+	ldsConfig, err := sharedProxyConfig(proxyLDSConfigTemplate, config)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate loadbalancer config data")
+	}
+	cdsConfig, err := sharedProxyConfig(proxyCDSConfigTemplate, config)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate loadbalancer config data")
+	}
+
+	klog.V(2).Infof("updating shared loadbalancer %s with config %s\n%s", name, redactPrivateKey(ldsConfig, certificate), cdsConfig)
+	for dir, config := range map[string]string{sharedConfigDirLDS: ldsConfig, sharedConfigDirCDS: cdsConfig} {
+		err = container.Exec(ctx, name, []string{"bash", "-c", fmt.Sprintf("mkdir -p %s && cp /dev/stdin %s", dir, path.Join(dir, key+".yaml"))}, strings.NewReader(config), &stdout, &stderr)
+		if err != nil {
+			return fmt.Errorf("error updating configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+		}
+	}
+	if err := sharedRegenerateConfig(ctx, name); err != nil {
+		return err
+	}
+	return waitLoadBalancerReady(ctx, name, 30*time.Second)
+}
+
+// proxySharedDeleteLoadBalancer removes the configuration of the Service from the shared loadbalancer,
+// it returns the number of Services that remain configured.
+func proxySharedDeleteLoadBalancer(ctx context.Context, name string, clusterName string, service *v1.Service) (int, error) {
+	var stdout, stderr bytes.Buffer
+	key := sharedServiceKey(clusterName, service)
+	cmd := fmt.Sprintf("rm -f %s %s", path.Join(sharedConfigDirLDS, key+".yaml"), path.Join(sharedConfigDirCDS, key+".yaml"))
+	err := container.Exec(ctx, name, []string{"bash", "-c", cmd}, nil, &stdout, &stderr)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+	}
+	stdout.Reset()
+	err = container.Exec(ctx, name, []string{"bash", "-c", fmt.Sprintf("ls -1 %s | wc -l", sharedConfigDirLDS)}, nil, &stdout, &stderr)
+	if err != nil {
+		return 0, fmt.Errorf("error listing configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+	}
+	var remaining int
+	fmt.Sscanf(strings.TrimSpace(stdout.String()), "%d", &remaining) // nolint:errcheck
+	if remaining == 0 {
+		return 0, nil
+	}
+	return remaining, sharedRegenerateConfig(ctx, name)
+}
+
+// sharedServiceConfigured returns true if the shared loadbalancer has the configuration of the
+// Service, the container exists as long as any Service of the cluster uses it.
+func sharedServiceConfigured(ctx context.Context, name string, clusterName string, service *v1.Service) (bool, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := fmt.Sprintf("test -f %s && echo configured || true", path.Join(sharedConfigDirLDS, sharedServiceKey(clusterName, service)+".yaml"))
+	err := container.Exec(ctx, name, []string{"bash", "-c", cmd}, nil, &stdout, &stderr)
+	if err != nil {
+		return false, fmt.Errorf("error reading configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+	}
+	return strings.TrimSpace(stdout.String()) == "configured", nil
+}
+
+// sharedRegenerateConfig concatenates the resources of all the Services and atomically replaces
+// the envoy configuration files, CDS first so the listeners find their clusters.
+func sharedRegenerateConfig(ctx context.Context, name string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := fmt.Sprintf(`mkdir -p %[1]s %[2]s && { echo resources:; cat %[1]s/*.yaml 2>/dev/null; } > %[3]s.tmp && { echo resources:; cat %[2]s/*.yaml 2>/dev/null; } > %[4]s.tmp && chmod a+rw /home/envoy/* && mv %[3]s.tmp %[3]s && mv %[4]s.tmp %[4]s`,
+		sharedConfigDirCDS, sharedConfigDirLDS, proxyConfigPathCDS, proxyConfigPathLDS)
+	err := container.Exec(ctx, name, []string{"bash", "-c", cmd}, nil, &stdout, &stderr)
+	if err != nil {
+		return fmt.Errorf("error updating configuration Stdout: %s Stderr: %s : %w", stdout.String(), stderr.String(), err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSharedPorts(t *testing.T) {
+	makeSvc := func(name string, ports ...int32) *v1.Service {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+		for _, p := range ports {
+			svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Port: p, Protocol: v1.ProtocolTCP})
+		}
+		return svc
+	}
+
+	p := newSharedPorts()
+	if err := p.claim("lb", "a", makeSvc("a", 80, 443)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// claiming again the same ports is idempotent
+	if err := p.claim("lb", "a", makeSvc("a", 80, 443)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.claim("lb", "b", makeSvc("b", 443)); err == nil {
+		t.Fatalf("expected error claiming a port in use")
+	}
+	// the same port on other container does not conflict
+	if err := p.claim("other", "b", makeSvc("b", 443)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// removing a port from the service releases it
+	if err := p.claim("lb", "a", makeSvc("a", 80)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.claim("lb", "b", makeSvc("b", 443)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.release("lb", "a")
+	if err := p.claim("lb", "c", makeSvc("c", 80)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
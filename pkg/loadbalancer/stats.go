@@ -0,0 +1,97 @@
+package loadbalancer
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/metrics"
+)
+
+// statsCollector reports the resource usage of the loadbalancer containers of a cluster
+type statsCollector struct {
+	clusterName string
+	// services caches the Service of each container, the labels do not change
+	services map[string]string
+	// reported are the Services with metrics, so the ones of the removed containers are deleted
+	reported map[string]bool
+	// stats returns the resource usage of the containers by name
+	stats func(ctx context.Context) (map[string]container.ResourceUsage, error)
+	// labels returns the labels of the container
+	labels func(ctx context.Context, name string) (map[string]string, error)
+}
+
+// CollectStats reports the CPU and memory usage of the running loadbalancer containers of the
+// cluster every interval, until the context is cancelled. The metrics are deleted when it returns.
+func CollectStats(ctx context.Context, clusterName string, interval time.Duration) {
+	c := &statsCollector{
+		clusterName: clusterName,
+		services:    map[string]string{},
+		reported:    map[string]bool{},
+		stats: func(ctx context.Context) (map[string]container.ResourceUsage, error) {
+			ids, err := ListRunningLoadBalancers(ctx, clusterName)
+			if err != nil {
+				return nil, err
+			}
+			return container.Stats(ctx, ids...)
+		},
+		labels: container.Labels,
+	}
+	wait.UntilWithContext(ctx, c.collect, interval)
+	c.reset()
+}
+
+func (c *statsCollector) collect(ctx context.Context) {
+	usage, err := c.stats(ctx)
+	if err != nil {
+		klog.Infof("error collecting the resource usage of the loadbalancers of cluster %s: %v", c.clusterName, err)
+		return
+	}
+	reported := map[string]bool{}
+	for name, u := range usage {
+		service, ok := c.services[name]
+		if !ok {
+			labels, err := c.labels(ctx, name)
+			if err != nil {
+				klog.V(2).Infof("error getting the labels of loadbalancer %s: %v", name, err)
+				continue
+			}
+			// the shared loadbalancer has no Service
+			if _, svc := ServiceFromLoadBalancerLabels(labels); svc != nil {
+				service = svc.Namespace + "/" + svc.Name
+			}
+			c.services[name] = service
+		}
+		metrics.LoadBalancerContainerCPUUsage.WithLabelValues(c.clusterName, service).Set(u.CPU)
+		metrics.LoadBalancerContainerMemoryBytes.WithLabelValues(c.clusterName, service).Set(u.MemoryBytes)
+		reported[service] = true
+	}
+	for service := range c.reported {
+		if !reported[service] {
+			c.deleteMetrics(service)
+		}
+	}
+	// forget the containers that are gone
+	for name := range c.services {
+		if _, ok := usage[name]; !ok {
+			delete(c.services, name)
+		}
+	}
+	c.reported = reported
+}
+
+// reset deletes the metrics of all the loadbalancers of the cluster
+func (c *statsCollector) reset() {
+	for service := range c.reported {
+		c.deleteMetrics(service)
+	}
+	c.reported = map[string]bool{}
+}
+
+func (c *statsCollector) deleteMetrics(service string) {
+	metrics.LoadBalancerContainerCPUUsage.DeleteLabelValues(c.clusterName, service)
+	metrics.LoadBalancerContainerMemoryBytes.DeleteLabelValues(c.clusterName, service)
+}
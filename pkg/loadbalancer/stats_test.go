@@ -0,0 +1,68 @@
+package loadbalancer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/component-base/metrics/testutil"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/metrics"
+)
+
+func Test_statsCollector(t *testing.T) {
+	metrics.Register()
+	usage := map[string]container.ResourceUsage{
+		"kindccm-web":    {CPU: 0.25, MemoryBytes: 32 << 20},
+		"kindccm-shared": {CPU: 0.5, MemoryBytes: 48 << 20},
+	}
+	lookups := 0
+	c := &statsCollector{
+		clusterName: "stats",
+		services:    map[string]string{},
+		reported:    map[string]bool{},
+		stats: func(ctx context.Context) (map[string]container.ResourceUsage, error) {
+			return usage, nil
+		},
+		labels: func(ctx context.Context, name string) (map[string]string, error) {
+			lookups++
+			if name == "kindccm-shared" {
+				return map[string]string{constants.NodeCCMLabelKey: "stats", constants.LoadBalancerSharedLabelKey: "true"}, nil
+			}
+			return map[string]string{
+				constants.NodeCCMLabelKey:                      "stats",
+				constants.LoadBalancerServiceNamespaceLabelKey: "default",
+				constants.LoadBalancerServiceNameLabelKey:      "web",
+			}, nil
+		},
+	}
+
+	c.collect(context.Background())
+	for service, want := range map[string]float64{"default/web": 0.25, "": 0.5} {
+		got, err := testutil.GetGaugeMetricValue(metrics.LoadBalancerContainerCPUUsage.WithLabelValues("stats", service))
+		if err != nil || got != want {
+			t.Errorf("expected the CPU usage %v of Service %q, got %v: %v", want, service, got, err)
+		}
+	}
+	got, err := testutil.GetGaugeMetricValue(metrics.LoadBalancerContainerMemoryBytes.WithLabelValues("stats", "default/web"))
+	if err != nil || got != 32<<20 {
+		t.Errorf("expected the memory usage of the Service, got %v: %v", got, err)
+	}
+
+	// the labels are cached and the removed containers are forgotten
+	delete(usage, "kindccm-shared")
+	c.collect(context.Background())
+	if lookups != 2 {
+		t.Errorf("expected the labels of each container to be read once, got %d lookups", lookups)
+	}
+	if want := map[string]bool{"default/web": true}; !reflect.DeepEqual(c.reported, want) {
+		t.Errorf("expected the reported Services %v, got %v", want, c.reported)
+	}
+
+	c.reset()
+	if len(c.reported) != 0 {
+		t.Errorf("expected no reported Services after the reset, got %v", c.reported)
+	}
+}
@@ -0,0 +1,106 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
+)
+
+// configuredSubnets returns the subnets configured to assign the loadbalancer addresses from
+func configuredSubnets() []netip.Prefix {
+	subnets := []netip.Prefix{}
+	for _, subnet := range []netip.Prefix{config.DefaultConfig.LoadBalancerIPv4Subnet, config.DefaultConfig.LoadBalancerIPv6Subnet} {
+		if subnet.IsValid() {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets
+}
+
+// inConfiguredSubnet returns false if a subnet is configured for the family of the address
+// and it does not contain it
+func inConfiguredSubnet(addr netip.Addr) bool {
+	for _, subnet := range configuredSubnets() {
+		if subnet.Addr().Is6() == addr.Is6() && !subnet.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// networkHasSubnet returns an error if the subnet is not one of the subnets of the network,
+// the container runtime does not assign addresses out of them
+func networkHasSubnet(network *container.Network, networkName string, subnet netip.Prefix) error {
+	for _, s := range network.Subnets {
+		prefix, err := netip.ParsePrefix(s)
+		if err == nil && prefix.Masked() == subnet {
+			return nil
+		}
+	}
+	return fmt.Errorf("loadbalancer subnet %s is not one of the subnets %v of network %s", subnet, network.Subnets, networkName)
+}
+
+// allocateSubnetIPs returns an address of each configured subnet for the loadbalancer container,
+// except for the family of ip that is already assigned. The container runtime picks the first
+// subnet of each family otherwise, that is not predictable in networks with more than one.
+func (s *Server) allocateSubnetIPs(ctx context.Context, networkName string, name string, ip netip.Addr) ([]netip.Addr, error) {
+	subnets := configuredSubnets()
+	if len(subnets) == 0 {
+		return nil, nil
+	}
+	network, err := container.NetworkInspect(ctx, networkName)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []netip.Addr{}
+	for _, subnet := range subnets {
+		if ip.IsValid() && ip.Is6() == subnet.Addr().Is6() {
+			continue
+		}
+		if err := networkHasSubnet(network, networkName, subnet); err != nil {
+			return nil, err
+		}
+		// the addresses in use are obtained from the container runtime, as for the requested addresses,
+		// and the ones allocated to the loadbalancers being created are kept by the allocator
+		allocator := s.subnetAllocator(subnet)
+		reserveNetworkAddresses(allocator, network)
+		addr, err := allocator.Allocate(name)
+		if err != nil {
+			return nil, fmt.Errorf("loadbalancer subnet %s of network %s: %w", subnet, networkName, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// subnetAllocator returns the allocator of the configured subnet, it is shared by all the
+// loadbalancers so the ones created at the same time do not get the same address
+func (s *Server) subnetAllocator(subnet netip.Prefix) *ipam.Allocator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subnetAllocators == nil {
+		s.subnetAllocators = map[netip.Prefix]*ipam.Allocator{}
+	}
+	allocator, ok := s.subnetAllocators[subnet]
+	if !ok {
+		allocator = ipam.New(subnet)
+		s.subnetAllocators[subnet] = allocator
+	}
+	return allocator
+}
+
+// releaseIPs frees the addresses of the configured range and subnets allocated to the loadbalancer
+func (s *Server) releaseIPs(name string) {
+	if s.ipAllocator != nil {
+		s.ipAllocator.Release(name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, allocator := range s.subnetAllocators {
+		allocator.Release(name)
+	}
+}
@@ -0,0 +1,128 @@
+package loadbalancer
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+// fakeNetwork replaces the container runtime with a script that inspects a network with two IPv4 pools and one IPv6 pool
+func fakeNetwork(t *testing.T) {
+	t.Helper()
+	script := `echo '{"IPAM":{"Config":[{"Subnet":"172.18.0.0/16","Gateway":"172.18.0.1"},{"Subnet":"10.89.0.0/24","Gateway":"10.89.0.1"},{"Subnet":"fc00:f853:ccd:e793::/64","Gateway":"fc00:f853:ccd:e793::1"}]},"Containers":{"a":{"Name":"kind-control-plane","IPv4Address":"10.89.0.2/24","IPv6Address":"fc00:f853:ccd:e793::2/64"}}}'`
+	t.Cleanup(container.Use(containertest.New(t, script)))
+}
+
+func Test_allocateSubnetIPs(t *testing.T) {
+	fakeNetwork(t)
+	oldConfig := config.DefaultConfig
+	defer func() { config.DefaultConfig = oldConfig }()
+
+	tests := []struct {
+		name    string
+		ipv4    string
+		ipv6    string
+		ip      netip.Addr
+		want    []netip.Addr
+		wantErr string
+	}{
+		{name: "no subnets"},
+		{
+			// the IPv6 address is derived from the name of the loadbalancer on a /64
+			name: "both families",
+			ipv4: "10.89.0.0/24",
+			ipv6: "fc00:f853:ccd:e793::/64",
+			want: []netip.Addr{netip.MustParseAddr("10.89.0.3"), netip.MustParseAddr("fc00:f853:ccd:e793:899:8f15:d853:9128")},
+		},
+		{
+			name: "the family of the assigned address is skipped",
+			ipv4: "10.89.0.0/24",
+			ipv6: "fc00:f853:ccd:e793::/64",
+			ip:   netip.MustParseAddr("172.18.255.10"),
+			want: []netip.Addr{netip.MustParseAddr("fc00:f853:ccd:e793:899:8f15:d853:9128")},
+		},
+		{name: "not a subnet of the network", ipv4: "10.89.0.0/16", wantErr: "is not one of the subnets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.DefaultConfig.LoadBalancerIPv4Subnet, config.DefaultConfig.LoadBalancerIPv6Subnet = netip.Prefix{}, netip.Prefix{}
+			if tt.ipv4 != "" {
+				config.DefaultConfig.LoadBalancerIPv4Subnet = netip.MustParsePrefix(tt.ipv4)
+			}
+			if tt.ipv6 != "" {
+				config.DefaultConfig.LoadBalancerIPv6Subnet = netip.MustParsePrefix(tt.ipv6)
+			}
+			got, err := (&Server{}).allocateSubnetIPs(context.Background(), "kind", "kindccm-test", tt.ip)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("allocateSubnetIPs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("allocateSubnetIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_allocateSubnetIPsShared(t *testing.T) {
+	fakeNetwork(t)
+	oldConfig := config.DefaultConfig
+	defer func() { config.DefaultConfig = oldConfig }()
+	config.DefaultConfig.LoadBalancerIPv4Subnet = netip.MustParsePrefix("10.89.0.0/24")
+	config.DefaultConfig.LoadBalancerIPv6Subnet = netip.Prefix{}
+
+	// the containers being created are not in the network yet
+	s := &Server{}
+	first, err := s.allocateSubnetIPs(context.Background(), "kind", "kindccm-a", netip.Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.allocateSubnetIPs(context.Background(), "kind", "kindccm-b", netip.Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []netip.Addr{netip.MustParseAddr("10.89.0.3")}; !reflect.DeepEqual(first, want) {
+		t.Errorf("allocateSubnetIPs() = %v, want %v", first, want)
+	}
+	if want := []netip.Addr{netip.MustParseAddr("10.89.0.4")}; !reflect.DeepEqual(second, want) {
+		t.Errorf("allocateSubnetIPs() = %v, want %v", second, want)
+	}
+
+	// the address is free once the loadbalancer releases it
+	s.releaseIPs("kindccm-a")
+	third, err := s.allocateSubnetIPs(context.Background(), "kind", "kindccm-c", netip.Addr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(third, first) {
+		t.Errorf("allocateSubnetIPs() = %v, want the released address %v", third, first)
+	}
+}
+
+func Test_inConfiguredSubnet(t *testing.T) {
+	oldConfig := config.DefaultConfig
+	defer func() { config.DefaultConfig = oldConfig }()
+	config.DefaultConfig.LoadBalancerIPv4Subnet = netip.MustParsePrefix("10.89.0.0/24")
+	config.DefaultConfig.LoadBalancerIPv6Subnet = netip.Prefix{}
+
+	for addr, want := range map[string]bool{
+		"10.89.0.7":             true,
+		"172.18.0.7":            false,
+		"fc00:f853:ccd:e793::7": true,
+	} {
+		if got := inConfiguredSubnet(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("inConfiguredSubnet(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package loadbalancer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// SecretGetter returns the Secret with the namespace and name.
+type SecretGetter func(namespace, name string) (*v1.Secret, error)
+
+// tlsCertificate is the certificate the loadbalancer presents on the ports that terminate TLS
+type tlsCertificate struct {
+	// CertificateChain is the PEM encoded certificate chain
+	CertificateChain string
+	// PrivateKey is the PEM encoded private key
+	PrivateKey string
+}
+
+// SetSecretGetter sets the function used to get the Secrets referenced by the TLS secret
+// annotation, the Services that reference one fail to update until it is set.
+func (s *Server) SetSecretGetter(getter SecretGetter) {
+	s.secretGetter = getter
+}
+
+// tlsCertificate returns the certificate of the Secret referenced by the Service, nil if it
+// does not terminate TLS. A missing or invalid Secret is an error, the ports of the Service must
+// not be served in plain text.
+func (s *Server) tlsCertificate(service *v1.Service) (*tlsCertificate, error) {
+	name := service.Annotations[constants.TLSSecretAnnotationKey]
+	if name == "" {
+		return nil, nil
+	}
+	if s.secretGetter == nil {
+		return nil, fmt.Errorf("the Secrets are not available, Service %s/%s can not terminate TLS", service.Namespace, service.Name)
+	}
+	secret, err := s.secretGetter(service.Namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the TLS Secret %s/%s of Service %s: %w", service.Namespace, name, service.Name, err)
+	}
+	return parseTLSSecret(secret)
+}
+
+// parseTLSSecret returns the certificate of a Secret with the keys of the kubernetes.io/tls type
+func parseTLSSecret(secret *v1.Secret) (*tlsCertificate, error) {
+	chain, key := secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey]
+	if len(chain) == 0 || len(key) == 0 {
+		return nil, fmt.Errorf("TLS Secret %s/%s must have the keys %s and %s", secret.Namespace, secret.Name, v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+	// envoy rejects the whole configuration if the certificate is invalid
+	if _, err := tls.X509KeyPair(chain, key); err != nil {
+		return nil, fmt.Errorf("invalid certificate in TLS Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return &tlsCertificate{CertificateChain: string(chain), PrivateKey: string(key)}, nil
+}
+
+// tlsPortSelected returns true if the Service port terminates TLS, the TLS ports annotation
+// lists the port numbers or names and all the TCP ports terminate TLS if it is not set.
+func tlsPortSelected(service *v1.Service, port v1.ServicePort) bool {
+	if port.Protocol != v1.ProtocolTCP {
+		return false
+	}
+	value, ok := service.Annotations[constants.TLSPortsAnnotationKey]
+	if !ok {
+		return true
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if tlsPortMatches(entry, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsPortMatches returns true if the entry of the TLS ports annotation is the number or the name of the port
+func tlsPortMatches(entry string, port v1.ServicePort) bool {
+	return entry == strconv.Itoa(int(port.Port)) || (port.Name != "" && entry == port.Name)
+}
+
+// setTLS configures the certificate on the listeners of the Service ports that terminate TLS
+func setTLS(config *proxyConfigData, service *v1.Service, certificate *tlsCertificate) {
+	if config == nil || certificate == nil {
+		return
+	}
+	warnUnknownTLSPorts(service)
+	config.TLSCertificate = certificate
+	for _, ipFamily := range service.Spec.IPFamilies {
+		for _, port := range service.Spec.Ports {
+			key := fmt.Sprintf("%s_%d_%s", ipFamily, port.Port, port.Protocol)
+			sp, ok := config.ServicePorts[key]
+			if !ok || !tlsPortSelected(service, port) {
+				continue
+			}
+			sp.TLS = true
+			config.ServicePorts[key] = sp
+		}
+	}
+}
+
+// warnUnknownTLSPorts logs the entries of the TLS ports annotation that are not TCP ports of the Service
+func warnUnknownTLSPorts(service *v1.Service) {
+	value, ok := service.Annotations[constants.TLSPortsAnnotationKey]
+	if !ok {
+		return
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		found := false
+		for _, port := range service.Spec.Ports {
+			if port.Protocol == v1.ProtocolTCP && tlsPortMatches(entry, port) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			klog.Warningf("service %s/%s annotation %s lists %q that is not a TCP port of the Service",
+				service.Namespace, service.Name, constants.TLSPortsAnnotationKey, entry)
+		}
+	}
+}
+
+// redactPrivateKey replaces the private key of the certificate in the rendered configuration,
+// so it can be logged. The lines of the key are replaced one by one, the override merge can
+// change how the key is quoted.
+func redactPrivateKey(config string, certificate *tlsCertificate) string {
+	if certificate == nil {
+		return config
+	}
+	for _, line := range strings.Split(certificate.PrivateKey, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-----") {
+			continue
+		}
+		config = strings.ReplaceAll(config, line, "[redacted]")
+	}
+	return config
+}
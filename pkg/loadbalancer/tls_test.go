@@ -0,0 +1,161 @@
+package loadbalancer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// selfSignedCertificate returns a PEM encoded certificate and private key
+func selfSignedCertificate(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func Test_parseTLSSecret(t *testing.T) {
+	cert, key := selfSignedCertificate(t)
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: map[string][]byte{v1.TLSCertKey: cert, v1.TLSPrivateKeyKey: key},
+		},
+		{
+			name:    "missing key",
+			data:    map[string][]byte{v1.TLSCertKey: cert},
+			wantErr: true,
+		},
+		{
+			name:    "invalid certificate",
+			data:    map[string][]byte{v1.TLSCertKey: []byte("not a certificate"), v1.TLSPrivateKeyKey: key},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "test"}, Data: tt.data}
+			got, err := parseTLSSecret(secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTLSSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.CertificateChain != string(cert) || got.PrivateKey != string(key)) {
+				t.Errorf("parseTLSSecret() = %+v, want the data of the Secret", got)
+			}
+		})
+	}
+}
+
+func Test_setTLS(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]bool
+	}{
+		{
+			name: "all TCP ports by default",
+			want: map[string]bool{"IPv4_443_TCP": true, "IPv4_8443_TCP": true, "IPv4_53_UDP": false},
+		},
+		{
+			name:        "ports by number and name",
+			annotations: map[string]string{constants.TLSPortsAnnotationKey: "443, admin"},
+			want:        map[string]bool{"IPv4_443_TCP": true, "IPv4_8443_TCP": true, "IPv4_53_UDP": false},
+		},
+		{
+			name:        "selected port",
+			annotations: map[string]string{constants.TLSPortsAnnotationKey: "443"},
+			want:        map[string]bool{"IPv4_443_TCP": true, "IPv4_8443_TCP": false, "IPv4_53_UDP": false},
+		},
+		{
+			name:        "UDP ports are ignored",
+			annotations: map[string]string{constants.TLSPortsAnnotationKey: "53"},
+			want:        map[string]bool{"IPv4_443_TCP": false, "IPv4_8443_TCP": false, "IPv4_53_UDP": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test", Annotations: tt.annotations},
+				Spec: v1.ServiceSpec{
+					IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+					Ports: []v1.ServicePort{
+						{Name: "https", Port: 443, Protocol: v1.ProtocolTCP, NodePort: 30443},
+						{Name: "admin", Port: 8443, Protocol: v1.ProtocolTCP, NodePort: 30843},
+						{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP, NodePort: 30053},
+					},
+				},
+			}
+			config := generateConfig(service, []*v1.Node{makeNode("a", "10.0.0.1")})
+			setTLS(config, service, &tlsCertificate{CertificateChain: "chain", PrivateKey: "key"})
+			if config.TLSCertificate == nil {
+				t.Fatalf("setTLS() did not set the certificate")
+			}
+			for key, want := range tt.want {
+				if got := config.ServicePorts[key].TLS; got != want {
+					t.Errorf("port %s TLS = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_proxyConfigTLS(t *testing.T) {
+	cert, key := selfSignedCertificate(t)
+	certificate := &tlsCertificate{CertificateChain: string(cert), PrivateKey: string(key)}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+		Spec: v1.ServiceSpec{
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			Ports:      []v1.ServicePort{{Port: 443, Protocol: v1.ProtocolTCP, NodePort: 30443}},
+		},
+	}
+	config := generateConfig(service, []*v1.Node{makeNode("a", "10.0.0.1")})
+	setTLS(config, service, certificate)
+	lds, err := proxyConfig(proxyLDSConfigTemplate, config)
+	if err != nil {
+		t.Fatalf("proxyConfig() error = %v", err)
+	}
+	if !strings.Contains(lds, "envoy.transport_sockets.tls") {
+		t.Errorf("expected the TLS transport socket in the listeners:\n%s", lds)
+	}
+	redacted := redactPrivateKey(lds, certificate)
+	if !strings.Contains(redacted, "[redacted]") || strings.Contains(redacted, strings.Split(string(key), "\n")[1]) {
+		t.Errorf("expected the private key to be redacted:\n%s", redacted)
+	}
+	if !strings.Contains(redacted, strings.Split(string(cert), "\n")[1]) {
+		t.Errorf("expected the certificate chain to be kept:\n%s", redacted)
+	}
+}
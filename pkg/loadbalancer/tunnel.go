@@ -1,6 +1,7 @@
 package loadbalancer
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -23,17 +24,17 @@ func NewTunnelManager() *tunnelManager {
 	return t
 }
 
-func (t *tunnelManager) setupTunnels(containerName string) error {
+func (t *tunnelManager) setupTunnels(ctx context.Context, containerName string) error {
 	// get the portmapping from the container and its internal IPs and forward them
 	// 1. Create the fake IP on the tunnel interface
 	// 2. Capture the traffic directed to that IP port and forward to the exposed port in the host
-	portmaps, err := container.PortMaps(containerName)
+	portmaps, err := container.PortMaps(ctx, containerName)
 	if err != nil {
 		return err
 	}
 	klog.V(0).Infof("found port maps %v associated to container %s", portmaps, containerName)
 
-	ipv4, _, err := container.IPs(containerName)
+	ipv4, _, err := container.IPs(ctx, containerName)
 	if err != nil {
 		return err
 	}
@@ -44,12 +45,17 @@ func (t *tunnelManager) setupTunnels(containerName string) error {
 		return err
 	}
 
-	// create tunnel from the ip:svcport to the localhost:portmap
+	// create tunnel from the ip:svcport to the localhost:portmap, the ports of a remote
+	// container runtime are published on its host
+	remoteHost := "localhost"
+	if host := container.RemoteHost(); host != "" {
+		remoteHost = host
+	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	// There is one IP per Service and a tunnel per Service Port
 	for containerPort, hostPort := range portmaps {
-		tun := NewTunnel(ipv4, containerPort, "localhost", hostPort)
+		tun := NewTunnel(ipv4, containerPort, remoteHost, hostPort)
 		// TODO check if we can leak tunnels
 		err = tun.Start()
 		if err != nil {
@@ -0,0 +1,101 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// supportedAnnotations are the Service annotations with the annotation prefix that the loadbalancers implement
+var supportedAnnotations = sets.New(
+	constants.ProxyProtocolAnnotationKey,
+	constants.IdleTimeoutAnnotationKey,
+	constants.TCPKeepaliveAnnotationKey,
+	constants.LoadBalancerIPAnnotationKey,
+	constants.HostPortsAnnotationKey,
+	constants.AdditionalNetworksAnnotationKey,
+	constants.HostnameAnnotationKey,
+	constants.ProxyConfigOverrideAnnotationKey,
+	constants.HealthCheckProtocolAnnotationKey,
+	constants.HealthCheckPathAnnotationKey,
+	constants.HealthCheckExpectedStatusAnnotationKey,
+	constants.BackendWeightsAnnotationKey,
+	constants.DisabledAnnotationKey,
+	constants.ExtraHostsAnnotationKey,
+	constants.DNSServersAnnotationKey,
+	constants.TrafficPolicyAnnotationKey,
+	constants.TLSSecretAnnotationKey,
+	constants.TLSPortsAnnotationKey,
+	constants.AssignedIPAnnotationKey,
+)
+
+// sharedIgnoredAnnotations are ignored by the loadbalancer shared by all the Services, they would affect all of them
+var sharedIgnoredAnnotations = sets.New(
+	constants.LoadBalancerIPAnnotationKey,
+	constants.HostPortsAnnotationKey,
+	constants.AdditionalNetworksAnnotationKey,
+	constants.DisabledAnnotationKey,
+	constants.ExtraHostsAnnotationKey,
+	constants.DNSServersAnnotationKey,
+)
+
+// directSupportedAnnotations are the only annotations implemented with direct routing, kube-proxy forwards the traffic
+var directSupportedAnnotations = sets.New(
+	constants.LoadBalancerIPAnnotationKey,
+	constants.AssignedIPAnnotationKey,
+)
+
+// UnsupportedFeature is a feature requested by a Service that the loadbalancer does not implement
+type UnsupportedFeature struct {
+	// Reason is the reason of the Warning Event reported on the Service
+	Reason string
+	// Message describes what is ignored
+	Message string
+}
+
+// UnsupportedFeatures returns the features requested by the Service that are ignored by the
+// loadbalancers with the current configuration: the ports with protocols that are not forwarded,
+// the unknown annotations with the annotation prefix and the annotations that do not apply.
+func UnsupportedFeatures(service *v1.Service) []UnsupportedFeature {
+	features := []UnsupportedFeature{}
+	for _, port := range service.Spec.Ports {
+		if !IsProtocolSupported(port.Protocol) {
+			features = append(features, UnsupportedFeature{
+				Reason:  "UnsupportedPortProtocol",
+				Message: fmt.Sprintf("Port %q %d/%s is not forwarded by the load balancer, only TCP and UDP are supported", port.Name, port.Port, port.Protocol),
+			})
+		}
+	}
+	keys := []string{}
+	for key := range service.Annotations {
+		if strings.HasPrefix(key, constants.AnnotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	// the Events of the same Service are recorded in a stable order
+	sort.Strings(keys)
+	for _, key := range keys {
+		var reason string
+		switch {
+		case !supportedAnnotations.Has(key):
+			reason = "is not supported"
+		case config.DefaultConfig.LoadBalancerDirectRouting && !directSupportedAnnotations.Has(key):
+			reason = "is not supported with direct routing"
+		case config.DefaultConfig.EnableSharedLoadBalancer && sharedIgnoredAnnotations.Has(key):
+			reason = "is not supported by the shared load balancer"
+		default:
+			continue
+		}
+		features = append(features, UnsupportedFeature{
+			Reason:  "UnsupportedAnnotation",
+			Message: fmt.Sprintf("Annotation %s %s, it is ignored", key, reason),
+		})
+	}
+	return features
+}
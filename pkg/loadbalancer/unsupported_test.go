@@ -0,0 +1,78 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func TestUnsupportedFeatures(t *testing.T) {
+	oldConfig := config.DefaultConfig
+	defer func() { config.DefaultConfig = oldConfig }()
+
+	service := func(annotations map[string]string, protocols ...v1.Protocol) *v1.Service {
+		s := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: annotations}}
+		for i, protocol := range protocols {
+			s.Spec.Ports = append(s.Spec.Ports, v1.ServicePort{Name: string(protocol), Port: int32(80 + i), Protocol: protocol})
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		shared  bool
+		direct  bool
+		service *v1.Service
+		want    []string
+	}{
+		{
+			name:    "supported",
+			service: service(map[string]string{constants.IdleTimeoutAnnotationKey: "1m", "other.io/key": "value"}, v1.ProtocolTCP, v1.ProtocolUDP),
+		},
+		{
+			name:    "unsupported protocol",
+			service: service(nil, v1.ProtocolTCP, v1.ProtocolSCTP),
+			want:    []string{`UnsupportedPortProtocol: Port "SCTP" 81/SCTP is not forwarded by the load balancer, only TCP and UDP are supported`},
+		},
+		{
+			name: "unknown annotations",
+			service: service(map[string]string{
+				constants.AnnotationPrefix + "proxy-protcol": "v2",
+				constants.AnnotationPrefix + "cross-zone":    "true",
+			}, v1.ProtocolTCP),
+			want: []string{
+				"UnsupportedAnnotation: Annotation loadbalancer.kind.sigs.k8s.io/cross-zone is not supported, it is ignored",
+				"UnsupportedAnnotation: Annotation loadbalancer.kind.sigs.k8s.io/proxy-protcol is not supported, it is ignored",
+			},
+		},
+		{
+			name:    "shared loadbalancer",
+			shared:  true,
+			service: service(map[string]string{constants.HostPortsAnnotationKey: "true", constants.IdleTimeoutAnnotationKey: "1m"}, v1.ProtocolTCP),
+			want:    []string{"UnsupportedAnnotation: Annotation loadbalancer.kind.sigs.k8s.io/host-ports is not supported by the shared load balancer, it is ignored"},
+		},
+		{
+			name:    "direct routing",
+			direct:  true,
+			service: service(map[string]string{constants.LoadBalancerIPAnnotationKey: "172.18.255.10", constants.ProxyProtocolAnnotationKey: "v2"}, v1.ProtocolTCP),
+			want:    []string{"UnsupportedAnnotation: Annotation loadbalancer.kind.sigs.k8s.io/proxy-protocol is not supported with direct routing, it is ignored"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.DefaultConfig.EnableSharedLoadBalancer = tt.shared
+			config.DefaultConfig.LoadBalancerDirectRouting = tt.direct
+			got := []string{}
+			for _, feature := range UnsupportedFeatures(tt.service) {
+				got = append(got, feature.Reason+": "+feature.Message)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("UnsupportedFeatures() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
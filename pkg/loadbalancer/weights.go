@@ -0,0 +1,82 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+const (
+	// defaultBackendWeight is the weight of the backends whose node or zone is not listed
+	defaultBackendWeight = 1
+	// maxBackendWeight limits the weights so their sum fits in the envoy limits
+	maxBackendWeight = 1000
+	// zoneWeightPrefix prefixes the zones in the backend weights, the node names can not contain a slash
+	zoneWeightPrefix = "zone/"
+)
+
+// backendWeights are the weights of the backends of a Service by node and by zone
+type backendWeights struct {
+	nodes map[string]int
+	zones map[string]int
+}
+
+// parseBackendWeights returns the backend weights of the Service annotation, nil means that
+// the backends are not weighted. An invalid annotation is ignored.
+func parseBackendWeights(service *v1.Service) *backendWeights {
+	value, ok := service.Annotations[constants.BackendWeightsAnnotationKey]
+	if !ok {
+		return nil
+	}
+	weights, err := parseWeights(value)
+	if err != nil {
+		klog.Warningf("service %s/%s annotation %s has an invalid value %q: %v",
+			service.Namespace, service.Name, constants.BackendWeightsAnnotationKey, value, err)
+		return nil
+	}
+	return weights
+}
+
+func parseWeights(value string) (*backendWeights, error) {
+	weights := &backendWeights{nodes: map[string]int{}, zones: map[string]int{}}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, w, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || name == zoneWeightPrefix {
+			return nil, fmt.Errorf("entry %q must be in the form node=weight or %szone=weight", entry, zoneWeightPrefix)
+		}
+		weight, err := strconv.Atoi(w)
+		if err != nil || weight < 1 || weight > maxBackendWeight {
+			return nil, fmt.Errorf("weight of %q must be a number between 1 and %d", name, maxBackendWeight)
+		}
+		if zone, ok := strings.CutPrefix(name, zoneWeightPrefix); ok {
+			weights.zones[zone] = weight
+		} else {
+			weights.nodes[name] = weight
+		}
+	}
+	return weights, nil
+}
+
+// weight returns the weight of the backends on the node, the weight of the node takes precedence
+// over the weight of its zone. It returns zero if the backends are not weighted.
+func (w *backendWeights) weight(node, zone string) int {
+	if w == nil {
+		return 0
+	}
+	if weight, ok := w.nodes[node]; ok && node != "" {
+		return weight
+	}
+	if weight, ok := w.zones[zone]; ok && zone != "" {
+		return weight
+	}
+	return defaultBackendWeight
+}
@@ -0,0 +1,94 @@
+package loadbalancer
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_parseWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *backendWeights
+		wantErr bool
+	}{
+		{
+			name:  "nodes and zones",
+			value: "kind-worker=3, zone/zone-b=2,",
+			want:  &backendWeights{nodes: map[string]int{"kind-worker": 3}, zones: map[string]int{"zone-b": 2}},
+		},
+		{name: "missing weight", value: "kind-worker", wantErr: true},
+		{name: "empty zone", value: "zone/=2", wantErr: true},
+		{name: "zero weight", value: "kind-worker=0", wantErr: true},
+		{name: "too big", value: "kind-worker=1001", wantErr: true},
+		{name: "not a number", value: "kind-worker=high", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWeights(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWeights() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWeights() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_generateConfigWeights(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Namespace:   "default",
+			Annotations: map[string]string{constants.BackendWeightsAnnotationKey: "kind-worker=5,zone/zone-b=2"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:       v1.ServiceTypeLoadBalancer,
+			IPFamilies: []v1.IPFamily{v1.IPv4Protocol},
+			Ports:      []v1.ServicePort{{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	node := func(name, zone, ip string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{v1.LabelTopologyZone: zone}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: ip}}},
+		}
+	}
+	nodes := []*v1.Node{
+		// the node weight takes precedence over the zone
+		node("kind-worker", "zone-b", "10.0.0.1"),
+		node("kind-worker2", "zone-b", "10.0.0.2"),
+		node("kind-worker3", "zone-a", "10.0.0.3"),
+	}
+	config := generateConfig(service, nodes)
+	if !config.Weighted {
+		t.Errorf("expected the config to be weighted")
+	}
+	want := map[endpoint]int{
+		{"10.0.0.1", 30080, "TCP"}: 5,
+		{"10.0.0.2", 30080, "TCP"}: 2,
+		{"10.0.0.3", 30080, "TCP"}: defaultBackendWeight,
+	}
+	if got := config.ServicePorts["IPv4_80_TCP"].Weights; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected weights %v, got %v", want, got)
+	}
+
+	// the weights are recomputed with the current nodes
+	config = generateConfig(service, nodes[1:])
+	if got := len(config.ServicePorts["IPv4_80_TCP"].Weights); got != 2 {
+		t.Errorf("expected 2 weights, got %d", got)
+	}
+
+	// an invalid annotation is ignored
+	service.Annotations[constants.BackendWeightsAnnotationKey] = "kind-worker=0"
+	config = generateConfig(service, nodes)
+	if config.Weighted || config.ServicePorts["IPv4_80_TCP"].Weights != nil {
+		t.Errorf("expected the config to not be weighted")
+	}
+}
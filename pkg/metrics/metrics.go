@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"sync"
+
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const namespace = "cpk"
+
+var (
+	once sync.Once
+
+	// LoadBalancerImageReady is 1 once the loadbalancer image is present on the host
+	LoadBalancerImageReady = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "loadbalancer_image_ready",
+			Help:           "Indicates if the load balancer image is available on the host",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+	)
+
+	// LoadBalancerContainers is the number of loadbalancer containers per cluster
+	LoadBalancerContainers = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "loadbalancer_containers_total",
+			Help:           "Number of load balancer containers by cluster",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster"},
+	)
+
+	// LoadBalancerProvisionDuration is the time it takes to provision a loadbalancer
+	LoadBalancerProvisionDuration = k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Namespace:      namespace,
+			Name:           "loadbalancer_provision_duration_seconds",
+			Help:           "Time in seconds to ensure a load balancer by cluster",
+			Buckets:        k8smetrics.ExponentialBuckets(0.25, 2, 10),
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster"},
+	)
+
+	// LoadBalancerReconcileErrors is the number of errors reconciling loadbalancers
+	LoadBalancerReconcileErrors = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "loadbalancer_reconcile_errors_total",
+			Help:           "Number of errors reconciling load balancers by cluster and reason",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster", "reason"},
+	)
+
+	// LoadBalancerRepairs is the number of loadbalancers repaired after diverging from their Service
+	LoadBalancerRepairs = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "loadbalancer_repairs_total",
+			Help:           "Number of repairs of load balancers modified outside of cloud-provider-kind by cluster and action",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster", "action"},
+	)
+
+	// LoadBalancerIPPoolUsed is the number of addresses in use of the pool the loadbalancer addresses are assigned from
+	LoadBalancerIPPoolUsed = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "lb_ip_pool_used",
+			Help:           "Number of addresses in use of the load balancer address pool by cluster and network",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster", "network"},
+	)
+
+	// LoadBalancerIPPoolAvailable is the number of free addresses of the pool the loadbalancer addresses are assigned from
+	LoadBalancerIPPoolAvailable = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "lb_ip_pool_available",
+			Help:           "Number of free addresses of the load balancer address pool by cluster and network",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster", "network"},
+	)
+
+	// LoadBalancerContainerCPUUsage is the CPU usage in cores of the loadbalancer containers
+	LoadBalancerContainerCPUUsage = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "lb_container_cpu_usage",
+			Help:           "CPU usage in cores of the load balancer containers by cluster and service, the service is empty for the shared load balancer",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster", "service"},
+	)
+
+	// LoadBalancerContainerMemoryBytes is the memory usage of the loadbalancer containers
+	LoadBalancerContainerMemoryBytes = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "lb_container_memory_bytes",
+			Help:           "Memory usage in bytes of the load balancer containers by cluster and service, the service is empty for the shared load balancer",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster", "service"},
+	)
+
+	// ClusterDegraded is 1 if the apiserver of the cluster is unreachable after repeated attempts
+	ClusterDegraded = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "cluster_degraded",
+			Help:           "Indicates if the cloud controller manager of the cluster can not be started after repeated attempts",
+			StabilityLevel: k8smetrics.ALPHA,
+		},
+		[]string{"cluster"},
+	)
+)
+
+// Reasons of the loadbalancer reconcile errors
+const (
+	ReasonEnsure = "ensure"
+	ReasonUpdate = "update"
+	ReasonDelete = "delete"
+	ReasonRepair = "repair"
+)
+
+// Register the cloud-provider-kind metrics.
+func Register() {
+	once.Do(func() {
+		legacyregistry.MustRegister(LoadBalancerImageReady)
+		legacyregistry.MustRegister(LoadBalancerContainers)
+		legacyregistry.MustRegister(LoadBalancerProvisionDuration)
+		legacyregistry.MustRegister(LoadBalancerReconcileErrors)
+		legacyregistry.MustRegister(LoadBalancerRepairs)
+		legacyregistry.MustRegister(ClusterDegraded)
+		legacyregistry.MustRegister(LoadBalancerIPPoolUsed)
+		legacyregistry.MustRegister(LoadBalancerIPPoolAvailable)
+		legacyregistry.MustRegister(LoadBalancerContainerCPUUsage)
+		legacyregistry.MustRegister(LoadBalancerContainerMemoryBytes)
+	})
+}
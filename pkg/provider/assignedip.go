@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// assignedIPs returns the comma-separated addresses of the loadbalancer status, the ingress
+// entries with only a hostname are not included.
+func assignedIPs(status *v1.LoadBalancerStatus) string {
+	if status == nil {
+		return ""
+	}
+	var ips []string
+	for _, ingress := range status.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return strings.Join(ips, ",")
+}
+
+// setAssignedIPAnnotation sets the addresses of the loadbalancer in the assigned IP annotation of
+// the Service, and removes it if value is empty. The service controller syncs the Service again
+// when its annotations change, the Service is only patched if the value is different so the
+// next sync does not patch it again.
+func (c *cloud) setAssignedIPAnnotation(ctx context.Context, service *v1.Service, value string) {
+	if c.kubeClient == nil || service == nil {
+		return
+	}
+	if service.Annotations[constants.AssignedIPAnnotationKey] == value {
+		return
+	}
+	// a merge patch with a null value removes the annotation
+	var annotation interface{}
+	if value != "" {
+		annotation = value
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{constants.AssignedIPAnnotationKey: annotation},
+		},
+	})
+	if err != nil {
+		return
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.V(2).InfoS("Could not update the Service assigned IP annotation", "service", klog.KObj(service), "err", err)
+	}
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func Test_assignedIPs(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *v1.LoadBalancerStatus
+		want   string
+	}{
+		{name: "nil"},
+		{name: "dual stack", status: &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "192.168.8.10"}, {IP: "fc00:f853:ccd:e793::10"}}}, want: "192.168.8.10,fc00:f853:ccd:e793::10"},
+		{name: "hostname only", status: &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{Hostname: "docker.example.com"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := assignedIPs(tt.status); got != tt.want {
+				t.Errorf("assignedIPs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setAssignedIPAnnotation(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{"other": "value"}},
+	}
+	client := fake.NewSimpleClientset(service)
+	c := &cloud{clusterName: "test", kubeClient: client}
+	get := func() *v1.Service {
+		t.Helper()
+		got, err := client.CoreV1().Services("default").Get(context.Background(), "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	c.setAssignedIPAnnotation(context.Background(), service, "192.168.8.10")
+	got := get()
+	if got.Annotations[constants.AssignedIPAnnotationKey] != "192.168.8.10" || got.Annotations["other"] != "value" {
+		t.Errorf("expected the assigned IP annotation to be set, got %v", got.Annotations)
+	}
+
+	// the next sync of the service controller sees the annotation and does not patch it again
+	client.ClearActions()
+	c.setAssignedIPAnnotation(context.Background(), got, "192.168.8.10")
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected no patch when the annotation did not change, got %v", actions)
+	}
+
+	c.setAssignedIPAnnotation(context.Background(), got, "")
+	got = get()
+	if _, ok := got.Annotations[constants.AssignedIPAnnotationKey]; ok || got.Annotations["other"] != "value" {
+		t.Errorf("expected the assigned IP annotation to be removed, got %v", got.Annotations)
+	}
+
+	// the Service is already gone when its loadbalancer is deleted
+	c.setAssignedIPAnnotation(context.Background(), &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: "default",
+		Annotations: map[string]string{constants.AssignedIPAnnotationKey: "192.168.8.11"}}}, "")
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+// GateLoadBalancerStatus withdraws the loadbalancer status of the Service when none of its backends
+// passes the health checks, so the clients do not use an address that refuses the connections, and
+// reports it again once any backend is healthy. The service controller only sets the status when
+// the Service or the nodes change, so it is restored here.
+func (c *cloud) GateLoadBalancerStatus(ctx context.Context, clusterName string, service *v1.Service) error {
+	lb, ok := c.lbController.(interface {
+		HealthyBackends(ctx context.Context, clusterName string, service *v1.Service) (int, error)
+	})
+	if !ok || c.kubeClient == nil {
+		return nil
+	}
+	healthy, err := lb.HealthyBackends(ctx, clusterName, service)
+	if err != nil {
+		return err
+	}
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	c.mu.Lock()
+	withdrawn := c.withdrawn[key]
+	c.mu.Unlock()
+
+	switch {
+	case healthy == 0 && len(service.Status.LoadBalancer.Ingress) > 0:
+		if err := c.patchLoadBalancerStatus(ctx, service, nil); err != nil {
+			return err
+		}
+		klog.InfoS("LoadBalancer status withdrawn, no backend is healthy", "cluster", clusterName, "service", klog.KObj(service))
+		c.setWithdrawn(key, true)
+		c.setReadyCondition(ctx, service, readyCondition(nil, loadbalancer.ErrNoHealthyBackends))
+		c.recordEvent(service, v1.EventTypeWarning, "LoadBalancerNoHealthyBackends",
+			"The load balancer address is withdrawn until a backend passes the health checks")
+	case healthy > 0 && withdrawn:
+		status, exists, err := c.lbController.GetLoadBalancer(ctx, clusterName, service)
+		if err != nil || !exists {
+			return err
+		}
+		if err := c.patchLoadBalancerStatus(ctx, service, status.Ingress); err != nil {
+			return err
+		}
+		klog.InfoS("LoadBalancer status restored, a backend is healthy", "cluster", clusterName, "service", klog.KObj(service))
+		c.setWithdrawn(key, false)
+		c.setReadyCondition(ctx, service, readyCondition(status, nil))
+		c.recordEvent(service, v1.EventTypeNormal, "LoadBalancerHealthyBackends",
+			"The load balancer address is reported again, %d backends pass the health checks", healthy)
+	}
+	return nil
+}
+
+// setWithdrawn records if the loadbalancer status of the Service was withdrawn
+func (c *cloud) setWithdrawn(key types.NamespacedName, withdrawn bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !withdrawn {
+		delete(c.withdrawn, key)
+		return
+	}
+	if c.withdrawn == nil {
+		c.withdrawn = map[types.NamespacedName]bool{}
+	}
+	c.withdrawn[key] = true
+}
+
+// patchLoadBalancerStatus replaces the ingress of the Service loadbalancer status, it is removed if empty
+func (c *cloud) patchLoadBalancerStatus(ctx context.Context, service *v1.Service, ingress []v1.LoadBalancerIngress) error {
+	// a merge patch replaces the whole list, and a null value removes it
+	var value interface{}
+	if len(ingress) > 0 {
+		value = ingress
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"loadBalancer": map[string]interface{}{"ingress": value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// fakeHealthLoadBalancer reports the number of healthy backends and a fixed status
+type fakeHealthLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	healthy int
+	status  *v1.LoadBalancerStatus
+}
+
+func (f *fakeHealthLoadBalancer) HealthyBackends(ctx context.Context, clusterName string, service *v1.Service) (int, error) {
+	return f.healthy, nil
+}
+
+func (f *fakeHealthLoadBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	return f.status, true, nil
+}
+
+func TestCloud_GateLoadBalancerStatus(t *testing.T) {
+	status := v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "192.168.8.10"}}}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status:     v1.ServiceStatus{LoadBalancer: status},
+	}
+	client := fake.NewSimpleClientset(service)
+	lb := &fakeHealthLoadBalancer{status: &status}
+	c := &cloud{clusterName: "test", kubeClient: client, lbController: lb}
+	ctx := context.Background()
+	get := func() *v1.Service {
+		t.Helper()
+		got, err := client.CoreV1().Services("default").Get(ctx, "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if err := c.GateLoadBalancerStatus(ctx, "test", service); err != nil {
+		t.Fatal(err)
+	}
+	got := get()
+	if len(got.Status.LoadBalancer.Ingress) != 0 {
+		t.Fatalf("expected the status to be withdrawn, got %+v", got.Status.LoadBalancer)
+	}
+	condition := meta.FindStatusCondition(got.Status.Conditions, constants.LoadBalancerReadyConditionType)
+	if condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("expected the ready condition to be false, got %+v", got.Status.Conditions)
+	}
+
+	// the status is not restored while the backends are unhealthy
+	client.ClearActions()
+	if err := c.GateLoadBalancerStatus(ctx, "test", got); err != nil {
+		t.Fatal(err)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected no patch while the backends are unhealthy, got %v", actions)
+	}
+
+	lb.healthy = 2
+	if err := c.GateLoadBalancerStatus(ctx, "test", got); err != nil {
+		t.Fatal(err)
+	}
+	got = get()
+	if len(got.Status.LoadBalancer.Ingress) != 1 || got.Status.LoadBalancer.Ingress[0].IP != "192.168.8.10" {
+		t.Errorf("expected the status to be restored, got %+v", got.Status.LoadBalancer)
+	}
+
+	// the Services that were not withdrawn are left to the service controller
+	pending := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"}}
+	client.ClearActions()
+	if err := c.GateLoadBalancerStatus(ctx, "test", pending); err != nil {
+		t.Fatal(err)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected no patch for the Service not withdrawn, got %v", actions)
+	}
+}
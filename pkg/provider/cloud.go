@@ -1,34 +1,104 @@
 package provider
 
 import (
+	"context"
+	"sync"
+
 	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
 	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/kind/pkg/cluster"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
 )
 
 func New(clusterName string, kindClient *cluster.Provider) cloudprovider.Interface {
 	return &cloud{
-		clusterName:  clusterName,
-		kindClient:   kindClient,
-		lbController: loadbalancer.NewServer(),
+		clusterName:    clusterName,
+		kindClient:     kindClient,
+		lbController:   loadbalancer.NewServer(),
+		containerState: container.State,
 	}
 }
 
 var _ cloudprovider.Interface = (*cloud)(nil)
 
+// kindClient lists the KIND clusters and their nodes, it is implemented by the KIND provider
+type kindClient interface {
+	List() ([]string, error)
+	ListNodes(name string) ([]nodes.Node, error)
+}
+
 // controller is the KIND implementation of the cloud provider interface
 type cloud struct {
 	clusterName  string // name of the kind cluster
-	kindClient   *cluster.Provider
+	kindClient   kindClient
 	lbController cloudprovider.LoadBalancer
+	// kubeClient updates the conditions of the Services, it is nil until Initialize is called
+	kubeClient kubernetes.Interface
+	// eventRecorder records the Events on the Services, it is nil until Initialize is called
+	eventRecorder record.EventRecorder
+	// containerState returns the ID and the status of the node containers
+	containerState func(ctx context.Context, name string) (id string, status string, err error)
+
+	// serviceLocks serializes the operations on the loadbalancer of each Service
+	serviceLocks serviceLocks
+
+	// mu protects withdrawn
+	mu sync.Mutex
+	// withdrawn are the Services whose status was removed because none of their backends is healthy
+	withdrawn map[types.NamespacedName]bool
 }
 
 // Initialize passes a Kubernetes clientBuilder interface to the cloud provider
 func (c *cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stopCh <-chan struct{}) {
-	// noop
+	kubeClient, err := clientBuilder.Client(constants.ProviderName)
+	if err != nil {
+		klog.ErrorS(err, "Failed to create client, events will not be recorded", "cluster", c.clusterName)
+		return
+	}
+	c.kubeClient = kubeClient
+	// the proxy config overrides are read from the ConfigMaps of the cluster
+	if lb, ok := c.lbController.(interface {
+		SetConfigMapGetter(loadbalancer.ConfigMapGetter)
+	}); ok {
+		lb.SetConfigMapGetter(func(namespace, name string) (*v1.ConfigMap, error) {
+			return kubeClient.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		})
+	}
+	// the certificates of the Services that terminate TLS are read from the Secrets of the cluster
+	if lb, ok := c.lbController.(interface {
+		SetSecretGetter(loadbalancer.SecretGetter)
+	}); ok {
+		lb.SetSecretGetter(func(namespace, name string) (*v1.Secret, error) {
+			return kubeClient.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		})
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	c.eventRecorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "cloud-provider-kind"})
+	go func() {
+		<-stopCh
+		broadcaster.Shutdown()
+	}()
+}
+
+// recordEvent records an Event on the object if the event recorder is initialized
+func (c *cloud) recordEvent(object *v1.Service, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.eventRecorder == nil || object == nil {
+		return
+	}
+	c.eventRecorder.Eventf(object, eventType, reason, messageFmt, args...)
 }
 
 // Clusters returns the list of clusters.
@@ -12,13 +12,13 @@ var _ cloudprovider.Clusters = &cloud{}
 
 // ListClusters lists the names of the available clusters.
 func (c *cloud) ListClusters(ctx context.Context) ([]string, error) {
-	klog.V(2).Infof("List clusters")
+	klog.V(2).InfoS("List clusters")
 	return c.kindClient.List()
 }
 
 // Master gets back the address (either DNS name or IP address) of the master node for the cluster.
 func (c *cloud) Master(ctx context.Context, clusterName string) (string, error) {
-	klog.V(2).Infof("Get master for %s", clusterName)
+	klog.V(2).InfoS("Get master", "cluster", clusterName)
 	clusters, err := c.kindClient.List()
 	if err != nil {
 		return "", err
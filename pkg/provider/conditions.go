@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+const (
+	// ReasonLoadBalancerReady is the reason of the ready condition once the loadbalancer serves the Service
+	ReasonLoadBalancerReady = "LoadBalancerReady"
+	// ReasonLoadBalancerNotReady is the reason of the ready condition while the loadbalancer is provisioned
+	ReasonLoadBalancerNotReady = "LoadBalancerNotReady"
+)
+
+// readyCondition returns the ready condition of the Service for the result of EnsureLoadBalancer,
+// nil if the result does not tell if the loadbalancer is serving.
+func readyCondition(status *v1.LoadBalancerStatus, err error) *metav1.Condition {
+	switch {
+	case errors.Is(err, loadbalancer.ErrNotReady):
+		return &metav1.Condition{Status: metav1.ConditionFalse, Reason: ReasonLoadBalancerNotReady, Message: err.Error()}
+	case err != nil || status == nil:
+		return nil
+	}
+	for _, ingress := range status.Ingress {
+		for _, port := range ingress.Ports {
+			if port.Error != nil && *port.Error == loadbalancer.DisabledReason {
+				return &metav1.Condition{Status: metav1.ConditionFalse, Reason: loadbalancer.DisabledReason,
+					Message: "The load balancer is disabled by the annotation " + constants.DisabledAnnotationKey}
+			}
+		}
+	}
+	return &metav1.Condition{Status: metav1.ConditionTrue, Reason: ReasonLoadBalancerReady, Message: "The load balancer is serving the Service"}
+}
+
+// setReadyCondition sets the ready condition on the Service status if it changed, the service
+// controller only updates the loadbalancer status so the condition is patched on its own.
+func (c *cloud) setReadyCondition(ctx context.Context, service *v1.Service, condition *metav1.Condition) {
+	if c.kubeClient == nil || service == nil || condition == nil {
+		return
+	}
+	condition.Type = constants.LoadBalancerReadyConditionType
+	condition.ObservedGeneration = service.Generation
+	current := meta.FindStatusCondition(service.Status.Conditions, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Reason == condition.Reason &&
+		current.Message == condition.Message && current.ObservedGeneration == condition.ObservedGeneration {
+		return
+	}
+	// keep the transition time if only the reason or the message change
+	conditions := append([]metav1.Condition{}, service.Status.Conditions...)
+	meta.SetStatusCondition(&conditions, *condition)
+	// the conditions are merged by type, the other conditions of the Service are not modified
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []metav1.Condition{*meta.FindStatusCondition(conditions, condition.Type)},
+		},
+	})
+	if err != nil {
+		return
+	}
+	_, err = c.kubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		klog.V(2).InfoS("Could not update the Service conditions", "service", klog.KObj(service), "err", err)
+	}
+}
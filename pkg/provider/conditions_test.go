@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+)
+
+func Test_readyCondition(t *testing.T) {
+	ready := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{
+		IP:    "192.168.8.10",
+		Ports: []v1.PortStatus{{Port: 80, Protocol: v1.ProtocolTCP}},
+	}}}
+	disabled := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{
+		IP:    "192.168.8.10",
+		Ports: []v1.PortStatus{{Port: 80, Protocol: v1.ProtocolTCP, Error: ptr.To(loadbalancer.DisabledReason)}},
+	}}}
+	tests := []struct {
+		name       string
+		status     *v1.LoadBalancerStatus
+		err        error
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{
+		{name: "ready", status: ready, wantStatus: metav1.ConditionTrue, wantReason: ReasonLoadBalancerReady},
+		{name: "not ready", err: fmt.Errorf("%w: listeners warming", loadbalancer.ErrNotReady), wantStatus: metav1.ConditionFalse, wantReason: ReasonLoadBalancerNotReady},
+		{name: "disabled", status: disabled, wantStatus: metav1.ConditionFalse, wantReason: loadbalancer.DisabledReason},
+		{name: "other error", err: fmt.Errorf("can not create the container")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readyCondition(tt.status, tt.err)
+			if tt.wantReason == "" {
+				if got != nil {
+					t.Errorf("readyCondition() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Status != tt.wantStatus || got.Reason != tt.wantReason {
+				t.Errorf("readyCondition() = %+v, want status %s reason %s", got, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_setReadyCondition(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 2},
+		Status: v1.ServiceStatus{Conditions: []metav1.Condition{{
+			Type:               "Other",
+			Status:             metav1.ConditionTrue,
+			Reason:             "Other",
+			LastTransitionTime: metav1.Now(),
+		}}},
+	}
+	client := fake.NewSimpleClientset(service)
+	c := &cloud{clusterName: "test", kubeClient: client}
+
+	c.setReadyCondition(context.Background(), service, readyCondition(&v1.LoadBalancerStatus{}, nil))
+	got, err := client.CoreV1().Services("default").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(got.Status.Conditions, constants.LoadBalancerReadyConditionType)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.ObservedGeneration != 2 || condition.LastTransitionTime.IsZero() {
+		t.Errorf("expected the ready condition to be set, got %+v", got.Status.Conditions)
+	}
+	if meta.FindStatusCondition(got.Status.Conditions, "Other") == nil {
+		t.Errorf("expected the other conditions to be kept, got %+v", got.Status.Conditions)
+	}
+
+	// the condition is not patched again if it does not change
+	client.ClearActions()
+	c.setReadyCondition(context.Background(), got, readyCondition(&v1.LoadBalancerStatus{}, nil))
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected no update, got %v", actions)
+	}
+
+	// the clients without a kubernetes client do nothing
+	(&cloud{}).setReadyCondition(context.Background(), service, readyCondition(&v1.LoadBalancerStatus{}, nil))
+}
@@ -9,6 +9,10 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/kind/pkg/cluster/nodes"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/config"
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
 )
 
 var _ cloudprovider.InstancesV2 = (*cloud)(nil)
@@ -17,8 +21,8 @@ var errNodeNotFound = errors.New("node not found")
 
 // InstanceExists returns true if the instance for the given node exists according to the cloud provider.
 func (c *cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
-	klog.V(2).Infof("Check if instance %s exists", node.Name)
-	_, err := c.findNodeByName(node.Name)
+	klog.V(2).InfoS("Check if instance exists", "cluster", c.clusterName, "node", klog.KObj(node))
+	_, err := c.findNode(node)
 	if err == nil {
 		return true, nil
 	}
@@ -28,30 +32,41 @@ func (c *cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error)
 	return false, err
 }
 
-// InstanceShutdown returns true of the container doesn't exist
+// InstanceShutdown returns true if the container doesn't exist or is not running,
+// per example stopped or paused, the instance still exists in that case so the
+// Node is tainted instead of deleted.
 func (c *cloud) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
-	klog.V(2).Infof("Check if instance %s is shutdown", node.Name)
-	_, err := c.findNodeByName(node.Name)
-	if err == nil {
-		return false, nil
-	}
+	klog.V(2).InfoS("Check if instance is shutdown", "cluster", c.clusterName, "node", klog.KObj(node))
+	n, err := c.findNode(node)
 	if errors.Is(err, errNodeNotFound) {
 		return true, nil
 	}
-	return false, err
+	if err != nil {
+		return false, err
+	}
+	_, status, err := c.containerState(ctx, n.String())
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case "running", "restarting":
+		return false, nil
+	default:
+		klog.V(2).InfoS("Instance is shutdown", "cluster", c.clusterName, "node", klog.KObj(node), "status", status)
+		return true, nil
+	}
 }
 
 // InstanceMetadata returns the instance's metadata. The values returned in InstanceMetadata are
 // translated into specific fields and labels in the Node object on registration.
 func (c *cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	klog.V(2).Infof("Check instance metadata for %s", node.Name)
-	n, err := c.findNodeByName(node.Name)
+	klog.V(2).InfoS("Check instance metadata", "cluster", c.clusterName, "node", klog.KObj(node))
+	n, err := c.findNode(node)
 	if err != nil {
 		return nil, err
 	}
 	m := &cloudprovider.InstanceMetadata{
-		// TODO: podman support
-		ProviderID:   fmt.Sprintf("kind://%s/kind/%s", c.clusterName, n.String()), // providerID: kind://<cluster-name>/kind/<node-name>
+		ProviderID:   providerID(c.clusterName, n.String()),
 		InstanceType: "kind-node",
 		NodeAddresses: []v1.NodeAddress{
 			{
@@ -59,32 +74,89 @@ func (c *cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprov
 				Address: n.String(),
 			},
 		},
-		Zone:   "",
-		Region: "",
+		Zone:   nodeTopology(ctx, node, n, constants.NodeZoneLabelKey, constants.NodeZoneContainerLabelKey),
+		Region: nodeTopology(ctx, node, n, constants.NodeRegionLabelKey, constants.NodeRegionContainerLabelKey),
 	}
+	addresses, err := nodeAddresses(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	m.NodeAddresses = append(m.NodeAddresses, addresses...)
+	klog.V(2).InfoS("Instance metadata", "cluster", c.clusterName, "node", klog.KObj(node), "metadata", m)
+	return m, nil
+}
+
+// nodeTopology returns the value of the Node label, or the node container label if not set,
+// so different zones and regions can be assigned to the nodes of a cluster.
+func nodeTopology(ctx context.Context, node *v1.Node, n nodes.Node, nodeLabel string, containerLabel string) string {
+	if v, ok := node.Labels[nodeLabel]; ok {
+		return v
+	}
+	v, err := container.GetLabelValue(ctx, n.String(), containerLabel)
+	if err != nil || v == "<no value>" {
+		return ""
+	}
+	return v
+}
+
+// nodeAddresses returns the container IPs of the node as InternalIP, and the
+// addresses the node is reachable from the host as ExternalIP: the container IPs
+// if there is direct connectivity, or the loopback address if the node has ports
+// mapped on the host.
+func nodeAddresses(ctx context.Context, n nodes.Node) ([]v1.NodeAddress, error) {
 	ipv4, ipv6, err := n.IP()
 	if err != nil {
 		return nil, err
 	}
-	if ipv4 != "" {
-		m.NodeAddresses = append(m.NodeAddresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ipv4})
+	addresses := []v1.NodeAddress{}
+	for _, ip := range []string{ipv4, ipv6} {
+		if ip != "" {
+			addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ip})
+		}
 	}
-	if ipv6 != "" {
-		m.NodeAddresses = append(m.NodeAddresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ipv6})
+	if config.DefaultConfig.ControlPlaneConnectivity == config.Direct {
+		for _, ip := range []string{ipv4, ipv6} {
+			if ip != "" {
+				addresses = append(addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: ip})
+			}
+		}
+		return addresses, nil
 	}
-	klog.V(2).Infof("instance metadata for %s: %#v", node.Name, m)
-	return m, nil
+	portmaps, err := container.PortMaps(ctx, n.String())
+	if err != nil {
+		klog.V(2).InfoS("Could not get the node port maps", "container", n.String(), "err", err)
+		return addresses, nil
+	}
+	if len(portmaps) > 0 {
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: "127.0.0.1"})
+	}
+	return addresses, nil
+}
+
+// findNode returns the KIND node of the Node, using the ProviderID if it is set
+func (c *cloud) findNode(node *v1.Node) (nodes.Node, error) {
+	if node.Spec.ProviderID == "" {
+		return c.findNodeByName(node.Name)
+	}
+	clusterName, nodeName, err := parseProviderID(node.Spec.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if clusterName != c.clusterName {
+		return nil, fmt.Errorf("node %s belongs to cluster %s: %w", node.Name, clusterName, errNodeNotFound)
+	}
+	return c.findNodeByName(nodeName)
 }
 
 func (c *cloud) findNodeByName(name string) (nodes.Node, error) {
 	nodes, err := c.kindClient.ListNodes(c.clusterName)
 	if err != nil {
-		return nil, fmt.Errorf("no nodes founds")
+		return nil, fmt.Errorf("no nodes founds: %w", err)
 	}
 	for _, n := range nodes {
 		if n.String() == name {
 			return n, nil
 		}
 	}
-	return nil, fmt.Errorf("node with name %s does not exist on cluster %s", name, c.clusterName)
+	return nil, fmt.Errorf("node with name %s does not exist on cluster %s: %w", name, c.clusterName, errNodeNotFound)
 }
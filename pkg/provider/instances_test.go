@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// fakeNode is a KIND node that only implements the name and the addresses
+type fakeNode struct {
+	name string
+	ipv4 string
+	ipv6 string
+}
+
+func (n *fakeNode) String() string                                             { return n.name }
+func (n *fakeNode) Role() (string, error)                                      { return "worker", nil }
+func (n *fakeNode) IP() (string, string, error)                                { return n.ipv4, n.ipv6, nil }
+func (n *fakeNode) SerialLogs(writer io.Writer) error                          { return nil }
+func (n *fakeNode) Command(string, ...string) exec.Cmd                         { return nil }
+func (n *fakeNode) CommandContext(context.Context, string, ...string) exec.Cmd { return nil }
+
+// fakeKindClient returns the nodes of the clusters, the key is the cluster name
+type fakeKindClient map[string][]nodes.Node
+
+func (f fakeKindClient) List() ([]string, error) {
+	clusters := []string{}
+	for name := range f {
+		clusters = append(clusters, name)
+	}
+	return clusters, nil
+}
+
+func (f fakeKindClient) ListNodes(name string) ([]nodes.Node, error) {
+	return f[name], nil
+}
+
+// fakeContainerState returns the same status for all the containers
+func fakeContainerState(status string) func(ctx context.Context, name string) (string, string, error) {
+	return func(ctx context.Context, name string) (string, string, error) {
+		return "id-" + name, status, nil
+	}
+}
+
+func TestInstanceExists(t *testing.T) {
+	client := fakeKindClient{
+		"test": []nodes.Node{
+			&fakeNode{name: "test-control-plane", ipv4: "192.168.8.2"},
+			&fakeNode{name: "test-worker", ipv4: "192.168.8.3"},
+		},
+	}
+	c := &cloud{clusterName: "test", kindClient: client, containerState: fakeContainerState("running")}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-worker"}}
+
+	exists, err := c.InstanceExists(context.Background(), node)
+	if err != nil || !exists {
+		t.Fatalf("expected node to exist, got %v : %v", exists, err)
+	}
+	shutdown, err := c.InstanceShutdown(context.Background(), node)
+	if err != nil || shutdown {
+		t.Fatalf("expected node to not be shutdown, got %v : %v", shutdown, err)
+	}
+
+	// remove the worker container
+	client["test"] = client["test"][:1]
+	exists, err = c.InstanceExists(context.Background(), node)
+	if err != nil || exists {
+		t.Fatalf("expected node to not exist, got %v : %v", exists, err)
+	}
+}
+
+func TestInstanceMetadataProviderID(t *testing.T) {
+	client := fakeKindClient{
+		"test": []nodes.Node{
+			&fakeNode{name: "test-worker", ipv4: "192.168.8.3", ipv6: "fc00:f853:ccd:e793::3"},
+		},
+	}
+	c := &cloud{clusterName: "test", kindClient: client}
+
+	m, err := c.InstanceMetadata(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-worker"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.ProviderID != "kind://test/test-worker" {
+		t.Fatalf("unexpected ProviderID %s", m.ProviderID)
+	}
+
+	// the lookups use the ProviderID, including the legacy format
+	for _, id := range []string{"kind://test/test-worker", "kind://test/kind/test-worker"} {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "renamed"}, Spec: v1.NodeSpec{ProviderID: id}}
+		exists, err := c.InstanceExists(context.Background(), node)
+		if err != nil || !exists {
+			t.Fatalf("expected node with ProviderID %s to exist, got %v : %v", id, exists, err)
+		}
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-worker"}, Spec: v1.NodeSpec{ProviderID: "kind://other/test-worker"}}
+	exists, err := c.InstanceExists(context.Background(), node)
+	if err != nil || exists {
+		t.Fatalf("expected node of other cluster to not exist, got %v : %v", exists, err)
+	}
+}
+
+// TestInstancesV2Supported guards that the node controllers use InstancesV2,
+// they fall back to the deprecated Instances interface if it is not supported.
+func TestInstancesV2Supported(t *testing.T) {
+	c := &cloud{clusterName: "test", kindClient: fakeKindClient{}}
+	if i, ok := c.InstancesV2(); !ok || i == nil {
+		t.Errorf("expected InstancesV2 to be supported")
+	}
+	if _, ok := c.Instances(); ok {
+		t.Errorf("expected Instances to not be supported")
+	}
+	if _, ok := c.Zones(); ok {
+		t.Errorf("expected Zones to not be supported, the zones are reported by InstanceMetadata")
+	}
+}
+
+func TestInstanceShutdown(t *testing.T) {
+	client := fakeKindClient{
+		"test": []nodes.Node{
+			&fakeNode{name: "test-worker", ipv4: "192.168.8.3"},
+		},
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-worker"}}
+	tests := []struct {
+		status       string
+		wantShutdown bool
+	}{
+		{status: "running"},
+		{status: "restarting"},
+		{status: "exited", wantShutdown: true},
+		{status: "paused", wantShutdown: true},
+		{status: "created", wantShutdown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			c := &cloud{clusterName: "test", kindClient: client, containerState: fakeContainerState(tt.status)}
+			shutdown, err := c.InstanceShutdown(context.Background(), node)
+			if err != nil || shutdown != tt.wantShutdown {
+				t.Fatalf("InstanceShutdown() = %v, %v, want %v", shutdown, err, tt.wantShutdown)
+			}
+			// the stopped containers still exist so the Node is not deleted
+			exists, err := c.InstanceExists(context.Background(), node)
+			if err != nil || !exists {
+				t.Fatalf("InstanceExists() = %v, %v, want true", exists, err)
+			}
+		})
+	}
+}
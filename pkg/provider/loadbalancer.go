@@ -2,10 +2,22 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/ipam"
+	"sigs.k8s.io/cloud-provider-kind/pkg/loadbalancer"
+	"sigs.k8s.io/cloud-provider-kind/pkg/metrics"
 )
 
 var _ cloudprovider.LoadBalancer = &cloud{}
@@ -13,32 +25,220 @@ var _ cloudprovider.LoadBalancer = &cloud{}
 // GetLoadBalancer returns whether the specified load balancer exists, and if so, what its status is.
 // Parameter 'clusterName' is the name of the cluster as presented to kube-controller-manager
 func (c *cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
-	klog.V(2).Infof("Get LoadBalancer cluster: %s service: %s", clusterName, service.Name)
+	klog.V(2).InfoS("Get LoadBalancer", "cluster", clusterName, "service", klog.KObj(service))
 	return c.lbController.GetLoadBalancer(ctx, clusterName, service)
 }
 
 // GetLoadBalancerName returns the name of the load balancer.
 func (c *cloud) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
-	klog.V(2).Infof("Get LoadBalancerNmae cluster: %s service: %s", clusterName, service.Name)
+	klog.V(2).InfoS("Get LoadBalancerName", "cluster", clusterName, "service", klog.KObj(service))
 	return c.lbController.GetLoadBalancerName(ctx, clusterName, service)
 }
 
 // EnsureLoadBalancer creates a new load balancer 'name', or updates the existing one. Returns the status of the balancer
 func (c *cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	klog.V(2).Infof("Ensure LoadBalancer cluster: %s service: %s", clusterName, service.Name)
-	return c.lbController.EnsureLoadBalancer(ctx, clusterName, service, nodes)
+	klog.V(2).InfoS("Ensure LoadBalancer", "cluster", clusterName, "service", klog.KObj(service))
+	defer c.serviceLocks.lock(service)()
+	c.recordUnsupportedFeatures(service)
+	start := time.Now()
+	status, err := c.lbController.EnsureLoadBalancer(ctx, clusterName, service, nodes)
+	defer c.updateContainersMetric(ctx)
+	// the service controller only checks for the error itself, it must not be wrapped
+	if err == cloudprovider.ImplementedElsewhere {
+		return nil, err
+	}
+	c.setReadyCondition(ctx, service, readyCondition(status, err))
+	if err != nil {
+		metrics.LoadBalancerReconcileErrors.WithLabelValues(c.clusterName, metrics.ReasonEnsure).Inc()
+		if errors.Is(err, ipam.ErrExhausted) {
+			c.recordEvent(service, v1.EventTypeWarning, "LoadBalancerIPPoolExhausted",
+				"There are no free addresses to allocate the load balancer: %v", err)
+		}
+		if errors.Is(err, ipam.ErrInUse) || errors.Is(err, ipam.ErrOutOfRange) {
+			c.recordEvent(service, v1.EventTypeWarning, "LoadBalancerIPUnavailable",
+				"The requested load balancer IP can not be assigned: %v", err)
+		}
+		if errors.Is(err, ipam.ErrPortInUse) {
+			c.recordEvent(service, v1.EventTypeWarning, "LoadBalancerPortConflict",
+				"The load balancer IP and port are already used by other Service: %v", err)
+		}
+		// the service controller records the error in the Service Events
+		return nil, fmt.Errorf("load balancer container %s: %w", c.lbController.GetLoadBalancerName(ctx, clusterName, service), err)
+	}
+	metrics.LoadBalancerProvisionDuration.WithLabelValues(c.clusterName).Observe(time.Since(start).Seconds())
+	c.setAssignedIPAnnotation(ctx, service, assignedIPs(status))
+	// the service controller reports the status
+	c.setWithdrawn(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, false)
+	return status, nil
 }
 
 // UpdateLoadBalancer updates hosts under the specified load balancer.
 func (c *cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
-	klog.V(2).Infof("Update LoadBalancer cluster: %s service: %s", clusterName, service.Name)
-	return c.lbController.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+	klog.V(2).InfoS("Update LoadBalancer", "cluster", clusterName, "service", klog.KObj(service))
+	defer c.serviceLocks.lock(service)()
+	err := c.lbController.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+	if err != nil {
+		metrics.LoadBalancerReconcileErrors.WithLabelValues(c.clusterName, metrics.ReasonUpdate).Inc()
+		return fmt.Errorf("load balancer container %s: %w", c.lbController.GetLoadBalancerName(ctx, clusterName, service), err)
+	}
+	return nil
 }
 
 // EnsureLoadBalancerDeleted deletes the specified load balancer if it
 // exists, returning nil if the load balancer specified either didn't exist or
 // was successfully deleted.
 func (c *cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
-	klog.V(2).Infof("Ensure LoadBalancer deleted cluster: %s service: %s", clusterName, service.Name)
-	return c.lbController.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+	klog.V(2).InfoS("Ensure LoadBalancer deleted", "cluster", clusterName, "service", klog.KObj(service))
+	defer c.serviceLocks.lock(service)()
+	defer c.updateContainersMetric(ctx)
+	err := c.lbController.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+	if err != nil {
+		metrics.LoadBalancerReconcileErrors.WithLabelValues(c.clusterName, metrics.ReasonDelete).Inc()
+		return err
+	}
+	c.setAssignedIPAnnotation(ctx, service, "")
+	c.setWithdrawn(types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, false)
+	return nil
+}
+
+// ResyncLoadBalancer updates the loadbalancer of the Service after its configuration changes,
+// per example the proxy config override ConfigMap, with the last nodes it was updated with.
+func (c *cloud) ResyncLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error {
+	lb, ok := c.lbController.(interface {
+		ResyncLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error
+	})
+	if !ok {
+		return nil
+	}
+	klog.V(2).InfoS("Resync LoadBalancer", "cluster", clusterName, "service", klog.KObj(service))
+	defer c.serviceLocks.lock(service)()
+	if err := lb.ResyncLoadBalancer(ctx, clusterName, service); err != nil {
+		metrics.LoadBalancerReconcileErrors.WithLabelValues(c.clusterName, metrics.ReasonUpdate).Inc()
+		return fmt.Errorf("load balancer container %s: %w", c.lbController.GetLoadBalancerName(ctx, clusterName, service), err)
+	}
+	return nil
+}
+
+// RepairLoadBalancer repairs the loadbalancer of the Service if it diverged from the Service
+// configuration, per example because its container was stopped or modified by hand. It waits
+// for the service controller operations on the Service, the loadbalancers deleted meanwhile
+// are not repaired.
+func (c *cloud) RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error {
+	lb, ok := c.lbController.(interface {
+		RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) ([]string, error)
+	})
+	if !ok {
+		return nil
+	}
+	defer c.serviceLocks.lock(service)()
+	repairs, err := lb.RepairLoadBalancer(ctx, clusterName, service)
+	for _, repair := range repairs {
+		klog.InfoS("Repaired LoadBalancer", "cluster", clusterName, "service", klog.KObj(service), "action", repair)
+		metrics.LoadBalancerRepairs.WithLabelValues(c.clusterName, repair).Inc()
+	}
+	if err != nil {
+		metrics.LoadBalancerReconcileErrors.WithLabelValues(c.clusterName, metrics.ReasonRepair).Inc()
+		return fmt.Errorf("load balancer container %s: %w", c.lbController.GetLoadBalancerName(ctx, clusterName, service), err)
+	}
+	return nil
+}
+
+// CleanupLoadBalancers removes the resources of the loadbalancers of the cluster that are not
+// loadbalancer containers, per example the addresses programmed on the nodes with direct routing.
+func (c *cloud) CleanupLoadBalancers(ctx context.Context, clusterName string) error {
+	lb, ok := c.lbController.(interface {
+		CleanupLoadBalancers(ctx context.Context, clusterName string) error
+	})
+	if !ok {
+		return nil
+	}
+	klog.V(2).InfoS("Cleanup LoadBalancers", "cluster", clusterName)
+	return lb.CleanupLoadBalancers(ctx, clusterName)
+}
+
+// LoadBalancerNodes returns the names of the nodes the loadbalancer of the Service sends traffic to.
+func (c *cloud) LoadBalancerNodes(clusterName string, service *v1.Service) []string {
+	lb, ok := c.lbController.(interface {
+		LoadBalancerNodes(clusterName string, service *v1.Service) []string
+	})
+	if !ok {
+		return nil
+	}
+	return lb.LoadBalancerNodes(clusterName, service)
+}
+
+// SetEndpointSliceLister sets the lister used by the loadbalancers of the Services that do
+// not allocate NodePorts to forward the traffic directly to the Pods.
+func (c *cloud) SetEndpointSliceLister(lister discoverylisters.EndpointSliceLister) {
+	lb, ok := c.lbController.(interface {
+		SetEndpointSliceLister(loadbalancer.EndpointSliceLister)
+	})
+	if !ok {
+		return
+	}
+	lb.SetEndpointSliceLister(func(namespace, service string) ([]*discoveryv1.EndpointSlice, error) {
+		selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service})
+		return lister.EndpointSlices(namespace).List(selector)
+	})
+}
+
+// updateContainersMetric sets the number of loadbalancer containers of the cluster
+func (c *cloud) updateContainersMetric(ctx context.Context) {
+	containers, err := loadbalancer.ListLoadBalancers(ctx, c.clusterName)
+	if err != nil {
+		klog.V(2).InfoS("Can not list containers", "cluster", c.clusterName, "err", err)
+		return
+	}
+	metrics.LoadBalancerContainers.WithLabelValues(c.clusterName).Set(float64(len(containers)))
+}
+
+// recordUnsupportedFeatures warns the users about the features requested by the Service that are
+// ignored, per example the ports that are not forwarded or the unknown annotations, so they do not
+// go unnoticed
+func (c *cloud) recordUnsupportedFeatures(service *v1.Service) {
+	for _, feature := range loadbalancer.UnsupportedFeatures(service) {
+		klog.InfoS("Unsupported LoadBalancer feature", "cluster", c.clusterName, "service", klog.KObj(service), "reason", feature.Reason, "message", feature.Message)
+		c.recordEvent(service, v1.EventTypeWarning, feature.Reason, "%s", feature.Message)
+	}
+}
+
+// serviceLocks serializes the operations on the loadbalancer of each Service, the workers of the
+// service controller and the loops that repair and resync the loadbalancers run them concurrently
+type serviceLocks struct {
+	mu    sync.Mutex
+	locks map[types.NamespacedName]*serviceLock
+}
+
+// serviceLock is the lock of a Service and the number of operations holding or waiting for it
+type serviceLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// lock waits until there are no other operations on the loadbalancer of the Service and
+// returns the function to release it
+func (l *serviceLocks) lock(service *v1.Service) (unlock func()) {
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[types.NamespacedName]*serviceLock{}
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &serviceLock{}
+		l.locks[key] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(l.locks, key)
+		}
+	}
 }
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/container"
+	"sigs.k8s.io/cloud-provider-kind/pkg/container/containertest"
+)
+
+// blockingRepairLoadBalancer blocks the repairs until release is closed
+type blockingRepairLoadBalancer struct {
+	cloudprovider.LoadBalancer
+	repairing chan struct{}
+	release   chan struct{}
+	deleted   chan struct{}
+}
+
+func (b *blockingRepairLoadBalancer) RepairLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) ([]string, error) {
+	close(b.repairing)
+	<-b.release
+	return nil, nil
+}
+
+func (b *blockingRepairLoadBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	close(b.deleted)
+	return nil
+}
+
+func TestCloud_RepairLoadBalancerSerialized(t *testing.T) {
+	t.Cleanup(container.Use(containertest.New(t, "")))
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	lb := &blockingRepairLoadBalancer{repairing: make(chan struct{}), release: make(chan struct{}), deleted: make(chan struct{})}
+	c := &cloud{clusterName: "kind", lbController: lb}
+
+	repaired := make(chan error, 1)
+	go func() { repaired <- c.RepairLoadBalancer(context.Background(), "kind", service) }()
+	<-lb.repairing
+	go func() {
+		if err := c.EnsureLoadBalancerDeleted(context.Background(), "kind", service); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+	// the deletion waits for the repair of the same Service
+	select {
+	case <-lb.deleted:
+		t.Fatalf("expected the deletion to wait for the repair in progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(lb.release)
+	if err := <-repaired; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case <-lb.deleted:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the deletion once the repair finished")
+	}
+
+	// other Services are not blocked
+	other := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"}}
+	unlock := c.serviceLocks.lock(service)
+	defer unlock()
+	done := make(chan struct{})
+	go func() {
+		c.serviceLocks.lock(other)()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the lock of other Service not to wait")
+	}
+}
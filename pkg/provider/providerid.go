@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+// providerIDPrefix is the scheme of the ProviderIDs of the KIND nodes
+const providerIDPrefix = constants.ProviderName + "://"
+
+// providerID returns the ProviderID of a KIND node: kind://<cluster-name>/<node-container-name>
+func providerID(clusterName string, nodeName string) string {
+	return providerIDPrefix + clusterName + "/" + nodeName
+}
+
+// parseProviderID returns the cluster and the node container names of a ProviderID,
+// the format kind://<cluster-name>/kind/<node-name> used by previous versions is also accepted.
+func parseProviderID(id string) (clusterName string, nodeName string, err error) {
+	if !strings.HasPrefix(id, providerIDPrefix) {
+		return "", "", fmt.Errorf("invalid ProviderID %q, expected prefix %s", id, providerIDPrefix)
+	}
+	parts := strings.Split(strings.TrimPrefix(id, providerIDPrefix), "/")
+	switch {
+	case len(parts) == 2:
+		clusterName, nodeName = parts[0], parts[1]
+	case len(parts) == 3 && parts[1] == "kind":
+		clusterName, nodeName = parts[0], parts[2]
+	default:
+		return "", "", fmt.Errorf("invalid ProviderID %q, expected format %s<cluster-name>/<node-name>", id, providerIDPrefix)
+	}
+	if clusterName == "" || nodeName == "" {
+		return "", "", fmt.Errorf("invalid ProviderID %q, cluster and node names can not be empty", id)
+	}
+	return clusterName, nodeName, nil
+}
@@ -0,0 +1,45 @@
+package provider
+
+import "testing"
+
+func Test_parseProviderID(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		wantCluster string
+		wantNode    string
+		wantErr     bool
+	}{
+		{name: "valid", id: "kind://test/test-worker", wantCluster: "test", wantNode: "test-worker"},
+		{name: "legacy format", id: "kind://test/kind/test-worker", wantCluster: "test", wantNode: "test-worker"},
+		{name: "empty", id: "", wantErr: true},
+		{name: "other provider", id: "gce://test/test-worker", wantErr: true},
+		{name: "missing node", id: "kind://test", wantErr: true},
+		{name: "empty node", id: "kind://test/", wantErr: true},
+		{name: "empty cluster", id: "kind:///test-worker", wantErr: true},
+		{name: "too many segments", id: "kind://test/a/b", wantErr: true},
+		{name: "too many segments legacy", id: "kind://test/kind/a/b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, node, err := parseProviderID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProviderID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cluster != tt.wantCluster || node != tt.wantNode {
+				t.Errorf("parseProviderID() = %s, %s, want %s, %s", cluster, node, tt.wantCluster, tt.wantNode)
+			}
+		})
+	}
+}
+
+func Test_providerID(t *testing.T) {
+	id := providerID("test", "test-worker")
+	if id != "kind://test/test-worker" {
+		t.Fatalf("unexpected ProviderID %s", id)
+	}
+	cluster, node, err := parseProviderID(id)
+	if err != nil || cluster != "test" || node != "test-worker" {
+		t.Fatalf("parseProviderID(%s) = %s, %s, %v", id, cluster, node, err)
+	}
+}
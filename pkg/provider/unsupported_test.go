@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/cloud-provider-kind/pkg/constants"
+)
+
+func TestCloud_recordUnsupportedFeatures(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	c := &cloud{clusterName: "test", eventRecorder: recorder}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{
+			constants.AnnotationPrefix + "idle-timout": "1m",
+		}},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Port: 80, Protocol: v1.ProtocolTCP}}},
+	}
+	c.recordUnsupportedFeatures(service)
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning UnsupportedAnnotation") || !strings.Contains(event, "idle-timout") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Fatal("expected a warning event for the unknown annotation")
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected one event, got %d more", len(recorder.Events))
+	}
+}